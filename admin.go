@@ -20,9 +20,11 @@ import (
 	"net/http"
 	"os"
 	"reflect"
+	"strconv"
 	"text/template"
 	"time"
 
+	"github.com/goasana/asana/cache"
 	"github.com/goasana/asana/grace"
 	"github.com/goasana/asana/logs"
 	"github.com/goasana/asana/toolbox"
@@ -60,6 +62,8 @@ func init() {
 	asanaAdminApp.Route("/prof", profIndex)
 	asanaAdminApp.Route("/healthcheck", healthcheck)
 	asanaAdminApp.Route("/task", taskStatus)
+	asanaAdminApp.Route("/cache", cacheStats)
+	asanaAdminApp.Route("/metrics", metrics)
 	asanaAdminApp.Route("/listconf", listConf)
 	FilterMonitorFunc = func(string, string, time.Duration, string, int) bool { return true }
 }
@@ -368,6 +372,55 @@ func taskStatus(rw http.ResponseWriter, req *http.Request) {
 	execTpl(rw, data, tasksTpl, defaultScriptsTpl)
 }
 
+// CacheStats is a http.Handler showing the stats of the instrumented caches.
+// it's in "/cache" pattern in admin module.
+func cacheStats(rw http.ResponseWriter, _ *http.Request) {
+	data := make(map[interface{}]interface{})
+	resultList := new([][]string)
+	size := func(n int64) string {
+		if n < 0 {
+			return "-"
+		}
+		return strconv.FormatInt(n, 10)
+	}
+	for _, s := range cache.AllStats() {
+		get, put := s.Op("get"), s.Op("put")
+		*resultList = append(*resultList, []string{
+			template.HTMLEscapeString(s.Name),
+			strconv.FormatInt(s.Hits, 10),
+			strconv.FormatInt(s.Misses, 10),
+			fmt.Sprintf("%.2f%%", s.HitRatio()*100),
+			strconv.FormatInt(s.Errors, 10),
+			get.Avg().String(),
+			get.Max.String(),
+			put.Avg().String(),
+			put.Max.String(),
+			strconv.FormatInt(s.ReadBytes, 10),
+			strconv.FormatInt(s.WrittenBytes, 10),
+			size(s.Entries),
+			size(s.Bytes),
+		})
+	}
+
+	data["Content"] = M{
+		"Fields": []string{
+			"Name", "Hits", "Misses", "Hit Ratio", "Errors",
+			"Get Avg", "Get Max", "Put Avg", "Put Max",
+			"Read Bytes", "Written Bytes", "Entries", "Size",
+		},
+		"data": resultList,
+	}
+	data["Title"] = "Caches"
+	execTpl(rw, data, cacheStatsTpl, defaultScriptsTpl)
+}
+
+// Metrics writes the stats of the instrumented caches in the prometheus text format.
+// it's in "/metrics" pattern in admin module.
+func metrics(rw http.ResponseWriter, _ *http.Request) {
+	rw.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	_ = cache.WriteMetrics(rw)
+}
+
 func execTpl(rw http.ResponseWriter, data map[interface{}]interface{}, tpls ...string) {
 	tmpl := template.Must(template.New("dashboard").Parse(dashboardTpl))
 	for _, tpl := range tpls {
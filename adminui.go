@@ -237,6 +237,36 @@ var healthCheckTpl = `
 </table>
 {{end}}`
 
+var cacheStatsTpl = `{{define "content"}}
+
+<h1>{{.Title}}</h1>
+<table class="table table-striped table-hover ">
+<thead>
+<tr>
+{{range .Content.Fields}}
+<th>
+{{.}}
+</th>
+{{end}}
+</tr>
+</thead>
+
+<tbody>
+{{range $i, $slice := .Content.data}}
+<tr>
+	{{range $slice}}
+	<td>
+	{{.}}
+	</td>
+	{{end}}
+</tr>
+{{end}}
+</tbody>
+</table>
+<p><a href="/metrics">Metrics</a></p>
+
+{{end}}`
+
 // The base dashboardTpl
 var dashboardTpl = `
 <!DOCTYPE html>
@@ -322,6 +352,12 @@ Healthcheck
 <a href="/task" class="dropdown-toggle disabled" data-toggle="dropdown">Tasks</a>
 </li>
 
+<li>
+<a href="/cache">
+Caches
+</a>
+</li>
+
 <li class="dropdown">
 <a href="#" class="dropdown-toggle disabled" data-toggle="dropdown">Config Status<span class="caret"></span></a>
 <ul class="dropdown-menu" role="menu">
@@ -0,0 +1,48 @@
+// Copyright 2019 asana Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+// PutEach put the items to c one by one, it stops at the first error.
+// it is the PutMulti of the adapters without a batch operation.
+func PutEach(ctx context.Context, c ContextCache, items map[string]interface{}, timeout time.Duration) error {
+	for key, val := range items {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := c.Put(ctx, key, val, timeout); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteEach delete the keys from c one by one, ErrCacheMiss is ignored and it stops at the first other error.
+// it is the DeleteMulti of the adapters without a batch operation.
+func DeleteEach(ctx context.Context, c ContextCache, keys []string) error {
+	for _, key := range keys {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := c.Delete(ctx, key); err != nil && err != ErrCacheMiss {
+			return err
+		}
+	}
+	return nil
+}
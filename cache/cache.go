@@ -28,14 +28,31 @@
 //	bm.IsExist("asana")
 //	bm.Delete("asana")
 //
+// Or with the ContextCache interface, which reports the misses and the errors of the adapters:
+//
+//	cc, err := cache.NewContextCache(cache.RedisProvider, `{"conn":"127.0.0.1:6379"}`)
+//	v, err := cc.Get(ctx, "asana")
+//	if err == cache.ErrCacheMiss {
+//		...
+//	}
+//
 //  more docs http://asana.me/docs/module/cache.md
 package cache
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"time"
 )
 
+var (
+	// ErrCacheMiss is returned by ContextCache when the key is not cached or expired.
+	ErrCacheMiss = errors.New("cache: miss")
+	// ErrNotSupported is returned by ContextCache when the adapter cannot do the operation.
+	ErrNotSupported = errors.New("cache: operation not supported by the adapter")
+)
+
 // Cache interface contains all behaviors for cache adapter.
 // usage:
 //	cache.Register("file",cache.NewFileCache) // this operation is run in init method of file.go.
@@ -53,8 +70,12 @@ type Cache interface {
 	GetMulti(keys []string) []interface{}
 	// set cached value with key and expire time.
 	Put(key string, val interface{}, timeout time.Duration) error
+	// PutMulti is a batch version of Put, all the items have the same expire time.
+	PutMulti(items map[string]interface{}, timeout time.Duration) error
 	// delete cached value by key.
 	Delete(key string) error
+	// DeleteMulti is a batch version of Delete, the keys not cached are ignored.
+	DeleteMulti(keys []string) error
 	// increase cached int value by key, as a counter.
 	Incr(key string) error
 	// decrease cached int value by key, as a counter.
@@ -67,6 +88,44 @@ type Cache interface {
 	StartAndGC(config string) error
 }
 
+// ContextCache interface contains all behaviors for cache adapter, with a context and an error for each operation.
+// a miss is reported as ErrCacheMiss, so it is not mistaken for a stored nil or a failure of the backend.
+// usage:
+//	c, err := cache.NewContextCache(cache.MemoryProvider, `{"interval":60}`)
+//	err = c.Put(ctx, "key", value, 3600 * time.Second)
+//	v, err := c.Get(ctx, "key")
+//
+//	n, err := c.IncrBy(ctx, "counter", 2)  // now is 2
+//	n, err = c.DecrBy(ctx, "counter", 1)   // now is 1
+type ContextCache interface {
+	// get cached value by key, ErrCacheMiss if it is not cached.
+	Get(ctx context.Context, key string) (interface{}, error)
+	// GetMulti is a batch version of Get, errs[i] is the error of keys[i].
+	GetMulti(ctx context.Context, keys []string) (values []interface{}, errs []error)
+	// set cached value with key and expire time, 0 means no expiration.
+	Put(ctx context.Context, key string, val interface{}, timeout time.Duration) error
+	// PutMulti is a batch version of Put, all the items have the same expire time.
+	PutMulti(ctx context.Context, items map[string]interface{}, timeout time.Duration) error
+	// delete cached value by key.
+	Delete(ctx context.Context, key string) error
+	// DeleteMulti is a batch version of Delete, the keys not cached are ignored.
+	DeleteMulti(ctx context.Context, keys []string) error
+	// increase cached int value by key and return the new value, a missing key counts from 0.
+	IncrBy(ctx context.Context, key string, n int64) (int64, error)
+	// decrease cached int value by key and return the new value, a missing key counts from 0.
+	DecrBy(ctx context.Context, key string, n int64) (int64, error)
+	// check if cached value exists or not.
+	IsExist(ctx context.Context, key string) (bool, error)
+	// reset the expire time of the cached value, 0 means no expiration.
+	Touch(ctx context.Context, key string, timeout time.Duration) error
+	// get the remaining time to live of the cached value, 0 means no expiration.
+	TTL(ctx context.Context, key string) (time.Duration, error)
+	// clear all cache.
+	ClearAll(ctx context.Context) error
+	// start gc routine based on config string settings.
+	StartAndGC(config string) error
+}
+
 // Provider type
 type Provider string
 
@@ -83,34 +142,86 @@ const (
 // Instance is a function create a new Cache Instance
 type Instance func() Cache
 
-var adapters = make(map[Provider]Instance)
+// ContextInstance is a function create a new ContextCache Instance
+type ContextInstance func() ContextCache
 
-// Register makes a cache adapter available by the adapter name.
-// If Register is called twice with the same name or if driver is nil,
-// it panics.
-func Register(provider Provider, adapter Instance) {
-	if adapter == nil {
+var (
+	adapters        = make(map[Provider]Instance)
+	contextAdapters = make(map[Provider]ContextInstance)
+)
+
+// check the provider is not registered yet
+func checkRegister(provider Provider, isNil bool) {
+	if isNil {
 		panic("cache: Register adapter is nil")
 	}
-	if _, ok := adapters[provider]; ok {
+	_, ok := adapters[provider]
+	_, ctxOk := contextAdapters[provider]
+	if ok || ctxOk {
 		panic("cache: Register called twice for adapter " + provider)
 	}
+}
+
+// Register makes a cache adapter available by the adapter name.
+// If Register is called twice with the same name or if driver is nil,
+// it panics.
+func Register(provider Provider, adapter Instance) {
+	checkRegister(provider, adapter == nil)
 	adapters[provider] = adapter
 }
 
+// RegisterContext makes a ContextCache adapter available by the adapter name,
+// the adapter is also available to NewCache through ToCache.
+// If RegisterContext is called twice with the same name or if driver is nil,
+// it panics.
+func RegisterContext(provider Provider, adapter ContextInstance) {
+	checkRegister(provider, adapter == nil)
+	contextAdapters[provider] = adapter
+}
+
 // NewCache Create a new cache driver by adapter name and config string.
-// config need to be correct JSON as string: {"interval":360}.
+// config need to be correct JSON as string: {"interval":360},
+// the "codec" key sets the Codec of the values, {"interval":360,"codec":"json"}.
 // it will start gc automatically.
 func NewCache(provider Provider, config string) (adapter Cache, err error) {
-	instanceFunc, ok := adapters[provider]
-	if !ok {
+	if instanceFunc, ok := adapters[provider]; ok {
+		adapter = instanceFunc()
+	} else if contextFunc, ok := contextAdapters[provider]; ok {
+		adapter = ToCache(contextFunc())
+	} else {
 		err = fmt.Errorf("cache: unknown adapter name %q (forgot to import?)", provider)
 		return
 	}
-	adapter = instanceFunc()
 	err = adapter.StartAndGC(config)
 	if err != nil {
 		adapter = nil
+		return
+	}
+	cc, err := withConfigCodec(ToContextCache(adapter), config)
+	if err != nil {
+		return nil, err
+	}
+	return ToCache(cc), nil
+}
+
+// NewContextCache Create a new ContextCache driver by adapter name and config string.
+// the adapters registered by Register are used through ToContextCache.
+// config need to be correct JSON as string: {"interval":360},
+// the "codec" key sets the Codec of the values, {"interval":360,"codec":"json"}.
+// it will start gc automatically.
+func NewContextCache(provider Provider, config string) (adapter ContextCache, err error) {
+	if contextFunc, ok := contextAdapters[provider]; ok {
+		adapter = contextFunc()
+	} else if instanceFunc, ok := adapters[provider]; ok {
+		adapter = ToContextCache(instanceFunc())
+	} else {
+		err = fmt.Errorf("cache: unknown adapter name %q (forgot to import?)", provider)
+		return
+	}
+	err = adapter.StartAndGC(config)
+	if err != nil {
+		adapter = nil
+		return
 	}
-	return
+	return withConfigCodec(adapter, config)
 }
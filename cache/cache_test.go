@@ -15,8 +15,12 @@
 package cache
 
 import (
+	"context"
 	"os"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -326,3 +330,545 @@ func TestFileCache(t *testing.T) {
 
 	_ = os.RemoveAll("cache")
 }
+
+func TestContextCache(t *testing.T) {
+	ctx := context.Background()
+	configs := map[Provider]string{
+		MemoryProvider: `{"interval":20}`,
+		GCacheProvider: `{"size":20,"type":"lru"}`,
+		FileProvider:   `{"CachePath":"cache_ctx"}`,
+	}
+	for provider, config := range configs {
+		bm, err := NewContextCache(provider, config)
+		if err != nil {
+			t.Fatal(provider, "init err", err)
+		}
+
+		if _, err = bm.Get(ctx, "asana"); err != ErrCacheMiss {
+			t.Error(provider, "miss err", err)
+		}
+		if err = bm.Put(ctx, "asana", nil, time.Minute); err != nil {
+			t.Error(provider, "set Error", err)
+		}
+		if v, err := bm.Get(ctx, "asana"); err != nil || v != nil {
+			t.Error(provider, "get nil err", v, err)
+		}
+
+		if n, err := bm.IncrBy(ctx, "counter", 5); err != nil || n != 5 {
+			t.Error(provider, "IncrBy err", n, err)
+		}
+		if n, err := bm.DecrBy(ctx, "counter", 2); err != nil || n != 3 {
+			t.Error(provider, "DecrBy err", n, err)
+		}
+
+		if ttl, err := bm.TTL(ctx, "counter"); err != nil || ttl != 0 {
+			t.Error(provider, "TTL err", ttl, err)
+		}
+		if err = bm.Touch(ctx, "counter", time.Minute); err != nil {
+			t.Error(provider, "Touch err", err)
+		}
+		if ttl, err := bm.TTL(ctx, "counter"); err != nil || ttl <= 50*time.Second || ttl > time.Minute {
+			t.Error(provider, "TTL err", ttl, err)
+		}
+		if err = bm.Touch(ctx, "missing", time.Minute); err != ErrCacheMiss {
+			t.Error(provider, "Touch miss err", err)
+		}
+
+		_, errs := bm.GetMulti(ctx, []string{"counter", "missing"})
+		if len(errs) != 2 || errs[0] != nil || errs[1] != ErrCacheMiss {
+			t.Error(provider, "GetMulti err", errs)
+		}
+
+		old := ToCache(bm)
+		if old.Get("missing") != nil || GetInt64(old.Get("counter")) != 3 {
+			t.Error(provider, "shim err")
+		}
+		if ToContextCache(old) != bm {
+			t.Error(provider, "shim unwrap err")
+		}
+
+		if err = bm.ClearAll(ctx); err != nil {
+			t.Error(provider, "ClearAll err", err)
+		}
+		if ok, err := bm.IsExist(ctx, "counter"); err != nil || ok {
+			t.Error(provider, "ClearAll err", ok, err)
+		}
+	}
+	_ = os.RemoveAll("cache_ctx")
+}
+
+type codecItem struct {
+	Name  string
+	Count int
+	Tags  []string
+}
+
+func TestCodec(t *testing.T) {
+	ctx := context.Background()
+	item := codecItem{Name: "asana", Count: 3, Tags: []string{"a", "b"}}
+	configs := []string{
+		`{"interval":20}`,
+		`{"interval":20,"codec":"json"}`,
+		`{"interval":20,"codec":"msgpack"}`,
+		`{"interval":20,"codec":"gob"}`,
+	}
+	for _, config := range configs {
+		bm, err := NewContextCache(MemoryProvider, config)
+		if err != nil {
+			t.Fatal(config, "init err", err)
+		}
+		if err = bm.Put(ctx, "item", item, time.Minute); err != nil {
+			t.Error(config, "set Error", err)
+		}
+		var got codecItem
+		if err = GetInto(ctx, bm, "item", &got); err != nil || got.Name != item.Name || got.Count != item.Count || len(got.Tags) != 2 {
+			t.Error(config, "GetInto err", got, err)
+		}
+		if err = GetInto(ctx, bm, "missing", &got); err != ErrCacheMiss {
+			t.Error(config, "GetInto miss err", err)
+		}
+	}
+
+	fc, err := NewContextCache(FileProvider, `{"CachePath":"cache_codec","codec":"json"}`)
+	if err != nil {
+		t.Fatal("init err", err)
+	}
+	defer os.RemoveAll("cache_codec")
+	if err = fc.Put(ctx, "item", item, time.Minute); err != nil {
+		t.Error("set Error", err)
+	}
+	var got codecItem
+	if err = GetInto(ctx, fc, "item", &got); err != nil || got.Name != item.Name {
+		t.Error("GetInto err", got, err)
+	}
+
+	// the text values of the adapters without codec
+	bm, _ := NewContextCache(MemoryProvider, `{"interval":20}`)
+	_ = bm.Put(ctx, "text", []byte("42"), 0)
+	var n int
+	if err = GetInto(ctx, bm, "text", &n); err != nil || n != 42 {
+		t.Error("GetInto text err", n, err)
+	}
+	if err = GetInto(ctx, bm, "text", &got); err == nil {
+		t.Error("GetInto text into struct should fail")
+	}
+
+	if _, err = NewCache(MemoryProvider, `{"codec":"unknown"}`); err == nil {
+		t.Error("unknown codec should fail")
+	}
+}
+
+func TestGetOrLoad(t *testing.T) {
+	ctx := context.Background()
+	bm, err := NewContextCache(MemoryProvider, `{"interval":20}`)
+	if err != nil {
+		t.Fatal("init err", err)
+	}
+
+	var calls int32
+	loader := func(ctx context.Context, key string) (interface{}, error) {
+		n := atomic.AddInt32(&calls, 1)
+		time.Sleep(50 * time.Millisecond)
+		return int(n), nil
+	}
+
+	wg := sync.WaitGroup{}
+	wg.Add(10)
+	for i := 0; i < 10; i++ {
+		go func() {
+			defer wg.Done()
+			if v, err := GetOrLoad(ctx, bm, "asana", time.Minute, loader); err != nil || v.(int) != 1 {
+				t.Error("GetOrLoad err", v, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if calls != 1 {
+		t.Error("loader calls", calls)
+	}
+
+	// stale while revalidate
+	calls = 0
+	if _, err = GetOrLoad(ctx, bm, "stale", 100*time.Millisecond, loader, WithStale(time.Minute)); err != nil {
+		t.Error("GetOrLoad err", err)
+	}
+	time.Sleep(150 * time.Millisecond)
+	if v, err := GetOrLoad(ctx, bm, "stale", 100*time.Millisecond, loader, WithStale(time.Minute)); err != nil || v.(int) != 1 {
+		t.Error("stale value err", v, err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if v, _ := bm.Get(ctx, "stale"); v.(int) != 2 {
+		t.Error("refreshed value err", v)
+	}
+
+	for i := 0; i < 100; i++ {
+		if d := jitter(time.Minute, 0.1); d < 54*time.Second || d > 66*time.Second {
+			t.Error("jitter err", d)
+		}
+	}
+}
+
+func TestGetOrLoadPanic(t *testing.T) {
+	ctx := context.Background()
+	bm, _ := NewContextCache(MemoryProvider, `{"interval":20}`)
+	_, err := GetOrLoad(ctx, bm, "asana", time.Minute, func(ctx context.Context, key string) (interface{}, error) {
+		panic("boom")
+	})
+	if err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Error("panic err", err)
+	}
+
+	// the key is not blocked by the panic
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if v, err := GetOrLoad(ctx, bm, "asana", time.Minute, func(ctx context.Context, key string) (interface{}, error) {
+			return "loaded", nil
+		}); err != nil || v != "loaded" {
+			t.Error("GetOrLoad after panic err", v, err)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("GetOrLoad blocked after a panic")
+	}
+}
+
+func TestGetOrLoadCodec(t *testing.T) {
+	ctx := context.Background()
+	bm, _ := NewContextCache(MemoryProvider, `{"interval":20,"codec":"json"}`)
+	loader := func(ctx context.Context, key string) (interface{}, error) {
+		return map[string]int{"a": 1}, nil
+	}
+
+	// the miss and the hit return the encoded value
+	miss, err := GetOrLoad(ctx, bm, "asana", time.Minute, loader)
+	if err != nil {
+		t.Fatal("GetOrLoad err", err)
+	}
+	hit, err := GetOrLoad(ctx, bm, "asana", time.Minute, loader)
+	if err != nil {
+		t.Fatal("GetOrLoad err", err)
+	}
+	if _, ok := miss.([]byte); !ok || string(miss.([]byte)) != string(hit.([]byte)) {
+		t.Errorf("miss %T %v, hit %T %v", miss, miss, hit, hit)
+	}
+
+	var m map[string]int
+	if err = GetOrLoadInto(ctx, bm, "into", time.Minute, &m, loader); err != nil || m["a"] != 1 {
+		t.Error("GetOrLoadInto miss err", m, err)
+	}
+	m = nil
+	if err = GetOrLoadInto(ctx, bm, "into", time.Minute, &m, loader); err != nil || m["a"] != 1 {
+		t.Error("GetOrLoadInto hit err", m, err)
+	}
+}
+
+// locker whose locks are always held by another process
+type heldLocker struct{}
+
+func (heldLocker) TryLock(ctx context.Context, key string, ttl time.Duration) (string, bool, error) {
+	return "", false, nil
+}
+
+func (heldLocker) Unlock(ctx context.Context, key string, token string) error {
+	return nil
+}
+
+func TestGetOrLoadLocked(t *testing.T) {
+	ctx := context.Background()
+	bm, _ := NewContextCache(MemoryProvider, `{"interval":20}`)
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		_ = bm.Put(ctx, "asana", "other", time.Minute)
+	}()
+	loader := func(ctx context.Context, key string) (interface{}, error) {
+		return "self", nil
+	}
+	if v, err := GetOrLoad(ctx, bm, "asana", time.Minute, loader, WithLocker(heldLocker{}, time.Second)); err != nil || v != "other" {
+		t.Error("locked GetOrLoad err", v, err)
+	}
+	if v, err := GetOrLoad(ctx, bm, "timeout", time.Minute, loader, WithLocker(heldLocker{}, 100*time.Millisecond)); err != nil || v != "self" {
+		t.Error("lock timeout GetOrLoad err", v, err)
+	}
+}
+
+func TestTieredCache(t *testing.T) {
+	ctx := context.Background()
+	remote, _ := NewContextCache(MemoryProvider, `{"interval":20}`)
+	bus := NewMemoryBus()
+	node1, err := NewTieredCache(remote, bus, 10, time.Minute)
+	if err != nil {
+		t.Fatal("init err", err)
+	}
+	node2, _ := NewTieredCache(remote, bus, 10, time.Minute)
+	defer node1.Close()
+	defer node2.Close()
+
+	if err = node1.Put(ctx, "config", "v1", 0); err != nil {
+		t.Error("set Error", err)
+	}
+	for i := 0; i < 2; i++ {
+		if v, err := node2.Get(ctx, "config"); err != nil || v != "v1" {
+			t.Error("get err", v, err)
+		}
+	}
+	if s := node2.Stats(); s.LocalHits != 1 || s.LocalMisses != 1 || s.RemoteHits != 1 {
+		t.Error("stats err", s)
+	}
+
+	// the put of node1 drops the local copy of node2
+	_ = node1.Put(ctx, "config", "v2", 0)
+	if v, _ := node2.Get(ctx, "config"); v != "v2" {
+		t.Error("stale local value", v)
+	}
+
+	_ = node1.Delete(ctx, "config")
+	if _, err := node2.Get(ctx, "config"); err != ErrCacheMiss {
+		t.Error("delete err", err)
+	}
+	if s := node2.Stats(); s.RemoteMisses != 1 {
+		t.Error("stats err", s)
+	}
+
+	_ = node1.Put(ctx, "a", "a", 0)
+	_, _ = node2.GetMulti(ctx, []string{"a", "b"})
+	// a key named as the invalidation of ClearAll only drops its own copy
+	_ = node1.Put(ctx, "*", "star", 0)
+	hits := node2.Stats().LocalHits
+	if _, _ = node2.Get(ctx, "a"); node2.Stats().LocalHits != hits+1 {
+		t.Error("local copies dropped by the key *")
+	}
+	_ = node1.ClearAll(ctx)
+	if ok, _ := node2.IsExist(ctx, "a"); ok {
+		t.Error("ClearAll err")
+	}
+}
+
+func TestMemoryCacheEviction(t *testing.T) {
+	ctx := context.Background()
+	var evicted []string
+	for _, policy := range []string{EvictLRU, EvictLFU, EvictARC} {
+		cc, err := NewContextCache(MemoryProvider, `{"interval":20,"shards":1,"maxEntries":3,"policy":"`+policy+`"}`)
+		if err != nil {
+			t.Fatal(policy, "init err", err)
+		}
+		bm := Unwrap(cc).(*MemoryCache)
+		evicted = nil
+		bm.OnEvicted = func(key string, value interface{}) {
+			evicted = append(evicted, key)
+		}
+		_ = bm.Put(ctx, "a", 1, 0)
+		_ = bm.Put(ctx, "b", 2, 0)
+		_ = bm.Put(ctx, "c", 3, 0)
+		// a is used again, b is the least recently and the least frequently used
+		_, _ = bm.Get(ctx, "a")
+		_, _ = bm.Get(ctx, "c")
+		_ = bm.Put(ctx, "d", 4, 0)
+		if bm.Len() != 3 || len(evicted) != 1 || evicted[0] != "b" {
+			t.Error(policy, "eviction err", bm.Len(), evicted)
+		}
+		if ok, _ := bm.IsExist(ctx, "a"); !ok {
+			t.Error(policy, "a evicted")
+		}
+	}
+
+	// the limits apply to all the shards together, with fewer entries than shards
+	cc, _ := NewContextCache(MemoryProvider, `{"interval":20,"shards":16,"maxEntries":10}`)
+	bm := Unwrap(cc).(*MemoryCache)
+	evicted = nil
+	bm.OnEvicted = func(key string, value interface{}) {
+		evicted = append(evicted, key)
+	}
+	for i := 0; i < 10; i++ {
+		_ = bm.Put(ctx, strconv.Itoa(i), i, 0)
+	}
+	if bm.Len() != 10 || len(evicted) != 0 {
+		t.Error("entries limit err", bm.Len(), evicted)
+	}
+	for i := 10; i < 30; i++ {
+		_, _ = bm.IncrBy(ctx, strconv.Itoa(i), 1)
+	}
+	if bm.Len() != 10 || len(evicted) != 20 {
+		t.Error("entries limit err", bm.Len(), len(evicted))
+	}
+
+	if _, err := NewContextCache(MemoryProvider, `{"policy":"fifo"}`); err == nil {
+		t.Error("unknown policy should fail")
+	}
+
+	cc, _ = NewContextCache(MemoryProvider, `{"interval":20,"shards":4,"maxBytes":4096}`)
+	bm = Unwrap(cc).(*MemoryCache)
+	value := make([]byte, 100)
+	for i := 0; i < 100; i++ {
+		_ = bm.Put(ctx, strconv.Itoa(i), value, 0)
+	}
+	if bm.Bytes() > 4096 || bm.Len() == 0 || bm.Len() >= 100 {
+		t.Error("bytes limit err", bm.Bytes(), bm.Len())
+	}
+	_ = bm.ClearAll(ctx)
+	if bm.Bytes() != 0 || bm.Len() != 0 {
+		t.Error("ClearAll err", bm.Bytes(), bm.Len())
+	}
+}
+
+func TestTags(t *testing.T) {
+	ctx := context.Background()
+	configs := map[Provider]string{
+		MemoryProvider: `{"interval":20}`,
+		GCacheProvider: `{"size":20,"type":"lru"}`,
+		FileProvider:   `{"CachePath":"cache_tags"}`,
+	}
+	for provider, config := range configs {
+		bm, err := NewContextCache(provider, config)
+		if err != nil {
+			t.Fatal(provider, "init err", err)
+		}
+		if err = PutWithTags(ctx, bm, "user:1:profile", "p1", time.Minute, "user:1"); err != nil {
+			t.Error(provider, "PutWithTags err", err)
+		}
+		_ = PutWithTags(ctx, bm, "user:1:posts", "posts", 0, "user:1", "posts")
+		_ = PutWithTags(ctx, bm, "user:2:profile", "p2", 0, "user:2")
+		// put again without the tag, it is kept by the invalidation
+		_ = PutWithTags(ctx, bm, "user:1:profile", "p1", 0, "profiles")
+
+		if err = InvalidateTags(ctx, bm, "user:1"); err != nil {
+			t.Error(provider, "InvalidateTags err", err)
+		}
+		if ok, _ := bm.IsExist(ctx, "user:1:posts"); ok {
+			t.Error(provider, "tagged value not invalidated")
+		}
+		if ok, _ := bm.IsExist(ctx, "user:1:profile"); !ok {
+			t.Error(provider, "value put again invalidated")
+		}
+
+		if err = DeletePrefix(ctx, bm, "user:1:"); err != nil {
+			t.Error(provider, "DeletePrefix err", err)
+		}
+		if ok, _ := bm.IsExist(ctx, "user:1:profile"); ok {
+			t.Error(provider, "prefixed value not deleted")
+		}
+		if ok, _ := bm.IsExist(ctx, "user:2:profile"); !ok {
+			t.Error(provider, "other value deleted")
+		}
+		_ = bm.ClearAll(ctx)
+	}
+	_ = os.RemoveAll("cache_tags")
+
+	// the codec wrapper delegates to the adapter
+	bm, _ := NewContextCache(MemoryProvider, `{"interval":20,"codec":"json"}`)
+	_ = PutWithTags(ctx, bm, "item", codecItem{Name: "a"}, 0, "items")
+	_ = InvalidateTags(ctx, bm, "items")
+	if _, err := bm.Get(ctx, "item"); err != ErrCacheMiss {
+		t.Error("codec InvalidateTags err", err)
+	}
+
+	if err := InvalidateTags(ctx, &contextShim{}, "x"); err != ErrNotSupported {
+		t.Error("not supported err", err)
+	}
+}
+
+func TestMulti(t *testing.T) {
+	ctx := context.Background()
+	configs := map[Provider]string{
+		MemoryProvider: `{"interval":20}`,
+		GCacheProvider: `{"size":20,"type":"lru"}`,
+		FileProvider:   `{"CachePath":"cache_multi"}`,
+	}
+	for provider, config := range configs {
+		bm, err := NewContextCache(provider, config)
+		if err != nil {
+			t.Fatal(provider, "init err", err)
+		}
+		items := map[string]interface{}{"a": "1", "b": "2", "c": "3"}
+		if err = bm.PutMulti(ctx, items, time.Minute); err != nil {
+			t.Error(provider, "PutMulti err", err)
+		}
+		values, errs := bm.GetMulti(ctx, []string{"a", "b", "c"})
+		for i, v := range values {
+			if errs[i] != nil || GetString(v) != strconv.Itoa(i+1) {
+				t.Error(provider, "GetMulti err", v, errs[i])
+			}
+		}
+		if ttl, err := bm.TTL(ctx, "a"); err == nil && (ttl <= 0 || ttl > time.Minute) {
+			t.Error(provider, "PutMulti ttl", ttl)
+		}
+
+		// the missing keys are ignored
+		if err = bm.DeleteMulti(ctx, []string{"a", "c", "missing"}); err != nil {
+			t.Error(provider, "DeleteMulti err", err)
+		}
+		if ok, _ := bm.IsExist(ctx, "a"); ok {
+			t.Error(provider, "value not deleted")
+		}
+		if ok, _ := bm.IsExist(ctx, "b"); !ok {
+			t.Error(provider, "other value deleted")
+		}
+		_ = bm.ClearAll(ctx)
+	}
+	_ = os.RemoveAll("cache_multi")
+
+	// the codec wrapper encodes each value
+	bm, _ := NewContextCache(MemoryProvider, `{"interval":20,"codec":"json"}`)
+	_ = bm.PutMulti(ctx, map[string]interface{}{"item": codecItem{Name: "a"}}, 0)
+	var item codecItem
+	if err := GetInto(ctx, bm, "item", &item); err != nil || item.Name != "a" {
+		t.Error("codec PutMulti err", item, err)
+	}
+
+	// the old interface
+	c, _ := NewCache(MemoryProvider, `{"interval":20}`)
+	if err := c.PutMulti(map[string]interface{}{"x": 1, "y": 2}, 0); err != nil {
+		t.Error("Cache PutMulti err", err)
+	}
+	if err := c.DeleteMulti([]string{"x", "z"}); err != nil || c.IsExist("x") || !c.IsExist("y") {
+		t.Error("Cache DeleteMulti err", err)
+	}
+}
+
+func TestInstrumentedCache(t *testing.T) {
+	ctx := context.Background()
+	bm, err := NewCache(MemoryProvider, `{"interval":20}`)
+	if err != nil {
+		t.Fatal("init err", err)
+	}
+	bm = Instrument("test", bm)
+	_ = bm.Put("asana", "author", time.Minute)
+	_ = bm.Get("asana")
+	_ = bm.Get("missing")
+	_ = bm.GetMulti([]string{"asana", "missing"})
+
+	ic := ToContextCache(bm).(*InstrumentedCache)
+	defer ic.Unregister()
+	if _, err = ic.TTL(ctx, "asana"); err != nil {
+		t.Error("TTL err", err)
+	}
+	s := ic.Stats()
+	if s.Hits != 2 || s.Misses != 2 || s.Errors != 0 || s.HitRatio() != 0.5 {
+		t.Error("stats err", s)
+	}
+	if s.Entries != 1 || s.Bytes <= 0 || s.ReadBytes != 12 || s.WrittenBytes != 6 {
+		t.Error("sizes err", s)
+	}
+	// the sizes of the other values are not counted
+	if err = ic.Put(ctx, "struct", struct{ Name string }{"asana"}, time.Minute); err != nil || ic.Stats().WrittenBytes != 6 {
+		t.Error("struct size err", err, ic.Stats())
+	}
+	if get := s.Op("get"); get.Calls != 2 || get.Max <= 0 || get.Avg() > get.Max {
+		t.Error("latency err", get)
+	}
+
+	stats := AllStats()
+	if len(stats) != 1 || stats[0].Name != "test" {
+		t.Error("AllStats err", stats)
+	}
+	var buf strings.Builder
+	if err = WriteMetrics(&buf); err != nil {
+		t.Error("WriteMetrics err", err)
+	}
+	if !strings.Contains(buf.String(), `asana_cache_hits_total{cache="test"} 2`) ||
+		!strings.Contains(buf.String(), `asana_cache_operation_seconds_count{cache="test",op="get"} 2`) {
+		t.Error("metrics err", buf.String())
+	}
+}
@@ -0,0 +1,299 @@
+// Copyright 2019 asana Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/goasana/config/encoder/json"
+	"github.com/goasana/config/encoder/msgpack"
+	"github.com/goasana/config/encoder/proto"
+)
+
+// Codec serializes the values stored in a cache.
+// set it with the "codec" key of the config, {"conn":":6379","codec":"json"},
+// so the values round-trip the same way whatever the adapter is, read them with GetInto.
+type Codec interface {
+	Encode(v interface{}) ([]byte, error)
+	Decode(data []byte, v interface{}) error
+	String() string
+}
+
+// Codec Avails
+var (
+	JSONCodec    Codec = funcCodec{"json", func(v interface{}) ([]byte, error) { return json.Encode(v, false) }, json.Decode}
+	MsgpackCodec Codec = funcCodec{"msgpack", msgpack.Encode, msgpack.Decode}
+	ProtoCodec   Codec = funcCodec{"proto", proto.Encode, proto.Decode}
+	GobCodec     Codec = funcCodec{"gob", gobEncode, gobDecode}
+)
+
+var codecs = map[string]Codec{
+	JSONCodec.String():    JSONCodec,
+	MsgpackCodec.String(): MsgpackCodec,
+	ProtoCodec.String():   ProtoCodec,
+	GobCodec.String():     GobCodec,
+}
+
+// RegisterCodec makes a codec available by its name in the config of the caches.
+// If RegisterCodec is called twice with the same name or if codec is nil,
+// it panics.
+func RegisterCodec(codec Codec) {
+	if codec == nil {
+		panic("cache: RegisterCodec codec is nil")
+	}
+	if _, ok := codecs[codec.String()]; ok {
+		panic("cache: RegisterCodec called twice for codec " + codec.String())
+	}
+	codecs[codec.String()] = codec
+}
+
+// codec of encode and decode functions
+type funcCodec struct {
+	name   string
+	encode func(v interface{}) ([]byte, error)
+	decode func(data []byte, v interface{}) error
+}
+
+func (c funcCodec) Encode(v interface{}) ([]byte, error) {
+	return c.encode(v)
+}
+
+func (c funcCodec) Decode(data []byte, v interface{}) error {
+	return c.decode(data, v)
+}
+
+func (c funcCodec) String() string {
+	return c.name
+}
+
+func gobEncode(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func gobDecode(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// wrap adapter with the codec named in config
+func withConfigCodec(adapter ContextCache, config string) (ContextCache, error) {
+	var cf map[string]interface{}
+	_ = json.Decode([]byte(config), &cf)
+	name := GetString(cf["codec"])
+	if name == "" {
+		return adapter, nil
+	}
+	codec, ok := codecs[name]
+	if !ok {
+		return nil, fmt.Errorf("cache: unknown codec %q", name)
+	}
+	return NewCodecCache(adapter, codec), nil
+}
+
+// NewCodecCache wrap cc to store the values encoded by codec.
+// Get returns the encoded values as []byte, decode them with GetInto.
+// the counters of IncrBy and DecrBy are stored by the adapter as they are.
+func NewCodecCache(cc ContextCache, codec Codec) ContextCache {
+	return &codecCache{ContextCache: cc, codec: codec}
+}
+
+// ContextCache storing the values encoded by a codec
+type codecCache struct {
+	ContextCache
+	codec Codec
+}
+
+// Codec get the codec of the values
+func (c *codecCache) Codec() Codec {
+	return c.codec
+}
+
+// Unwrap get the wrapped cache
+func (c *codecCache) Unwrap() ContextCache {
+	return c.ContextCache
+}
+
+func (c *codecCache) Put(ctx context.Context, key string, val interface{}, timeout time.Duration) error {
+	data, err := c.codec.Encode(val)
+	if err != nil {
+		return err
+	}
+	return c.ContextCache.Put(ctx, key, data, timeout)
+}
+
+func (c *codecCache) PutMulti(ctx context.Context, items map[string]interface{}, timeout time.Duration) error {
+	encoded := make(map[string]interface{}, len(items))
+	for key, val := range items {
+		data, err := c.codec.Encode(val)
+		if err != nil {
+			return err
+		}
+		encoded[key] = data
+	}
+	return c.ContextCache.PutMulti(ctx, encoded, timeout)
+}
+
+func (c *codecCache) PutWithTags(ctx context.Context, key string, val interface{}, timeout time.Duration, tags ...string) error {
+	data, err := c.codec.Encode(val)
+	if err != nil {
+		return err
+	}
+	return PutWithTags(ctx, c.ContextCache, key, data, timeout, tags...)
+}
+
+func (c *codecCache) InvalidateTags(ctx context.Context, tags ...string) error {
+	return InvalidateTags(ctx, c.ContextCache, tags...)
+}
+
+func (c *codecCache) DeletePrefix(ctx context.Context, prefix string) error {
+	return DeletePrefix(ctx, c.ContextCache, prefix)
+}
+
+func (c *codecCache) Get(ctx context.Context, key string) (interface{}, error) {
+	v, err := c.ContextCache.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return toBytes(v)
+}
+
+func (c *codecCache) GetMulti(ctx context.Context, keys []string) ([]interface{}, []error) {
+	values, errs := c.ContextCache.GetMulti(ctx, keys)
+	for i, v := range values {
+		if errs[i] == nil {
+			values[i], errs[i] = toBytes(v)
+		}
+	}
+	return values, errs
+}
+
+// get the codec of c or of the caches it wraps, nil if there is none
+func codecOf(c ContextCache) Codec {
+	for {
+		if cc, ok := c.(interface{ Codec() Codec }); ok {
+			return cc.Codec()
+		}
+		w, ok := c.(interface{ Unwrap() ContextCache })
+		if !ok {
+			return nil
+		}
+		c = w.Unwrap()
+	}
+}
+
+// get the encoded value stored by an adapter
+func toBytes(v interface{}) ([]byte, error) {
+	switch data := v.(type) {
+	case []byte:
+		return data, nil
+	case string:
+		return []byte(data), nil
+	}
+	return nil, fmt.Errorf("cache: value of type %T is not encoded", v)
+}
+
+// GetInto get cached value by key and store it in the value pointed to by dst.
+// the values of a cache with a codec are decoded by the codec,
+// the other values are assigned when their type fits dst,
+// or converted when they are the strings or the bytes of the adapters storing the values as text.
+func GetInto(ctx context.Context, c ContextCache, key string, dst interface{}) error {
+	v, err := c.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	return decodeInto(c, v, dst)
+}
+
+// store the value v of c in the value pointed to by dst
+func decodeInto(c ContextCache, v interface{}, dst interface{}) error {
+	rv := reflect.ValueOf(dst)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return errors.New("cache: GetInto needs a non-nil pointer")
+	}
+	elem := rv.Elem()
+
+	if codec := codecOf(c); codec != nil {
+		data, err := toBytes(v)
+		if err != nil {
+			return err
+		}
+		return codec.Decode(data, dst)
+	}
+
+	if v == nil {
+		elem.Set(reflect.Zero(elem.Type()))
+		return nil
+	}
+	if val := reflect.ValueOf(v); val.Type().AssignableTo(elem.Type()) {
+		elem.Set(val)
+		return nil
+	}
+
+	data, err := toBytes(v)
+	if err != nil {
+		return fmt.Errorf("cache: cannot store %T into %T", v, dst)
+	}
+	return parseInto(data, elem)
+}
+
+// parse the text value of an adapter into elem
+func parseInto(data []byte, elem reflect.Value) error {
+	s := string(data)
+	switch elem.Kind() {
+	case reflect.String:
+		elem.SetString(s)
+		return nil
+	case reflect.Slice:
+		if elem.Type().Elem().Kind() == reflect.Uint8 {
+			elem.SetBytes(append([]byte(nil), data...))
+			return nil
+		}
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err == nil {
+			elem.SetBool(b)
+		}
+		return err
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, elem.Type().Bits())
+		if err == nil {
+			elem.SetInt(n)
+		}
+		return err
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, elem.Type().Bits())
+		if err == nil {
+			elem.SetUint(n)
+		}
+		return err
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, elem.Type().Bits())
+		if err == nil {
+			elem.SetFloat(f)
+		}
+		return err
+	}
+	return fmt.Errorf("cache: cannot store the text value into %s, set a codec in the config", elem.Type())
+}
@@ -15,6 +15,7 @@
 package cache
 
 import (
+	"errors"
 	"fmt"
 	"strconv"
 )
@@ -98,3 +99,43 @@ func GetBool(v interface{}) bool {
 	}
 	return false
 }
+
+// add n to the numeric value v keeping its type, it returns the new value and the new value as int64.
+func incrValue(v interface{}, n int64) (interface{}, int64, error) {
+	switch val := v.(type) {
+	case int:
+		return val + int(n), int64(val) + n, nil
+	case int8:
+		return val + int8(n), int64(val) + n, nil
+	case int16:
+		return val + int16(n), int64(val) + n, nil
+	case int32:
+		return val + int32(n), int64(val) + n, nil
+	case int64:
+		return val + n, val + n, nil
+	case uint:
+		return incrUint(uint64(val), n, func(u uint64) interface{} { return uint(u) })
+	case uint8:
+		return incrUint(uint64(val), n, func(u uint64) interface{} { return uint8(u) })
+	case uint16:
+		return incrUint(uint64(val), n, func(u uint64) interface{} { return uint16(u) })
+	case uint32:
+		return incrUint(uint64(val), n, func(u uint64) interface{} { return uint32(u) })
+	case uint64:
+		return incrUint(val, n, func(u uint64) interface{} { return u })
+	case float32:
+		return val + float32(n), int64(val) + n, nil
+	case float64:
+		return val + float64(n), int64(val) + n, nil
+	}
+	return nil, 0, errors.New("item val is not a number")
+}
+
+// add n to the unsigned value v, it fails when the new value is less than 0
+func incrUint(v uint64, n int64, conv func(uint64) interface{}) (interface{}, int64, error) {
+	if n < 0 && uint64(-n) > v {
+		return nil, 0, errors.New("item val is less than 0")
+	}
+	u := v + uint64(n)
+	return conv(u), int64(u), nil
+}
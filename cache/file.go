@@ -16,6 +16,7 @@ package cache
 
 import (
 	"bytes"
+	"context"
 	"crypto/md5"
 	"encoding/gob"
 	"encoding/hex"
@@ -24,8 +25,9 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
-	"reflect"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/goasana/config/encoder/json"
@@ -33,10 +35,27 @@ import (
 
 // FileCacheItem is basic unit of file cache adapter.
 // it contains data and expire time.
+// a zero expire time means the item never expires.
 type FileCacheItem struct {
 	Data       interface{}
 	LastAccess time.Time
 	Expired    time.Time
+	Key        string
+	Tags       []string
+}
+
+// check the item has tag
+func (item *FileCacheItem) hasTag(tag string) bool {
+	for _, t := range item.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+func (item *FileCacheItem) isExpire() bool {
+	return !item.Expired.IsZero() && item.Expired.Before(time.Now())
 }
 
 // FileCache Config
@@ -53,12 +72,17 @@ type FileCache struct {
 	FileSuffix     string
 	DirectoryLevel int
 	EmbedExpiry    int
+
+	mu sync.Mutex // serializes the read-modify-write operations
 }
 
-// NewFileCache Create new file cache with no config.
+// NewFileCache Create new file cache with no config, served through the Cache interface.
 // the level and expiry need set in method StartAndGC as config string.
 func NewFileCache() Cache {
-	//    return &FileCache{CachePath:FileCachePath, FileSuffix:FileCacheFileSuffix}
+	return ToCache(newFileCache())
+}
+
+func newFileCache() ContextCache {
 	return &FileCache{}
 }
 
@@ -119,53 +143,208 @@ func (fc *FileCache) getCacheFileName(key string) string {
 	return filepath.Join(cachePath, fmt.Sprintf("%s%s", keyMd5, fc.FileSuffix))
 }
 
-// Get value from file cache.
-// if non-exist or expired, return empty string.
-func (fc *FileCache) Get(key string) interface{} {
+// directory of the tag index files in the cache path
+const fileCacheTagDir = "tags"
+
+// get the index file name of a tag, it lists the keys put with the tag.
+func (fc *FileCache) getTagFileName(tag string) string {
+	m := md5.New()
+	_, _ = io.WriteString(m, tag)
+	return filepath.Join(fc.CachePath, fileCacheTagDir, hex.EncodeToString(m.Sum(nil))+".tag")
+}
+
+// read the item of key from file cache.
+// if non-exist or expired, return ErrCacheMiss.
+func (fc *FileCache) item(key string) (*FileCacheItem, error) {
 	fileData, err := FileGetContents(fc.getCacheFileName(key))
 	if err != nil {
-		return ""
+		if os.IsNotExist(err) {
+			return nil, ErrCacheMiss
+		}
+		return nil, err
 	}
 	var to FileCacheItem
-	_ = GobDecode(fileData, &to)
-	if to.Expired.Before(time.Now()) {
-		return ""
+	if err = GobDecode(fileData, &to); err != nil {
+		return nil, err
+	}
+	if to.isExpire() {
+		return nil, ErrCacheMiss
 	}
-	return to.Data
+	return &to, nil
+}
+
+// write the item of key to file cache.
+func (fc *FileCache) putItem(key string, item *FileCacheItem) error {
+	data, err := encodeFileItem(key, item)
+	if err != nil {
+		return err
+	}
+	return FilePutContents(fc.getCacheFileName(key), data)
+}
+
+// encode the item of key as it is stored in its file.
+func encodeFileItem(key string, item *FileCacheItem) ([]byte, error) {
+	if item.Data != nil {
+		gob.Register(item.Data)
+	}
+
+	item.Key = key
+	item.LastAccess = time.Now()
+	return GobEncode(item)
+}
+
+// Get value from file cache.
+// if non-exist or expired, return ErrCacheMiss.
+func (fc *FileCache) Get(ctx context.Context, key string) (interface{}, error) {
+	item, err := fc.item(key)
+	if err != nil {
+		return nil, err
+	}
+	return item.Data, nil
 }
 
 // GetMulti gets values from file cache.
-// if non-exist or expired, return empty string.
-func (fc *FileCache) GetMulti(keys []string) []interface{} {
-	var rc []interface{}
-	for _, key := range keys {
-		rc = append(rc, fc.Get(key))
+// if non-exist or expired, the error of the key is ErrCacheMiss.
+func (fc *FileCache) GetMulti(ctx context.Context, keys []string) ([]interface{}, []error) {
+	rc := make([]interface{}, len(keys))
+	errs := make([]error, len(keys))
+	for i, key := range keys {
+		rc[i], errs[i] = fc.Get(ctx, key)
 	}
-	return rc
+	return rc, errs
 }
 
 // Put value into file cache.
-// timeout means how long to keep this file, unit of ms.
-// if timeout equals fc.EmbedExpiry(default is 0), cache this item forever.
-func (fc *FileCache) Put(key string, val interface{}, timeout time.Duration) error {
-	gob.Register(val)
-
-	item := FileCacheItem{Data: val}
-	if timeout == time.Duration(fc.EmbedExpiry) {
-		item.Expired = time.Now().Add((86400 * 365 * 10) * time.Second) // ten years
-	} else {
+// timeout means how long to keep this file.
+// if timeout is 0 or equals fc.EmbedExpiry, cache this item forever.
+func (fc *FileCache) Put(ctx context.Context, key string, val interface{}, timeout time.Duration) error {
+	return fc.PutWithTags(ctx, key, val, timeout)
+}
+
+// PutMulti put values into file cache.
+// all the values are encoded before the files are written, so an encoding error writes nothing.
+func (fc *FileCache) PutMulti(ctx context.Context, items map[string]interface{}, timeout time.Duration) error {
+	var expired time.Time
+	if timeout != 0 && timeout != time.Duration(fc.EmbedExpiry) {
+		expired = time.Now().Add(timeout)
+	}
+	files := make(map[string][]byte, len(items))
+	for key, val := range items {
+		data, err := encodeFileItem(key, &FileCacheItem{Data: val, Expired: expired})
+		if err != nil {
+			return err
+		}
+		files[fc.getCacheFileName(key)] = data
+	}
+	for filename, data := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := FilePutContents(filename, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PutWithTags put value into file cache with tags, the key is appended to the index file of each tag.
+func (fc *FileCache) PutWithTags(ctx context.Context, key string, val interface{}, timeout time.Duration, tags ...string) error {
+	item := FileCacheItem{Data: val, Tags: tags}
+	if timeout != 0 && timeout != time.Duration(fc.EmbedExpiry) {
 		item.Expired = time.Now().Add(timeout)
 	}
-	item.LastAccess = time.Now()
-	data, err := GobEncode(item)
-	if err != nil {
+	if err := fc.putItem(key, &item); err != nil {
 		return err
 	}
-	return FilePutContents(fc.getCacheFileName(key), data)
+	if len(tags) == 0 {
+		return nil
+	}
+
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	if err := os.MkdirAll(filepath.Join(fc.CachePath, fileCacheTagDir), os.ModePerm); err != nil {
+		return err
+	}
+	for _, tag := range tags {
+		f, err := os.OpenFile(fc.getTagFileName(tag), os.O_CREATE|os.O_APPEND|os.O_WRONLY, os.ModePerm)
+		if err != nil {
+			return err
+		}
+		_, err = f.WriteString(strconv.Quote(key) + "\n")
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// InvalidateTags delete the file cache values of the tags listed in their index files.
+func (fc *FileCache) InvalidateTags(ctx context.Context, tags ...string) error {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	for _, tag := range tags {
+		filename := fc.getTagFileName(tag)
+		data, err := FileGetContents(filename)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		for _, line := range bytes.Split(data, []byte("\n")) {
+			key, err := strconv.Unquote(string(line))
+			if err != nil {
+				continue
+			}
+			// the key may have been put again with other tags
+			if item, err := fc.item(key); err == nil && item.hasTag(tag) {
+				if err = os.Remove(fc.getCacheFileName(key)); err != nil && !os.IsNotExist(err) {
+					return err
+				}
+			}
+		}
+		if err = os.Remove(filename); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeletePrefix delete the file cache values whose key starts with prefix, it reads every cached file.
+func (fc *FileCache) DeletePrefix(ctx context.Context, prefix string) error {
+	return filepath.Walk(fc.CachePath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if path == filepath.Join(fc.CachePath, fileCacheTagDir) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(path, fc.FileSuffix) {
+			return nil
+		}
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+		data, err := FileGetContents(path)
+		if err != nil {
+			return err
+		}
+		var item FileCacheItem
+		if GobDecode(data, &item) != nil || !strings.HasPrefix(item.Key, prefix) {
+			return nil
+		}
+		return os.Remove(path)
+	})
 }
 
 // Delete file cache value.
-func (fc *FileCache) Delete(key string) error {
+func (fc *FileCache) Delete(ctx context.Context, key string) error {
 	filename := fc.getCacheFileName(key)
 	if ok, _ := exists(filename); ok {
 		return os.Remove(filename)
@@ -173,43 +352,86 @@ func (fc *FileCache) Delete(key string) error {
 	return nil
 }
 
-// Incr will increase cached int value.
-// fc value is saving forever unless Delete.
-func (fc *FileCache) Incr(key string) error {
-	data := fc.Get(key)
-	var incr int
-	if reflect.TypeOf(data).Name() != "int" {
-		incr = 0
-	} else {
-		incr = data.(int) + 1
+// DeleteMulti delete file cache values, the non-exist values are ignored.
+func (fc *FileCache) DeleteMulti(ctx context.Context, keys []string) error {
+	for _, key := range keys {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := os.Remove(fc.getCacheFileName(key)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
 	}
-	_ = fc.Put(key, incr, time.Duration(fc.EmbedExpiry))
 	return nil
 }
 
-// Decr will decrease cached int value.
-func (fc *FileCache) Decr(key string) error {
-	data := fc.Get(key)
-	var decr int
-	if reflect.TypeOf(data).Name() != "int" || data.(int)-1 <= 0 {
-		decr = 0
-	} else {
-		decr = data.(int) - 1
+// IncrBy will increase cached int value and return the new value.
+// the value keeps its expire time, a non-exist value is created as an int64 counter saving forever.
+func (fc *FileCache) IncrBy(ctx context.Context, key string, n int64) (int64, error) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	item, err := fc.item(key)
+	if err == ErrCacheMiss {
+		return n, fc.putItem(key, &FileCacheItem{Data: n})
 	}
-	_ = fc.Put(key, decr, time.Duration(fc.EmbedExpiry))
-	return nil
+	if err != nil {
+		return 0, err
+	}
+	val, num, err := incrValue(item.Data, n)
+	if err != nil {
+		return 0, err
+	}
+	item.Data = val
+	return num, fc.putItem(key, item)
+}
+
+// DecrBy will decrease cached int value and return the new value.
+func (fc *FileCache) DecrBy(ctx context.Context, key string, n int64) (int64, error) {
+	return fc.IncrBy(ctx, key, -n)
+}
+
+// IsExist check value is exist and not expired.
+func (fc *FileCache) IsExist(ctx context.Context, key string) (bool, error) {
+	_, err := fc.item(key)
+	if err == ErrCacheMiss {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Touch reset the expire time of the value, 0 means forever.
+func (fc *FileCache) Touch(ctx context.Context, key string, timeout time.Duration) error {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	item, err := fc.item(key)
+	if err != nil {
+		return err
+	}
+	item.Expired = time.Time{}
+	if timeout != 0 {
+		item.Expired = time.Now().Add(timeout)
+	}
+	return fc.putItem(key, item)
 }
 
-// IsExist check value is exist.
-func (fc *FileCache) IsExist(key string) bool {
-	ret, _ := exists(fc.getCacheFileName(key))
-	return ret
+// TTL get the remaining time of the value, 0 means forever.
+func (fc *FileCache) TTL(ctx context.Context, key string) (time.Duration, error) {
+	item, err := fc.item(key)
+	if err != nil {
+		return 0, err
+	}
+	if item.Expired.IsZero() {
+		return 0, nil
+	}
+	return time.Until(item.Expired), nil
 }
 
 // ClearAll will clean cached files.
-// not implemented.
-func (fc *FileCache) ClearAll() error {
-	return nil
+func (fc *FileCache) ClearAll(ctx context.Context) error {
+	if err := os.RemoveAll(fc.CachePath); err != nil {
+		return err
+	}
+	return os.MkdirAll(fc.CachePath, os.ModePerm)
 }
 
 // check file exist.
@@ -255,5 +477,5 @@ func GobDecode(data []byte, to *FileCacheItem) error {
 }
 
 func init() {
-	Register(FileProvider, NewFileCache)
+	RegisterContext(FileProvider, newFileCache)
 }
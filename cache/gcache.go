@@ -1,7 +1,9 @@
 package cache
 
 import (
-	"errors"
+	"context"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/bluele/gcache"
@@ -11,138 +13,226 @@ import (
 // Cache gCache adapter
 type gCache struct {
 	cache gcache.Cache
+	mu    sync.Mutex // serializes the read-modify-write operations
+
+	tagMu sync.Mutex
+	tags  map[string]map[string]struct{} // keys of the tags
+}
+
+// value stored in gcache with its expire time, zero means forever
+type gCacheItem struct {
+	val     interface{}
+	expired time.Time
+	tags    []string
 }
 
-//NewGCache create new gCache adapter.
+// check the item has tag
+func (item *gCacheItem) hasTag(tag string) bool {
+	for _, t := range item.tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+//NewGCache create new gCache adapter served through the Cache interface.
 func NewGCache() Cache {
+	return ToCache(newGCache())
+}
+
+func newGCache() ContextCache {
 	return &gCache{}
 }
 
-// Get get value from memcache.
-func (rc *gCache) Get(key string) interface{} {
-	value, err := rc.cache.Get(key)
-	if err == nil {
-		return value
+// get the item of key, ErrCacheMiss if non-exist or expired
+func (rc *gCache) item(key string) (*gCacheItem, error) {
+	v, err := rc.cache.Get(key)
+	if err == gcache.KeyNotFoundError {
+		return nil, ErrCacheMiss
+	}
+	if err != nil {
+		return nil, err
+	}
+	return v.(*gCacheItem), nil
+}
+
+// store the item of key until its expire time
+func (rc *gCache) set(key string, item *gCacheItem) error {
+	if item.expired.IsZero() {
+		return rc.cache.Set(key, item)
+	}
+	return rc.cache.SetWithExpire(key, item, time.Until(item.expired))
+}
+
+// Get get value from gCache.
+func (rc *gCache) Get(ctx context.Context, key string) (interface{}, error) {
+	item, err := rc.item(key)
+	if err != nil {
+		return nil, err
+	}
+	return item.val, nil
+}
+
+// GetMulti get value from gCache.
+func (rc *gCache) GetMulti(ctx context.Context, keys []string) ([]interface{}, []error) {
+	values := make([]interface{}, len(keys))
+	errs := make([]error, len(keys))
+	for i, key := range keys {
+		values[i], errs[i] = rc.Get(ctx, key)
+	}
+	return values, errs
+}
+
+// DeleteMulti delete values from gCache.
+func (rc *gCache) DeleteMulti(ctx context.Context, keys []string) error {
+	return DeleteEach(ctx, rc, keys)
+}
+
+// Put put value to gCache.
+func (rc *gCache) Put(ctx context.Context, key string, value interface{}, timeout time.Duration) error {
+	return rc.PutWithTags(ctx, key, value, timeout)
+}
+
+// PutMulti put values to gCache, gcache has no batch operation so they are put one by one.
+func (rc *gCache) PutMulti(ctx context.Context, items map[string]interface{}, timeout time.Duration) error {
+	return PutEach(ctx, rc, items, timeout)
+}
+
+// PutWithTags put value to gCache with tags, they are indexed so InvalidateTags finds the value.
+func (rc *gCache) PutWithTags(ctx context.Context, key string, value interface{}, timeout time.Duration, tags ...string) error {
+	item := &gCacheItem{val: value, tags: tags}
+	if timeout != 0 {
+		item.expired = time.Now().Add(timeout)
+	}
+	if err := rc.set(key, item); err != nil {
+		return err
+	}
+	if len(tags) > 0 {
+		rc.tagMu.Lock()
+		for _, tag := range tags {
+			if rc.tags[tag] == nil {
+				rc.tags[tag] = make(map[string]struct{})
+			}
+			rc.tags[tag][key] = struct{}{}
+		}
+		rc.tagMu.Unlock()
 	}
 	return nil
 }
 
-// GetMulti get value from memcache.
-func (rc *gCache) GetMulti(keys []string) []interface{} {
-	values := make([]interface{}, 0)
-	for _, key := range keys {
-		values = append(values, rc.Get(key))
+// remove the evicted or removed value from the index of its tags, it is called by gcache
+func (rc *gCache) untag(key, value interface{}) {
+	item, ok := value.(*gCacheItem)
+	if !ok || len(item.tags) == 0 {
+		return
+	}
+	rc.tagMu.Lock()
+	defer rc.tagMu.Unlock()
+	for _, tag := range item.tags {
+		delete(rc.tags[tag], key.(string))
+		if len(rc.tags[tag]) == 0 {
+			delete(rc.tags, tag)
+		}
 	}
-	return values
 }
 
-// DelMulti get value from memcache.
-func (rc *gCache) DelMulti(keys []string) error {
-	for _, key := range keys {
-		_ = rc.Delete(key)
+// InvalidateTags delete the values of the tags in gCache.
+func (rc *gCache) InvalidateTags(ctx context.Context, tags ...string) error {
+	for _, tag := range tags {
+		rc.tagMu.Lock()
+		keys := make([]string, 0, len(rc.tags[tag]))
+		for key := range rc.tags[tag] {
+			keys = append(keys, key)
+		}
+		rc.tagMu.Unlock()
+
+		for _, key := range keys {
+			// the key may have been put again with other tags
+			if item, err := rc.item(key); err == nil && item.hasTag(tag) {
+				rc.cache.Remove(key)
+			}
+		}
+		rc.tagMu.Lock()
+		delete(rc.tags, tag)
+		rc.tagMu.Unlock()
 	}
 	return nil
 }
 
-// Put put value to memcache. only support string.
-func (rc *gCache) Put(key string, value interface{}, timeout time.Duration) error {
-	if timeout == 0 {
-		return rc.cache.Set(key, value)
+// DeletePrefix delete the values whose key starts with prefix in gCache.
+func (rc *gCache) DeletePrefix(ctx context.Context, prefix string) error {
+	for _, key := range rc.cache.Keys(false) {
+		if k, ok := key.(string); ok && strings.HasPrefix(k, prefix) {
+			rc.cache.Remove(k)
+		}
 	}
-	return rc.cache.SetWithExpire(key, value, timeout)
+	return nil
 }
 
-// Delete delete value in memcache.
-func (rc *gCache) Delete(key string) error {
+// Delete delete value in gCache.
+func (rc *gCache) Delete(ctx context.Context, key string) error {
 	rc.cache.Remove(key)
 	return nil
 }
 
-// Incr increase counter.
-func (rc *gCache) Incr(key string) error {
-	val, err := rc.cache.Get(key)
-
+// IncrBy increase counter and return the new value, the value keeps its type and its expire time.
+func (rc *gCache) IncrBy(ctx context.Context, key string, n int64) (int64, error) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	item, err := rc.item(key)
+	if err == ErrCacheMiss {
+		return n, rc.set(key, &gCacheItem{val: n})
+	}
 	if err != nil {
-		return err
+		return 0, err
 	}
-
-	switch v := val.(type) {
-	case float32:
-		err = rc.cache.Set(key, float32(v)+1)
-	case float64:
-		err = rc.cache.Set(key, float64(v)+1)
-	case int8:
-		err = rc.cache.Set(key, int8(v)+1)
-	case int16:
-		err = rc.cache.Set(key, int16(v)+1)
-	case int32:
-		err = rc.cache.Set(key, int32(v)+1)
-	case int64:
-		err = rc.cache.Set(key, int64(v)+1)
-	case uint:
-		err = rc.cache.Set(key, uint(v)+1)
-	case uint8:
-		err = rc.cache.Set(key, uint8(v)+1)
-	case uint16:
-		err = rc.cache.Set(key, uint16(v)+1)
-	case uint32:
-		err = rc.cache.Set(key, uint32(v)+1)
-	case uint64:
-		err = rc.cache.Set(key, uint64(v)+1)
-	case int:
-		err = rc.cache.Set(key, int(v)+1)
-	default:
-		return errors.New("is not numeric")
+	val, num, err := incrValue(item.val, n)
+	if err != nil {
+		return 0, err
 	}
-	return err
+	return num, rc.set(key, &gCacheItem{val: val, expired: item.expired, tags: item.tags})
+}
+
+// DecrBy decrease counter and return the new value.
+func (rc *gCache) DecrBy(ctx context.Context, key string, n int64) (int64, error) {
+	return rc.IncrBy(ctx, key, -n)
 }
 
-// Decr decrease counter.
-func (rc *gCache) Decr(key string) error {
-	val, err := rc.cache.Get(key)
+// IsExist check value exists in gCache.
+func (rc *gCache) IsExist(ctx context.Context, key string) (bool, error) {
+	return rc.cache.Has(key), nil
+}
 
+// Touch reset the expire time of the value.
+func (rc *gCache) Touch(ctx context.Context, key string, timeout time.Duration) error {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	item, err := rc.item(key)
 	if err != nil {
 		return err
 	}
-
-	switch v := val.(type) {
-	case float32:
-		err = rc.cache.Set(key, float32(v)-1)
-	case float64:
-		err = rc.cache.Set(key, float64(v)-1)
-	case int8:
-		err = rc.cache.Set(key, int8(v)-1)
-	case int16:
-		err = rc.cache.Set(key, int16(v)-1)
-	case int32:
-		err = rc.cache.Set(key, int32(v)-1)
-	case int64:
-		err = rc.cache.Set(key, int64(v)-1)
-	case uint:
-		err = rc.cache.Set(key, uint(v)-1)
-	case uint8:
-		err = rc.cache.Set(key, uint8(v)-1)
-	case uint16:
-		err = rc.cache.Set(key, uint16(v)-1)
-	case uint32:
-		err = rc.cache.Set(key, uint32(v)-1)
-	case uint64:
-		err = rc.cache.Set(key, uint64(v)-1)
-	case int:
-		err = rc.cache.Set(key, int(v)-1)
-	default:
-		return errors.New("is not numeric")
+	touched := &gCacheItem{val: item.val, tags: item.tags}
+	if timeout != 0 {
+		touched.expired = time.Now().Add(timeout)
 	}
-	return err
+	return rc.set(key, touched)
 }
 
-// IsExist check value exists in memcache.
-func (rc *gCache) IsExist(key string) bool {
-	return rc.cache.Has(key)
+// TTL get the remaining time of the value.
+func (rc *gCache) TTL(ctx context.Context, key string) (time.Duration, error) {
+	item, err := rc.item(key)
+	if err != nil {
+		return 0, err
+	}
+	if item.expired.IsZero() {
+		return 0, nil
+	}
+	return time.Until(item.expired), nil
 }
 
-// ClearAll clear all cached in memcache.
-func (rc *gCache) ClearAll() error {
+// ClearAll clear all cached in gCache.
+func (rc *gCache) ClearAll(ctx context.Context) error {
 	rc.cache.Purge()
 	return nil
 }
@@ -156,20 +246,22 @@ func (rc *gCache) StartAndGC(config string) error {
 		cf["size"] = 30
 	}
 
+	rc.tags = make(map[string]map[string]struct{})
+	builder := gcache.New(GetInt(cf["size"])).EvictedFunc(rc.untag)
 	switch GetString(cf["type"]) {
 	case "arc":
-		rc.cache = gcache.New(GetInt(cf["size"])).ARC().Build()
+		rc.cache = builder.ARC().Build()
 	case "lru":
-		rc.cache = gcache.New(GetInt(cf["size"])).LRU().Build()
+		rc.cache = builder.LRU().Build()
 	case "lfu":
-		rc.cache = gcache.New(GetInt(cf["size"])).LFU().Build()
+		rc.cache = builder.LFU().Build()
 	default:
-		rc.cache = gcache.New(GetInt(cf["size"])).Build()
+		rc.cache = builder.Build()
 	}
 
 	return nil
 }
 
 func init() {
-	Register(GCacheProvider, NewGCache)
+	RegisterContext(GCacheProvider, newGCache)
 }
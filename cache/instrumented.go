@@ -0,0 +1,438 @@
+// Copyright 2019 asana Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// operations counted by an InstrumentedCache
+const (
+	opGet = iota
+	opGetMulti
+	opPut
+	opPutMulti
+	opDelete
+	opDeleteMulti
+	opIncrBy
+	opDecrBy
+	opIsExist
+	opTouch
+	opTTL
+	opClearAll
+	opCount
+)
+
+var opNames = [opCount]string{"get", "get_multi", "put", "put_multi", "delete", "delete_multi", "incr_by", "decr_by", "is_exist", "touch", "ttl", "clear_all"}
+
+// OpStats counts the calls of an operation of an InstrumentedCache.
+type OpStats struct {
+	Name   string
+	Calls  int64
+	Errors int64
+	Total  time.Duration
+	Max    time.Duration
+}
+
+// Avg get the average latency of the calls
+func (s OpStats) Avg() time.Duration {
+	if s.Calls == 0 {
+		return 0
+	}
+	return s.Total / time.Duration(s.Calls)
+}
+
+// Stats of an InstrumentedCache.
+// the misses are not errors, ReadBytes and WrittenBytes count the []byte and string values only,
+// Entries and Bytes are -1 when the adapter does not report them.
+type Stats struct {
+	Name         string
+	Hits         int64
+	Misses       int64
+	Errors       int64
+	ReadBytes    int64
+	WrittenBytes int64
+	Entries      int64
+	Bytes        int64
+	Ops          []OpStats
+}
+
+// HitRatio get the part of the reads which were hits
+func (s Stats) HitRatio() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+// Op get the stats of an operation by its name, such as "get"
+func (s Stats) Op(name string) OpStats {
+	for _, op := range s.Ops {
+		if op.Name == name {
+			return op
+		}
+	}
+	return OpStats{Name: name}
+}
+
+type opCounter struct {
+	calls, errors, total, max int64
+}
+
+// InstrumentedCache counts the hits, the misses, the errors, the latencies and the sizes of the values of a cache.
+// only the sizes of the []byte and string values are counted.
+// the instances are registered by name, their stats are shown on the cache page of the admin module.
+//
+//	bm, err := cache.NewCache(cache.RedisProvider, `{"conn":"127.0.0.1:6379"}`)
+//	bm = cache.Instrument("sessions", bm)
+type InstrumentedCache struct {
+	cc   ContextCache
+	name string
+
+	hits, misses, errors    int64
+	readBytes, writtenBytes int64
+	ops                     [opCount]opCounter
+}
+
+// the instrumented caches by name
+var instruments = struct {
+	sync.RWMutex
+	caches map[string]*InstrumentedCache
+}{caches: make(map[string]*InstrumentedCache)}
+
+// Instrument wrap c, a result of NewCache, to collect its stats under name.
+func Instrument(name string, c Cache) Cache {
+	return ToCache(NewInstrumentedCache(name, ToContextCache(c)))
+}
+
+// NewInstrumentedCache wrap cc to collect its stats under name.
+// a new cache with the name of a registered one replaces it in the stats.
+func NewInstrumentedCache(name string, cc ContextCache) *InstrumentedCache {
+	ic := &InstrumentedCache{cc: cc, name: name}
+	instruments.Lock()
+	instruments.caches[name] = ic
+	instruments.Unlock()
+	return ic
+}
+
+// Unregister remove the stats of the cache.
+func (ic *InstrumentedCache) Unregister() {
+	instruments.Lock()
+	if instruments.caches[ic.name] == ic {
+		delete(instruments.caches, ic.name)
+	}
+	instruments.Unlock()
+}
+
+// Unwrap get the wrapped cache
+func (ic *InstrumentedCache) Unwrap() ContextCache {
+	return ic.cc
+}
+
+// Name get the name of the stats
+func (ic *InstrumentedCache) Name() string {
+	return ic.name
+}
+
+// count a call of op started at start
+func (ic *InstrumentedCache) done(op int, start time.Time, err error) {
+	d := int64(time.Since(start))
+	c := &ic.ops[op]
+	atomic.AddInt64(&c.calls, 1)
+	atomic.AddInt64(&c.total, d)
+	for {
+		max := atomic.LoadInt64(&c.max)
+		if d <= max || atomic.CompareAndSwapInt64(&c.max, max, d) {
+			break
+		}
+	}
+	if err != nil && err != ErrCacheMiss {
+		atomic.AddInt64(&c.errors, 1)
+		atomic.AddInt64(&ic.errors, 1)
+	}
+}
+
+// get the size of the []byte and string values, the other values are not counted
+// to keep the stats off the cost of walking them.
+func byteSize(v interface{}) int64 {
+	switch v := v.(type) {
+	case []byte:
+		return int64(len(v))
+	case string:
+		return int64(len(v))
+	}
+	return 0
+}
+
+// count the result of a read
+func (ic *InstrumentedCache) read(v interface{}, err error) {
+	switch err {
+	case nil:
+		atomic.AddInt64(&ic.hits, 1)
+		atomic.AddInt64(&ic.readBytes, byteSize(v))
+	case ErrCacheMiss:
+		atomic.AddInt64(&ic.misses, 1)
+	}
+}
+
+// Stats get the stats of the cache
+func (ic *InstrumentedCache) Stats() Stats {
+	s := Stats{
+		Name:         ic.name,
+		Hits:         atomic.LoadInt64(&ic.hits),
+		Misses:       atomic.LoadInt64(&ic.misses),
+		Errors:       atomic.LoadInt64(&ic.errors),
+		ReadBytes:    atomic.LoadInt64(&ic.readBytes),
+		WrittenBytes: atomic.LoadInt64(&ic.writtenBytes),
+		Entries:      -1,
+		Bytes:        -1,
+		Ops:          make([]OpStats, opCount),
+	}
+	adapter := Unwrap(ic.cc)
+	if l, ok := adapter.(interface{ Len() int }); ok {
+		s.Entries = int64(l.Len())
+	}
+	if b, ok := adapter.(interface{ Bytes() int64 }); ok {
+		s.Bytes = b.Bytes()
+	}
+	for i := range ic.ops {
+		c := &ic.ops[i]
+		s.Ops[i] = OpStats{
+			Name:   opNames[i],
+			Calls:  atomic.LoadInt64(&c.calls),
+			Errors: atomic.LoadInt64(&c.errors),
+			Total:  time.Duration(atomic.LoadInt64(&c.total)),
+			Max:    time.Duration(atomic.LoadInt64(&c.max)),
+		}
+	}
+	return s
+}
+
+// Get get cached value and count a hit or a miss.
+func (ic *InstrumentedCache) Get(ctx context.Context, key string) (interface{}, error) {
+	start := time.Now()
+	v, err := ic.cc.Get(ctx, key)
+	ic.done(opGet, start, err)
+	ic.read(v, err)
+	return v, err
+}
+
+// GetMulti get cached values and count a hit or a miss for each key.
+func (ic *InstrumentedCache) GetMulti(ctx context.Context, keys []string) ([]interface{}, []error) {
+	start := time.Now()
+	values, errs := ic.cc.GetMulti(ctx, keys)
+	var failed error
+	for i, err := range errs {
+		ic.read(values[i], err)
+		if err != nil && err != ErrCacheMiss {
+			failed = err
+		}
+	}
+	ic.done(opGetMulti, start, failed)
+	return values, errs
+}
+
+// Put put value and count its size.
+func (ic *InstrumentedCache) Put(ctx context.Context, key string, val interface{}, timeout time.Duration) error {
+	start := time.Now()
+	err := ic.cc.Put(ctx, key, val, timeout)
+	ic.done(opPut, start, err)
+	if err == nil {
+		atomic.AddInt64(&ic.writtenBytes, byteSize(val))
+	}
+	return err
+}
+
+// PutMulti put values and count their size.
+func (ic *InstrumentedCache) PutMulti(ctx context.Context, items map[string]interface{}, timeout time.Duration) error {
+	start := time.Now()
+	err := ic.cc.PutMulti(ctx, items, timeout)
+	ic.done(opPutMulti, start, err)
+	if err == nil {
+		for _, val := range items {
+			atomic.AddInt64(&ic.writtenBytes, byteSize(val))
+		}
+	}
+	return err
+}
+
+// PutWithTags put value with tags when the wrapped cache is a Tagger, it is counted as a put.
+func (ic *InstrumentedCache) PutWithTags(ctx context.Context, key string, val interface{}, timeout time.Duration, tags ...string) error {
+	start := time.Now()
+	err := PutWithTags(ctx, ic.cc, key, val, timeout, tags...)
+	ic.done(opPut, start, err)
+	if err == nil {
+		atomic.AddInt64(&ic.writtenBytes, byteSize(val))
+	}
+	return err
+}
+
+// InvalidateTags delete the values of the tags when the wrapped cache is a Tagger.
+func (ic *InstrumentedCache) InvalidateTags(ctx context.Context, tags ...string) error {
+	return InvalidateTags(ctx, ic.cc, tags...)
+}
+
+// DeletePrefix delete the values whose key starts with prefix when the wrapped cache is a PrefixDeleter.
+func (ic *InstrumentedCache) DeletePrefix(ctx context.Context, prefix string) error {
+	return DeletePrefix(ctx, ic.cc, prefix)
+}
+
+// Delete delete cached value.
+func (ic *InstrumentedCache) Delete(ctx context.Context, key string) error {
+	start := time.Now()
+	err := ic.cc.Delete(ctx, key)
+	ic.done(opDelete, start, err)
+	return err
+}
+
+// DeleteMulti delete cached values.
+func (ic *InstrumentedCache) DeleteMulti(ctx context.Context, keys []string) error {
+	start := time.Now()
+	err := ic.cc.DeleteMulti(ctx, keys)
+	ic.done(opDeleteMulti, start, err)
+	return err
+}
+
+// IncrBy increase the counter.
+func (ic *InstrumentedCache) IncrBy(ctx context.Context, key string, n int64) (int64, error) {
+	start := time.Now()
+	v, err := ic.cc.IncrBy(ctx, key, n)
+	ic.done(opIncrBy, start, err)
+	return v, err
+}
+
+// DecrBy decrease the counter.
+func (ic *InstrumentedCache) DecrBy(ctx context.Context, key string, n int64) (int64, error) {
+	start := time.Now()
+	v, err := ic.cc.DecrBy(ctx, key, n)
+	ic.done(opDecrBy, start, err)
+	return v, err
+}
+
+// IsExist check cached value exists.
+func (ic *InstrumentedCache) IsExist(ctx context.Context, key string) (bool, error) {
+	start := time.Now()
+	ok, err := ic.cc.IsExist(ctx, key)
+	ic.done(opIsExist, start, err)
+	return ok, err
+}
+
+// Touch reset the expiration of the value.
+func (ic *InstrumentedCache) Touch(ctx context.Context, key string, timeout time.Duration) error {
+	start := time.Now()
+	err := ic.cc.Touch(ctx, key, timeout)
+	ic.done(opTouch, start, err)
+	return err
+}
+
+// TTL get the remaining time to live of the value.
+func (ic *InstrumentedCache) TTL(ctx context.Context, key string) (time.Duration, error) {
+	start := time.Now()
+	ttl, err := ic.cc.TTL(ctx, key)
+	if err == ErrNotSupported {
+		// not an error of the cache
+		ic.done(opTTL, start, nil)
+	} else {
+		ic.done(opTTL, start, err)
+	}
+	return ttl, err
+}
+
+// ClearAll clear the cache.
+func (ic *InstrumentedCache) ClearAll(ctx context.Context) error {
+	start := time.Now()
+	err := ic.cc.ClearAll(ctx)
+	ic.done(opClearAll, start, err)
+	return err
+}
+
+// StartAndGC start the wrapped cache.
+func (ic *InstrumentedCache) StartAndGC(config string) error {
+	return ic.cc.StartAndGC(config)
+}
+
+// AllStats get the stats of the instrumented caches sorted by name.
+func AllStats() []Stats {
+	instruments.RLock()
+	caches := make([]*InstrumentedCache, 0, len(instruments.caches))
+	for _, ic := range instruments.caches {
+		caches = append(caches, ic)
+	}
+	instruments.RUnlock()
+
+	stats := make([]Stats, len(caches))
+	for i, ic := range caches {
+		stats[i] = ic.Stats()
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Name < stats[j].Name
+	})
+	return stats
+}
+
+// escape a label value of the prometheus text format
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// WriteMetrics write the stats of the instrumented caches in the prometheus text format.
+func WriteMetrics(w io.Writer) error {
+	stats := AllStats()
+	var b strings.Builder
+	counter := func(name, help string, value func(s Stats) int64) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s counter\n", name, help, name)
+		for _, s := range stats {
+			fmt.Fprintf(&b, "%s{cache=\"%s\"} %d\n", name, labelEscaper.Replace(s.Name), value(s))
+		}
+	}
+	gauge := func(name, help string, value func(s Stats) int64) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+		for _, s := range stats {
+			if v := value(s); v >= 0 {
+				fmt.Fprintf(&b, "%s{cache=\"%s\"} %d\n", name, labelEscaper.Replace(s.Name), v)
+			}
+		}
+	}
+	counter("asana_cache_hits_total", "Reads of the cache which were hits.", func(s Stats) int64 { return s.Hits })
+	counter("asana_cache_misses_total", "Reads of the cache which were misses.", func(s Stats) int64 { return s.Misses })
+	counter("asana_cache_errors_total", "Failed operations of the cache.", func(s Stats) int64 { return s.Errors })
+	counter("asana_cache_read_bytes_total", "Size of the []byte and string values read.", func(s Stats) int64 { return s.ReadBytes })
+	counter("asana_cache_written_bytes_total", "Size of the []byte and string values written.", func(s Stats) int64 { return s.WrittenBytes })
+	gauge("asana_cache_entries", "Number of entries of the cache.", func(s Stats) int64 { return s.Entries })
+	gauge("asana_cache_size_bytes", "Approximate size of the entries of the cache.", func(s Stats) int64 { return s.Bytes })
+
+	b.WriteString("# HELP asana_cache_operation_seconds Latency of the operations of the cache.\n# TYPE asana_cache_operation_seconds summary\n")
+	for _, s := range stats {
+		name := labelEscaper.Replace(s.Name)
+		for _, op := range s.Ops {
+			fmt.Fprintf(&b, "asana_cache_operation_seconds_sum{cache=\"%s\",op=\"%s\"} %g\n", name, op.Name, op.Total.Seconds())
+			fmt.Fprintf(&b, "asana_cache_operation_seconds_count{cache=\"%s\",op=\"%s\"} %d\n", name, op.Name, op.Calls)
+		}
+	}
+	b.WriteString("# HELP asana_cache_operation_max_seconds Slowest call of the operations of the cache.\n# TYPE asana_cache_operation_max_seconds gauge\n")
+	for _, s := range stats {
+		name := labelEscaper.Replace(s.Name)
+		for _, op := range s.Ops {
+			fmt.Fprintf(&b, "asana_cache_operation_max_seconds{cache=\"%s\",op=\"%s\"} %g\n", name, op.Name, op.Max.Seconds())
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
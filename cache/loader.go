@@ -0,0 +1,271 @@
+// Copyright 2019 asana Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+var (
+	// DefaultLockTTL is the lifetime of the locks taken by GetOrLoad across processes.
+	DefaultLockTTL = 10 * time.Second
+	// DefaultLockWait is the interval GetOrLoad polls the cache while another process loads the value.
+	DefaultLockWait = 50 * time.Millisecond
+)
+
+// Loader loads the value of a key missing in the cache.
+type Loader func(ctx context.Context, key string) (interface{}, error)
+
+// Locker is implemented by the adapters able to lock a key across processes,
+// GetOrLoad uses it so only one process loads a missing key.
+type Locker interface {
+	// take the lock of key for ttl if it is free, token identifies the owner.
+	TryLock(ctx context.Context, key string, ttl time.Duration) (token string, ok bool, err error)
+	// release the lock of key if token still owns it.
+	Unlock(ctx context.Context, key string, token string) error
+}
+
+// LoadOption configure GetOrLoad
+type LoadOption func(*loadOptions)
+
+type loadOptions struct {
+	stale   time.Duration
+	jitter  float64
+	locker  Locker
+	lockTTL time.Duration
+}
+
+// WithStale serve the values up to window after their ttl while one caller refreshes them in background.
+func WithStale(window time.Duration) LoadOption {
+	return func(o *loadOptions) {
+		o.stale = window
+	}
+}
+
+// WithJitter spread the expirations by up to fraction of the ttl, so the keys loaded together do not expire together.
+func WithJitter(fraction float64) LoadOption {
+	return func(o *loadOptions) {
+		o.jitter = fraction
+	}
+}
+
+// WithLocker lock the keys with l across processes while they are loaded, the locks expire after ttl.
+// by default the cache is used when it is a Locker.
+func WithLocker(l Locker, ttl time.Duration) LoadOption {
+	return func(o *loadOptions) {
+		o.locker = l
+		o.lockTTL = ttl
+	}
+}
+
+// call of a loader shared by the concurrent callers of a key
+type loadCall struct {
+	wg  sync.WaitGroup
+	val interface{}
+	err error
+}
+
+type loadKey struct {
+	c   ContextCache
+	key string
+}
+
+// the loads in progress
+var loads = struct {
+	sync.Mutex
+	calls map[loadKey]*loadCall
+}{calls: make(map[loadKey]*loadCall)}
+
+// run fn once for the concurrent callers of the same key, they all get its result.
+// a panic of fn is returned as an error, so the waiters and the next callers are not blocked.
+func singleLoad(k loadKey, fn func() (interface{}, error)) (interface{}, error) {
+	loads.Lock()
+	if call, ok := loads.calls[k]; ok {
+		loads.Unlock()
+		call.wg.Wait()
+		return call.val, call.err
+	}
+	call := new(loadCall)
+	call.wg.Add(1)
+	loads.calls[k] = call
+	loads.Unlock()
+
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				call.val, call.err = nil, fmt.Errorf("cache: loader of %q panicked: %v", k.key, r)
+			}
+			call.wg.Done()
+
+			loads.Lock()
+			delete(loads.calls, k)
+			loads.Unlock()
+		}()
+		call.val, call.err = fn()
+	}()
+	return call.val, call.err
+}
+
+// the key marking the value of key fresh
+func freshKey(key string) string {
+	return key + ":fresh"
+}
+
+// the key of the lock of key across processes
+func lockKey(key string) string {
+	return key + ":lock"
+}
+
+// GetOrLoad get cached value by key, on a miss load it with loader and put it for ttl.
+// the concurrent misses of a key call loader once in the process,
+// and once across the processes when the cache or its adapter is a Locker or WithLocker is set.
+// the errors of loader are returned and not cached, a failure to put the loaded value is returned with the value.
+// a cache with a codec returns the encoded value on a miss as on a hit, decode it with GetOrLoadInto.
+//	v, err := cache.GetOrLoad(ctx, bm, "user:42", time.Minute, func(ctx context.Context, key string) (interface{}, error) {
+//		return loadUser(ctx, 42)
+//	}, cache.WithStale(10*time.Second), cache.WithJitter(0.1))
+func GetOrLoad(ctx context.Context, c ContextCache, key string, ttl time.Duration, loader Loader, opts ...LoadOption) (interface{}, error) {
+	o := loadOptions{lockTTL: DefaultLockTTL}
+	if l, ok := c.(Locker); ok {
+		o.locker = l
+	} else if l, ok := Unwrap(c).(Locker); ok {
+		o.locker = l
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if ttl == 0 {
+		o.stale = 0
+	}
+
+	v, err := c.Get(ctx, key)
+	if err == nil {
+		if o.stale > 0 {
+			if fresh, err := c.IsExist(ctx, freshKey(key)); err == nil && !fresh {
+				go refresh(c, key, ttl, loader, o)
+			}
+		}
+		return v, nil
+	}
+	if err != ErrCacheMiss {
+		return nil, err
+	}
+
+	return singleLoad(loadKey{c, key}, func() (interface{}, error) {
+		return load(ctx, c, key, ttl, loader, o)
+	})
+}
+
+// load the missing key, waiting for the process holding its lock
+func load(ctx context.Context, c ContextCache, key string, ttl time.Duration, loader Loader, o loadOptions) (interface{}, error) {
+	if o.locker != nil {
+		token, ok, err := o.locker.TryLock(ctx, lockKey(key), o.lockTTL)
+		if err == nil && ok {
+			defer o.locker.Unlock(context.Background(), lockKey(key), token)
+		} else if err == nil {
+			if v, err := waitLoaded(ctx, c, key, o.lockTTL); err != ErrCacheMiss {
+				return v, err
+			}
+		}
+	}
+
+	v, err := loader(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	err = store(ctx, c, key, v, ttl, o)
+	if codec := codecOf(c); codec != nil {
+		// the value as a hit returns it
+		data, eerr := codec.Encode(v)
+		if eerr != nil {
+			return nil, eerr
+		}
+		return data, err
+	}
+	return v, err
+}
+
+// GetOrLoadInto get cached value by key as GetOrLoad does, and store it in the value pointed to by dst
+// as GetInto does, whether it is a hit or a miss.
+func GetOrLoadInto(ctx context.Context, c ContextCache, key string, ttl time.Duration, dst interface{}, loader Loader, opts ...LoadOption) error {
+	v, err := GetOrLoad(ctx, c, key, ttl, loader, opts...)
+	if err != nil {
+		return err
+	}
+	return decodeInto(c, v, dst)
+}
+
+// wait for another process to load key, ErrCacheMiss if it is not loaded in timeout
+func waitLoaded(ctx context.Context, c ContextCache, key string, timeout time.Duration) (interface{}, error) {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(DefaultLockWait):
+		}
+		if v, err := c.Get(ctx, key); err != ErrCacheMiss {
+			return v, err
+		}
+	}
+	return nil, ErrCacheMiss
+}
+
+// reload the stale key in background, unless another caller does it
+func refresh(c ContextCache, key string, ttl time.Duration, loader Loader, o loadOptions) {
+	ctx := context.Background()
+	_, _ = singleLoad(loadKey{c, freshKey(key)}, func() (interface{}, error) {
+		if o.locker != nil {
+			token, ok, err := o.locker.TryLock(ctx, lockKey(key), o.lockTTL)
+			if err != nil || !ok {
+				return nil, err
+			}
+			defer o.locker.Unlock(ctx, lockKey(key), token)
+		}
+		v, err := loader(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		return v, store(ctx, c, key, v, ttl, o)
+	})
+}
+
+// put the loaded value, it is kept stale for the stale window after its ttl
+func store(ctx context.Context, c ContextCache, key string, v interface{}, ttl time.Duration, o loadOptions) error {
+	ttl = jitter(ttl, o.jitter)
+	if err := c.Put(ctx, key, v, ttl+o.stale); err != nil {
+		return err
+	}
+	if o.stale > 0 {
+		return c.Put(ctx, freshKey(key), "1", ttl)
+	}
+	return nil
+}
+
+// spread ttl randomly by up to fraction of it
+func jitter(ttl time.Duration, fraction float64) time.Duration {
+	if ttl <= 0 || fraction <= 0 {
+		return ttl
+	}
+	delta := time.Duration(float64(ttl) * fraction * (2*rand.Float64() - 1))
+	if ttl+delta <= 0 {
+		return ttl
+	}
+	return ttl + delta
+}
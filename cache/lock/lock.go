@@ -0,0 +1,294 @@
+// Copyright 2019 asana Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package lock provides distributed locks on top of the cache adapters.
+//
+// The redis, memcache, ssdb and memory adapters are lock backends.
+// A lock is held by a random token and released only by its owner,
+// it is renewed in background until Unlock and carries a fencing number
+// increasing with each acquisition of the key, assigned atomically with the acquisition on redis
+// and best-effort on the other backends (see FencedBackend).
+//
+// Usage:
+//
+//	bm, err := cache.NewContextCache(cache.RedisProvider, `{"conn":"127.0.0.1:6379"}`)
+//	tok, err := lock.Lock(ctx, bm, "report", 30*time.Second)
+//	if err != nil {
+//		return err
+//	}
+//	defer tok.Unlock(ctx)
+//	// pass tok.Fence() to the storage so it rejects the writes of an older owner
+package lock
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/goasana/asana/cache"
+)
+
+var (
+	// DefaultRetry is the interval Lock polls a lock held by another owner.
+	DefaultRetry = 50 * time.Millisecond
+
+	// ErrNotAcquired is returned by TryLock when the lock is held by another owner.
+	ErrNotAcquired = errors.New("lock: not acquired")
+	// ErrNotHeld is returned when the token does not own the lock anymore, it expired or was taken.
+	ErrNotHeld = errors.New("lock: not held")
+)
+
+// Backend is implemented by the adapters able to hold the locks,
+// the value of a lock key is the token of its owner.
+type Backend interface {
+	// put token as the value of key for ttl if key is free.
+	Acquire(ctx context.Context, key string, token string, ttl time.Duration) (bool, error)
+	// reset the ttl of key if token still owns it.
+	Renew(ctx context.Context, key string, token string, ttl time.Duration) (bool, error)
+	// delete key if token still owns it.
+	Release(ctx context.Context, key string, token string) (bool, error)
+}
+
+// FencedBackend is implemented by the backends assigning the fencing number with the acquisition, atomically,
+// as the redis adapter does. the other backends take it by a separate IncrBy of the adapter, so their fencing is best-effort:
+// an owner stalled between the two calls may get a higher number than the next owner,
+// and the counter restarts when it is evicted or cleared.
+type FencedBackend interface {
+	Backend
+	// put token as the value of key for ttl if key is free, and get the next fencing number of key.
+	AcquireFenced(ctx context.Context, key string, token string, ttl time.Duration) (fence int64, ok bool, err error)
+}
+
+// Option configure Lock and TryLock
+type Option func(*options)
+
+type options struct {
+	retry time.Duration
+	renew bool
+}
+
+// WithRetry poll a lock held by another owner every interval.
+func WithRetry(interval time.Duration) Option {
+	return func(o *options) {
+		o.retry = interval
+	}
+}
+
+// WithoutRenewal let the lock expire after its ttl, it is renewed until Unlock by default.
+func WithoutRenewal() Option {
+	return func(o *options) {
+		o.renew = false
+	}
+}
+
+// get the lock backend of c or of the adapter under its wrappers
+func backendOf(c cache.ContextCache) (Backend, cache.ContextCache, error) {
+	if b, ok := c.(Backend); ok {
+		return b, c, nil
+	}
+	adapter := cache.Unwrap(c)
+	if b, ok := adapter.(Backend); ok {
+		return b, adapter, nil
+	}
+	return nil, nil, cache.ErrNotSupported
+}
+
+// the key of the fencing counter of key
+func fenceKey(key string) string {
+	return key + ":fence"
+}
+
+// Lock take the lock of key for ttl, waiting until it is free or ctx is done.
+// it returns cache.ErrNotSupported when the adapter of c is not a Backend.
+func Lock(ctx context.Context, c cache.ContextCache, key string, ttl time.Duration, opts ...Option) (*Token, error) {
+	o := options{retry: DefaultRetry, renew: true}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	for {
+		tok, err := tryLock(ctx, c, key, ttl, o)
+		if err != ErrNotAcquired {
+			return tok, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(o.retry):
+		}
+	}
+}
+
+// TryLock take the lock of key for ttl if it is free, else it returns ErrNotAcquired.
+func TryLock(ctx context.Context, c cache.ContextCache, key string, ttl time.Duration, opts ...Option) (*Token, error) {
+	o := options{retry: DefaultRetry, renew: true}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return tryLock(ctx, c, key, ttl, o)
+}
+
+func tryLock(ctx context.Context, c cache.ContextCache, key string, ttl time.Duration, o options) (*Token, error) {
+	b, adapter, err := backendOf(c)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 16)
+	if _, err = rand.Read(buf); err != nil {
+		return nil, err
+	}
+	tok := &Token{key: key, value: hex.EncodeToString(buf), ttl: ttl, b: b}
+	if fb, ok := b.(FencedBackend); ok {
+		fence, ok, err := fb.AcquireFenced(ctx, key, tok.value, ttl)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, ErrNotAcquired
+		}
+		tok.fence = fence
+	} else {
+		ok, err := b.Acquire(ctx, key, tok.value, ttl)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, ErrNotAcquired
+		}
+		if tok.fence, err = adapter.IncrBy(ctx, fenceKey(key), 1); err != nil {
+			_, _ = b.Release(ctx, key, tok.value)
+			return nil, err
+		}
+	}
+	tok.lost = make(chan struct{})
+	if o.renew {
+		tok.stop = make(chan struct{})
+		tok.stopped = make(chan struct{})
+		go tok.renew()
+	}
+	return tok, nil
+}
+
+// Token is a held lock.
+type Token struct {
+	key   string
+	value string
+	fence int64
+	ttl   time.Duration
+	b     Backend
+
+	stop     chan struct{} // closed by Unlock to stop the renewal
+	stopped  chan struct{} // closed when the renewal stopped
+	lost     chan struct{} // closed when the lock is not held anymore
+	lostOnce sync.Once
+	stopOnce sync.Once
+}
+
+// Key get the locked key
+func (t *Token) Key() string {
+	return t.key
+}
+
+// String get the random value identifying the owner
+func (t *Token) String() string {
+	return t.value
+}
+
+// Fence get the fencing number, it increases with each acquisition of the key.
+// the storage written under the lock rejects the writes with a number lower than the last one it saw.
+func (t *Token) Fence() int64 {
+	return t.fence
+}
+
+// Lost is closed when the lock is not held anymore, after Unlock or when it could not be renewed,
+// the owner must then stop its work.
+func (t *Token) Lost() <-chan struct{} {
+	return t.lost
+}
+
+func (t *Token) markLost() {
+	t.lostOnce.Do(func() {
+		close(t.lost)
+	})
+}
+
+// renew the lock every third of its ttl until Unlock, the errors are retried until the ttl passed
+func (t *Token) renew() {
+	defer close(t.stopped)
+	interval := t.ttl / 3
+	if interval <= 0 {
+		interval = time.Millisecond
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	renewed := time.Now()
+	for {
+		select {
+		case <-t.stop:
+			return
+		case <-ticker.C:
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		ok, err := t.b.Renew(ctx, t.key, t.value, t.ttl)
+		cancel()
+		switch {
+		case err == nil && ok:
+			renewed = time.Now()
+		case err == nil || time.Since(renewed) >= t.ttl:
+			t.markLost()
+			return
+		}
+	}
+}
+
+// stop the renewal and wait for it
+func (t *Token) stopRenewal() {
+	if t.stop == nil {
+		return
+	}
+	t.stopOnce.Do(func() {
+		close(t.stop)
+	})
+	<-t.stopped
+}
+
+// Refresh reset the ttl of the lock, it returns ErrNotHeld when the token does not own the lock anymore.
+func (t *Token) Refresh(ctx context.Context, ttl time.Duration) error {
+	ok, err := t.b.Renew(ctx, t.key, t.value, ttl)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		t.markLost()
+		return ErrNotHeld
+	}
+	return nil
+}
+
+// Unlock stop the renewal and release the lock,
+// it returns ErrNotHeld when the token does not own the lock anymore.
+func (t *Token) Unlock(ctx context.Context) error {
+	t.stopRenewal()
+	ok, err := t.b.Release(ctx, t.key, t.value)
+	if err != nil {
+		return err
+	}
+	t.markLost()
+	if !ok {
+		return ErrNotHeld
+	}
+	return nil
+}
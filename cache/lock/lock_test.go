@@ -0,0 +1,115 @@
+// Copyright 2019 asana Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lock
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/goasana/asana/cache"
+)
+
+func TestLock(t *testing.T) {
+	ctx := context.Background()
+	bm, err := cache.NewContextCache(cache.MemoryProvider, `{"interval":20}`)
+	if err != nil {
+		t.Fatal("init err", err)
+	}
+
+	tok, err := Lock(ctx, bm, "job", 30*time.Millisecond)
+	if err != nil {
+		t.Fatal("Lock err", err)
+	}
+	if _, err = TryLock(ctx, bm, "job", time.Second); err != ErrNotAcquired {
+		t.Error("TryLock held err", err)
+	}
+	// renewed past its ttl
+	time.Sleep(100 * time.Millisecond)
+	select {
+	case <-tok.Lost():
+		t.Error("lock lost")
+	default:
+	}
+	if ok, _ := bm.IsExist(ctx, "job"); !ok {
+		t.Error("renewal err")
+	}
+
+	wait, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if _, err = Lock(wait, bm, "job", time.Second); err != context.DeadlineExceeded {
+		t.Error("Lock wait err", err)
+	}
+
+	if err = tok.Unlock(ctx); err != nil {
+		t.Error("Unlock err", err)
+	}
+	if err = tok.Unlock(ctx); err != ErrNotHeld {
+		t.Error("Unlock twice err", err)
+	}
+
+	next, err := TryLock(ctx, bm, "job", 20*time.Millisecond, WithoutRenewal())
+	if err != nil {
+		t.Fatal("TryLock err", err)
+	}
+	if next.Fence() <= tok.Fence() {
+		t.Error("fence err", tok.Fence(), next.Fence())
+	}
+	time.Sleep(30 * time.Millisecond)
+	if err = next.Refresh(ctx, time.Second); err != ErrNotHeld {
+		t.Error("expired lock err", err)
+	}
+
+	fc, _ := cache.NewContextCache(cache.GCacheProvider, `{"size":10}`)
+	if _, err = Lock(ctx, fc, "job", time.Second); err != cache.ErrNotSupported {
+		t.Error("not supported err", err)
+	}
+}
+
+// backend assigning the fences with the acquisition
+type fencedCache struct {
+	*cache.MemoryCache
+	fence int64
+}
+
+func (c *fencedCache) AcquireFenced(ctx context.Context, key string, token string, ttl time.Duration) (int64, bool, error) {
+	ok, err := c.Acquire(ctx, key, token, ttl)
+	if err != nil || !ok {
+		return 0, false, err
+	}
+	c.fence += 10
+	return c.fence, true, nil
+}
+
+func TestFencedBackend(t *testing.T) {
+	ctx := context.Background()
+	bm, _ := cache.NewContextCache(cache.MemoryProvider, `{"interval":20}`)
+	fc := &fencedCache{MemoryCache: bm.(*cache.MemoryCache)}
+
+	for _, want := range []int64{10, 20} {
+		tok, err := TryLock(ctx, fc, "job", time.Second, WithoutRenewal())
+		if err != nil {
+			t.Fatal("TryLock err", err)
+		}
+		if tok.Fence() != want {
+			t.Error("fence", tok.Fence(), "want", want)
+		}
+		_ = tok.Unlock(ctx)
+	}
+	// the adapter counter is not used
+	if ok, _ := bm.IsExist(ctx, fenceKey("job")); ok {
+		t.Error("fence counter of the adapter used")
+	}
+}
@@ -30,7 +30,9 @@
 package memcache
 
 import (
+	"context"
 	"errors"
+	"strconv"
 	"strings"
 	"time"
 
@@ -45,118 +47,427 @@ type Cache struct {
 	connInfo []string
 }
 
-// NewMemCache create new memcache adapter.
+// NewMemCache create new memcache adapter served through the cache.Cache interface.
 func NewMemCache() cache.Cache {
+	return cache.ToCache(newMemCache())
+}
+
+func newMemCache() cache.ContextCache {
 	return &Cache{}
 }
 
+// convert the miss of memcache to cache.ErrCacheMiss
+func missErr(err error) error {
+	if err == memcache.ErrCacheMiss {
+		return cache.ErrCacheMiss
+	}
+	return err
+}
+
 // Get get value from memcache.
-func (rc *Cache) Get(key string) interface{} {
+func (rc *Cache) Get(ctx context.Context, key string) (interface{}, error) {
 	if rc.conn == nil {
 		if err := rc.connectInit(); err != nil {
-			return err
+			return nil, err
 		}
 	}
-	if item, err := rc.conn.Get(key); err == nil {
-		return item.Value
+	item, err := rc.conn.Get(key)
+	if err != nil {
+		return nil, missErr(err)
 	}
-	return nil
+	return rc.untag(item.Value)
 }
 
 // GetMulti get value from memcache.
-func (rc *Cache) GetMulti(keys []string) []interface{} {
-	size := len(keys)
-	var rv []interface{}
+func (rc *Cache) GetMulti(ctx context.Context, keys []string) ([]interface{}, []error) {
+	rv := make([]interface{}, len(keys))
+	errs := make([]error, len(keys))
+	fail := func(err error) ([]interface{}, []error) {
+		for i := range errs {
+			errs[i] = err
+		}
+		return rv, errs
+	}
 	if rc.conn == nil {
 		if err := rc.connectInit(); err != nil {
-			for i := 0; i < size; i++ {
-				rv = append(rv, err)
-			}
-			return rv
+			return fail(err)
 		}
 	}
 	mv, err := rc.conn.GetMulti(keys)
-	if err == nil {
-		for _, v := range mv {
-			rv = append(rv, v.Value)
+	if err != nil {
+		return fail(err)
+	}
+	for i, key := range keys {
+		if item, ok := mv[key]; ok {
+			rv[i], errs[i] = rc.untag(item.Value)
+		} else {
+			errs[i] = cache.ErrCacheMiss
 		}
-		return rv
 	}
-	for i := 0; i < size; i++ {
-		rv = append(rv, err)
+	return rv, errs
+}
+
+// get the expiration of memcache, in seconds
+func expiration(timeout time.Duration) int32 {
+	if timeout == 0 {
+		return 0
 	}
-	return rv
+	return int32(timeout / time.Second)
 }
 
 // Put put value to memcache.
-func (rc *Cache) Put(key string, val interface{}, timeout time.Duration) error {
+func (rc *Cache) Put(ctx context.Context, key string, val interface{}, timeout time.Duration) error {
+	if rc.conn == nil {
+		if err := rc.connectInit(); err != nil {
+			return err
+		}
+	}
+
+	value, err := itemValue(val)
+	if err != nil {
+		return err
+	}
+	return rc.conn.Set(&memcache.Item{Key: key, Value: value, Expiration: expiration(timeout)})
+}
+
+// get the bytes stored for val
+func itemValue(val interface{}) ([]byte, error) {
+	if v, ok := val.([]byte); ok {
+		return v, nil
+	} else if str, ok := val.(string); ok {
+		return []byte(str), nil
+	}
+	return nil, errors.New("val only support string and []byte")
+}
+
+// MultiConcurrency is the number of the concurrent requests of PutMulti and DeleteMulti,
+// the memcache protocol has no batch write.
+var MultiConcurrency = 8
+
+// run fn for the n indexes by MultiConcurrency workers, it returns the first error
+func parallel(ctx context.Context, n int, fn func(i int) error) error {
+	workers := MultiConcurrency
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > n {
+		workers = n
+	}
+	indexes := make(chan int)
+	errs := make(chan error, workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			var first error
+			for i := range indexes {
+				if first == nil {
+					first = fn(i)
+				}
+			}
+			errs <- first
+		}()
+	}
+	var err error
+	for i := 0; i < n && err == nil; i++ {
+		select {
+		case indexes <- i:
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+	}
+	close(indexes)
+	for w := 0; w < workers; w++ {
+		if werr := <-errs; err == nil {
+			err = werr
+		}
+	}
+	return err
+}
+
+// PutMulti put values to memcache by concurrent requests.
+// the values are checked before any is put.
+func (rc *Cache) PutMulti(ctx context.Context, items map[string]interface{}, timeout time.Duration) error {
 	if rc.conn == nil {
 		if err := rc.connectInit(); err != nil {
 			return err
 		}
 	}
+	list := make([]*memcache.Item, 0, len(items))
+	for key, val := range items {
+		value, err := itemValue(val)
+		if err != nil {
+			return err
+		}
+		list = append(list, &memcache.Item{Key: key, Value: value, Expiration: expiration(timeout)})
+	}
+	return parallel(ctx, len(list), func(i int) error {
+		return rc.conn.Set(list[i])
+	})
+}
 
-	var ttl int32
-	if timeout != 0 {
-		ttl = int32(timeout / time.Second)
+// get the value stored by PutWithTags, it is a miss once one of its tags is invalidated
+func (rc *Cache) untag(value []byte) (interface{}, error) {
+	versions, data, ok := cache.UnwrapTagged(value)
+	if !ok {
+		return value, nil
+	}
+	tags := make([]string, 0, len(versions))
+	for tag := range versions {
+		tags = append(tags, tag)
+	}
+	current, err := rc.tagVersions(tags)
+	if err != nil {
+		return nil, err
+	}
+	for tag, version := range versions {
+		if current[tag] != version {
+			return nil, cache.ErrCacheMiss
+		}
+	}
+	return data, nil
+}
+
+// get the current versions of the tags, the missing versions are added
+func (rc *Cache) tagVersions(tags []string) (map[string]string, error) {
+	keys := make([]string, len(tags))
+	for i, tag := range tags {
+		keys[i] = cache.TagVersionKey(tag)
+	}
+	mv, err := rc.conn.GetMulti(keys)
+	if err != nil {
+		return nil, err
+	}
+	versions := make(map[string]string, len(tags))
+	for i, tag := range tags {
+		if item, ok := mv[keys[i]]; ok {
+			versions[tag] = string(item.Value)
+			continue
+		}
+		version := cache.NewTagVersion()
+		err = rc.conn.Add(&memcache.Item{Key: keys[i], Value: []byte(version)})
+		if err == memcache.ErrNotStored {
+			// added by another client in the meantime
+			var item *memcache.Item
+			if item, err = rc.conn.Get(keys[i]); err == nil {
+				version = string(item.Value)
+			}
+		}
+		if err != nil {
+			return nil, missErr(err)
+		}
+		versions[tag] = version
+	}
+	return versions, nil
+}
+
+// PutWithTags put value to memcache with the current versions of its tags.
+func (rc *Cache) PutWithTags(ctx context.Context, key string, val interface{}, timeout time.Duration, tags ...string) error {
+	if len(tags) == 0 {
+		return rc.Put(ctx, key, val, timeout)
+	}
+	if rc.conn == nil {
+		if err := rc.connectInit(); err != nil {
+			return err
+		}
 	}
 
-	item := memcache.Item{Key: key, Expiration: ttl}
+	var data []byte
 	if v, ok := val.([]byte); ok {
-		item.Value = v
+		data = v
 	} else if str, ok := val.(string); ok {
-		item.Value = []byte(str)
+		data = []byte(str)
 	} else {
 		return errors.New("val only support string and []byte")
 	}
-	return rc.conn.Set(&item)
+	versions, err := rc.tagVersions(tags)
+	if err != nil {
+		return err
+	}
+	if data, err = cache.WrapTagged(versions, data); err != nil {
+		return err
+	}
+	return rc.conn.Set(&memcache.Item{Key: key, Value: data, Expiration: expiration(timeout)})
 }
 
-// Delete delete value in memcache.
-func (rc *Cache) Delete(key string) error {
+// InvalidateTags change the versions of the tags, so the values put with them become misses.
+// memcache cannot list the values, they expire or get evicted by themselves.
+func (rc *Cache) InvalidateTags(ctx context.Context, tags ...string) error {
 	if rc.conn == nil {
 		if err := rc.connectInit(); err != nil {
 			return err
 		}
 	}
-	return rc.conn.Delete(key)
+	for _, tag := range tags {
+		err := rc.conn.Set(&memcache.Item{Key: cache.TagVersionKey(tag), Value: []byte(cache.NewTagVersion())})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// get the expiration of a lock, memcache would keep a lock of less than a second forever
+func lockExpiration(ttl time.Duration) int32 {
+	if sec := expiration(ttl); sec > 0 {
+		return sec
+	}
+	return 1
+}
+
+// Acquire add token as the value of the lock key for ttl if the key is free.
+func (rc *Cache) Acquire(ctx context.Context, key string, token string, ttl time.Duration) (bool, error) {
+	if rc.conn == nil {
+		if err := rc.connectInit(); err != nil {
+			return false, err
+		}
+	}
+	err := rc.conn.Add(&memcache.Item{Key: key, Value: []byte(token), Expiration: lockExpiration(ttl)})
+	if err == memcache.ErrNotStored {
+		return false, nil
+	}
+	return err == nil, err
 }
 
-// Incr increase counter.
-func (rc *Cache) Incr(key string) error {
+// swap the lock key if token still owns it, a negative expiration deletes it
+func (rc *Cache) swapLock(key string, token string, exp int32) (bool, error) {
+	if rc.conn == nil {
+		if err := rc.connectInit(); err != nil {
+			return false, err
+		}
+	}
+	item, err := rc.conn.Get(key)
+	if err == memcache.ErrCacheMiss {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if string(item.Value) != token {
+		return false, nil
+	}
+	item.Expiration = exp
+	// the compare and swap fails if the lock changed since the get
+	err = rc.conn.CompareAndSwap(item)
+	if err == memcache.ErrCASConflict || err == memcache.ErrCacheMiss || err == memcache.ErrNotStored {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Renew reset the ttl of the lock key if token still owns it.
+func (rc *Cache) Renew(ctx context.Context, key string, token string, ttl time.Duration) (bool, error) {
+	return rc.swapLock(key, token, lockExpiration(ttl))
+}
+
+// Release delete the lock key if token still owns it.
+func (rc *Cache) Release(ctx context.Context, key string, token string) (bool, error) {
+	return rc.swapLock(key, token, -1)
+}
+
+// Delete delete value in memcache.
+func (rc *Cache) Delete(ctx context.Context, key string) error {
 	if rc.conn == nil {
 		if err := rc.connectInit(); err != nil {
 			return err
 		}
 	}
-	_, err := rc.conn.Increment(key, 1)
-	return err
+	return missErr(rc.conn.Delete(key))
 }
 
-// Decr decrease counter.
-func (rc *Cache) Decr(key string) error {
+// DeleteMulti delete values from memcache by concurrent requests, the missing keys are ignored.
+func (rc *Cache) DeleteMulti(ctx context.Context, keys []string) error {
 	if rc.conn == nil {
 		if err := rc.connectInit(); err != nil {
 			return err
 		}
 	}
-	_, err := rc.conn.Decrement(key, 1)
-	return err
+	return parallel(ctx, len(keys), func(i int) error {
+		if err := rc.conn.Delete(keys[i]); err != nil && err != memcache.ErrCacheMiss {
+			return err
+		}
+		return nil
+	})
+}
+
+// IncrBy increase counter and return the new value.
+// a missing counter is added with n, a negative n decreases the counter.
+func (rc *Cache) IncrBy(ctx context.Context, key string, n int64) (int64, error) {
+	if n < 0 {
+		return rc.DecrBy(ctx, key, -n)
+	}
+	if rc.conn == nil {
+		if err := rc.connectInit(); err != nil {
+			return 0, err
+		}
+	}
+	v, err := rc.conn.Increment(key, uint64(n))
+	if err == memcache.ErrCacheMiss {
+		err = rc.conn.Add(&memcache.Item{Key: key, Value: []byte(strconv.FormatInt(n, 10))})
+		if err == nil {
+			return n, nil
+		}
+		if err == memcache.ErrNotStored {
+			// added by another client in the meantime
+			v, err = rc.conn.Increment(key, uint64(n))
+		}
+	}
+	return int64(v), missErr(err)
+}
+
+// DecrBy decrease counter and return the new value.
+// memcache counters do not go below 0, a missing counter is added with 0.
+func (rc *Cache) DecrBy(ctx context.Context, key string, n int64) (int64, error) {
+	if n < 0 {
+		return rc.IncrBy(ctx, key, -n)
+	}
+	if rc.conn == nil {
+		if err := rc.connectInit(); err != nil {
+			return 0, err
+		}
+	}
+	v, err := rc.conn.Decrement(key, uint64(n))
+	if err == memcache.ErrCacheMiss {
+		err = rc.conn.Add(&memcache.Item{Key: key, Value: []byte("0")})
+		if err == nil {
+			return 0, nil
+		}
+		if err == memcache.ErrNotStored {
+			v, err = rc.conn.Decrement(key, uint64(n))
+		}
+	}
+	return int64(v), missErr(err)
 }
 
 // IsExist check value exists in memcache.
-func (rc *Cache) IsExist(key string) bool {
+func (rc *Cache) IsExist(ctx context.Context, key string) (bool, error) {
+	if rc.conn == nil {
+		if err := rc.connectInit(); err != nil {
+			return false, err
+		}
+	}
+	_, err := rc.Get(ctx, key)
+	if err == cache.ErrCacheMiss {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Touch reset the expiration of the value in memcache.
+func (rc *Cache) Touch(ctx context.Context, key string, timeout time.Duration) error {
 	if rc.conn == nil {
 		if err := rc.connectInit(); err != nil {
-			return false
+			return err
 		}
 	}
-	_, err := rc.conn.Get(key)
-	return err == nil
+	return missErr(rc.conn.Touch(key, expiration(timeout)))
+}
+
+// TTL is not supported, memcache does not report the expiration of the values.
+func (rc *Cache) TTL(ctx context.Context, key string) (time.Duration, error) {
+	return 0, cache.ErrNotSupported
 }
 
 // ClearAll clear all cached in memcache.
-func (rc *Cache) ClearAll() error {
+func (rc *Cache) ClearAll(ctx context.Context) error {
 	if rc.conn == nil {
 		if err := rc.connectInit(); err != nil {
 			return err
@@ -190,5 +501,5 @@ func (rc *Cache) connectInit() error {
 }
 
 func init() {
-	cache.Register(cache.MemCachedProvider, NewMemCache)
+	cache.RegisterContext(cache.MemCachedProvider, newMemCache)
 }
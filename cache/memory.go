@@ -15,8 +15,12 @@
 package cache
 
 import (
-	"errors"
+	"context"
+	"hash/fnv"
+	"reflect"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/goasana/config/encoder/json"
@@ -25,6 +29,8 @@ import (
 var (
 	// DefaultEvery means the clock time of recycling the expired cache items in memory.
 	DefaultEvery = 60 // 1 minute
+	// DefaultShards is the number of the shards of the memory cache, each one has its own lock.
+	DefaultShards = 16
 )
 
 // MemoryItem store memory cache item.
@@ -32,6 +38,8 @@ type MemoryItem struct {
 	val         interface{}
 	createdTime time.Time
 	lifespan    time.Duration
+	size        int64
+	tags        []string
 }
 
 func (mi *MemoryItem) isExpire() bool {
@@ -42,168 +50,509 @@ func (mi *MemoryItem) isExpire() bool {
 	return time.Now().Sub(mi.createdTime) > mi.lifespan
 }
 
+// number and size of the items of all the shards, the limits are checked against them
+type memoryTotals struct {
+	// updated atomically, first in the struct so they are 64-bit aligned on 32-bit platforms
+	entries int64
+	bytes   int64
+}
+
+// check whether the totals are over the limits, 0 means no limit
+func (t *memoryTotals) over(maxEntries int, maxBytes int64) bool {
+	return (maxEntries > 0 && atomic.LoadInt64(&t.entries) > int64(maxEntries)) ||
+		(maxBytes > 0 && atomic.LoadInt64(&t.bytes) > maxBytes)
+}
+
+// part of the keys of the memory cache, with its own lock, eviction policy and size
+type memoryShard struct {
+	sync.Mutex
+	items  map[string]*MemoryItem
+	tags   map[string]map[string]struct{} // keys of the tags
+	policy evictionPolicy
+	bytes  int64
+	totals *memoryTotals
+}
+
 // MemoryCache is Memory cache adapter.
-// it contains a RW locker for safe map storage.
+// the items are split in shards by key, each shard has its own lock.
+// the capacity is limited by the number of entries and by the approximate size of the entries,
+// the items over the limits are evicted by the lru, lfu or arc policy.
 type MemoryCache struct {
 	sync.RWMutex
-	dur   time.Duration
-	items map[string]*MemoryItem
-	Every int // run an expiration check Every clock time
+	dur    time.Duration
+	shards []*memoryShard
+	Every  int // run an expiration check Every clock time
+
+	MaxEntries int    // max number of entries, 0 means no limit
+	MaxBytes   int64  // max approximate size of the entries, 0 means no limit
+	Policy     string // eviction policy, lru, lfu or arc
+
+	// OnEvicted is called with the items evicted to respect the limits
+	OnEvicted func(key string, value interface{})
 }
 
-// NewMemoryCache returns a new MemoryCache.
+// NewMemoryCache returns a new MemoryCache served through the Cache interface.
 func NewMemoryCache() Cache {
-	cache := MemoryCache{items: make(map[string]*MemoryItem)}
+	return ToCache(newMemoryCache())
+}
+
+func newMemoryCache() ContextCache {
+	cache := MemoryCache{}
+	_ = cache.initShards(DefaultShards)
 	return &cache
 }
 
-// Get cache from memory.
-// if non-existed or expired, return nil.
-func (bc *MemoryCache) Get(name string) interface{} {
-	bc.RLock()
-	defer bc.RUnlock()
-	if itm, ok := bc.items[name]; ok {
-		if itm.isExpire() {
-			return nil
+// make n empty shards with the eviction policy of the cache
+func (bc *MemoryCache) initShards(n int) error {
+	if n < 1 {
+		n = 1
+	}
+	shards := make([]*memoryShard, n)
+	totals := &memoryTotals{}
+	for i := range shards {
+		policy, err := newEvictionPolicy(bc.Policy)
+		if err != nil {
+			return err
+		}
+		shards[i] = &memoryShard{
+			items:  make(map[string]*MemoryItem),
+			tags:   make(map[string]map[string]struct{}),
+			policy: policy,
+			totals: totals,
 		}
-		return itm.val
 	}
+	bc.Lock()
+	bc.shards = shards
+	bc.Unlock()
 	return nil
 }
 
+// get the shard of key
+func (bc *MemoryCache) shard(key string) *memoryShard {
+	bc.RLock()
+	shards := bc.shards
+	bc.RUnlock()
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return shards[h.Sum32()%uint32(len(shards))]
+}
+
+// get the item of name, nil if non-existed or expired.
+// it is called under the lock of the shard.
+func (s *memoryShard) item(name string) *MemoryItem {
+	itm, ok := s.items[name]
+	if !ok {
+		return nil
+	}
+	if itm.isExpire() {
+		s.remove(name, itm)
+		return nil
+	}
+	return itm
+}
+
+// store the item of name in the shard
+func (s *memoryShard) put(name string, itm *MemoryItem) {
+	if old, ok := s.items[name]; ok {
+		s.bytes -= old.size
+		atomic.AddInt64(&s.totals.bytes, -old.size)
+		s.untag(name, old)
+	} else {
+		atomic.AddInt64(&s.totals.entries, 1)
+	}
+	itm.size = approxSize(name, itm.val)
+	s.items[name] = itm
+	s.bytes += itm.size
+	atomic.AddInt64(&s.totals.bytes, itm.size)
+	s.policy.add(name)
+	for _, tag := range itm.tags {
+		if s.tags[tag] == nil {
+			s.tags[tag] = make(map[string]struct{})
+		}
+		s.tags[tag][name] = struct{}{}
+	}
+}
+
+// remove the item of name from the shard
+func (s *memoryShard) remove(name string, itm *MemoryItem) {
+	s.drop(name, itm)
+	s.policy.remove(name)
+}
+
+// delete the item of name from the shard and the totals, the policy is left to the caller
+func (s *memoryShard) drop(name string, itm *MemoryItem) {
+	delete(s.items, name)
+	s.bytes -= itm.size
+	atomic.AddInt64(&s.totals.entries, -1)
+	atomic.AddInt64(&s.totals.bytes, -itm.size)
+	s.untag(name, itm)
+}
+
+// remove the item of name from the index of its tags
+func (s *memoryShard) untag(name string, itm *MemoryItem) {
+	for _, tag := range itm.tags {
+		delete(s.tags[tag], name)
+		if len(s.tags[tag]) == 0 {
+			delete(s.tags, tag)
+		}
+	}
+}
+
+// evict the items of the shard while the cache is over the limits, they are returned for the eviction callback
+func (s *memoryShard) evict(maxEntries int, maxBytes int64) (evicted map[string]interface{}) {
+	for s.totals.over(maxEntries, maxBytes) {
+		key, ok := s.policy.victim()
+		if !ok {
+			return
+		}
+		itm, ok := s.items[key]
+		if !ok {
+			continue
+		}
+		s.drop(key, itm)
+		if evicted == nil {
+			evicted = make(map[string]interface{})
+		}
+		evicted[key] = itm.val
+	}
+	return
+}
+
+// evict the items over the limits of the cache, from the shard of the put first and then from the next ones.
+// each shard is locked in turn, it is called without the lock of any shard.
+func (bc *MemoryCache) evict(first *memoryShard) {
+	bc.RLock()
+	shards := bc.shards
+	maxEntries, maxBytes, onEvicted := bc.MaxEntries, bc.MaxBytes, bc.OnEvicted
+	bc.RUnlock()
+	if !first.totals.over(maxEntries, maxBytes) {
+		return
+	}
+
+	start := 0
+	for i, s := range shards {
+		if s == first {
+			start = i
+			break
+		}
+	}
+	for i := range shards {
+		s := shards[(start+i)%len(shards)]
+		s.Lock()
+		evicted := s.evict(maxEntries, maxBytes)
+		s.Unlock()
+
+		if onEvicted != nil {
+			for key, val := range evicted {
+				onEvicted(key, val)
+			}
+		}
+		if !s.totals.over(maxEntries, maxBytes) {
+			return
+		}
+	}
+}
+
+// Get cache from memory.
+// if non-existed or expired, return ErrCacheMiss.
+func (bc *MemoryCache) Get(ctx context.Context, name string) (interface{}, error) {
+	s := bc.shard(name)
+	s.Lock()
+	defer s.Unlock()
+	if itm := s.item(name); itm != nil {
+		s.policy.access(name)
+		return itm.val, nil
+	}
+	return nil, ErrCacheMiss
+}
+
 // GetMulti gets caches from memory.
-// if non-existed or expired, return nil.
-func (bc *MemoryCache) GetMulti(names []string) []interface{} {
-	var rc []interface{}
-	for _, name := range names {
-		rc = append(rc, bc.Get(name))
+// if non-existed or expired, the error of the key is ErrCacheMiss.
+func (bc *MemoryCache) GetMulti(ctx context.Context, names []string) ([]interface{}, []error) {
+	rc := make([]interface{}, len(names))
+	errs := make([]error, len(names))
+	for i, name := range names {
+		rc[i], errs[i] = bc.Get(ctx, name)
 	}
-	return rc
+	return rc, errs
 }
 
 // Put cache to memory.
-// if lifespan is 0, it will be forever till restart.
-func (bc *MemoryCache) Put(name string, value interface{}, lifespan time.Duration) error {
-	bc.Lock()
-	defer bc.Unlock()
-	bc.items[name] = &MemoryItem{
+// if lifespan is 0, it will be forever till restart or eviction.
+func (bc *MemoryCache) Put(ctx context.Context, name string, value interface{}, lifespan time.Duration) error {
+	return bc.PutWithTags(ctx, name, value, lifespan)
+}
+
+// PutWithTags put cache to memory with tags, they are indexed so InvalidateTags finds their items.
+func (bc *MemoryCache) PutWithTags(ctx context.Context, name string, value interface{}, lifespan time.Duration, tags ...string) error {
+	s := bc.shard(name)
+	s.Lock()
+	s.put(name, &MemoryItem{
 		val:         value,
 		createdTime: time.Now(),
 		lifespan:    lifespan,
-	}
+		tags:        tags,
+	})
+	s.Unlock()
+	bc.evict(s)
 	return nil
 }
 
-// Delete cache in memory.
-func (bc *MemoryCache) Delete(name string) error {
-	bc.Lock()
-	defer bc.Unlock()
-	if _, ok := bc.items[name]; !ok {
-		return errors.New("key not exist")
+// PutMulti put caches to memory, the items of a shard are put under one lock.
+func (bc *MemoryCache) PutMulti(ctx context.Context, items map[string]interface{}, lifespan time.Duration) error {
+	names := make([]string, 0, len(items))
+	for name := range items {
+		names = append(names, name)
 	}
-	delete(bc.items, name)
-	if _, ok := bc.items[name]; ok {
-		return errors.New("delete key error")
+	now := time.Now()
+	for s, names := range bc.byShard(names) {
+		s.Lock()
+		for _, name := range names {
+			s.put(name, &MemoryItem{val: items[name], createdTime: now, lifespan: lifespan})
+		}
+		s.Unlock()
+		bc.evict(s)
 	}
 	return nil
 }
 
-// Incr increase cache counter in memory.
-// it supports int,int32,int64,uint,uint32,uint64.
-func (bc *MemoryCache) Incr(key string) error {
-	bc.Lock()
-	defer bc.Unlock()
-	itm, ok := bc.items[key]
+// group the names by shard
+func (bc *MemoryCache) byShard(names []string) map[*memoryShard][]string {
+	groups := make(map[*memoryShard][]string)
+	for _, name := range names {
+		s := bc.shard(name)
+		groups[s] = append(groups[s], name)
+	}
+	return groups
+}
+
+// Acquire put token as the value of the lock key for ttl if the key is free.
+func (bc *MemoryCache) Acquire(ctx context.Context, key string, token string, ttl time.Duration) (bool, error) {
+	s := bc.shard(key)
+	s.Lock()
+	defer s.Unlock()
+	if s.item(key) != nil {
+		return false, nil
+	}
+	s.put(key, &MemoryItem{val: token, createdTime: time.Now(), lifespan: ttl})
+	return true, nil
+}
+
+// Renew reset the ttl of the lock key if token still owns it.
+func (bc *MemoryCache) Renew(ctx context.Context, key string, token string, ttl time.Duration) (bool, error) {
+	s := bc.shard(key)
+	s.Lock()
+	defer s.Unlock()
+	itm := s.item(key)
+	if itm == nil || itm.val != token {
+		return false, nil
+	}
+	itm.createdTime = time.Now()
+	itm.lifespan = ttl
+	return true, nil
+}
+
+// Release delete the lock key if token still owns it.
+func (bc *MemoryCache) Release(ctx context.Context, key string, token string) (bool, error) {
+	s := bc.shard(key)
+	s.Lock()
+	defer s.Unlock()
+	itm := s.item(key)
+	if itm == nil || itm.val != token {
+		return false, nil
+	}
+	s.remove(key, itm)
+	return true, nil
+}
+
+// Delete cache in memory.
+// if non-existed, return ErrCacheMiss.
+func (bc *MemoryCache) Delete(ctx context.Context, name string) error {
+	s := bc.shard(name)
+	s.Lock()
+	defer s.Unlock()
+	itm, ok := s.items[name]
 	if !ok {
-		return errors.New("key not exist")
-	}
-	switch val := itm.val.(type) {
-	case int:
-		itm.val = val + 1
-	case int32:
-		itm.val = val + 1
-	case int64:
-		itm.val = val + 1
-	case uint:
-		itm.val = val + 1
-	case uint32:
-		itm.val = val + 1
-	case uint64:
-		itm.val = val + 1
-	default:
-		return errors.New("item val is not (u)int (u)int32 (u)int64")
+		return ErrCacheMiss
 	}
+	s.remove(name, itm)
 	return nil
 }
 
-// Decr decrease counter in memory.
-func (bc *MemoryCache) Decr(key string) error {
-	bc.Lock()
-	defer bc.Unlock()
-	itm, ok := bc.items[key]
-	if !ok {
-		return errors.New("key not exist")
-	}
-	switch val := itm.val.(type) {
-	case int:
-		itm.val = val - 1
-	case int64:
-		itm.val = val - 1
-	case int32:
-		itm.val = val - 1
-	case uint:
-		if val > 0 {
-			itm.val = val - 1
-		} else {
-			return errors.New("item val is less than 0")
-		}
-	case uint32:
-		if val > 0 {
-			itm.val = val - 1
-		} else {
-			return errors.New("item val is less than 0")
+// DeleteMulti delete caches in memory, the non-existed names are ignored.
+func (bc *MemoryCache) DeleteMulti(ctx context.Context, names []string) error {
+	for s, names := range bc.byShard(names) {
+		s.Lock()
+		for _, name := range names {
+			if itm, ok := s.items[name]; ok {
+				s.remove(name, itm)
+			}
 		}
-	case uint64:
-		if val > 0 {
-			itm.val = val - 1
-		} else {
-			return errors.New("item val is less than 0")
-		}
-	default:
-		return errors.New("item val is not int int64 int32")
+		s.Unlock()
 	}
 	return nil
 }
 
+// IncrBy increase cache counter in memory and return the new value.
+// it supports the integer and float types, the value keeps its type.
+// a non-existed key is created as an int64 counter.
+func (bc *MemoryCache) IncrBy(ctx context.Context, key string, n int64) (int64, error) {
+	s := bc.shard(key)
+	s.Lock()
+	itm := s.item(key)
+	if itm == nil {
+		s.put(key, &MemoryItem{val: n, createdTime: time.Now()})
+		s.Unlock()
+		bc.evict(s)
+		return n, nil
+	}
+	defer s.Unlock()
+	val, num, err := incrValue(itm.val, n)
+	if err != nil {
+		return 0, err
+	}
+	itm.val = val
+	s.policy.access(key)
+	return num, nil
+}
+
+// DecrBy decrease counter in memory and return the new value.
+func (bc *MemoryCache) DecrBy(ctx context.Context, key string, n int64) (int64, error) {
+	return bc.IncrBy(ctx, key, -n)
+}
+
 // IsExist check cache exist in memory.
-func (bc *MemoryCache) IsExist(name string) bool {
+func (bc *MemoryCache) IsExist(ctx context.Context, name string) (bool, error) {
+	s := bc.shard(name)
+	s.Lock()
+	defer s.Unlock()
+	return s.item(name) != nil, nil
+}
+
+// Touch reset the lifespan of the cache in memory.
+func (bc *MemoryCache) Touch(ctx context.Context, name string, lifespan time.Duration) error {
+	s := bc.shard(name)
+	s.Lock()
+	defer s.Unlock()
+	itm := s.item(name)
+	if itm == nil {
+		return ErrCacheMiss
+	}
+	itm.createdTime = time.Now()
+	itm.lifespan = lifespan
+	return nil
+}
+
+// TTL get the remaining lifespan of the cache in memory.
+func (bc *MemoryCache) TTL(ctx context.Context, name string) (time.Duration, error) {
+	s := bc.shard(name)
+	s.Lock()
+	defer s.Unlock()
+	itm := s.item(name)
+	if itm == nil {
+		return 0, ErrCacheMiss
+	}
+	if itm.lifespan == 0 {
+		return 0, nil
+	}
+	return itm.lifespan - time.Now().Sub(itm.createdTime), nil
+}
+
+// InvalidateTags delete the caches of the tags in memory.
+func (bc *MemoryCache) InvalidateTags(ctx context.Context, tags ...string) error {
 	bc.RLock()
-	defer bc.RUnlock()
-	if v, ok := bc.items[name]; ok {
-		return !v.isExpire()
+	shards := bc.shards
+	bc.RUnlock()
+	for _, s := range shards {
+		s.Lock()
+		for _, tag := range tags {
+			for name := range s.tags[tag] {
+				s.remove(name, s.items[name])
+			}
+		}
+		s.Unlock()
 	}
-	return false
+	return nil
 }
 
-// ClearAll will delete all cache in memory.
-func (bc *MemoryCache) ClearAll() error {
-	bc.Lock()
-	defer bc.Unlock()
-	bc.items = make(map[string]*MemoryItem)
+// DeletePrefix delete the caches whose name starts with prefix in memory.
+func (bc *MemoryCache) DeletePrefix(ctx context.Context, prefix string) error {
+	bc.RLock()
+	shards := bc.shards
+	bc.RUnlock()
+	for _, s := range shards {
+		s.Lock()
+		for name, itm := range s.items {
+			if strings.HasPrefix(name, prefix) {
+				s.remove(name, itm)
+			}
+		}
+		s.Unlock()
+	}
 	return nil
 }
 
+// ClearAll will delete all cache in memory.
+func (bc *MemoryCache) ClearAll(ctx context.Context) error {
+	bc.RLock()
+	n := len(bc.shards)
+	bc.RUnlock()
+	return bc.initShards(n)
+}
+
+// Len get the number of the items in memory, the expired items not collected yet included.
+func (bc *MemoryCache) Len() int {
+	bc.RLock()
+	shards := bc.shards
+	bc.RUnlock()
+	n := 0
+	for _, s := range shards {
+		s.Lock()
+		n += len(s.items)
+		s.Unlock()
+	}
+	return n
+}
+
+// Bytes get the approximate size of the items in memory.
+func (bc *MemoryCache) Bytes() int64 {
+	bc.RLock()
+	shards := bc.shards
+	bc.RUnlock()
+	var n int64
+	for _, s := range shards {
+		s.Lock()
+		n += s.bytes
+		s.Unlock()
+	}
+	return n
+}
+
 // StartAndGC start memory cache. it will check expiration in every clock time.
+// config is like {"interval":60,"shards":16,"maxEntries":10000,"maxBytes":67108864,"policy":"lru"},
+// the limits apply to all the shards together.
 func (bc *MemoryCache) StartAndGC(config string) error {
-	var cf map[string]int
+	var cf map[string]interface{}
 	_ = json.Decode([]byte(config), &cf)
-	if _, ok := cf["interval"]; !ok {
-		cf = make(map[string]int)
-		cf["interval"] = DefaultEvery
+	every := DefaultEvery
+	if _, ok := cf["interval"]; ok {
+		every = GetInt(cf["interval"])
+	}
+	shards := DefaultShards
+	if _, ok := cf["shards"]; ok {
+		shards = GetInt(cf["shards"])
+	}
+
+	bc.Lock()
+	bc.Every = every
+	bc.dur = time.Duration(every) * time.Second
+	bc.MaxEntries = GetInt(cf["maxEntries"])
+	bc.MaxBytes = int64(GetFloat64(cf["maxBytes"]))
+	bc.Policy = GetString(cf["policy"])
+	bc.Unlock()
+	if err := bc.initShards(shards); err != nil {
+		return err
 	}
-	dur := time.Duration(cf["interval"]) * time.Second
-	bc.Every = cf["interval"]
-	bc.dur = dur
 	go bc.vacuum()
 	return nil
 }
@@ -220,38 +569,79 @@ func (bc *MemoryCache) vacuum() {
 	for {
 		<-time.After(bc.dur)
 		bc.RLock()
-		if bc.items == nil {
-			bc.RUnlock()
+		shards := bc.shards
+		bc.RUnlock()
+		if shards == nil {
 			return
 		}
-		bc.RUnlock()
-		if keys := bc.expiredKeys(); len(keys) != 0 {
-			bc.clearItems(keys)
+		for _, s := range shards {
+			s.clearExpired()
 		}
 	}
 }
 
-// expiredKeys returns key list which are expired.
-func (bc *MemoryCache) expiredKeys() (keys []string) {
-	bc.RLock()
-	defer bc.RUnlock()
-	for key, itm := range bc.items {
+// clearExpired removes the expired items of the shard.
+func (s *memoryShard) clearExpired() {
+	s.Lock()
+	defer s.Unlock()
+	for key, itm := range s.items {
 		if itm.isExpire() {
-			keys = append(keys, key)
+			s.remove(key, itm)
 		}
 	}
-	return
 }
 
-// clearItems removes all the items which key in keys.
-func (bc *MemoryCache) clearItems(keys []string) {
-	bc.Lock()
-	defer bc.Unlock()
-	for _, key := range keys {
-		delete(bc.items, key)
+// approximate memory size of an item, the key, the value and a fixed overhead
+func approxSize(key string, val interface{}) int64 {
+	const overhead = 64
+	return overhead + int64(len(key)) + valueSize(reflect.ValueOf(val), 0)
+}
+
+// approximate memory size of a value, the pointers are followed to a limited depth
+func valueSize(v reflect.Value, depth int) int64 {
+	if !v.IsValid() || depth > 8 {
+		return 0
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return int64(v.Type().Size()) + int64(v.Len())
+	case reflect.Slice:
+		n := int64(v.Type().Size())
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return n + int64(v.Len())
+		}
+		for i := 0; i < v.Len(); i++ {
+			n += valueSize(v.Index(i), depth+1)
+		}
+		return n
+	case reflect.Array:
+		var n int64
+		for i := 0; i < v.Len(); i++ {
+			n += valueSize(v.Index(i), depth+1)
+		}
+		return n
+	case reflect.Map:
+		n := int64(v.Type().Size())
+		iter := v.MapRange()
+		for iter.Next() {
+			n += valueSize(iter.Key(), depth+1) + valueSize(iter.Value(), depth+1)
+		}
+		return n
+	case reflect.Struct:
+		var n int64
+		for i := 0; i < v.NumField(); i++ {
+			n += valueSize(v.Field(i), depth+1)
+		}
+		return n
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return int64(v.Type().Size())
+		}
+		return int64(v.Type().Size()) + valueSize(v.Elem(), depth+1)
 	}
+	return int64(v.Type().Size())
 }
 
 func init() {
-	Register(MemoryProvider, NewMemoryCache)
+	RegisterContext(MemoryProvider, newMemoryCache)
 }
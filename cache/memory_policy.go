@@ -0,0 +1,252 @@
+// Copyright 2019 asana Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"container/heap"
+	"container/list"
+	"fmt"
+)
+
+// Eviction policies of the memory cache
+const (
+	EvictLRU = "lru"
+	EvictLFU = "lfu"
+	EvictARC = "arc"
+)
+
+// evictionPolicy chooses the keys evicted when a shard of the memory cache is full.
+// it is called under the lock of the shard.
+type evictionPolicy interface {
+	// a key is stored
+	add(key string)
+	// a key is read
+	access(key string)
+	// a key is deleted or expired
+	remove(key string)
+	// choose the key to evict and forget it
+	victim() (string, bool)
+}
+
+func newEvictionPolicy(name string) (evictionPolicy, error) {
+	switch name {
+	case "", EvictLRU:
+		return newLRUList(), nil
+	case EvictLFU:
+		return &lfuPolicy{items: make(map[string]*lfuEntry)}, nil
+	case EvictARC:
+		return &arcPolicy{t1: newLRUList(), t2: newLRUList(), b1: newLRUList(), b2: newLRUList()}, nil
+	}
+	return nil, fmt.Errorf("cache: unknown eviction policy %q", name)
+}
+
+// keys from the most to the least recently used
+type lruList struct {
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+func newLRUList() *lruList {
+	return &lruList{ll: list.New(), items: make(map[string]*list.Element)}
+}
+
+func (l *lruList) has(key string) bool {
+	_, ok := l.items[key]
+	return ok
+}
+
+func (l *lruList) len() int {
+	return l.ll.Len()
+}
+
+func (l *lruList) add(key string) {
+	if e, ok := l.items[key]; ok {
+		l.ll.MoveToFront(e)
+		return
+	}
+	l.items[key] = l.ll.PushFront(key)
+}
+
+func (l *lruList) access(key string) {
+	if e, ok := l.items[key]; ok {
+		l.ll.MoveToFront(e)
+	}
+}
+
+func (l *lruList) remove(key string) {
+	if e, ok := l.items[key]; ok {
+		l.ll.Remove(e)
+		delete(l.items, key)
+	}
+}
+
+func (l *lruList) victim() (string, bool) {
+	e := l.ll.Back()
+	if e == nil {
+		return "", false
+	}
+	key := e.Value.(string)
+	l.ll.Remove(e)
+	delete(l.items, key)
+	return key, true
+}
+
+// least frequently used keys, the least recently added first among the same frequency
+type lfuPolicy struct {
+	seq   int64
+	heap  lfuHeap
+	items map[string]*lfuEntry
+}
+
+type lfuEntry struct {
+	key   string
+	freq  int64
+	seq   int64
+	index int
+}
+
+type lfuHeap []*lfuEntry
+
+func (h lfuHeap) Len() int { return len(h) }
+func (h lfuHeap) Less(i, j int) bool {
+	if h[i].freq != h[j].freq {
+		return h[i].freq < h[j].freq
+	}
+	return h[i].seq < h[j].seq
+}
+func (h lfuHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+func (h *lfuHeap) Push(x interface{}) {
+	e := x.(*lfuEntry)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+func (h *lfuHeap) Pop() interface{} {
+	old := *h
+	e := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return e
+}
+
+func (p *lfuPolicy) add(key string) {
+	p.seq++
+	if e, ok := p.items[key]; ok {
+		e.freq++
+		e.seq = p.seq
+		heap.Fix(&p.heap, e.index)
+		return
+	}
+	e := &lfuEntry{key: key, freq: 1, seq: p.seq}
+	p.items[key] = e
+	heap.Push(&p.heap, e)
+}
+
+func (p *lfuPolicy) access(key string) {
+	if e, ok := p.items[key]; ok {
+		e.freq++
+		heap.Fix(&p.heap, e.index)
+	}
+}
+
+func (p *lfuPolicy) remove(key string) {
+	if e, ok := p.items[key]; ok {
+		heap.Remove(&p.heap, e.index)
+		delete(p.items, key)
+	}
+}
+
+func (p *lfuPolicy) victim() (string, bool) {
+	if len(p.heap) == 0 {
+		return "", false
+	}
+	e := heap.Pop(&p.heap).(*lfuEntry)
+	delete(p.items, e.key)
+	return e.key, true
+}
+
+// adaptive replacement: t1 holds the keys read once and t2 the keys read again,
+// the ghosts b1 and b2 of their evicted keys move the target size p of t1.
+type arcPolicy struct {
+	p              int
+	t1, t2, b1, b2 *lruList
+}
+
+func (p *arcPolicy) add(key string) {
+	switch {
+	case p.t1.has(key) || p.t2.has(key):
+		p.access(key)
+	case p.b1.has(key):
+		// evicted from t1 too early, grow t1
+		p.p = minInt(p.p+maxInt(1, p.b2.len()/maxInt(1, p.b1.len())), p.t1.len()+p.t2.len()+1)
+		p.b1.remove(key)
+		p.t2.add(key)
+	case p.b2.has(key):
+		// evicted from t2 too early, shrink t1
+		p.p = maxInt(p.p-maxInt(1, p.b1.len()/maxInt(1, p.b2.len())), 0)
+		p.b2.remove(key)
+		p.t2.add(key)
+	default:
+		p.t1.add(key)
+	}
+}
+
+func (p *arcPolicy) access(key string) {
+	if p.t1.has(key) {
+		p.t1.remove(key)
+		p.t2.add(key)
+		return
+	}
+	p.t2.access(key)
+}
+
+func (p *arcPolicy) remove(key string) {
+	p.t1.remove(key)
+	p.t2.remove(key)
+}
+
+func (p *arcPolicy) victim() (key string, ok bool) {
+	if p.t1.len() > 0 && (p.t1.len() > p.p || p.t2.len() == 0) {
+		key, ok = p.t1.victim()
+		p.b1.add(key)
+	} else if key, ok = p.t2.victim(); ok {
+		p.b2.add(key)
+	}
+	// the ghosts remember as many keys as the cache holds
+	for size := p.t1.len() + p.t2.len(); p.b1.len()+p.b2.len() > size; {
+		if p.b1.len() > p.b2.len() {
+			p.b1.victim()
+		} else {
+			p.b2.victim()
+		}
+	}
+	return key, ok
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,60 @@
+// Copyright 2019 asana Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ratelimit provides rate limiters shared by the replicas through the cache adapters.
+//
+// TokenBucket refills a bucket at a steady rate and allows bursts up to its size.
+// SlidingWindow allows a number of requests in any window of time,
+// weighting the counter of the previous fixed window by its overlap with the sliding one.
+//
+// Usage:
+//
+//	bm, err := cache.NewContextCache(cache.RedisProvider, `{"conn":"127.0.0.1:6379"}`)
+//	limiter := ratelimit.NewSlidingWindow(bm, 100, time.Minute)
+//	res, err := limiter.Allow(ctx, "api:"+clientIP)
+//	if err == nil && !res.Allowed {
+//		w.Header().Set("Retry-After", strconv.Itoa(int(res.RetryAfter.Seconds())+1))
+//		w.WriteHeader(http.StatusTooManyRequests)
+//	}
+package ratelimit
+
+import (
+	"context"
+	"time"
+)
+
+// KeyPrefix is prepended to the keys of the limiters in the cache.
+var KeyPrefix = "asanaRateLimit:"
+
+// Result of a request to a limiter.
+type Result struct {
+	// the requests are allowed
+	Allowed bool
+	// number of requests still allowed now
+	Remaining int64
+	// wait before the denied requests may be allowed
+	RetryAfter time.Duration
+}
+
+// Limiter limits the rate of the requests of the keys.
+type Limiter interface {
+	// take n requests of key.
+	AllowN(ctx context.Context, key string, n int64) (Result, error)
+}
+
+// Scripter is implemented by the adapters running lua scripts atomically, as the redis adapter does,
+// the limiters then keep their state in one round trip.
+type Scripter interface {
+	Eval(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error)
+}
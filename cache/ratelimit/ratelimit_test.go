@@ -0,0 +1,97 @@
+// Copyright 2019 asana Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/goasana/asana/cache"
+)
+
+func TestTokenBucket(t *testing.T) {
+	ctx := context.Background()
+	bm, err := cache.NewContextCache(cache.MemoryProvider, `{"interval":20}`)
+	if err != nil {
+		t.Fatal("init err", err)
+	}
+	tb := NewTokenBucket(bm, 10, 5)
+
+	var allowed int64
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := tb.Allow(ctx, "api")
+			if err != nil {
+				t.Error("Allow err", err)
+			}
+			if res.Allowed {
+				atomic.AddInt64(&allowed, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	// the burst and at most a token refilled meanwhile
+	if allowed < 5 || allowed > 6 {
+		t.Error("burst err", allowed)
+	}
+
+	res, _ := tb.AllowN(ctx, "api", 3)
+	if res.Allowed || res.RetryAfter <= 0 || res.RetryAfter > 300*time.Millisecond {
+		t.Error("denied err", res)
+	}
+	time.Sleep(res.RetryAfter + 10*time.Millisecond)
+	if res, _ = tb.AllowN(ctx, "api", 3); !res.Allowed {
+		t.Error("refill err", res)
+	}
+}
+
+func TestSlidingWindow(t *testing.T) {
+	ctx := context.Background()
+	bm, err := cache.NewContextCache(cache.MemoryProvider, `{"interval":20}`)
+	if err != nil {
+		t.Fatal("init err", err)
+	}
+	sw := NewSlidingWindow(bm, 3, time.Hour)
+	for i := int64(0); i < 3; i++ {
+		res, err := sw.Allow(ctx, "api")
+		if err != nil || !res.Allowed || res.Remaining != 2-i {
+			t.Error("Allow err", i, res, err)
+		}
+	}
+	res, err := sw.Allow(ctx, "api")
+	if err != nil || res.Allowed || res.Remaining != 0 || res.RetryAfter <= 0 {
+		t.Error("denied err", res, err)
+	}
+	// the denied requests are not counted
+	if res, _ = sw.Allow(ctx, "other"); !res.Allowed {
+		t.Error("other key err", res)
+	}
+
+	sw = NewSlidingWindow(bm, 2, 100*time.Millisecond)
+	_, _ = sw.AllowN(ctx, "short", 2)
+	if res, _ = sw.Allow(ctx, "short"); res.Allowed {
+		t.Error("limit err", res)
+	}
+	time.Sleep(res.RetryAfter + 10*time.Millisecond)
+	if res, _ = sw.Allow(ctx, "short"); !res.Allowed {
+		t.Error("slide err", res)
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright 2019 asana Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/goasana/asana/cache"
+)
+
+// SlidingWindow allows Limit requests in any Window of time.
+// the requests are counted by fixed windows with the atomic counters of the adapter,
+// the counter of the previous window is weighted by its overlap with the sliding window.
+type SlidingWindow struct {
+	c      cache.ContextCache
+	Limit  int64
+	Window time.Duration
+}
+
+// NewSlidingWindow create a SlidingWindow of c allowing limit requests in any window of time.
+func NewSlidingWindow(c cache.ContextCache, limit int64, window time.Duration) *SlidingWindow {
+	return &SlidingWindow{c: cache.Unwrap(c), Limit: limit, Window: window}
+}
+
+// Allow take a request of key.
+func (sw *SlidingWindow) Allow(ctx context.Context, key string) (Result, error) {
+	return sw.AllowN(ctx, key, 1)
+}
+
+// AllowN take n requests of key, the denied requests are not counted.
+func (sw *SlidingWindow) AllowN(ctx context.Context, key string, n int64) (Result, error) {
+	now := time.Now().UnixNano()
+	window := int64(sw.Window)
+	index := now / window
+	// part of the current fixed window elapsed, the previous one overlaps the rest of the sliding window
+	elapsed := float64(now-index*window) / float64(window)
+	curKey := KeyPrefix + key + ":" + strconv.FormatInt(index, 10)
+	prevKey := KeyPrefix + key + ":" + strconv.FormatInt(index-1, 10)
+
+	var prev int64
+	if v, err := sw.c.Get(ctx, prevKey); err == nil {
+		prev = cache.GetInt64(v)
+	} else if err != cache.ErrCacheMiss {
+		return Result{}, err
+	}
+	cur, err := sw.c.IncrBy(ctx, curKey, n)
+	if err != nil {
+		return Result{}, err
+	}
+	if cur == n {
+		// first requests of the window, it is read as the previous one by the next window
+		if err = sw.c.Touch(ctx, curKey, 2*sw.Window); err != nil {
+			return Result{}, err
+		}
+	}
+
+	weighted := float64(prev) * (1 - elapsed)
+	count := int64(math.Ceil(weighted)) + cur
+	if count <= sw.Limit {
+		return Result{Allowed: true, Remaining: sw.Limit - count}, nil
+	}
+
+	if _, err = sw.c.DecrBy(ctx, curKey, n); err != nil {
+		return Result{}, err
+	}
+	var res Result
+	if left := sw.Limit - cur; left > 0 && prev > 0 {
+		// the weight of the previous window decreases until the requests fit
+		until := 1 - float64(left)/float64(prev)
+		res.RetryAfter = time.Duration(math.Max(0, until-elapsed) * float64(window))
+	} else {
+		// the current window becomes the previous one, its weight decreases until the requests fit
+		var until float64
+		if counted := cur - n; counted > 0 {
+			until = math.Max(0, 1-float64(sw.Limit-n)/float64(counted))
+		}
+		res.RetryAfter = time.Duration((1 - elapsed + until) * float64(window))
+	}
+	if remaining := sw.Limit - (count - n); remaining > 0 {
+		res.Remaining = remaining
+	}
+	return res, nil
+}
@@ -0,0 +1,150 @@
+// Copyright 2019 asana Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/goasana/asana/cache"
+	"github.com/goasana/asana/cache/lock"
+)
+
+// TokenBucket refills Burst tokens at Rate tokens per second, each request takes a token.
+// on the adapters without lua scripts the state of a key is read and written under a lock of the key.
+type TokenBucket struct {
+	c     cache.ContextCache
+	Rate  float64
+	Burst int64
+}
+
+// NewTokenBucket create a TokenBucket of c refilling burst tokens at rate tokens per second.
+func NewTokenBucket(c cache.ContextCache, rate float64, burst int64) *TokenBucket {
+	return &TokenBucket{c: cache.Unwrap(c), Rate: rate, Burst: burst}
+}
+
+// Allow take a token of key.
+func (tb *TokenBucket) Allow(ctx context.Context, key string) (Result, error) {
+	return tb.AllowN(ctx, key, 1)
+}
+
+// refill the bucket since the last request in milliseconds and take n tokens
+var tokenBucketScript = `
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local n = tonumber(ARGV[4])
+local state = redis.call("hmget", KEYS[1], "tokens", "ts")
+local tokens = tonumber(state[1])
+local ts = tonumber(state[2])
+if tokens == nil then
+	tokens = burst
+	ts = now
+end
+tokens = math.min(burst, tokens + math.max(0, now - ts) * rate / 1000)
+local allowed = 0
+if tokens >= n then
+	tokens = tokens - n
+	allowed = 1
+end
+redis.call("hmset", KEYS[1], "tokens", tostring(tokens), "ts", now)
+redis.call("pexpire", KEYS[1], math.ceil(burst / rate * 1000) + 1000)
+return {allowed, tostring(tokens)}`
+
+// AllowN take n tokens of key.
+func (tb *TokenBucket) AllowN(ctx context.Context, key string, n int64) (Result, error) {
+	if tb.Rate <= 0 {
+		return Result{}, fmt.Errorf("ratelimit: bad rate %v", tb.Rate)
+	}
+	key = KeyPrefix + key
+	now := time.Now()
+
+	if s, ok := tb.c.(Scripter); ok {
+		v, err := s.Eval(ctx, tokenBucketScript, []string{key}, tb.Rate, tb.Burst, now.UnixNano()/int64(time.Millisecond), n)
+		if err != nil {
+			return Result{}, err
+		}
+		reply, _ := v.([]interface{})
+		if len(reply) != 2 {
+			return Result{}, fmt.Errorf("ratelimit: bad reply %v", v)
+		}
+		tokens, err := strconv.ParseFloat(cache.GetString(reply[1]), 64)
+		if err != nil {
+			return Result{}, err
+		}
+		return tb.result(cache.GetInt64(reply[0]) == 1, tokens, n), nil
+	}
+
+	tok, err := lock.Lock(ctx, tb.c, key+":lock", time.Second, lock.WithoutRenewal(), lock.WithRetry(5*time.Millisecond))
+	if err != nil {
+		return Result{}, err
+	}
+	defer func() {
+		_ = tok.Unlock(ctx)
+	}()
+
+	tokens, last := float64(tb.Burst), now
+	if v, err := tb.c.Get(ctx, key); err == nil {
+		tokens, last = parseBucket(cache.GetString(v), tokens, now)
+	} else if err != cache.ErrCacheMiss {
+		return Result{}, err
+	}
+	if elapsed := now.Sub(last); elapsed > 0 {
+		tokens = math.Min(float64(tb.Burst), tokens+elapsed.Seconds()*tb.Rate)
+	}
+	allowed := tokens >= float64(n)
+	if allowed {
+		tokens -= float64(n)
+	}
+	state := strconv.FormatFloat(tokens, 'f', -1, 64) + " " + strconv.FormatInt(now.UnixNano(), 10)
+	if err = tb.c.Put(ctx, key, state, tb.fullAfter()+time.Second); err != nil {
+		return Result{}, err
+	}
+	return tb.result(allowed, tokens, n), nil
+}
+
+// parse the tokens and the time of the last request stored as "tokens unixnano"
+func parseBucket(s string, tokens float64, last time.Time) (float64, time.Time) {
+	fields := strings.Fields(s)
+	if len(fields) != 2 {
+		return tokens, last
+	}
+	t, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return tokens, last
+	}
+	ns, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return tokens, last
+	}
+	return t, time.Unix(0, ns)
+}
+
+// get the time an empty bucket takes to be full
+func (tb *TokenBucket) fullAfter() time.Duration {
+	return time.Duration(float64(tb.Burst) / tb.Rate * float64(time.Second))
+}
+
+func (tb *TokenBucket) result(allowed bool, tokens float64, n int64) Result {
+	res := Result{Allowed: allowed, Remaining: int64(tokens)}
+	if !allowed {
+		res.RetryAfter = time.Duration((float64(n) - tokens) / tb.Rate * float64(time.Second))
+	}
+	return res
+}
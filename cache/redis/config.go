@@ -0,0 +1,240 @@
+// Copyright 2019 asana Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redis
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/go-redis/redis"
+	"github.com/goasana/asana/cache"
+)
+
+// Modes of the redis topology
+const (
+	ModeSingle   = "single"
+	ModeCluster  = "cluster"
+	ModeSentinel = "sentinel"
+)
+
+var (
+	// DefaultPoolSize the pool size of the connections to each redis node.
+	DefaultPoolSize = 100
+	// DefaultMasterName the master name of the sentinel mode.
+	DefaultMasterName = "mymaster"
+)
+
+// topology and credentials of the redis servers
+type config struct {
+	mode            string
+	addrs           []string
+	poolSize        int
+	username        string
+	password        string
+	dbNum           int
+	masterName      string
+	tls             *tls.Config
+	readFromReplica bool
+}
+
+// parse the conn of the config, it is an address, a redis:// url
+// or the save path of the redis session providers, like
+// 127.0.0.1:6379;127.0.0.1:6380,100,password,0,mymaster
+// which is the addresses, the pool size, the password, the db number and the master name.
+func (c *config) parseConn(conn string) error {
+	fields := strings.Split(conn, ",")
+	addrs := fields[0]
+	// Format redis://<password>@<host>:<port>
+	addrs = strings.Replace(addrs, "redis://", "", 1)
+	if i := strings.LastIndex(addrs, "@"); i > -1 {
+		c.password = addrs[0:i]
+		addrs = addrs[i+1:]
+	}
+	c.addrs = strings.Split(addrs, ";")
+	if len(fields) > 1 && fields[1] != "" {
+		n, err := strconv.Atoi(fields[1])
+		if err != nil || n < 0 {
+			return fmt.Errorf("redis: bad pool size %q", fields[1])
+		}
+		c.poolSize = n
+	}
+	if len(fields) > 2 && fields[2] != "" {
+		c.password = fields[2]
+	}
+	if len(fields) > 3 && fields[3] != "" {
+		n, err := strconv.Atoi(fields[3])
+		if err != nil || n < 0 {
+			return fmt.Errorf("redis: bad db number %q", fields[3])
+		}
+		c.dbNum = n
+	}
+	if len(fields) > 4 && fields[4] != "" {
+		c.masterName = fields[4]
+	}
+	return nil
+}
+
+// read the config of the adapter, the keys override the fields of conn
+func parseConfig(cf map[string]interface{}) (*config, error) {
+	conn := cache.GetString(cf["conn"])
+	if conn == "" {
+		return nil, errors.New("config has no conn key")
+	}
+	c := &config{poolSize: DefaultPoolSize, masterName: DefaultMasterName}
+	if err := c.parseConn(conn); err != nil {
+		return nil, err
+	}
+
+	c.mode = cache.GetString(cf["mode"])
+	switch c.mode {
+	case "":
+		c.mode = ModeSingle
+	case ModeSingle, ModeCluster, ModeSentinel:
+	default:
+		return nil, fmt.Errorf("redis: unknown mode %q", c.mode)
+	}
+	if v, ok := cf["poolSize"]; ok {
+		c.poolSize = cache.GetInt(v)
+	}
+	if v, ok := cf["password"]; ok {
+		c.password = cache.GetString(v)
+	}
+	if v, ok := cf["dbNum"]; ok {
+		c.dbNum = cache.GetInt(v)
+	}
+	if v, ok := cf["masterName"]; ok {
+		c.masterName = cache.GetString(v)
+	}
+	c.username = cache.GetString(cf["username"])
+	c.readFromReplica = cache.GetBool(cf["readFromReplica"])
+
+	if cache.GetBool(cf["tls"]) {
+		c.tls = &tls.Config{
+			ServerName:         cache.GetString(cf["tlsServerName"]),
+			InsecureSkipVerify: cache.GetBool(cf["tlsSkipVerify"]),
+		}
+		if ca := cache.GetString(cf["tlsCA"]); ca != "" {
+			pem, err := ioutil.ReadFile(ca)
+			if err != nil {
+				return nil, err
+			}
+			c.tls.RootCAs = x509.NewCertPool()
+			if !c.tls.RootCAs.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("redis: no certificate in %s", ca)
+			}
+		}
+	}
+	return c, nil
+}
+
+// authenticate the connections with the acl user, go-redis only sends the password
+func (c *config) onConnect(cn *redis.Conn) error {
+	return cn.Do("auth", c.username, c.password).Err()
+}
+
+// get the password given to go-redis, it is sent by onConnect with an acl user
+func (c *config) clientPassword() string {
+	if c.username != "" {
+		return ""
+	}
+	return c.password
+}
+
+// options of a client of a single node
+func (c *config) options(addr string) *redis.Options {
+	opt := &redis.Options{
+		Addr:      addr,
+		DB:        c.dbNum,
+		Password:  c.clientPassword(),
+		PoolSize:  c.poolSize,
+		TLSConfig: c.tls,
+	}
+	if c.username != "" {
+		opt.OnConnect = c.onConnect
+	}
+	return opt
+}
+
+// connect to the servers, the replica client is nil when the reads go to the master
+func (c *config) dial() (client redis.UniversalClient, replica *redis.Client, err error) {
+	switch c.mode {
+	case ModeCluster:
+		opt := &redis.ClusterOptions{
+			Addrs:     c.addrs,
+			Password:  c.clientPassword(),
+			PoolSize:  c.poolSize,
+			TLSConfig: c.tls,
+			// the read only commands are routed to the replicas of the slots
+			ReadOnly: c.readFromReplica,
+		}
+		if c.username != "" {
+			opt.OnConnect = c.onConnect
+		}
+		return redis.NewClusterClient(opt), nil, nil
+	case ModeSentinel:
+		opt := &redis.FailoverOptions{
+			MasterName:    c.masterName,
+			SentinelAddrs: c.addrs,
+			DB:            c.dbNum,
+			Password:      c.clientPassword(),
+			PoolSize:      c.poolSize,
+			TLSConfig:     c.tls,
+		}
+		if c.username != "" {
+			opt.OnConnect = c.onConnect
+		}
+		client = redis.NewFailoverClient(opt)
+		if c.readFromReplica {
+			if addr := c.replicaAddr(); addr != "" {
+				replica = redis.NewClient(c.options(addr))
+			}
+		}
+		return client, replica, nil
+	}
+	return redis.NewClient(c.options(c.addrs[0])), nil, nil
+}
+
+// ask the sentinels for the address of a healthy replica of the master, "" if there is none
+func (c *config) replicaAddr() string {
+	for _, addr := range c.addrs {
+		sentinel := redis.NewSentinelClient(&redis.Options{Addr: addr, TLSConfig: c.tls})
+		replicas, err := sentinel.Do("sentinel", "slaves", c.masterName).Result()
+		_ = sentinel.Close()
+		if err != nil {
+			continue
+		}
+		list, _ := replicas.([]interface{})
+		for _, r := range list {
+			// each replica is a flat list of fields and values
+			fields, _ := r.([]interface{})
+			info := make(map[string]string, len(fields)/2)
+			for i := 0; i+1 < len(fields); i += 2 {
+				info[cache.GetString(fields[i])] = cache.GetString(fields[i+1])
+			}
+			if flags := info["flags"]; strings.Contains(flags, "down") || strings.Contains(flags, "disconnected") {
+				continue
+			}
+			if info["ip"] != "" && info["port"] != "" {
+				return info["ip"] + ":" + info["port"]
+			}
+		}
+	}
+	return ""
+}
@@ -30,9 +30,11 @@
 package redis
 
 import (
-	"errors"
-	"strconv"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-redis/redis"
@@ -47,136 +49,479 @@ var (
 
 // Cache is Redis cache adapter.
 type Cache struct {
-	p        *redis.Client // redis connection pool
+	p        redis.UniversalClient // redis connection pool of the master or of the cluster
+	r        *redis.Client         // replica of the sentinel mode for the reads, nil reads the master
 	connInfo string
+	mode     string
 	dbNum    int
 	key      string
+	prefix   string
 	password string
 	maxIdle  int
 }
 
-// NewRedisCache create new redis cache with default collection name.
+// NewRedisCache create new redis cache with default collection name, served through the cache.Cache interface.
 func NewRedisCache() cache.Cache {
+	return cache.ToCache(newRedisCache())
+}
+
+func newRedisCache() cache.ContextCache {
 	return &Cache{key: DefaultKey}
 }
 
-// Get cache from redis.
-func (rc *Cache) Get(key string) interface{} {
-	v, err := rc.p.Get(key).Bytes()
-	if err == nil {
-		return v
+// get the client of the requests of ctx
+func (rc *Cache) client(ctx context.Context) redis.UniversalClient {
+	switch c := rc.p.(type) {
+	case *redis.Client:
+		return c.WithContext(ctx)
+	case *redis.ClusterClient:
+		return c.WithContext(ctx)
 	}
-	return nil
+	return rc.p
 }
 
-// GetMulti get cache from redis.
-func (rc *Cache) GetMulti(keys []string) []interface{} {
-	c := rc.p.MGet(keys...)
-	values, err := c.Result()
+// run the read fn on the replica, then on the master when the replica fails
+func (rc *Cache) read(ctx context.Context, fn func(c redis.UniversalClient) error) error {
+	if rc.r != nil {
+		err := fn(rc.r.WithContext(ctx))
+		if err == nil || err == redis.Nil || ctx.Err() != nil {
+			return err
+		}
+	}
+	return fn(rc.client(ctx))
+}
+
+// get the redis key of a cache key
+func (rc *Cache) k(key string) string {
+	return rc.prefix + key
+}
+
+// Get cache from redis.
+func (rc *Cache) Get(ctx context.Context, key string) (interface{}, error) {
+	var v []byte
+	err := rc.read(ctx, func(c redis.UniversalClient) (err error) {
+		v, err = c.Get(rc.k(key)).Bytes()
+		return err
+	})
+	if err == redis.Nil {
+		return nil, cache.ErrCacheMiss
+	}
 	if err != nil {
-		return nil
+		return nil, err
 	}
-	return values
+	return v, nil
+}
+
+// GetMulti get cache from redis, the keys are read in a pipeline so they may live on different cluster nodes.
+func (rc *Cache) GetMulti(ctx context.Context, keys []string) ([]interface{}, []error) {
+	values := make([]interface{}, len(keys))
+	errs := make([]error, len(keys))
+	cmds := make([]*redis.StringCmd, len(keys))
+	err := rc.read(ctx, func(c redis.UniversalClient) error {
+		_, err := c.Pipelined(func(pipe redis.Pipeliner) error {
+			for i, key := range keys {
+				cmds[i] = pipe.Get(rc.k(key))
+			}
+			return nil
+		})
+		if err == redis.Nil {
+			// a missing key, the others are read
+			return nil
+		}
+		return err
+	})
+	for i, cmd := range cmds {
+		switch {
+		case err != nil:
+			errs[i] = err
+		case cmd.Err() == redis.Nil:
+			errs[i] = cache.ErrCacheMiss
+		default:
+			values[i], errs[i] = cmd.Bytes()
+		}
+	}
+	return values, errs
 }
 
 // Put put cache to redis.
-func (rc *Cache) Put(key string, val interface{}, timeout time.Duration) error {
-	_, err := rc.p.Set(key, val, timeout).Result()
+func (rc *Cache) Put(ctx context.Context, key string, val interface{}, timeout time.Duration) error {
+	return rc.client(ctx).Set(rc.k(key), val, timeout).Err()
+}
+
+// PutMulti put caches to redis in one round trip.
+// the values without expiration are put by one MSET, unless their keys may live on different cluster nodes,
+// else each value is SET in a pipeline.
+func (rc *Cache) PutMulti(ctx context.Context, items map[string]interface{}, timeout time.Duration) error {
+	if len(items) == 0 {
+		return nil
+	}
+	client := rc.client(ctx)
+	if _, cluster := rc.p.(*redis.ClusterClient); timeout == 0 && !cluster {
+		pairs := make([]interface{}, 0, 2*len(items))
+		for key, val := range items {
+			pairs = append(pairs, rc.k(key), val)
+		}
+		return client.MSet(pairs...).Err()
+	}
+	_, err := client.Pipelined(func(pipe redis.Pipeliner) error {
+		for key, val := range items {
+			pipe.Set(rc.k(key), val, timeout)
+		}
+		return nil
+	})
 	return err
 }
 
-// Delete delete cache in redis.
-func (rc *Cache) Delete(key string) (err error) {
-	c := rc.p.Del(key)
+// get the key of the set of the keys put with tag
+func (rc *Cache) tagKey(tag string) string {
+	return rc.k(rc.key + ":tag:" + tag)
+}
+
+// PutWithTags put cache to redis and add key to the redis set of each tag.
+func (rc *Cache) PutWithTags(ctx context.Context, key string, val interface{}, timeout time.Duration, tags ...string) error {
+	_, err := rc.client(ctx).TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.Set(rc.k(key), val, timeout)
+		for _, tag := range tags {
+			pipe.SAdd(rc.tagKey(tag), rc.k(key))
+		}
+		return nil
+	})
+	return err
+}
 
-	_, err = c.Result()
+// delete the redis keys one by one in a pipeline, a multi-key DEL fails across the slots of a cluster
+func delKeys(c redis.Cmdable, keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	_, err := c.Pipelined(func(pipe redis.Pipeliner) error {
+		for _, key := range keys {
+			pipe.Del(key)
+		}
+		return nil
+	})
+	return err
+}
 
-	return
+// InvalidateTags delete the caches in the redis sets of the tags and the sets.
+func (rc *Cache) InvalidateTags(ctx context.Context, tags ...string) error {
+	client := rc.client(ctx)
+	for _, tag := range tags {
+		keys, err := client.SMembers(rc.tagKey(tag)).Result()
+		if err != nil {
+			return err
+		}
+		if err = delKeys(client, append(keys, rc.tagKey(tag))); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-// IsExist check cache's existence in redis.
-func (rc *Cache) IsExist(key string) bool {
-	v, err := rc.p.Exists(key).Result()
+// escape the glob characters of the patterns of redis
+var globEscaper = strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`, `]`, `\]`)
 
+// call fn with the client of each master, the client itself out of the cluster mode
+func (rc *Cache) forEachMaster(ctx context.Context, fn func(c redis.Cmdable) error) error {
+	if cc, ok := rc.p.(*redis.ClusterClient); ok {
+		return cc.WithContext(ctx).ForEachMaster(func(c *redis.Client) error {
+			return fn(c.WithContext(ctx))
+		})
+	}
+	return fn(rc.client(ctx))
+}
+
+// DeletePrefix delete the caches whose key starts with prefix, the keys of each master are scanned in batches.
+func (rc *Cache) DeletePrefix(ctx context.Context, prefix string) error {
+	match := globEscaper.Replace(rc.k(prefix)) + "*"
+	return rc.forEachMaster(ctx, func(c redis.Cmdable) error {
+		var cursor uint64
+		for {
+			keys, next, err := c.Scan(cursor, match, 100).Result()
+			if err != nil {
+				return err
+			}
+			if err = delKeys(c, keys); err != nil {
+				return err
+			}
+			if cursor = next; cursor == 0 {
+				return nil
+			}
+		}
+	})
+}
+
+// Delete delete cache in redis.
+func (rc *Cache) Delete(ctx context.Context, key string) error {
+	return rc.client(ctx).Del(rc.k(key)).Err()
+}
+
+// DeleteMulti delete caches in redis by one DEL, or in a pipeline in the cluster mode.
+func (rc *Cache) DeleteMulti(ctx context.Context, keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	rkeys := make([]string, len(keys))
+	for i, key := range keys {
+		rkeys[i] = rc.k(key)
+	}
+	client := rc.client(ctx)
+	if _, cluster := rc.p.(*redis.ClusterClient); cluster {
+		return delKeys(client, rkeys)
+	}
+	return client.Del(rkeys...).Err()
+}
+
+// IsExist check cache's existence in redis.
+func (rc *Cache) IsExist(ctx context.Context, key string) (bool, error) {
+	var v int64
+	err := rc.read(ctx, func(c redis.UniversalClient) (err error) {
+		v, err = c.Exists(rc.k(key)).Result()
+		return err
+	})
 	if err != nil {
-		return false
+		return false, err
 	}
+	return v > 0, nil
+}
 
-	return v > 0
+// IncrBy increase counter in redis.
+func (rc *Cache) IncrBy(ctx context.Context, key string, n int64) (int64, error) {
+	return rc.client(ctx).IncrBy(rc.k(key), n).Result()
 }
 
-// Incr increase counter in redis.
-func (rc *Cache) Incr(key string) error {
-	_, err := rc.p.Incr(key).Result()
-	return err
+// DecrBy decrease counter in redis.
+func (rc *Cache) DecrBy(ctx context.Context, key string, n int64) (int64, error) {
+	return rc.client(ctx).DecrBy(rc.k(key), n).Result()
 }
 
-// Decr decrease counter in redis.
-func (rc *Cache) Decr(key string) error {
-	_, err := rc.p.Decr(key).Result()
-	return err
+// Touch reset the expiration of the cache in redis, 0 removes the expiration.
+func (rc *Cache) Touch(ctx context.Context, key string, timeout time.Duration) error {
+	client := rc.client(ctx)
+	var ok bool
+	var err error
+	if timeout == 0 {
+		// persist is false for a key without expiration as for a missing key
+		if ok, err = client.Persist(rc.k(key)).Result(); err == nil && !ok {
+			var n int64
+			n, err = client.Exists(rc.k(key)).Result()
+			ok = n > 0
+		}
+	} else {
+		ok, err = client.PExpire(rc.k(key), timeout).Result()
+	}
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return cache.ErrCacheMiss
+	}
+	return nil
 }
 
-// ClearAll clean all cache in redis. delete this redis collection.
-func (rc *Cache) ClearAll() error {
-	c := rc.p.FlushDB()
-	return c.Err()
+// TTL get the remaining time to live of the cache in redis.
+func (rc *Cache) TTL(ctx context.Context, key string) (time.Duration, error) {
+	var ttl time.Duration
+	err := rc.read(ctx, func(c redis.UniversalClient) (err error) {
+		ttl, err = c.PTTL(rc.k(key)).Result()
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	// -2 means the key does not exist, -1 means it has no expiration
+	switch ttl {
+	case -2 * time.Millisecond:
+		return 0, cache.ErrCacheMiss
+	case -1 * time.Millisecond:
+		return 0, nil
+	}
+	return ttl, nil
 }
 
-// StartAndGC start redis cache adapter.
-// config is like {"key":"collection key","conn":"connection info","dbNum":"0"}
-// the cache item in redis are stored forever,
-// so no gc operation.
-func (rc *Cache) StartAndGC(config string) error {
-	var cf map[string]string
-	_ = json.Decode([]byte(config), &cf)
+// release the lock if the token still owns it
+var unlockScript = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("del", KEYS[1])
+end
+return 0`)
 
-	if _, ok := cf["key"]; !ok {
-		cf["key"] = DefaultKey
+// TryLock take the lock of key in redis for ttl if it is free.
+func (rc *Cache) TryLock(ctx context.Context, key string, ttl time.Duration) (string, bool, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", false, err
 	}
-	if _, ok := cf["conn"]; !ok {
-		return errors.New("config has no conn key")
+	token := hex.EncodeToString(b)
+	ok, err := rc.client(ctx).SetNX(rc.k(key), token, ttl).Result()
+	if err != nil || !ok {
+		return "", false, err
 	}
+	return token, true, nil
+}
+
+// Unlock release the lock of key in redis if token still owns it.
+func (rc *Cache) Unlock(ctx context.Context, key string, token string) error {
+	return unlockScript.Run(rc.client(ctx), []string{rc.k(key)}, token).Err()
+}
+
+// extend the lock if the token still owns it
+var renewScript = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("pexpire", KEYS[1], ARGV[2])
+end
+return 0`)
 
-	// Format redis://<password>@<host>:<port>
-	cf["conn"] = strings.Replace(cf["conn"], "redis://", "", 1)
-	if i := strings.Index(cf["conn"], "@"); i > -1 {
-		cf["password"] = cf["conn"][0:i]
-		cf["conn"] = cf["conn"][i+1:]
+// Acquire put token as the value of the lock key for ttl if the key is free, with SET NX PX.
+func (rc *Cache) Acquire(ctx context.Context, key string, token string, ttl time.Duration) (bool, error) {
+	return rc.client(ctx).SetNX(rc.k(key), token, ttl).Result()
+}
+
+// take the lock and increase its fencing number in one step.
+// the number is at least the time of the server in microseconds, so it still increases when the counter was evicted or cleared.
+var acquireFencedScript = redis.NewScript(`
+redis.replicate_commands()
+if not redis.call("set", KEYS[1], ARGV[1], "NX", "PX", ARGV[2]) then
+	return false
+end
+local fence = redis.call("incr", KEYS[2])
+local t = redis.call("time")
+local now = tonumber(t[1]) * 1000000 + tonumber(t[2])
+if fence < now then
+	fence = now
+	redis.call("set", KEYS[2], string.format("%.0f", fence))
+end
+return fence`)
+
+// get the key of the fencing number of a lock key, in the same cluster slot as the lock key
+func fenceKey(key string) string {
+	if strings.ContainsAny(key, "{}") {
+		// the hash tag of the key is the one of the fence key too
+		return key + ":fence"
 	}
+	return "{" + key + "}:fence"
+}
 
-	if _, ok := cf["dbNum"]; !ok {
-		cf["dbNum"] = "0"
+// AcquireFenced put token as the value of the lock key for ttl if the key is free,
+// and get the next fencing number of the key in the same script.
+func (rc *Cache) AcquireFenced(ctx context.Context, key string, token string, ttl time.Duration) (int64, bool, error) {
+	ms := int64(ttl / time.Millisecond)
+	if ms < 1 {
+		ms = 1
 	}
-	if _, ok := cf["password"]; !ok {
-		cf["password"] = ""
+	fence, err := acquireFencedScript.Run(rc.client(ctx), []string{rc.k(key), fenceKey(rc.k(key))}, token, ms).Int64()
+	if err == redis.Nil {
+		return 0, false, nil
 	}
-	if _, ok := cf["maxIdle"]; !ok {
-		cf["maxIdle"] = "3"
+	if err != nil {
+		return 0, false, err
 	}
-	rc.key = cf["key"]
-	rc.connInfo = cf["conn"]
-	rc.dbNum, _ = strconv.Atoi(cf["dbNum"])
-	rc.password = cf["password"]
-	rc.maxIdle, _ = strconv.Atoi(cf["maxIdle"])
+	return fence, true, nil
+}
+
+// Renew reset the ttl of the lock key if token still owns it.
+func (rc *Cache) Renew(ctx context.Context, key string, token string, ttl time.Duration) (bool, error) {
+	n, err := renewScript.Run(rc.client(ctx), []string{rc.k(key)}, token, int64(ttl/time.Millisecond)).Int64()
+	return n == 1, err
+}
+
+// Release delete the lock key if token still owns it.
+func (rc *Cache) Release(ctx context.Context, key string, token string) (bool, error) {
+	n, err := unlockScript.Run(rc.client(ctx), []string{rc.k(key)}, token).Int64()
+	return n == 1, err
+}
 
-	rc.connectInit()
+// scripts run by Eval, by their source
+var scripts sync.Map
 
-	c := rc.p.Ping()
+// Eval run the lua script on the keys in redis, the script is cached by the server.
+func (rc *Cache) Eval(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error) {
+	s, ok := scripts.Load(script)
+	if !ok {
+		s, _ = scripts.LoadOrStore(script, redis.NewScript(script))
+	}
+	prefixed := make([]string, len(keys))
+	for i, key := range keys {
+		prefixed[i] = rc.k(key)
+	}
+	v, err := s.(*redis.Script).Run(rc.client(ctx), prefixed, args...).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	return v, err
+}
 
-	return c.Err()
+// Publish send msg to the subscribers of the redis channel.
+func (rc *Cache) Publish(ctx context.Context, channel string, msg string) error {
+	return rc.client(ctx).Publish(channel, msg).Err()
 }
 
-// connect to redis.
-func (rc *Cache) connectInit() {
-	// initialize a new pool
-	rc.p = redis.NewClient(&redis.Options{
-		Addr:     rc.connInfo,
-		DB:       rc.dbNum,
-		Password: rc.password,
+// Subscribe call handler with the messages of the redis channel until close is called.
+func (rc *Cache) Subscribe(ctx context.Context, channel string, handler func(msg string)) (func() error, error) {
+	pubsub := rc.client(ctx).Subscribe(channel)
+	// wait for the confirmation of the subscription
+	if _, err := pubsub.Receive(); err != nil {
+		_ = pubsub.Close()
+		return nil, err
+	}
+	go func() {
+		for msg := range pubsub.Channel() {
+			handler(msg.Payload)
+		}
+	}()
+	return pubsub.Close, nil
+}
+
+// ClearAll clean all cache in redis. delete this redis collection.
+// with a key prefix only the prefixed keys are deleted, otherwise the db of every master is flushed.
+func (rc *Cache) ClearAll(ctx context.Context) error {
+	if rc.prefix != "" {
+		return rc.DeletePrefix(ctx, "")
+	}
+	return rc.forEachMaster(ctx, func(c redis.Cmdable) error {
+		return c.FlushDB().Err()
 	})
 }
 
+// StartAndGC start redis cache adapter.
+// config is like {"key":"collection key","conn":"connection info","dbNum":"0"}
+// conn also takes the save path of the redis session providers, so they share one topology config:
+//
+//	{"mode":"sentinel","conn":"127.0.0.1:26379;127.0.0.2:26379,100,password,0,mymaster"}
+//
+// the other keys are "mode" (single, cluster or sentinel), "poolSize", "password", "username" for the acl,
+// "dbNum", "masterName", "prefix" of the keys, "readFromReplica",
+// and "tls" with "tlsCA", "tlsServerName" and "tlsSkipVerify".
+// the cache item in redis are stored forever,
+// so no gc operation.
+func (rc *Cache) StartAndGC(config string) error {
+	cf := make(map[string]interface{})
+	_ = json.Decode([]byte(config), &cf)
+
+	c, err := parseConfig(cf)
+	if err != nil {
+		return err
+	}
+	rc.key = DefaultKey
+	if v, ok := cf["key"]; ok {
+		rc.key = cache.GetString(v)
+	}
+	rc.prefix = cache.GetString(cf["prefix"])
+	rc.maxIdle = 3
+	if v, ok := cf["maxIdle"]; ok {
+		rc.maxIdle = cache.GetInt(v)
+	}
+	rc.connInfo = strings.Join(c.addrs, ";")
+	rc.mode = c.mode
+	rc.dbNum = c.dbNum
+	rc.password = c.password
+
+	if rc.p, rc.r, err = c.dial(); err != nil {
+		return err
+	}
+	return rc.p.Ping().Err()
+}
+
 func init() {
-	cache.Register(cache.RedisProvider, NewRedisCache)
+	cache.RegisterContext(cache.RedisProvider, newRedisCache)
 }
@@ -92,10 +92,10 @@ func TestRedisCache(t *testing.T) {
 	if len(vv) != 2 {
 		t.Error("GetMulti ERROR")
 	}
-	if v := vv[0]; v != "author" {
+	if v, _ := redis.String(vv[0], nil); v != "author" {
 		t.Error("GetMulti ERROR")
 	}
-	if v := vv[1]; v != "author1" {
+	if v, _ := redis.String(vv[1], nil); v != "author1" {
 		t.Error("GetMulti ERROR")
 	}
 
@@ -104,3 +104,38 @@ func TestRedisCache(t *testing.T) {
 		t.Error("clear all err")
 	}
 }
+
+func TestParseConfig(t *testing.T) {
+	c, err := parseConfig(map[string]interface{}{
+		"mode": "sentinel",
+		"conn": "127.0.0.1:26379;127.0.0.2:26379,50,secret,2,cache",
+	})
+	if err != nil {
+		t.Fatal("parse err", err)
+	}
+	if len(c.addrs) != 2 || c.poolSize != 50 || c.password != "secret" || c.dbNum != 2 || c.masterName != "cache" {
+		t.Error("session save path err", c)
+	}
+
+	c, err = parseConfig(map[string]interface{}{
+		"conn":            "redis://secret@127.0.0.1:6379",
+		"username":        "app",
+		"dbNum":           float64(1),
+		"readFromReplica": true,
+		"tls":             "true",
+	})
+	if err != nil {
+		t.Fatal("parse err", err)
+	}
+	if c.mode != ModeSingle || c.addrs[0] != "127.0.0.1:6379" || c.password != "secret" || c.dbNum != 1 ||
+		c.masterName != DefaultMasterName || !c.readFromReplica || c.tls == nil || c.clientPassword() != "" {
+		t.Error("config err", c)
+	}
+
+	if _, err = parseConfig(map[string]interface{}{"conn": "127.0.0.1:6379", "mode": "ring"}); err == nil {
+		t.Error("unknown mode should fail")
+	}
+	if _, err = parseConfig(map[string]interface{}{}); err == nil {
+		t.Error("missing conn should fail")
+	}
+}
@@ -0,0 +1,218 @@
+// Copyright 2019 asana Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+// ToCache serve a ContextCache through the Cache interface for the old callers.
+// the misses and the errors of Get are returned as nil.
+func ToCache(cc ContextCache) Cache {
+	if c, ok := cc.(*contextShim); ok {
+		return c.c
+	}
+	return &cacheShim{cc: cc}
+}
+
+// ToContextCache serve a Cache through the ContextCache interface.
+// a nil value of the Cache is reported as ErrCacheMiss, Touch and IncrBy are emulated
+// and TTL returns ErrNotSupported.
+func ToContextCache(c Cache) ContextCache {
+	if cc, ok := c.(*cacheShim); ok {
+		return cc.cc
+	}
+	return &contextShim{c: c}
+}
+
+// Unwrap get the adapter under the wrappers of cc, such as the codec of the config.
+//	bus := cache.Unwrap(cc).(cache.Bus)
+func Unwrap(cc ContextCache) ContextCache {
+	for {
+		w, ok := cc.(interface{ Unwrap() ContextCache })
+		if !ok {
+			return cc
+		}
+		cc = w.Unwrap()
+	}
+}
+
+// Cache over a ContextCache
+type cacheShim struct {
+	cc ContextCache
+}
+
+func (s *cacheShim) Get(key string) interface{} {
+	v, err := s.cc.Get(context.Background(), key)
+	if err != nil {
+		return nil
+	}
+	return v
+}
+
+func (s *cacheShim) GetMulti(keys []string) []interface{} {
+	values, _ := s.cc.GetMulti(context.Background(), keys)
+	return values
+}
+
+func (s *cacheShim) Put(key string, val interface{}, timeout time.Duration) error {
+	return s.cc.Put(context.Background(), key, val, timeout)
+}
+
+func (s *cacheShim) PutMulti(items map[string]interface{}, timeout time.Duration) error {
+	return s.cc.PutMulti(context.Background(), items, timeout)
+}
+
+func (s *cacheShim) Delete(key string) error {
+	return s.cc.Delete(context.Background(), key)
+}
+
+func (s *cacheShim) DeleteMulti(keys []string) error {
+	return s.cc.DeleteMulti(context.Background(), keys)
+}
+
+func (s *cacheShim) Incr(key string) error {
+	_, err := s.cc.IncrBy(context.Background(), key, 1)
+	return err
+}
+
+func (s *cacheShim) Decr(key string) error {
+	_, err := s.cc.DecrBy(context.Background(), key, 1)
+	return err
+}
+
+func (s *cacheShim) IsExist(key string) bool {
+	ok, _ := s.cc.IsExist(context.Background(), key)
+	return ok
+}
+
+func (s *cacheShim) ClearAll() error {
+	return s.cc.ClearAll(context.Background())
+}
+
+func (s *cacheShim) StartAndGC(config string) error {
+	return s.cc.StartAndGC(config)
+}
+
+// ContextCache over a Cache
+type contextShim struct {
+	c Cache
+}
+
+func (s *contextShim) Get(ctx context.Context, key string) (interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if v := s.c.Get(key); v != nil {
+		return v, nil
+	}
+	return nil, ErrCacheMiss
+}
+
+func (s *contextShim) GetMulti(ctx context.Context, keys []string) ([]interface{}, []error) {
+	values := make([]interface{}, len(keys))
+	errs := make([]error, len(keys))
+	for i, key := range keys {
+		values[i], errs[i] = s.Get(ctx, key)
+	}
+	return values, errs
+}
+
+func (s *contextShim) Put(ctx context.Context, key string, val interface{}, timeout time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.c.Put(key, val, timeout)
+}
+
+func (s *contextShim) PutMulti(ctx context.Context, items map[string]interface{}, timeout time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.c.PutMulti(items, timeout)
+}
+
+func (s *contextShim) Delete(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.c.Delete(key)
+}
+
+func (s *contextShim) DeleteMulti(ctx context.Context, keys []string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.c.DeleteMulti(keys)
+}
+
+// the Cache only increases by 1, n is applied step by step
+func (s *contextShim) IncrBy(ctx context.Context, key string, n int64) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	if !s.c.IsExist(key) {
+		if err := s.c.Put(key, 0, 0); err != nil {
+			return 0, err
+		}
+	}
+	for ; n > 0; n-- {
+		if err := s.c.Incr(key); err != nil {
+			return 0, err
+		}
+	}
+	for ; n < 0; n++ {
+		if err := s.c.Decr(key); err != nil {
+			return 0, err
+		}
+	}
+	return GetInt64(s.c.Get(key)), nil
+}
+
+func (s *contextShim) DecrBy(ctx context.Context, key string, n int64) (int64, error) {
+	return s.IncrBy(ctx, key, -n)
+}
+
+func (s *contextShim) IsExist(ctx context.Context, key string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	return s.c.IsExist(key), nil
+}
+
+// the Cache has no expire operation, the value is put again with timeout
+func (s *contextShim) Touch(ctx context.Context, key string, timeout time.Duration) error {
+	v, err := s.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	return s.c.Put(key, v, timeout)
+}
+
+func (s *contextShim) TTL(ctx context.Context, key string) (time.Duration, error) {
+	return 0, ErrNotSupported
+}
+
+func (s *contextShim) ClearAll(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.c.ClearAll()
+}
+
+func (s *contextShim) StartAndGC(config string) error {
+	return s.c.StartAndGC(config)
+}
@@ -1,7 +1,9 @@
 package ssdb
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"strconv"
 	"strings"
 	"time"
@@ -17,151 +19,412 @@ type Cache struct {
 	connInfo []string
 }
 
-//NewSsdbCache create new ssdb adapter.
+//NewSsdbCache create new ssdb adapter served through the cache.Cache interface.
 func NewSsdbCache() cache.Cache {
+	return cache.ToCache(newSsdbCache())
+}
+
+func newSsdbCache() cache.ContextCache {
 	return &Cache{}
 }
 
-// Get get value from ssdb.
-func (rc *Cache) Get(key string) interface{} {
+// send a command to ssdb and check its status is ok
+func (rc *Cache) do(args ...interface{}) ([]string, error) {
 	if rc.conn == nil {
 		if err := rc.connectInit(); err != nil {
-			return nil
+			return nil, err
 		}
 	}
-	value, err := rc.conn.Get(key)
-	if err == nil {
-		return value
+	resp, err := rc.conn.Do(args...)
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	if len(resp) == 0 {
+		return nil, errors.New("bad response")
+	}
+	switch resp[0] {
+	case "ok":
+		return resp, nil
+	case "not_found":
+		return nil, cache.ErrCacheMiss
+	}
+	return nil, fmt.Errorf("bad response: %v", resp)
+}
+
+// Get get value from ssdb.
+func (rc *Cache) Get(ctx context.Context, key string) (interface{}, error) {
+	resp, err := rc.do("get", key)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp) != 2 {
+		return nil, errors.New("bad response")
+	}
+	return rc.untag(resp[1])
 }
 
 // GetMulti get value from ssdb.
-func (rc *Cache) GetMulti(keys []string) []interface{} {
-	size := len(keys)
-	var values []interface{}
-	if rc.conn == nil {
-		if err := rc.connectInit(); err != nil {
-			for i := 0; i < size; i++ {
-				values = append(values, err)
-			}
-			return values
+func (rc *Cache) GetMulti(ctx context.Context, keys []string) ([]interface{}, []error) {
+	values := make([]interface{}, len(keys))
+	errs := make([]error, len(keys))
+	resp, err := rc.do("multi_get", keys)
+	if err != nil {
+		for i := range errs {
+			errs[i] = err
 		}
+		return values, errs
+	}
+	// the response is the pairs of the found keys and their values
+	found := make(map[string]string, len(resp)/2)
+	for i := 1; i+1 < len(resp); i += 2 {
+		found[resp[i]] = resp[i+1]
 	}
-	res, err := rc.conn.Do("multi_get", keys)
-	resSize := len(res)
-	if err == nil {
-		for i := 1; i < resSize; i += 2 {
-			values = append(values, res[i+1])
+	for i, key := range keys {
+		if v, ok := found[key]; ok {
+			values[i], errs[i] = rc.untag(v)
+		} else {
+			errs[i] = cache.ErrCacheMiss
 		}
-		return values
 	}
-	for i := 0; i < size; i++ {
-		values = append(values, err)
+	return values, errs
+}
+
+// DeleteMulti delete values from ssdb by one multi_del.
+func (rc *Cache) DeleteMulti(ctx context.Context, keys []string) error {
+	if len(keys) == 0 {
+		return nil
 	}
-	return values
+	_, err := rc.do("multi_del", keys)
+	return err
 }
 
-// DelMulti get value from ssdb.
+// DelMulti delete values from ssdb.
+// Deprecated: use DeleteMulti instead.
 func (rc *Cache) DelMulti(keys []string) error {
-	if rc.conn == nil {
-		if err := rc.connectInit(); err != nil {
+	return rc.DeleteMulti(context.Background(), keys)
+}
+
+// get the string stored for value, only string and []byte are supported
+func toString(value interface{}) (string, error) {
+	switch val := value.(type) {
+	case string:
+		return val, nil
+	case []byte:
+		return string(val), nil
+	}
+	return "", errors.New("value must string")
+}
+
+// PutMulti put values to ssdb, only support string and []byte.
+// multi_set has no expiration, so the values with a timeout are put one by one by setx.
+func (rc *Cache) PutMulti(ctx context.Context, items map[string]interface{}, timeout time.Duration) error {
+	pairs := make([]string, 0, 2*len(items))
+	for key, value := range items {
+		v, err := toString(value)
+		if err != nil {
+			return err
+		}
+		pairs = append(pairs, key, v)
+	}
+	if len(pairs) == 0 {
+		return nil
+	}
+	ttl := int(timeout / time.Second)
+	if ttl <= 0 {
+		_, err := rc.do("multi_set", pairs)
+		return err
+	}
+	for i := 0; i < len(pairs); i += 2 {
+		if err := ctx.Err(); err != nil {
 			return err
 		}
+		if _, err := rc.do("setx", pairs[i], pairs[i+1], ttl); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Put put value to ssdb. only support string and []byte.
+func (rc *Cache) Put(ctx context.Context, key string, value interface{}, timeout time.Duration) error {
+	v, err := toString(value)
+	if err != nil {
+		return err
+	}
+	if ttl := int(timeout / time.Second); ttl <= 0 {
+		_, err = rc.do("set", key, v)
+	} else {
+		_, err = rc.do("setx", key, v, ttl)
 	}
-	_, err := rc.conn.Do("multi_del", keys)
 	return err
 }
 
-// Put put value to ssdb. only support string.
-func (rc *Cache) Put(key string, value interface{}, timeout time.Duration) error {
-	if rc.conn == nil {
-		if err := rc.connectInit(); err != nil {
-			return err
+// get the value stored by PutWithTags, it is a miss once one of its tags is invalidated
+func (rc *Cache) untag(value string) (interface{}, error) {
+	versions, data, ok := cache.UnwrapTagged([]byte(value))
+	if !ok {
+		return value, nil
+	}
+	tags := make([]string, 0, len(versions))
+	for tag := range versions {
+		tags = append(tags, tag)
+	}
+	current, err := rc.tagVersions(tags)
+	if err != nil {
+		return nil, err
+	}
+	for tag, version := range versions {
+		if current[tag] != version {
+			return nil, cache.ErrCacheMiss
 		}
 	}
-	v, ok := value.(string)
-	if !ok {
-		return errors.New("value must string")
+	return string(data), nil
+}
+
+// get the current versions of the tags, the missing versions are added
+func (rc *Cache) tagVersions(tags []string) (map[string]string, error) {
+	keys := make([]string, len(tags))
+	for i, tag := range tags {
+		keys[i] = cache.TagVersionKey(tag)
 	}
-	var resp []string
-	var err error
-	var ttl = 0
-	if timeout != 0 {
-		ttl = int(timeout / time.Second)
+	resp, err := rc.do("multi_get", keys)
+	if err != nil {
+		return nil, err
 	}
-	if ttl < 0 {
-		resp, err = rc.conn.Do("set", key, v)
-	} else {
-		resp, err = rc.conn.Do("setx", key, v, ttl)
+	found := make(map[string]string, len(resp)/2)
+	for i := 1; i+1 < len(resp); i += 2 {
+		found[resp[i]] = resp[i+1]
+	}
+	versions := make(map[string]string, len(tags))
+	for i, tag := range tags {
+		if version, ok := found[keys[i]]; ok {
+			versions[tag] = version
+			continue
+		}
+		version := cache.NewTagVersion()
+		if resp, err = rc.do("setnx", keys[i], version); err != nil {
+			return nil, err
+		}
+		if len(resp) != 2 || resp[1] != "1" {
+			// added by another client in the meantime
+			if resp, err = rc.do("get", keys[i]); err != nil {
+				return nil, err
+			}
+			if len(resp) != 2 {
+				return nil, errors.New("bad response")
+			}
+			version = resp[1]
+		}
+		versions[tag] = version
+	}
+	return versions, nil
+}
+
+// PutWithTags put value to ssdb with the current versions of its tags.
+func (rc *Cache) PutWithTags(ctx context.Context, key string, value interface{}, timeout time.Duration, tags ...string) error {
+	if len(tags) == 0 {
+		return rc.Put(ctx, key, value, timeout)
 	}
+	v, err := toString(value)
 	if err != nil {
 		return err
 	}
-	if len(resp) == 2 && resp[0] == "ok" {
-		return nil
+	versions, err := rc.tagVersions(tags)
+	if err != nil {
+		return err
+	}
+	data, err := cache.WrapTagged(versions, []byte(v))
+	if err != nil {
+		return err
 	}
-	return errors.New("bad response")
+	return rc.Put(ctx, key, data, timeout)
 }
 
-// Delete delete value in ssdb.
-func (rc *Cache) Delete(key string) error {
-	if rc.conn == nil {
-		if err := rc.connectInit(); err != nil {
+// InvalidateTags change the versions of the tags, so the values put with them become misses.
+// the values are not listed, they expire by themselves, only one version key is kept by tag.
+func (rc *Cache) InvalidateTags(ctx context.Context, tags ...string) error {
+	for _, tag := range tags {
+		if _, err := rc.do("set", cache.TagVersionKey(tag), cache.NewTagVersion()); err != nil {
 			return err
 		}
 	}
-	_, err := rc.conn.Del(key)
-	return err
+	return nil
 }
 
-// Incr increase counter.
-func (rc *Cache) Incr(key string) error {
-	if rc.conn == nil {
-		if err := rc.connectInit(); err != nil {
+// DeletePrefix delete the values whose key starts with prefix in ssdb.
+func (rc *Cache) DeletePrefix(ctx context.Context, prefix string) error {
+	// scan excludes its start, the key equal to prefix is deleted first
+	if err := rc.Delete(ctx, prefix); err != nil {
+		return err
+	}
+	keyStart, keyEnd := prefix, prefix+"\xff"
+	for {
+		resp, err := rc.do("scan", keyStart, keyEnd, 100)
+		if err != nil {
+			return err
+		}
+		var keys []string
+		for i := 1; i+1 < len(resp); i += 2 {
+			keys = append(keys, resp[i])
+		}
+		if len(keys) == 0 {
+			return nil
+		}
+		if err = rc.DeleteMulti(ctx, keys); err != nil {
 			return err
 		}
+		keyStart = keys[len(keys)-1]
 	}
-	_, err := rc.conn.Do("incr", key, 1)
-	return err
 }
 
-// Decr decrease counter.
-func (rc *Cache) Decr(key string) error {
-	if rc.conn == nil {
-		if err := rc.connectInit(); err != nil {
-			return err
-		}
+// get the ttl of a lock in seconds, at least one
+func lockTTL(ttl time.Duration) int {
+	if sec := int(ttl / time.Second); sec > 0 {
+		return sec
+	}
+	return 1
+}
+
+// Acquire set token as the value of the lock key for ttl if the key is free.
+// ssdb sets the key and its expiration in two commands, the key is deleted when the expiration fails.
+func (rc *Cache) Acquire(ctx context.Context, key string, token string, ttl time.Duration) (bool, error) {
+	resp, err := rc.do("setnx", key, token)
+	if err != nil {
+		return false, err
+	}
+	if len(resp) != 2 || resp[1] != "1" {
+		return false, nil
+	}
+	if _, err = rc.do("expire", key, lockTTL(ttl)); err != nil {
+		_, _ = rc.do("del", key)
+		return false, err
+	}
+	return true, nil
+}
+
+// check token owns the lock key, ssdb has no compare and set so the check and the next command are not atomic
+func (rc *Cache) owns(key string, token string) (bool, error) {
+	resp, err := rc.do("get", key)
+	if err == cache.ErrCacheMiss {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return len(resp) == 2 && resp[1] == token, nil
+}
+
+// Renew reset the ttl of the lock key if token still owns it.
+func (rc *Cache) Renew(ctx context.Context, key string, token string, ttl time.Duration) (bool, error) {
+	ok, err := rc.owns(key, token)
+	if err != nil || !ok {
+		return false, err
+	}
+	resp, err := rc.do("expire", key, lockTTL(ttl))
+	if err != nil {
+		return false, err
+	}
+	return len(resp) == 2 && resp[1] == "1", nil
+}
+
+// Release delete the lock key if token still owns it.
+func (rc *Cache) Release(ctx context.Context, key string, token string) (bool, error) {
+	ok, err := rc.owns(key, token)
+	if err != nil || !ok {
+		return false, err
 	}
-	_, err := rc.conn.Do("incr", key, -1)
+	_, err = rc.do("del", key)
+	return err == nil, err
+}
+
+// Delete delete value in ssdb.
+func (rc *Cache) Delete(ctx context.Context, key string) error {
+	_, err := rc.do("del", key)
 	return err
 }
 
+// get the integer of the response of ssdb
+func intResp(resp []string) (int64, error) {
+	if len(resp) != 2 {
+		return 0, errors.New("bad response")
+	}
+	return strconv.ParseInt(resp[1], 10, 64)
+}
+
+// IncrBy increase counter and return the new value.
+func (rc *Cache) IncrBy(ctx context.Context, key string, n int64) (int64, error) {
+	resp, err := rc.do("incr", key, n)
+	if err != nil {
+		return 0, err
+	}
+	return intResp(resp)
+}
+
+// DecrBy decrease counter and return the new value.
+func (rc *Cache) DecrBy(ctx context.Context, key string, n int64) (int64, error) {
+	return rc.IncrBy(ctx, key, -n)
+}
+
 // IsExist check value exists in ssdb.
-func (rc *Cache) IsExist(key string) bool {
-	if rc.conn == nil {
-		if err := rc.connectInit(); err != nil {
-			return false
+func (rc *Cache) IsExist(ctx context.Context, key string) (bool, error) {
+	resp, err := rc.do("exists", key)
+	if err != nil {
+		return false, err
+	}
+	return len(resp) == 2 && resp[1] == "1", nil
+}
+
+// Touch reset the expiration of the value in ssdb.
+// ssdb cannot remove an expiration, with 0 the value is set again without it.
+func (rc *Cache) Touch(ctx context.Context, key string, timeout time.Duration) error {
+	if ttl := int(timeout / time.Second); ttl > 0 {
+		resp, err := rc.do("expire", key, ttl)
+		if err != nil {
+			return err
+		}
+		if len(resp) == 2 && resp[1] == "0" {
+			return cache.ErrCacheMiss
 		}
+		return nil
 	}
-	resp, err := rc.conn.Do("exists", key)
+	// the stored value is set again as is, with the versions of its tags
+	resp, err := rc.do("get", key)
 	if err != nil {
-		return false
+		return err
 	}
-	if len(resp) == 2 && resp[1] == "1" {
-		return true
+	if len(resp) != 2 {
+		return errors.New("bad response")
 	}
-	return false
+	_, err = rc.do("set", key, resp[1])
+	return err
+}
 
+// TTL get the remaining time to live of the value in ssdb.
+func (rc *Cache) TTL(ctx context.Context, key string) (time.Duration, error) {
+	resp, err := rc.do("ttl", key)
+	if err != nil {
+		return 0, err
+	}
+	ttl, err := intResp(resp)
+	if err != nil {
+		return 0, err
+	}
+	if ttl >= 0 {
+		return time.Duration(ttl) * time.Second, nil
+	}
+	// -1 is returned for a missing key as for a key without expiration
+	ok, err := rc.IsExist(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return 0, cache.ErrCacheMiss
+	}
+	return 0, nil
 }
 
 // ClearAll clear all cached in ssdb.
-func (rc *Cache) ClearAll() error {
-	if rc.conn == nil {
-		if err := rc.connectInit(); err != nil {
-			return err
-		}
-	}
+func (rc *Cache) ClearAll(ctx context.Context) error {
 	keyStart, keyEnd, limit := "", "", 50
 	resp, err := rc.Scan(keyStart, keyEnd, limit)
 	for err == nil {
@@ -173,8 +436,7 @@ func (rc *Cache) ClearAll() error {
 		for i := 1; i < size; i += 2 {
 			keys = append(keys, resp[i])
 		}
-		_, e := rc.conn.Do("multi_del", keys)
-		if e != nil {
+		if _, e := rc.do("multi_del", keys); e != nil {
 			return e
 		}
 		keyStart = resp[size-2]
@@ -229,5 +491,5 @@ func (rc *Cache) connectInit() error {
 }
 
 func init() {
-	cache.Register(cache.SSDBProvider, NewSsdbCache)
+	cache.RegisterContext(cache.SSDBProvider, newSsdbCache)
 }
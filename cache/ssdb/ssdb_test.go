@@ -1,6 +1,7 @@
 package ssdb
 
 import (
+	"context"
 	"strconv"
 	"testing"
 	"time"
@@ -94,6 +95,22 @@ func TestSsdbcacheCache(t *testing.T) {
 		t.Error("getmulti error")
 	}
 
+	// test tags
+	cc := cache.ToContextCache(ssdb)
+	ctx := context.Background()
+	if err = cache.PutWithTags(ctx, cc, "ssdbTagged", "tagged", 10*time.Second, "ssdbTag"); err != nil {
+		t.Error("put with tags err", err)
+	}
+	if v, err := cc.Get(ctx, "ssdbTagged"); err != nil || v.(string) != "tagged" {
+		t.Error("get tagged err", v, err)
+	}
+	if err = cache.InvalidateTags(ctx, cc, "ssdbTag"); err != nil {
+		t.Error("invalidate tags err", err)
+	}
+	if _, err := cc.Get(ctx, "ssdbTagged"); err != cache.ErrCacheMiss {
+		t.Error("invalidated tag err", err)
+	}
+
 	// test clear all done
 	if err = ssdb.ClearAll(); err != nil {
 		t.Error("clear all err")
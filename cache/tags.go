@@ -0,0 +1,108 @@
+// Copyright 2019 asana Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/goasana/config/encoder/json"
+)
+
+// Tagger is implemented by the adapters able to invalidate the values by tags.
+type Tagger interface {
+	// set cached value with key, expire time and tags.
+	PutWithTags(ctx context.Context, key string, val interface{}, timeout time.Duration, tags ...string) error
+	// delete the cached values of the tags.
+	InvalidateTags(ctx context.Context, tags ...string) error
+}
+
+// PrefixDeleter is implemented by the adapters able to delete the keys by prefix.
+type PrefixDeleter interface {
+	// delete the cached values whose key starts with prefix.
+	DeletePrefix(ctx context.Context, prefix string) error
+}
+
+// PutWithTags set cached value with key, expire time and tags, so InvalidateTags deletes it with the other values of a tag.
+// it returns ErrNotSupported when the adapter of c is not a Tagger.
+//	err := cache.PutWithTags(ctx, bm, "user:42:profile", profile, time.Hour, "user:42")
+//	err = cache.InvalidateTags(ctx, bm, "user:42")
+func PutWithTags(ctx context.Context, c ContextCache, key string, val interface{}, timeout time.Duration, tags ...string) error {
+	if t, ok := c.(Tagger); ok {
+		return t.PutWithTags(ctx, key, val, timeout, tags...)
+	}
+	return ErrNotSupported
+}
+
+// InvalidateTags delete the cached values of the tags.
+// it returns ErrNotSupported when the adapter of c is not a Tagger.
+func InvalidateTags(ctx context.Context, c ContextCache, tags ...string) error {
+	if t, ok := c.(Tagger); ok {
+		return t.InvalidateTags(ctx, tags...)
+	}
+	return ErrNotSupported
+}
+
+// DeletePrefix delete the cached values whose key starts with prefix.
+// it returns ErrNotSupported when the adapter of c is not a PrefixDeleter.
+func DeletePrefix(ctx context.Context, c ContextCache, prefix string) error {
+	if d, ok := c.(PrefixDeleter); ok {
+		return d.DeletePrefix(ctx, prefix)
+	}
+	return ErrNotSupported
+}
+
+// TagVersionKey is the key of the version of a tag in the adapters using versioned tags.
+func TagVersionKey(tag string) string {
+	return "asanaCacheTag:" + tag
+}
+
+// NewTagVersion get a new version for an invalidated tag.
+func NewTagVersion() string {
+	return strconv.FormatInt(time.Now().UnixNano(), 36)
+}
+
+// header of the values stored with the versions of their tags
+var taggedHeader = []byte("\x00asanaTags\x00")
+
+// WrapTagged store data with the versions of its tags, for the adapters using versioned tags.
+// the value is a miss once the version of one of its tags changes.
+func WrapTagged(versions map[string]string, data []byte) ([]byte, error) {
+	head, err := json.Encode(versions, false)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 0, len(taggedHeader)+len(head)+1+len(data))
+	buf = append(buf, taggedHeader...)
+	buf = append(buf, head...)
+	buf = append(buf, '\n')
+	return append(buf, data...), nil
+}
+
+// UnwrapTagged get the versions of the tags and the data of a value stored by WrapTagged,
+// ok is false for the values without tags.
+func UnwrapTagged(value []byte) (versions map[string]string, data []byte, ok bool) {
+	if !bytes.HasPrefix(value, taggedHeader) {
+		return nil, value, false
+	}
+	rest := value[len(taggedHeader):]
+	i := bytes.IndexByte(rest, '\n')
+	if i < 0 || json.Decode(rest[:i], &versions) != nil {
+		return nil, value, false
+	}
+	return versions, rest[i+1:], true
+}
@@ -0,0 +1,367 @@
+// Copyright 2019 asana Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultTieredChannel is the channel of the invalidations of the tiered caches.
+var DefaultTieredChannel = "asanaCacheTiered"
+
+// Bus broadcasts the invalidations of the tiered caches to the nodes,
+// the redis adapter is a Bus over redis pub/sub.
+type Bus interface {
+	// send msg to the subscribers of channel.
+	Publish(ctx context.Context, channel string, msg string) error
+	// call handler with the messages of channel until the returned close is called.
+	Subscribe(ctx context.Context, channel string, handler func(msg string)) (close func() error, err error)
+}
+
+// NewMemoryBus create an in-process Bus, it stands for a shared bus in the tests.
+func NewMemoryBus() Bus {
+	return &memoryBus{handlers: make(map[string]map[int]func(string))}
+}
+
+type memoryBus struct {
+	sync.RWMutex
+	last     int
+	handlers map[string]map[int]func(string)
+}
+
+func (b *memoryBus) Publish(ctx context.Context, channel string, msg string) error {
+	b.RLock()
+	handlers := make([]func(string), 0, len(b.handlers[channel]))
+	for _, h := range b.handlers[channel] {
+		handlers = append(handlers, h)
+	}
+	b.RUnlock()
+	for _, h := range handlers {
+		h(msg)
+	}
+	return nil
+}
+
+func (b *memoryBus) Subscribe(ctx context.Context, channel string, handler func(msg string)) (func() error, error) {
+	b.Lock()
+	defer b.Unlock()
+	b.last++
+	id := b.last
+	if b.handlers[channel] == nil {
+		b.handlers[channel] = make(map[int]func(string))
+	}
+	b.handlers[channel][id] = handler
+	return func() error {
+		b.Lock()
+		defer b.Unlock()
+		delete(b.handlers[channel], id)
+		return nil
+	}, nil
+}
+
+// TieredStats counts the hits and the misses of the tiers of a TieredCache.
+type TieredStats struct {
+	LocalHits    int64
+	LocalMisses  int64
+	RemoteHits   int64
+	RemoteMisses int64
+}
+
+// TieredCache keeps the values of a shared remote cache in a bounded local lru.
+// the writes of a node are broadcast on a Bus, so every node drops its local copy of the written keys.
+//	remote, err := cache.NewContextCache(cache.RedisProvider, `{"conn":"127.0.0.1:6379"}`)
+//	tc, err := cache.NewTieredCache(remote, cache.Unwrap(remote).(cache.Bus), 1000, time.Minute)
+//	v, err := tc.Get(ctx, "config")
+type TieredCache struct {
+	// first in the struct, the 64-bit atomic operations need the alignment on 32-bit platforms
+	localHits, localMisses, remoteHits, remoteMisses int64
+
+	local    ContextCache
+	remote   ContextCache
+	localTTL time.Duration
+
+	bus     Bus
+	channel string
+	node    string
+	close   func() error
+}
+
+// NewTieredCache create a TieredCache keeping up to size values of remote for localTTL in the local lru.
+// the invalidations are broadcast on bus, a nil bus is for a single node.
+func NewTieredCache(remote ContextCache, bus Bus, size int, localTTL time.Duration) (*TieredCache, error) {
+	local := newGCache()
+	if err := local.StartAndGC(fmt.Sprintf(`{"size":%d,"type":"lru"}`, size)); err != nil {
+		return nil, err
+	}
+	node := make([]byte, 8)
+	if _, err := rand.Read(node); err != nil {
+		return nil, err
+	}
+	tc := &TieredCache{
+		local:    local,
+		remote:   remote,
+		localTTL: localTTL,
+		bus:      bus,
+		channel:  DefaultTieredChannel,
+		node:     hex.EncodeToString(node),
+	}
+	if bus != nil {
+		closeFn, err := bus.Subscribe(context.Background(), tc.channel, tc.onInvalidate)
+		if err != nil {
+			return nil, err
+		}
+		tc.close = closeFn
+	}
+	return tc, nil
+}
+
+// the kinds of the invalidation messages, "node\nkind[key]", so no key is mistaken for ClearAll
+const (
+	invalidateKey = "k"
+	invalidateAll = "a"
+)
+
+// drop the local copies invalidated by another node
+func (tc *TieredCache) onInvalidate(msg string) {
+	i := strings.IndexByte(msg, '\n')
+	if i < 0 || msg[:i] == tc.node {
+		return
+	}
+	switch body := msg[i+1:]; {
+	case body == invalidateAll:
+		_ = tc.local.ClearAll(context.Background())
+	case strings.HasPrefix(body, invalidateKey):
+		_ = tc.local.Delete(context.Background(), body[len(invalidateKey):])
+	}
+}
+
+// drop the local copies of key in every node
+func (tc *TieredCache) invalidate(ctx context.Context, key string) error {
+	_ = tc.local.Delete(ctx, key)
+	return tc.publish(ctx, invalidateKey+key)
+}
+
+// drop all the local copies in every node
+func (tc *TieredCache) invalidateAllNodes(ctx context.Context) error {
+	_ = tc.local.ClearAll(ctx)
+	return tc.publish(ctx, invalidateAll)
+}
+
+// send the invalidation body to the other nodes
+func (tc *TieredCache) publish(ctx context.Context, body string) error {
+	if tc.bus == nil {
+		return nil
+	}
+	return tc.bus.Publish(ctx, tc.channel, tc.node+"\n"+body)
+}
+
+// Stats get the hits and the misses of the tiers.
+func (tc *TieredCache) Stats() TieredStats {
+	return TieredStats{
+		LocalHits:    atomic.LoadInt64(&tc.localHits),
+		LocalMisses:  atomic.LoadInt64(&tc.localMisses),
+		RemoteHits:   atomic.LoadInt64(&tc.remoteHits),
+		RemoteMisses: atomic.LoadInt64(&tc.remoteMisses),
+	}
+}
+
+// Unwrap get the remote cache
+func (tc *TieredCache) Unwrap() ContextCache {
+	return tc.remote
+}
+
+// Close stop receiving the invalidations of the other nodes.
+func (tc *TieredCache) Close() error {
+	if tc.close == nil {
+		return nil
+	}
+	return tc.close()
+}
+
+// Get get cached value from the local lru, then from the remote cache.
+func (tc *TieredCache) Get(ctx context.Context, key string) (interface{}, error) {
+	if v, err := tc.local.Get(ctx, key); err == nil {
+		atomic.AddInt64(&tc.localHits, 1)
+		return v, nil
+	}
+	atomic.AddInt64(&tc.localMisses, 1)
+
+	v, err := tc.remote.Get(ctx, key)
+	if err == ErrCacheMiss {
+		atomic.AddInt64(&tc.remoteMisses, 1)
+	}
+	if err != nil {
+		return nil, err
+	}
+	atomic.AddInt64(&tc.remoteHits, 1)
+	_ = tc.local.Put(ctx, key, v, tc.localTTL)
+	return v, nil
+}
+
+// GetMulti get cached values from the local lru, then the missing ones from the remote cache.
+func (tc *TieredCache) GetMulti(ctx context.Context, keys []string) ([]interface{}, []error) {
+	values, errs := tc.local.GetMulti(ctx, keys)
+	var missing []string
+	var index []int
+	for i, err := range errs {
+		if err == nil {
+			atomic.AddInt64(&tc.localHits, 1)
+			continue
+		}
+		atomic.AddInt64(&tc.localMisses, 1)
+		missing = append(missing, keys[i])
+		index = append(index, i)
+	}
+	if len(missing) == 0 {
+		return values, errs
+	}
+
+	remotes, remoteErrs := tc.remote.GetMulti(ctx, missing)
+	for j, i := range index {
+		values[i], errs[i] = remotes[j], remoteErrs[j]
+		switch errs[i] {
+		case nil:
+			atomic.AddInt64(&tc.remoteHits, 1)
+			_ = tc.local.Put(ctx, keys[i], values[i], tc.localTTL)
+		case ErrCacheMiss:
+			atomic.AddInt64(&tc.remoteMisses, 1)
+		}
+	}
+	return values, errs
+}
+
+// Put put value to the remote cache and drop the local copies.
+func (tc *TieredCache) Put(ctx context.Context, key string, val interface{}, timeout time.Duration) error {
+	if err := tc.remote.Put(ctx, key, val, timeout); err != nil {
+		return err
+	}
+	return tc.invalidate(ctx, key)
+}
+
+// PutMulti put the values to the remote cache and drop the local copies.
+func (tc *TieredCache) PutMulti(ctx context.Context, items map[string]interface{}, timeout time.Duration) error {
+	if err := tc.remote.PutMulti(ctx, items, timeout); err != nil {
+		return err
+	}
+	for key := range items {
+		if err := tc.invalidate(ctx, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PutWithTags put value with tags to the remote cache and drop the local copies.
+func (tc *TieredCache) PutWithTags(ctx context.Context, key string, val interface{}, timeout time.Duration, tags ...string) error {
+	if err := PutWithTags(ctx, tc.remote, key, val, timeout, tags...); err != nil {
+		return err
+	}
+	return tc.invalidate(ctx, key)
+}
+
+// InvalidateTags delete the values of the tags in the remote cache.
+// the local lru does not know the tags, so every node drops all its local copies.
+func (tc *TieredCache) InvalidateTags(ctx context.Context, tags ...string) error {
+	if err := InvalidateTags(ctx, tc.remote, tags...); err != nil {
+		return err
+	}
+	return tc.invalidateAllNodes(ctx)
+}
+
+// DeletePrefix delete the values whose key starts with prefix in the remote cache,
+// and every node drops all its local copies.
+func (tc *TieredCache) DeletePrefix(ctx context.Context, prefix string) error {
+	if err := DeletePrefix(ctx, tc.remote, prefix); err != nil {
+		return err
+	}
+	return tc.invalidateAllNodes(ctx)
+}
+
+// Delete delete value in the remote cache and drop the local copies.
+func (tc *TieredCache) Delete(ctx context.Context, key string) error {
+	if err := tc.remote.Delete(ctx, key); err != nil {
+		return err
+	}
+	return tc.invalidate(ctx, key)
+}
+
+// DeleteMulti delete the values from the remote cache and drop the local copies.
+func (tc *TieredCache) DeleteMulti(ctx context.Context, keys []string) error {
+	if err := tc.remote.DeleteMulti(ctx, keys); err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := tc.invalidate(ctx, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// IncrBy increase the counter in the remote cache and drop the local copies.
+func (tc *TieredCache) IncrBy(ctx context.Context, key string, n int64) (int64, error) {
+	v, err := tc.remote.IncrBy(ctx, key, n)
+	if err != nil {
+		return 0, err
+	}
+	return v, tc.invalidate(ctx, key)
+}
+
+// DecrBy decrease the counter in the remote cache and drop the local copies.
+func (tc *TieredCache) DecrBy(ctx context.Context, key string, n int64) (int64, error) {
+	v, err := tc.remote.DecrBy(ctx, key, n)
+	if err != nil {
+		return 0, err
+	}
+	return v, tc.invalidate(ctx, key)
+}
+
+// IsExist check value exists in the local lru or in the remote cache.
+func (tc *TieredCache) IsExist(ctx context.Context, key string) (bool, error) {
+	if ok, _ := tc.local.IsExist(ctx, key); ok {
+		return true, nil
+	}
+	return tc.remote.IsExist(ctx, key)
+}
+
+// Touch reset the expiration of the value in the remote cache.
+func (tc *TieredCache) Touch(ctx context.Context, key string, timeout time.Duration) error {
+	return tc.remote.Touch(ctx, key, timeout)
+}
+
+// TTL get the remaining time to live of the value in the remote cache.
+func (tc *TieredCache) TTL(ctx context.Context, key string) (time.Duration, error) {
+	return tc.remote.TTL(ctx, key)
+}
+
+// ClearAll clear the remote cache and the local lru of every node.
+func (tc *TieredCache) ClearAll(ctx context.Context) error {
+	if err := tc.remote.ClearAll(ctx); err != nil {
+		return err
+	}
+	return tc.invalidateAllNodes(ctx)
+}
+
+// StartAndGC does nothing, the tiers are started by NewTieredCache.
+func (tc *TieredCache) StartAndGC(config string) error {
+	return nil
+}
@@ -42,6 +42,7 @@ type AccessLogRecord struct {
 	HTTPReferrer   string        `json:"http_referrer"`
 	HTTPUserAgent  string        `json:"http_user_agent"`
 	RemoteUser     string        `json:"remote_user"`
+	Queries        string        `json:"queries,omitempty"`
 }
 
 func (r *AccessLogRecord) json() ([]byte, error) {
@@ -69,6 +70,9 @@ func AccessLog(r *AccessLogRecord, format string) {
 		timeFormatted := r.RequestTime.Format("02/Jan/2006 03:04:05")
 		msg = fmt.Sprintf(apacheFormatPattern, r.RemoteAddr, timeFormatted, r.Request, r.Status, r.BodyBytesSent,
 			r.ElapsedTime.Seconds(), r.HTTPReferrer, r.HTTPUserAgent)
+		if r.Queries != "" {
+			msg += " " + r.Queries
+		}
 	case jsonFormat:
 		fallthrough
 	default:
@@ -0,0 +1,228 @@
+// Copyright 2019 asana Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"hash/fnv"
+	"time"
+
+	"github.com/goasana/asana/logs"
+	"github.com/goasana/asana/orm"
+)
+
+// LockName is the name of the advisory lock taken while migrations run
+const LockName = "asana_migrations"
+
+var (
+	// LockTimeout is how long a runner waits for another runner to release the lock
+	LockTimeout = time.Minute
+	// LockStaleAge is the age after which the lock of the lock table is taken over,
+	// its runner is assumed to have crashed. it must exceed the longest migration run, 0 never takes it over.
+	// the advisory locks of MySQL and PostgreSQL are released by the database when their session ends.
+	LockStaleAge = 10 * time.Minute
+	// ErrLockTimeout is returned when the migration lock could not be acquired in time
+	ErrLockTimeout = errors.New("<migration> timeout waiting for the migration lock")
+
+	lockRetryInterval = 500 * time.Millisecond
+)
+
+// locker serializes migration runners across processes
+type locker interface {
+	Lock() error
+	Unlock() error
+}
+
+// newLocker returns the advisory lock implementation for the database driver
+func newLocker(dr orm.DriverType, db *sql.DB) locker {
+	switch dr {
+	case orm.DRMySQL, orm.DRTiDB:
+		return &mysqlLocker{db: db}
+	case orm.DRPostgres:
+		return &postgresLocker{db: db}
+	case orm.DRSqlite:
+		return &tableLocker{db: db}
+	}
+	return noopLocker{}
+}
+
+// mysqlLocker uses GET_LOCK, which is bound to the session that took it,
+// so the lock and the release run on the same dedicated connection.
+type mysqlLocker struct {
+	db   *sql.DB
+	conn *sql.Conn
+}
+
+func (l *mysqlLocker) Lock() error {
+	ctx := context.Background()
+	conn, err := l.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	var got sql.NullInt64
+	err = conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", LockName, int(LockTimeout/time.Second)).Scan(&got)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	if !got.Valid || got.Int64 != 1 {
+		conn.Close()
+		return ErrLockTimeout
+	}
+	l.conn = conn
+	return nil
+}
+
+func (l *mysqlLocker) Unlock() error {
+	if l.conn == nil {
+		return nil
+	}
+	defer func() {
+		l.conn.Close()
+		l.conn = nil
+	}()
+	_, err := l.conn.ExecContext(context.Background(), "SELECT RELEASE_LOCK(?)", LockName)
+	return err
+}
+
+// postgresLocker uses a session level advisory lock keyed by a hash of LockName.
+type postgresLocker struct {
+	db   *sql.DB
+	conn *sql.Conn
+}
+
+func (l *postgresLocker) key() int64 {
+	h := fnv.New64a()
+	h.Write([]byte(LockName))
+	return int64(h.Sum64())
+}
+
+func (l *postgresLocker) Lock() error {
+	ctx := context.Background()
+	conn, err := l.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	deadline := time.Now().Add(LockTimeout)
+	for {
+		var got bool
+		err = conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", l.key()).Scan(&got)
+		if err != nil {
+			conn.Close()
+			return err
+		}
+		if got {
+			l.conn = conn
+			return nil
+		}
+		if time.Now().After(deadline) {
+			conn.Close()
+			return ErrLockTimeout
+		}
+		time.Sleep(lockRetryInterval)
+	}
+}
+
+func (l *postgresLocker) Unlock() error {
+	if l.conn == nil {
+		return nil
+	}
+	defer func() {
+		l.conn.Close()
+		l.conn = nil
+	}()
+	_, err := l.conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", l.key())
+	return err
+}
+
+// tableLocker emulates an advisory lock with a single row lock table,
+// for databases such as SQLite that have no native one.
+type tableLocker struct {
+	db *sql.DB
+}
+
+func (l *tableLocker) Lock() error {
+	_, err := l.db.Exec("CREATE TABLE IF NOT EXISTS migrations_lock (id integer NOT NULL PRIMARY KEY, locked_at datetime)")
+	if err != nil {
+		return err
+	}
+	deadline := time.Now().Add(LockTimeout)
+	for {
+		_, err = l.db.Exec("INSERT INTO migrations_lock (id, locked_at) VALUES (1, ?)", time.Now().Format(DBDateFormat))
+		if err == nil {
+			return nil
+		}
+		if took, err := l.takeOverStale(); err != nil {
+			return err
+		} else if took {
+			continue
+		}
+		if time.Now().After(deadline) {
+			return ErrLockTimeout
+		}
+		time.Sleep(lockRetryInterval)
+	}
+}
+
+// delete the lock taken more than LockStaleAge ago, so the next insert takes it
+func (l *tableLocker) takeOverStale() (bool, error) {
+	if LockStaleAge <= 0 {
+		return false, nil
+	}
+	res, err := l.db.Exec("DELETE FROM migrations_lock WHERE id = 1 AND locked_at < ?", time.Now().Add(-LockStaleAge).Format(DBDateFormat))
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if n > 0 {
+		logs.Warn("took over the stale migration lock")
+	}
+	return n > 0, nil
+}
+
+func (l *tableLocker) Unlock() error {
+	_, err := l.db.Exec("DELETE FROM migrations_lock WHERE id = 1")
+	return err
+}
+
+// noopLocker is used for drivers without a lock implementation
+type noopLocker struct{}
+
+func (noopLocker) Lock() error   { return nil }
+func (noopLocker) Unlock() error { return nil }
+
+// withLock runs fn while holding the migration lock of the default database
+func withLock(fn func() error) error {
+	db, err := orm.GetDB()
+	if err != nil {
+		return err
+	}
+	l := newLocker(orm.NewOrm().Driver().Type(), db)
+	if err := l.Lock(); err != nil {
+		logs.Error("acquire migration lock error:", err)
+		return err
+	}
+	defer func() {
+		if err := l.Unlock(); err != nil {
+			logs.Error("release migration lock error:", err)
+		}
+	}()
+	return fn()
+}
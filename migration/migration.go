@@ -23,12 +23,27 @@
 //		`statements` longtext COMMENT 'SQL statements for this migration',
 //		`rollback_statements` longtext,
 //		`status` enum('update','rollback') DEFAULT NULL COMMENT 'update indicates it is a normal migration while rollback means this migration is rolled back',
+//		`checksum` varchar(64) DEFAULT NULL COMMENT 'sha256 of the up statements, used to detect edited migrations',
 //		PRIMARY KEY (`id_migration`)
 //	) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+//
+// The checksum column is added to existing tables by the first Upgrade or Rollback,
+// Status and DryRun do not write the schema.
+//
+// A migration with the status rollback is pending again and is re-applied by the next Upgrade.
+//
+// Upgrade, Rollback and Reset hold an advisory lock for their whole run, so
+// several processes starting together apply each migration only once. Each
+// migration runs in its own transaction on databases with transactional DDL
+// (PostgreSQL and SQLite). On SQLite the lock is a row of the migrations_lock table,
+// it is taken over after LockStaleAge when its runner crashed.
 package migration
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"sort"
 	"strings"
 	"time"
@@ -72,10 +87,35 @@ type Migration struct {
 	RemoveForeigns []*Foreign
 }
 
+// State shows a registered migration and whether it was applied
+type State struct {
+	Name     string
+	Created  int64
+	Status   string // pending, update or rollback
+	Checksum string
+	// Modified is true when the migration was applied with other statements than it has now
+	Modified bool
+	// Statements holds the SQL Upgrade would run, only filled for pending migrations
+	Statements []string
+}
+
+// status of a migration which has not been applied yet
+const statusPending = "pending"
+
 var (
 	migrationMap map[string]Migrationer
+
+	// ErrModified is returned when an applied migration was changed afterwards
+	ErrModified = errors.New("<migration> applied migration has been modified")
 )
 
+// statementer is implemented by migrations which let the runner execute their
+// statements on a given Ormer, so they can be wrapped in a transaction
+type statementer interface {
+	Statements() []string
+	ExecWith(o orm.Ormer, name, status string) error
+}
+
 func init() {
 	migrationMap = make(map[string]Migrationer)
 }
@@ -120,9 +160,18 @@ func (m *Migration) Reset() {
 	m.sqls = make([]string, 0)
 }
 
+// Statements return the sql already add
+func (m *Migration) Statements() []string {
+	return m.sqls
+}
+
 // Exec execute the sql already add in the sql
 func (m *Migration) Exec(name, status string) error {
-	o := orm.NewOrm()
+	return m.ExecWith(orm.NewOrm(), name, status)
+}
+
+// ExecWith execute the sql already add on the given Ormer, which may be in a transaction
+func (m *Migration) ExecWith(o orm.Ormer, name, status string) error {
 	for _, s := range m.sqls {
 		logs.Info("exec sql:", s)
 		r := o.Raw(s)
@@ -131,26 +180,19 @@ func (m *Migration) Exec(name, status string) error {
 			return err
 		}
 	}
-	return m.addOrUpdateRecord(name, status)
+	return m.addOrUpdateRecord(o, name, status)
 }
 
-func (m *Migration) addOrUpdateRecord(name, status string) error {
-	o := orm.NewOrm()
+func (m *Migration) addOrUpdateRecord(o orm.Ormer, name, status string) error {
 	if status == "down" {
 		status = "rollback"
-		p, err := o.Raw("update migrations set status = ?, rollback_statements = ?, created_at = ? where name = ?").Prepare()
-		if err != nil {
-			return nil
-		}
-		_, err = p.Exec(status, strings.Join(m.sqls, "; "), time.Now().Format(DBDateFormat), name)
+		_, err := o.Raw("update migrations set status = ?, rollback_statements = ?, created_at = ? where name = ?",
+			status, strings.Join(m.sqls, "; "), time.Now().Format(DBDateFormat), name).Exec()
 		return err
 	}
 	status = "update"
-	p, err := o.Raw("insert into migrations(name, created_at, statements, status) values(?,?,?,?)").Prepare()
-	if err != nil {
-		return err
-	}
-	_, err = p.Exec(name, time.Now().Format(DBDateFormat), strings.Join(m.sqls, "; "), status)
+	_, err := o.Raw("insert into migrations(name, created_at, statements, status, checksum) values(?,?,?,?,?)",
+		name, time.Now().Format(DBDateFormat), strings.Join(m.sqls, "; "), status, checksum(m.sqls)).Exec()
 	return err
 }
 
@@ -174,44 +216,62 @@ func Register(name string, m Migrationer) error {
 
 // Upgrade upgrade the migration from lasttime
 func Upgrade(lasttime int64) error {
-	sm := sortMap(migrationMap)
-	i := 0
-	migs, _ := getAllMigrations()
-	for _, v := range sm {
-		if _, ok := migs[v.name]; !ok {
-			logs.Info("start upgrade", v.name)
-			v.m.Reset()
-			v.m.Up()
-			err := v.m.Exec(v.name, "up")
+	return withLock(func() error {
+		if err := ensureChecksumColumn(orm.NewOrm()); err != nil {
+			logs.Error("execute error:", err)
+			return err
+		}
+		states, err := getStates()
+		if err != nil {
+			logs.Error("execute error:", err)
+			time.Sleep(2 * time.Second)
+			return err
+		}
+		if err := checkModified(states); err != nil {
+			logs.Error("execute error:", err)
+			time.Sleep(2 * time.Second)
+			return err
+		}
+		i := 0
+		for _, st := range states {
+			if st.Status == "update" {
+				continue
+			}
+			logs.Info("start upgrade", st.Name)
+			err := run(st.Name, migrationMap[st.Name], "up")
 			if err != nil {
 				logs.Error("execute error:", err)
 				time.Sleep(2 * time.Second)
 				return err
 			}
-			logs.Info("end upgrade:", v.name)
+			logs.Info("end upgrade:", st.Name)
 			i++
 		}
-	}
-	logs.Info("total success upgrade:", i, " migration")
-	time.Sleep(2 * time.Second)
-	return nil
+		logs.Info("total success upgrade:", i, " migration")
+		time.Sleep(2 * time.Second)
+		return nil
+	})
 }
 
 // Rollback rollback the migration by the name
 func Rollback(name string) error {
 	if v, ok := migrationMap[name]; ok {
-		logs.Info("start rollback")
-		v.Reset()
-		v.Down()
-		err := v.Exec(name, "down")
-		if err != nil {
-			logs.Error("execute error:", err)
+		return withLock(func() error {
+			if err := ensureChecksumColumn(orm.NewOrm()); err != nil {
+				logs.Error("execute error:", err)
+				return err
+			}
+			logs.Info("start rollback")
+			err := run(name, v, "down")
+			if err != nil {
+				logs.Error("execute error:", err)
+				time.Sleep(2 * time.Second)
+				return err
+			}
+			logs.Info("end rollback")
 			time.Sleep(2 * time.Second)
-			return err
-		}
-		logs.Info("end rollback")
-		time.Sleep(2 * time.Second)
-		return nil
+			return nil
+		})
 	}
 	logs.Error("not exist the migrationMap name:" + name)
 	time.Sleep(2 * time.Second)
@@ -221,30 +281,71 @@ func Rollback(name string) error {
 // Reset reset all migration
 // run all migration's down function
 func Reset() error {
-	sm := sortMap(migrationMap)
-	i := 0
-	for j := len(sm) - 1; j >= 0; j-- {
-		v := sm[j]
-		if isRollBack(v.name) {
-			logs.Info("skip the", v.name)
-			time.Sleep(1 * time.Second)
-			continue
+	return withLock(func() error {
+		sm := sortMap(migrationMap)
+		i := 0
+		for j := len(sm) - 1; j >= 0; j-- {
+			v := sm[j]
+			if isRollBack(v.name) {
+				logs.Info("skip the", v.name)
+				time.Sleep(1 * time.Second)
+				continue
+			}
+			logs.Info("start reset:", v.name)
+			err := run(v.name, v.m, "down")
+			if err != nil {
+				logs.Error("execute error:", err)
+				time.Sleep(2 * time.Second)
+				return err
+			}
+			i++
+			logs.Info("end reset:", v.name)
 		}
-		logs.Info("start reset:", v.name)
-		v.m.Reset()
-		v.m.Down()
-		err := v.m.Exec(v.name, "down")
-		if err != nil {
-			logs.Error("execute error:", err)
-			time.Sleep(2 * time.Second)
-			return err
+		logs.Info("total success reset:", i, " migration")
+		time.Sleep(2 * time.Second)
+		return nil
+	})
+}
+
+// Status return every registered migration with its state in the database,
+// and print the statements of the pending ones
+func Status() ([]*State, error) {
+	states, err := getStates()
+	if err != nil {
+		return nil, err
+	}
+	for _, st := range states {
+		flag := st.Status
+		if st.Modified {
+			flag += ", modified"
 		}
-		i++
-		logs.Info("end reset:", v.name)
+		logs.Info(fmt.Sprintf("%s [%s]", st.Name, flag))
+		printStatements(st)
 	}
-	logs.Info("total success reset:", i, " migration")
-	time.Sleep(2 * time.Second)
-	return nil
+	return states, nil
+}
+
+// DryRun return the migrations Upgrade would apply and print their statements
+// without executing anything
+func DryRun() ([]*State, error) {
+	states, err := getStates()
+	if err != nil {
+		return nil, err
+	}
+	if err := checkModified(states); err != nil {
+		return nil, err
+	}
+	pending := make([]*State, 0, len(states))
+	for _, st := range states {
+		if st.Status == "update" {
+			continue
+		}
+		logs.Info("pending:", st.Name)
+		printStatements(st)
+		pending = append(pending, st)
+	}
+	logs.Info("total pending:", len(pending), " migration")
+	return pending, nil
 }
 
 // Refresh first Reset, then Upgrade
@@ -295,10 +396,142 @@ func sortMap(m map[string]Migrationer) dataSlice {
 	return s
 }
 
+// run the up or down statements of m, in a transaction when the database
+// supports transactional DDL
+func run(name string, m Migrationer, status string) error {
+	m.Reset()
+	if status == "up" {
+		m.Up()
+	} else {
+		m.Down()
+	}
+	sm, ok := m.(statementer)
+	if !ok {
+		return m.Exec(name, status)
+	}
+	o := orm.NewOrm()
+	if !transactionalDDL(o.Driver().Type()) {
+		return sm.ExecWith(o, name, status)
+	}
+	if err := o.Begin(); err != nil {
+		return err
+	}
+	if err := sm.ExecWith(o, name, status); err != nil {
+		if rerr := o.Rollback(); rerr != nil {
+			logs.Error("rollback transaction error:", rerr)
+		}
+		return err
+	}
+	return o.Commit()
+}
+
+// transactionalDDL report whether DDL statements can be rolled back on the driver.
+// MySQL commits implicitly on every DDL statement.
+func transactionalDDL(dr orm.DriverType) bool {
+	switch dr {
+	case orm.DRPostgres, orm.DRSqlite:
+		return true
+	}
+	return false
+}
+
+// checksum of the statements of a migration
+func checksum(sqls []string) string {
+	sum := sha256.Sum256([]byte(strings.Join(sqls, ";\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+// upStatements return the statements Upgrade would run for m
+func upStatements(m Migrationer) ([]string, bool) {
+	sm, ok := m.(statementer)
+	if !ok {
+		return nil, false
+	}
+	m.Reset()
+	m.Up()
+	sqls := append([]string(nil), sm.Statements()...)
+	m.Reset()
+	return sqls, true
+}
+
+// getStates join the registered migrations with the records of the migrations table
+// the checksums are ignored until the checksum column is added by Upgrade or Rollback.
+func getStates() ([]*State, error) {
+	o := orm.NewOrm()
+	query := "select name, status from migrations order by id_migration"
+	if hasChecksumColumn(o) {
+		query = "select name, status, checksum from migrations order by id_migration"
+	}
+	var maps []orm.Params
+	_, err := o.Raw(query).Values(&maps)
+	if err != nil {
+		return nil, err
+	}
+	records := make(map[string]orm.Params, len(maps))
+	for _, v := range maps {
+		// later records win, a migration may be applied again after a rollback
+		records[orm.ToStr(v["name"])] = v
+	}
+
+	sm := sortMap(migrationMap)
+	states := make([]*State, 0, len(sm))
+	for _, v := range sm {
+		st := &State{Name: v.name, Created: v.created, Status: statusPending}
+		sqls, ok := upStatements(v.m)
+		if ok {
+			st.Checksum = checksum(sqls)
+		}
+		if r, applied := records[v.name]; applied {
+			st.Status = orm.ToStr(r["status"])
+			// records written before checksums existed cannot be verified
+			if ok && st.Status == "update" && r["checksum"] != nil {
+				st.Modified = orm.ToStr(r["checksum"]) != st.Checksum
+			}
+		}
+		if st.Status != "update" {
+			st.Statements = sqls
+		}
+		states = append(states, st)
+	}
+	return states, nil
+}
+
+// checkModified return ErrModified if any applied migration has been edited
+func checkModified(states []*State) error {
+	for _, st := range states {
+		if st.Modified {
+			return fmt.Errorf("%s: %s", ErrModified, st.Name)
+		}
+	}
+	return nil
+}
+
+// hasChecksumColumn report whether the migrations table has the checksum column
+func hasChecksumColumn(o orm.Ormer) bool {
+	_, err := o.Raw("select checksum from migrations where 1 = 0").Exec()
+	return err == nil
+}
+
+// ensureChecksumColumn add the checksum column to migrations tables created before it existed,
+// it is called under the migration lock
+func ensureChecksumColumn(o orm.Ormer) error {
+	if hasChecksumColumn(o) {
+		return nil
+	}
+	_, err := o.Raw("alter table migrations add column checksum varchar(64)").Exec()
+	return err
+}
+
+func printStatements(st *State) {
+	for _, s := range st.Statements {
+		logs.Info("    " + s)
+	}
+}
+
 func isRollBack(name string) bool {
 	o := orm.NewOrm()
 	var maps []orm.Params
-	num, err := o.Raw("select * from migrations where `name` = ? order by id_migration desc", name).Values(&maps)
+	num, err := o.Raw("select status from migrations where name = ? order by id_migration desc", name).Values(&maps)
 	if err != nil {
 		logs.Info("get name has error", err)
 		return false
@@ -311,20 +544,3 @@ func isRollBack(name string) bool {
 	}
 	return false
 }
-func getAllMigrations() (map[string]string, error) {
-	o := orm.NewOrm()
-	var maps []orm.Params
-	migs := make(map[string]string)
-	num, err := o.Raw("select * from migrations order by id_migration desc").Values(&maps)
-	if err != nil {
-		logs.Info("get name has error", err)
-		return migs, err
-	}
-	if num > 0 {
-		for _, v := range maps {
-			name := v["name"].(string)
-			migs[name] = v["status"].(string)
-		}
-	}
-	return migs, nil
-}
@@ -0,0 +1,222 @@
+// Copyright 2014 beego Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migration
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/goasana/asana/orm"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+type testMigration struct {
+	Migration
+	up   []string
+	down []string
+}
+
+func (m *testMigration) Up() {
+	for _, s := range m.up {
+		m.SQL(s)
+	}
+}
+
+func (m *testMigration) Down() {
+	for _, s := range m.down {
+		m.SQL(s)
+	}
+}
+
+func TestMain(m *testing.M) {
+	dir, err := ioutil.TempDir("", "migration")
+	if err != nil {
+		panic(err)
+	}
+	if err := orm.RegisterDataBase("default", "sqlite3", filepath.Join(dir, "migration.db")); err != nil {
+		panic(err)
+	}
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// setup recreate the migrations table, without the checksum column when old is true
+func setup(t *testing.T, old bool) {
+	migrationMap = make(map[string]Migrationer)
+	o := orm.NewOrm()
+	for _, s := range []string{
+		"drop table if exists migrations",
+		"drop table if exists migrations_lock",
+		"drop table if exists t1",
+		"drop table if exists t2",
+	} {
+		if _, err := o.Raw(s).Exec(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	create := `create table migrations (id_migration integer primary key autoincrement, name varchar(255),
+		created_at datetime, statements text, rollback_statements text, status varchar(20)`
+	if !old {
+		create += ", checksum varchar(64)"
+	}
+	if _, err := o.Raw(create + ")").Exec(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func register(t *testing.T, name string, up, down []string) *testMigration {
+	m := &testMigration{Migration: Migration{Created: "20190101_000000"}, up: up, down: down}
+	if err := Register(name, m); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func tableExists(t *testing.T, name string) bool {
+	var maps []orm.Params
+	_, err := orm.NewOrm().Raw("select name from sqlite_master where type = 'table' and name = ?", name).Values(&maps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(maps) > 0
+}
+
+func TestTableLocker(t *testing.T) {
+	setup(t, false)
+	db, err := orm.GetDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(timeout time.Duration) { LockTimeout = timeout }(LockTimeout)
+	LockTimeout = 0
+
+	l := &tableLocker{db: db}
+	if err := l.Lock(); err != nil {
+		t.Fatal(err)
+	}
+	if err := (&tableLocker{db: db}).Lock(); err != ErrLockTimeout {
+		t.Fatalf("second lock: got %v, want ErrLockTimeout", err)
+	}
+	if err := l.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Lock(); err != nil {
+		t.Fatal(err)
+	}
+
+	// a lock left by a crashed runner is taken over once it is stale
+	stale := time.Now().Add(-2 * LockStaleAge).Format(DBDateFormat)
+	if _, err := db.Exec("UPDATE migrations_lock SET locked_at = ? WHERE id = 1", stale); err != nil {
+		t.Fatal(err)
+	}
+	if err := (&tableLocker{db: db}).Lock(); err != nil {
+		t.Fatalf("stale lock was not taken over: %v", err)
+	}
+	if err := l.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUpgradeChecksum(t *testing.T) {
+	setup(t, false)
+	m := register(t, "create_t1", []string{"create table t1 (id integer)"}, []string{"drop table t1"})
+	if err := Upgrade(0); err != nil {
+		t.Fatal(err)
+	}
+	if !tableExists(t, "t1") {
+		t.Fatal("t1 was not created")
+	}
+	states, err := Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(states) != 1 || states[0].Status != "update" || states[0].Modified {
+		t.Fatalf("unexpected states after upgrade: %+v", states[0])
+	}
+
+	m.up = []string{"create table t1 (id integer, name text)"}
+	if _, err := DryRun(); err == nil || !strings.HasPrefix(err.Error(), ErrModified.Error()) {
+		t.Fatalf("edited migration: got %v, want ErrModified", err)
+	}
+	if err := Upgrade(0); err == nil || !strings.HasPrefix(err.Error(), ErrModified.Error()) {
+		t.Fatalf("upgrade of an edited migration: got %v, want ErrModified", err)
+	}
+	m.up = []string{"create table t1 (id integer)"}
+
+	// a rolled back migration is pending again
+	if err := Rollback("create_t1"); err != nil {
+		t.Fatal(err)
+	}
+	if tableExists(t, "t1") {
+		t.Fatal("t1 was not dropped")
+	}
+	states, err = DryRun()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(states) != 1 || states[0].Status != "rollback" {
+		t.Fatalf("unexpected pending migrations after rollback: %+v", states)
+	}
+	if err := Upgrade(0); err != nil {
+		t.Fatal(err)
+	}
+	if !tableExists(t, "t1") {
+		t.Fatal("t1 was not created again")
+	}
+}
+
+func TestStatusReadOnly(t *testing.T) {
+	setup(t, true)
+	register(t, "create_t1", []string{"create table t1 (id integer)"}, nil)
+	o := orm.NewOrm()
+	if _, err := Status(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DryRun(); err != nil {
+		t.Fatal(err)
+	}
+	if hasChecksumColumn(o) {
+		t.Fatal("Status added the checksum column")
+	}
+	if err := Upgrade(0); err != nil {
+		t.Fatal(err)
+	}
+	if !hasChecksumColumn(o) {
+		t.Fatal("Upgrade did not add the checksum column")
+	}
+}
+
+func TestUpgradeTransaction(t *testing.T) {
+	setup(t, false)
+	register(t, "broken", []string{"create table t2 (id integer)", "insert into missing values (1)"}, nil)
+	if err := Upgrade(0); err == nil {
+		t.Fatal("expected the upgrade to fail")
+	}
+	if tableExists(t, "t2") {
+		t.Fatal("the statements of the failed migration were not rolled back")
+	}
+	var maps []orm.Params
+	if _, err := orm.NewOrm().Raw("select name from migrations").Values(&maps); err != nil {
+		t.Fatal(err)
+	}
+	if len(maps) != 0 {
+		t.Fatalf("the failed migration was recorded: %v", maps)
+	}
+}
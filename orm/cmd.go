@@ -36,6 +36,7 @@ func printHelp(errs ...string) {
 
     syncdb     - auto create tables
     sqlall     - print sql of create tables
+    models     - generate models from the database tables
     help       - print this help
 `
 
@@ -263,6 +264,7 @@ func (d *commandSQLAll) Run() error {
 func init() {
 	commands["syncdb"] = new(commandSyncDb)
 	commands["sqlall"] = new(commandSQLAll)
+	commands["models"] = new(commandModels)
 }
 
 // RunSyncdb run syncdb command line.
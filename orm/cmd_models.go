@@ -0,0 +1,629 @@
+// Copyright 2019 asana Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package orm
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// generate models from the database tables command.
+type commandModels struct {
+	al     *alias
+	pkg    string
+	tables []string
+	output string
+}
+
+// parse orm command line arguments.
+func (d *commandModels) Parse(args []string) {
+	var name, tables string
+
+	flagSet := flag.NewFlagSet("orm command: models", flag.ExitOnError)
+	flagSet.StringVar(&name, "db", "default", "DataBase alias name")
+	flagSet.StringVar(&d.pkg, "pkg", "models", "package name of the models")
+	flagSet.StringVar(&tables, "tables", "", "comma separated table names, all the tables by default")
+	flagSet.StringVar(&d.output, "o", "", "output file, print the models by default")
+	_ = flagSet.Parse(args)
+
+	d.al = getDbAlias(name)
+	for _, table := range strings.Split(tables, ",") {
+		if table = strings.TrimSpace(table); table != "" {
+			d.tables = append(d.tables, table)
+		}
+	}
+}
+
+// run orm line command.
+func (d *commandModels) Run() error {
+	src, err := generateModels(d.al, d.pkg, d.tables)
+	if err != nil {
+		fmt.Printf("    %s\n", err.Error())
+		return err
+	}
+
+	if d.output == "" {
+		fmt.Print(string(src))
+		return nil
+	}
+	if err := ioutil.WriteFile(d.output, src, 0644); err != nil {
+		fmt.Printf("    %s\n", err.Error())
+		return err
+	}
+	fmt.Printf("write models to `%s`\n", d.output)
+	return nil
+}
+
+// GenerateModels generate the go source of the models of the tables in database.
+// name means table's alias name. default is "default".
+// all the tables are generated if no tables are given.
+// the columns, indexes and foreign keys are mapped to the fields, orm tags and relations.
+func GenerateModels(name string, pkg string, tables ...string) ([]byte, error) {
+	return generateModels(getDbAlias(name), pkg, tables)
+}
+
+// the methods of models, they can not be the field names.
+var modelMethodNames = []string{"TableName", "TableIndex", "TableUnique", "TableEngine"}
+
+// a model generated from a table
+type genModel struct {
+	name    string
+	schema  *tableSchema
+	names   map[string]bool
+	columns map[string]string // the field names of the columns
+	rels    map[string]*foreignKeySchema
+	ones    map[string]bool
+	fields  []*genField
+	indexes [][]string
+	uniques [][]string
+	comment string
+	// the model has no primary key orm can use, it is not registered
+	unregistered bool
+}
+
+type genField struct {
+	name    string
+	typ     string
+	tags    []string
+	comment string
+}
+
+func generateModels(al *alias, pkg string, tables []string) ([]byte, error) {
+	exists, err := al.DbBaser.GetTables(al.DB)
+	if err != nil {
+		return nil, err
+	}
+	if len(tables) == 0 {
+		for table := range exists {
+			if !strings.HasPrefix(table, "sqlite_") {
+				tables = append(tables, table)
+			}
+		}
+	} else {
+		for _, table := range tables {
+			if !exists[table] {
+				return nil, fmt.Errorf("table `%s` not found", table)
+			}
+		}
+	}
+	if len(tables) == 0 {
+		return nil, fmt.Errorf("no tables found")
+	}
+	sort.Strings(tables)
+
+	names := make(map[string]bool)
+	models := make(map[string]*genModel, len(tables))
+	for _, table := range tables {
+		schema, err := al.DbBaser.GetTableSchema(al.DB, table)
+		if err != nil {
+			return nil, fmt.Errorf("read schema of table `%s`, %s", table, err.Error())
+		}
+		m := &genModel{
+			name:    uniqueName(names, goName(table)),
+			schema:  schema,
+			names:   make(map[string]bool),
+			columns: make(map[string]string),
+		}
+		for _, name := range modelMethodNames {
+			m.names[name] = true
+		}
+		models[table] = m
+	}
+
+	for _, table := range tables {
+		models[table].genRels(models)
+	}
+	for _, table := range tables {
+		m := models[table]
+		m.genFields(models)
+		if m.unregistered {
+			fmt.Fprintf(os.Stderr, "table `%s` has no single primary key, the model %s is not registered\n", table, m.name)
+		}
+	}
+	for _, table := range tables {
+		models[table].genReverses(models, tables)
+	}
+	for _, table := range tables {
+		models[table].genIndexes()
+	}
+	return renderModels(pkg, tables, models)
+}
+
+// check the column is the single primary key of the model
+func (m *genModel) isPk(column string) bool {
+	pks := m.schema.pkColumns()
+	return len(pks) == 1 && (column == "" || pks[0].name == column)
+}
+
+// the relations are the single column foreign keys to the primary keys of the generated models.
+func (m *genModel) genRels(models map[string]*genModel) {
+	m.rels = make(map[string]*foreignKeySchema)
+	m.ones = make(map[string]bool)
+
+	columns := make(map[string]int)
+	for _, fk := range m.schema.foreignKeys {
+		columns[fk.name]++
+	}
+	for _, fk := range m.schema.foreignKeys {
+		rm, ok := models[fk.refTable]
+		if !ok || columns[fk.name] != 1 || !rm.isPk(fk.refColumn) || m.rels[fk.column] != nil {
+			continue
+		}
+		m.rels[fk.column] = fk
+	}
+
+	// the foreign key with an unique index or being the primary key is one to one
+	for column := range m.rels {
+		if m.isPk(column) {
+			m.ones[column] = true
+		}
+	}
+	for _, idx := range m.schema.indexes {
+		if len(idx.columns) == 1 && (idx.unique || idx.primary) && m.rels[idx.columns[0]] != nil {
+			m.ones[idx.columns[0]] = true
+		}
+	}
+}
+
+func (m *genModel) genFields(models map[string]*genModel) {
+	pks := m.schema.pkColumns()
+	if len(pks) == 0 {
+		m.comment = "the table has no primary key, set the pk of the model"
+	} else if len(pks) > 1 {
+		var fields []string
+		for _, c := range pks {
+			fields = append(fields, c.name)
+		}
+		m.comment = fmt.Sprintf("the composite primary key (%s) is not supported, it is kept as an unique index", strings.Join(fields, ", "))
+	}
+	// orm uses an integer field named id as the primary key when none is set
+	if len(pks) != 1 {
+		m.unregistered = true
+		for _, c := range m.schema.columns {
+			if typ, _, _ := columnGoType(c); strings.EqualFold(c.name, "id") && strings.Contains(typ, "int") {
+				m.unregistered = false
+			}
+		}
+		if m.unregistered {
+			m.comment += " and register it"
+		}
+	}
+
+	// the single column indexes are the field tags
+	unique := make(map[string]bool)
+	index := make(map[string]bool)
+	for _, idx := range m.schema.indexes {
+		if len(idx.columns) == 1 && !idx.primary {
+			if idx.unique {
+				unique[idx.columns[0]] = true
+			} else {
+				index[idx.columns[0]] = true
+			}
+		}
+	}
+
+	for _, c := range m.schema.columns {
+		f := new(genField)
+		pk := c.pk && len(pks) == 1
+
+		if fk, ok := m.rels[c.name]; ok {
+			f.name = uniqueName(m.names, goName(strings.TrimSuffix(c.name, "_id")))
+			f.typ = "*" + models[fk.refTable].name
+			if pk {
+				f.tags = append(f.tags, "pk")
+			}
+			if m.ones[c.name] {
+				f.tags = append(f.tags, "rel(one)")
+			} else {
+				f.tags = append(f.tags, "rel(fk)")
+			}
+			if nameStrategyMap[nameStrategy](f.name)+"_id" != c.name {
+				f.tags = append(f.tags, fmt.Sprintf("column(%s)", c.name))
+			}
+			if c.null {
+				f.tags = append(f.tags, "null")
+			}
+			if index[c.name] {
+				f.tags = append(f.tags, "index")
+			}
+			if od := onDeleteTag(fk.onDelete, c); od != "" {
+				f.tags = append(f.tags, fmt.Sprintf("on_delete(%s)", od))
+			}
+		} else {
+			var typeTags []string
+			f.name = uniqueName(m.names, goName(c.name))
+			f.typ, typeTags, f.comment = columnGoType(c)
+			if nameStrategyMap[nameStrategy](f.name) != c.name {
+				f.tags = append(f.tags, fmt.Sprintf("column(%s)", c.name))
+			}
+			if pk {
+				if c.auto && strings.Contains(f.typ, "int") {
+					f.tags = append(f.tags, "auto")
+				} else {
+					f.tags = append(f.tags, "pk")
+				}
+			}
+			def, now := columnDefault(c)
+			if f.typ == "time.Time" {
+				if c.autoNow {
+					f.tags = append(f.tags, "auto_now")
+				} else if now {
+					f.tags = append(f.tags, "auto_now_add")
+				}
+			}
+			f.tags = append(f.tags, typeTags...)
+			if c.null && !pk {
+				f.tags = append(f.tags, "null")
+			}
+			if unique[c.name] && !pk {
+				f.tags = append(f.tags, "unique")
+			}
+			if index[c.name] && !pk {
+				f.tags = append(f.tags, "index")
+			}
+			if def != "" && !pk {
+				f.tags = append(f.tags, fmt.Sprintf("default(%s)", def))
+			}
+		}
+		m.columns[c.name] = f.name
+		m.fields = append(m.fields, f)
+	}
+}
+
+// the reverse fields of the relations to the model, in the order of the relations as orm pairs them.
+// the fields of several relations from a model are prefixed by the names of the relations.
+func (m *genModel) genReverses(models map[string]*genModel, tables []string) {
+	for _, table := range tables {
+		src := models[table]
+		if src.unregistered {
+			continue
+		}
+		var columns []string
+		for _, c := range src.schema.columns {
+			if fk, ok := src.rels[c.name]; ok && fk.refTable == m.schema.name {
+				columns = append(columns, c.name)
+			}
+		}
+		for _, column := range columns {
+			prefix := ""
+			if len(columns) > 1 {
+				prefix = goName(strings.TrimSuffix(column, "_id"))
+			}
+			f := new(genField)
+			if src.ones[column] {
+				f.name = uniqueName(m.names, prefix+src.name)
+				f.typ = "*" + src.name
+				f.tags = []string{"reverse(one)"}
+			} else {
+				f.name = uniqueName(m.names, prefix+pluralName(src.name))
+				f.typ = "[]*" + src.name
+				f.tags = []string{"reverse(many)"}
+			}
+			m.fields = append(m.fields, f)
+		}
+	}
+}
+
+// the multiple columns indexes are the TableIndex and TableUnique of the model
+func (m *genModel) genIndexes() {
+	pks := m.schema.pkColumns()
+	if len(pks) > 1 {
+		var fields []string
+		for _, c := range pks {
+			fields = append(fields, m.columns[c.name])
+		}
+		m.uniques = append(m.uniques, fields)
+	}
+	for _, idx := range m.schema.indexes {
+		if len(idx.columns) < 2 || idx.primary {
+			continue
+		}
+		var fields []string
+		for _, column := range idx.columns {
+			name, ok := m.columns[column]
+			if !ok {
+				// the expression indexes
+				fields = nil
+				break
+			}
+			fields = append(fields, name)
+		}
+		if len(fields) == 0 {
+			continue
+		}
+		if idx.unique {
+			m.uniques = append(m.uniques, fields)
+		} else {
+			m.indexes = append(m.indexes, fields)
+		}
+	}
+}
+
+// get the go type and the type tags of a column
+func columnGoType(c *columnSchema) (typ string, tags []string, comment string) {
+	integer := func(signed, unsigned string) string {
+		if c.unsigned {
+			return unsigned
+		}
+		return signed
+	}
+
+	switch c.dataType {
+	case "bool", "boolean":
+		typ = "bool"
+	case "bit":
+		typ = "bool"
+		if c.size > 1 {
+			typ = "uint64"
+		}
+	case "tinyint":
+		typ = integer("int8", "uint8")
+		if c.size == 1 {
+			typ = "bool"
+		}
+	case "smallint", "int2", "smallserial":
+		typ = integer("int16", "uint16")
+	case "mediumint", "int", "integer", "int4", "serial":
+		typ = integer("int", "uint")
+	case "bigint", "int8", "bigserial":
+		typ = integer("int64", "uint64")
+	case "float", "double", "double precision", "real", "float4", "float8":
+		typ = "float64"
+	case "decimal", "numeric":
+		typ = "float64"
+		if c.digits > 0 {
+			tags = append(tags, fmt.Sprintf("digits(%d)", c.digits), fmt.Sprintf("decimals(%d)", c.decimals))
+		}
+	case "char", "character", "nchar", "bpchar":
+		typ = "string"
+		tags = append(tags, "type(char)")
+		if c.size > 0 {
+			tags = append(tags, fmt.Sprintf("size(%d)", c.size))
+		}
+	case "varchar", "character varying", "nvarchar", "varchar2":
+		typ = "string"
+		if c.size == 0 {
+			tags = append(tags, "type(text)")
+		} else if c.size != 255 {
+			tags = append(tags, fmt.Sprintf("size(%d)", c.size))
+		}
+	case "text", "tinytext", "mediumtext", "longtext", "clob", "ntext":
+		typ = "string"
+		tags = append(tags, "type(text)")
+	case "date":
+		typ = "time.Time"
+		tags = append(tags, "type(date)")
+	case "datetime", "timestamp", "timestamp with time zone", "timestamp without time zone", "timestamptz":
+		typ = "time.Time"
+	case "time", "time with time zone", "time without time zone", "timetz":
+		typ = "time.Time"
+		tags = append(tags, "type(time)")
+	case "json", "jsonb":
+		typ = "string"
+		tags = append(tags, fmt.Sprintf("type(%s)", c.dataType))
+	default:
+		typ = "string"
+		comment = fmt.Sprintf("column type %s", c.dataType)
+	}
+	return
+}
+
+// get the simple literal default of a column, or now is true for the current time defaults.
+func columnDefault(c *columnSchema) (value string, now bool) {
+	if !c.def.Valid {
+		return
+	}
+	raw := strings.TrimSpace(c.def.String)
+	lower := strings.ToLower(raw)
+	for _, f := range []string{"current_timestamp", "now()", "current_date", "current_time", "localtimestamp", "'now'"} {
+		if strings.Contains(lower, f) {
+			return "", true
+		}
+	}
+
+	if strings.HasPrefix(raw, "'") {
+		// the quoted string with the postgresql type cast, such as 'a''b'::character varying
+		var buf []byte
+		i := 1
+		for ; i < len(raw); i++ {
+			if raw[i] == '\'' {
+				if i+1 < len(raw) && raw[i+1] == '\'' {
+					buf = append(buf, '\'')
+					i++
+					continue
+				}
+				break
+			}
+			buf = append(buf, raw[i])
+		}
+		if i >= len(raw) || i+1 < len(raw) && !strings.HasPrefix(raw[i+1:], "::") {
+			return
+		}
+		value = string(buf)
+	} else {
+		if i := strings.Index(raw, "::"); i != -1 {
+			raw = raw[:i]
+		}
+		raw = strings.TrimSuffix(strings.TrimPrefix(raw, "("), ")")
+		lower = strings.ToLower(raw)
+		if _, err := strconv.ParseFloat(raw, 64); err != nil && lower != "true" && lower != "false" {
+			return
+		}
+		value = raw
+	}
+	// the tag value can not contain these
+	if strings.ContainsAny(value, ");\"`") {
+		return "", false
+	}
+	return value, false
+}
+
+// get the on_delete tag of the referential action, cascade is the default.
+func onDeleteTag(action string, c *columnSchema) string {
+	switch strings.ToUpper(action) {
+	case "SET NULL":
+		if c.null {
+			return odSetNULL
+		}
+	case "SET DEFAULT":
+		if c.def.Valid {
+			return odSetDefault
+		}
+	case "NO ACTION", "RESTRICT":
+		return odDoNothing
+	}
+	return ""
+}
+
+// get the exported go name of a table or column, such as user_name to UserName.
+func goName(s string) string {
+	b := []byte(s)
+	for i, c := range b {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') {
+			b[i] = '_'
+		}
+	}
+	name := camelString(string(b))
+	if name == "" || name[0] >= '0' && name[0] <= '9' {
+		name = "X" + name
+	}
+	return name
+}
+
+// get a name not in names by adding a number
+func uniqueName(names map[string]bool, name string) string {
+	n := name
+	for i := 2; names[n]; i++ {
+		n = name + strconv.Itoa(i)
+	}
+	names[n] = true
+	return n
+}
+
+// the plural of a model name for the reverse many fields, such as Posts and Categories.
+func pluralName(s string) string {
+	switch {
+	case strings.HasSuffix(s, "s"), strings.HasSuffix(s, "x"), strings.HasSuffix(s, "z"),
+		strings.HasSuffix(s, "ch"), strings.HasSuffix(s, "sh"):
+		return s + "es"
+	case len(s) > 1 && s[len(s)-1] == 'y' && !strings.ContainsRune("aeiouAEIOU", rune(s[len(s)-2])):
+		return s[:len(s)-1] + "ies"
+	}
+	return s + "s"
+}
+
+func renderModels(pkg string, tables []string, models map[string]*genModel) ([]byte, error) {
+	var body bytes.Buffer
+	useTime := false
+	var news []string
+	for _, table := range tables {
+		m := models[table]
+		if !m.unregistered {
+			news = append(news, fmt.Sprintf("new(%s)", m.name))
+		}
+
+		fmt.Fprintf(&body, "\n// %s is the model of table `%s`.\n", m.name, table)
+		if m.comment != "" {
+			fmt.Fprintf(&body, "// %s\n", m.comment)
+		}
+		fmt.Fprintf(&body, "type %s struct {\n", m.name)
+		for _, f := range m.fields {
+			if f.typ == "time.Time" {
+				useTime = true
+			}
+			fmt.Fprintf(&body, "\t%s %s", f.name, f.typ)
+			if len(f.tags) > 0 {
+				fmt.Fprintf(&body, " `orm:\"%s\"`", strings.Join(f.tags, ";"))
+			}
+			if f.comment != "" {
+				fmt.Fprintf(&body, " // %s", f.comment)
+			}
+			body.WriteString("\n")
+		}
+		body.WriteString("}\n")
+
+		fmt.Fprintf(&body, "\n// TableName return the table name of %s.\n", m.name)
+		fmt.Fprintf(&body, "func (m *%s) TableName() string {\n\treturn %s\n}\n", m.name, strconv.Quote(table))
+		renderIndexes(&body, m.name, "TableIndex", "multiple columns indexes", m.indexes)
+		renderIndexes(&body, m.name, "TableUnique", "multiple columns unique indexes", m.uniques)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("// Models generated by the orm models command from the database tables.\n\n")
+	fmt.Fprintf(&buf, "package %s\n", pkg)
+	if useTime || len(news) > 0 {
+		buf.WriteString("\nimport (\n")
+		if useTime {
+			buf.WriteString("\t\"time\"\n\n")
+		}
+		if len(news) > 0 {
+			buf.WriteString("\t\"github.com/goasana/asana/orm\"\n")
+		}
+		buf.WriteString(")\n")
+	}
+	buf.Write(body.Bytes())
+	if len(news) > 0 {
+		fmt.Fprintf(&buf, "\nfunc init() {\n\torm.RegisterModel(%s)\n}\n", strings.Join(news, ", "))
+	}
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return buf.Bytes(), fmt.Errorf("format models, %s", err.Error())
+	}
+	return src, nil
+}
+
+func renderIndexes(buf *bytes.Buffer, model, method, desc string, indexes [][]string) {
+	if len(indexes) == 0 {
+		return
+	}
+	fmt.Fprintf(buf, "\n// %s return the %s of %s.\n", method, desc, model)
+	fmt.Fprintf(buf, "func (m *%s) %s() [][]string {\n\treturn [][]string{\n", model, method)
+	for _, fields := range indexes {
+		quoted := make([]string, len(fields))
+		for i, f := range fields {
+			quoted[i] = strconv.Quote(f)
+		}
+		fmt.Fprintf(buf, "\t\t{%s},\n", strings.Join(quoted, ", "))
+	}
+	buf.WriteString("\t}\n}\n")
+}
@@ -32,35 +32,40 @@ const (
 var (
 	// ErrMissPK missing pk error
 	ErrMissPK = errors.New("missed pk value")
+	// ErrStaleObject the version of the row is not the version of the model, it was changed or deleted
+	ErrStaleObject = errors.New("stale object, the row was changed or deleted")
 )
 
 var (
 	operators = map[string]bool{
-		"exact":     true,
-		"iexact":    true,
-		"contains":  true,
-		"icontains": true,
-		// "regex":       true,
-		// "iregex":      true,
-		"gt":          true,
-		"gte":         true,
-		"lt":          true,
-		"lte":         true,
-		"eq":          true,
-		"nq":          true,
-		"ne":          true,
-		"startswith":  true,
-		"endswith":    true,
-		"istartswith": true,
-		"iendswith":   true,
-		"in":          true,
-		"between":     true,
-		// "year":        true,
-		// "month":       true,
-		// "day":         true,
-		// "week_day":    true,
-		"isnull": true,
-		// "search":      true,
+		"exact":         true,
+		"iexact":        true,
+		"contains":      true,
+		"icontains":     true,
+		"regex":         true,
+		"iregex":        true,
+		"gt":            true,
+		"gte":           true,
+		"lt":            true,
+		"lte":           true,
+		"eq":            true,
+		"nq":            true,
+		"ne":            true,
+		"startswith":    true,
+		"endswith":      true,
+		"istartswith":   true,
+		"iendswith":     true,
+		"in":            true,
+		"between":       true,
+		"year":          true,
+		"month":         true,
+		"day":           true,
+		"week_day":      true,
+		"isnull":        true,
+		"search":        true,
+		"has_key":       true,
+		"json_contains": true,
+		"contained_by":  true,
 	}
 )
 
@@ -120,11 +125,20 @@ func (d *dbBase) collectFieldValue(mi *modelInfo, fi *fieldInfo, ind reflect.Val
 	var value interface{}
 	if fi.pk {
 		_, value, _ = getExistPk(mi, ind)
+	} else if fi.tenant && insert {
+		// the model is inserted for the tenant of the ormer
+		value = tenantValue(mi)
+		setTenant(fi, ind, value)
 	} else {
 		field := ind.FieldByIndex(fi.fieldIndex)
 		if fi.isFielder {
 			f := field.Addr().Interface().(Fielder)
 			value = f.RawValue()
+		} else if fi.jsonValue {
+			var err error
+			if value, err = jsonMarshalField(field); err != nil {
+				return nil, fmt.Errorf("field `%s` json encode failed, %s", fi.fullName, err.Error())
+			}
 		} else {
 			switch fi.fieldType {
 			case TypeBooleanField:
@@ -280,7 +294,7 @@ func (d *dbBase) PrepareInsert(q dbQuerier, mi *modelInfo) (stmtQuerier, string,
 	sep := fmt.Sprintf("%s, %s", Q, Q)
 	columns := strings.Join(dbcols, sep)
 
-	query := fmt.Sprintf("INSERT INTO %s%s%s (%s%s%s) VALUES (%s)", Q, mi.table, Q, Q, columns, Q, qmarks)
+	query := fmt.Sprintf("INSERT INTO %s (%s%s%s) VALUES (%s)", d.quoteTable(mi), Q, columns, Q, qmarks)
 
 	d.ins.ReplaceMarks(&query)
 
@@ -312,6 +326,34 @@ func (d *dbBase) InsertStmt(stmt stmtQuerier, mi *modelInfo, ind reflect.Value,
 
 // query sql ,read records and persist in dbBaser.
 func (d *dbBase) Read(q dbQuerier, mi *modelInfo, ind reflect.Value, tz *time.Location, cols []string, isForUpdate bool) error {
+	query, args, err := d.readSQL(mi, ind, tz, cols, isForUpdate)
+	if err != nil {
+		return err
+	}
+
+	refs := make([]interface{}, len(mi.fields.dbcols))
+	for i := range refs {
+		var ref interface{}
+		refs[i] = &ref
+	}
+
+	row := q.QueryRow(query, args...)
+	if err := row.Scan(refs...); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrNoRows
+		}
+		return err
+	}
+	elm := reflect.New(mi.addrField.Elem().Type())
+	mind := reflect.Indirect(elm)
+	d.setColsValues(mi, &mind, mi.fields.dbcols, refs, tz)
+	ind.Set(mind)
+	return nil
+}
+
+// generate the select sql of Read.
+// the where condition uses cols, or the pk when cols is empty.
+func (d *dbBase) readSQL(mi *modelInfo, ind reflect.Value, tz *time.Location, cols []string, isForUpdate bool) (string, []interface{}, error) {
 	var whereCols []string
 	var args []interface{}
 
@@ -321,23 +363,26 @@ func (d *dbBase) Read(q dbQuerier, mi *modelInfo, ind reflect.Value, tz *time.Lo
 		whereCols = make([]string, 0, len(cols))
 		args, _, err = d.collectValues(mi, ind, cols, false, false, &whereCols, tz)
 		if err != nil {
-			return err
+			return "", nil, err
 		}
 	} else {
 		// default use pk value as where condtion.
 		pkColumn, pkValue, ok := getExistPk(mi, ind)
 		if !ok {
-			return ErrMissPK
+			return "", nil, ErrMissPK
 		}
 		whereCols = []string{pkColumn}
 		args = append(args, pkValue)
 	}
+	if fi := mi.fields.tenant; fi != nil {
+		whereCols = append(whereCols, fi.column)
+		args = append(args, tenantValue(mi))
+	}
 
 	Q := d.ins.TableQuote()
 
 	sep := fmt.Sprintf("%s, %s", Q, Q)
 	sels := strings.Join(mi.fields.dbcols, sep)
-	colsNum := len(mi.fields.dbcols)
 
 	sep = fmt.Sprintf("%s = ? AND %s", Q, Q)
 	wheres := strings.Join(whereCols, sep)
@@ -347,28 +392,10 @@ func (d *dbBase) Read(q dbQuerier, mi *modelInfo, ind reflect.Value, tz *time.Lo
 		forUpdate = "FOR UPDATE"
 	}
 
-	query := fmt.Sprintf("SELECT %s%s%s FROM %s%s%s WHERE %s%s%s = ? %s", Q, sels, Q, Q, mi.table, Q, Q, wheres, Q, forUpdate)
-
-	refs := make([]interface{}, colsNum)
-	for i := range refs {
-		var ref interface{}
-		refs[i] = &ref
-	}
+	query := fmt.Sprintf("SELECT %s%s%s FROM %s WHERE %s%s%s = ? %s", Q, sels, Q, d.quoteTable(mi), Q, wheres, Q, forUpdate)
 
 	d.ins.ReplaceMarks(&query)
-
-	row := q.QueryRow(query, args...)
-	if err := row.Scan(refs...); err != nil {
-		if err == sql.ErrNoRows {
-			return ErrNoRows
-		}
-		return err
-	}
-	elm := reflect.New(mi.addrField.Elem().Type())
-	mind := reflect.Indirect(elm)
-	d.setColsValues(mi, &mind, mi.fields.dbcols, refs, tz)
-	ind.Set(mind)
-	return nil
+	return query, args, nil
 }
 
 // execute insert sql dbQuerier with given struct reflect.Value.
@@ -474,7 +501,7 @@ func (d *dbBase) InsertValue(q dbQuerier, mi *modelInfo, isMulti bool, names []s
 		qmarks = strings.Repeat(qmarks+"), (", multi-1) + qmarks
 	}
 
-	query := fmt.Sprintf("INSERT INTO %s%s%s (%s%s%s) VALUES (%s)", Q, mi.table, Q, Q, columns, Q, qmarks)
+	query := fmt.Sprintf("INSERT INTO %s (%s%s%s) VALUES (%s)", d.quoteTable(mi), Q, columns, Q, qmarks)
 
 	d.ins.ReplaceMarks(&query)
 
@@ -531,14 +558,37 @@ func (d *dbBase) InsertOrUpdate(q dbQuerier, mi *modelInfo, ind reflect.Value, a
 		return 0, err
 	}
 
+	// the inserted or updated row has the next version,
+	// the conflicting row is only updated when it has the version of the model
+	vfi := mi.fields.version
+	var version int64
+	var vcol string
+	if vfi != nil {
+		version = getVersion(vfi, ind)
+		vcol = fmt.Sprintf("%s%s%s", Q, vfi.column, Q)
+	}
+	tfi := mi.fields.tenant
+	var tcol string
+	if tfi != nil {
+		tcol = fmt.Sprintf("%s%s%s", Q, tfi.column, Q)
+	}
+
 	marks := make([]string, len(names))
 	updateValues := make([]interface{}, 0)
-	updates := make([]string, len(names))
+	updates := make([]string, 0, len(names))
 	var conflitValue interface{}
 	for i, v := range names {
 		// identifier in database may not be case-sensitive, so quote it
 		v = fmt.Sprintf("%s%s%s", Q, v, Q)
 		marks[i] = "?"
+		if vfi != nil && v == vcol {
+			values[i] = version + 1
+			continue
+		}
+		if tfi != nil && v == tcol {
+			// the row does not move to another tenant
+			continue
+		}
 		valueStr := argsMap[strings.ToLower(v)]
 		if v == args0 {
 			conflitValue = values[i]
@@ -546,22 +596,41 @@ func (d *dbBase) InsertOrUpdate(q dbQuerier, mi *modelInfo, ind reflect.Value, a
 		if valueStr != "" {
 			switch a.Driver {
 			case DRMySQL:
-				updates[i] = v + "=" + valueStr
+				updates = append(updates, v+"="+valueStr)
 			case DRPostgres:
 				if conflitValue != nil {
 					//postgres ON CONFLICT DO UPDATE SET can`t use colu=colu+values
-					updates[i] = fmt.Sprintf("%s=(select %s from %s where %s = ? )", v, valueStr, mi.table, args0)
+					updates = append(updates, fmt.Sprintf("%s=(select %s from %s where %s = ? )", v, valueStr, d.quoteTable(mi), args0))
 					updateValues = append(updateValues, conflitValue)
 				} else {
 					return 0, fmt.Errorf("`%s` must be in front of `%s` in your struct", args0, v)
 				}
 			}
 		} else {
-			updates[i] = v + "=?"
+			updates = append(updates, v+"=?")
 			updateValues = append(updateValues, values[i])
 		}
 	}
 
+	// the conflicting row is only updated when it has the version of the model and the tenant of the ormer
+	var conds []string
+	if a.Driver == DRPostgres {
+		table := d.quoteTable(mi)
+		if vfi != nil {
+			updates = append(updates, fmt.Sprintf("%s=%s.%s+1", vcol, table, vcol))
+			conds = append(conds, fmt.Sprintf("%s.%s = ?", table, vcol))
+			updateValues = append(updateValues, version)
+		}
+		if tfi != nil {
+			conds = append(conds, fmt.Sprintf("%s.%s = ?", table, tcol))
+			updateValues = append(updateValues, tenantValue(mi))
+		}
+	}
+	var conflictWhere string
+	if len(conds) > 0 {
+		conflictWhere = " WHERE " + strings.Join(conds, " AND ")
+	}
+
 	values = append(values, updateValues...)
 
 	sep := fmt.Sprintf("%s, %s", Q, Q)
@@ -575,7 +644,7 @@ func (d *dbBase) InsertOrUpdate(q dbQuerier, mi *modelInfo, ind reflect.Value, a
 		qmarks = strings.Repeat(qmarks+"), (", multi-1) + qmarks
 	}
 	//conflitValue maybe is a int,can`t use fmt.Sprintf
-	query := fmt.Sprintf("INSERT INTO %s%s%s (%s%s%s) VALUES (%s) %s "+qupdates, Q, mi.table, Q, Q, columns, Q, qmarks, iouStr)
+	query := fmt.Sprintf("INSERT INTO %s (%s%s%s) VALUES (%s) %s "+qupdates+conflictWhere, d.quoteTable(mi), Q, columns, Q, qmarks, iouStr)
 
 	d.ins.ReplaceMarks(&query)
 
@@ -596,6 +665,18 @@ func (d *dbBase) InsertOrUpdate(q dbQuerier, mi *modelInfo, ind reflect.Value, a
 	if err != nil && err.Error() == `pq: syntax error at or near "ON"` {
 		err = fmt.Errorf("postgres version must 9.5 or higher")
 	}
+	if vfi != nil {
+		// no row is returned when the version is stale
+		if err == sql.ErrNoRows {
+			return 0, ErrStaleObject
+		}
+		if err == nil {
+			setVersion(vfi, ind, version+1)
+		}
+	} else if tfi != nil && err == sql.ErrNoRows {
+		// the conflicting row belongs to another tenant, it is not updated
+		return 0, nil
+	}
 	return id, err
 }
 
@@ -646,22 +727,69 @@ func (d *dbBase) Update(q dbQuerier, mi *modelInfo, ind reflect.Value, tz *time.
 		}
 	}
 
+	// the version is increased by the update, not set
+	vfi := mi.fields.version
+	if vfi != nil {
+		for i, col := range setNames {
+			if col == vfi.column {
+				setNames = append(setNames[:i], setNames[i+1:]...)
+				setValues = append(setValues[:i], setValues[i+1:]...)
+				break
+			}
+		}
+	}
+
+	// the row does not move to another tenant
+	tfi := mi.fields.tenant
+	if tfi != nil {
+		for i, col := range setNames {
+			if col == tfi.column {
+				setNames = append(setNames[:i], setNames[i+1:]...)
+				setValues = append(setValues[:i], setValues[i+1:]...)
+				break
+			}
+		}
+	}
+
 	setValues = append(setValues, pkValue)
 
 	Q := d.ins.TableQuote()
 
-	sep := fmt.Sprintf("%s = ?, %s", Q, Q)
-	setColumns := strings.Join(setNames, sep)
+	sets := make([]string, 0, len(setNames)+1)
+	for _, col := range setNames {
+		sets = append(sets, fmt.Sprintf("%s%s%s = ?", Q, col, Q))
+	}
+	where := fmt.Sprintf("%s%s%s = ?", Q, pkName, Q)
 
-	query := fmt.Sprintf("UPDATE %s%s%s SET %s%s%s = ? WHERE %s%s%s = ?", Q, mi.table, Q, Q, setColumns, Q, Q, pkName, Q)
+	var version int64
+	if vfi != nil {
+		version = getVersion(vfi, ind)
+		sets = append(sets, fmt.Sprintf("%s%s%s = %s%s%s + 1", Q, vfi.column, Q, Q, vfi.column, Q))
+		where += fmt.Sprintf(" AND %s%s%s = ?", Q, vfi.column, Q)
+		setValues = append(setValues, version)
+	}
+	if tfi != nil {
+		where += fmt.Sprintf(" AND %s%s%s = ?", Q, tfi.column, Q)
+		setValues = append(setValues, tenantValue(mi))
+	}
+
+	query := fmt.Sprintf("UPDATE %s SET %s WHERE %s", d.quoteTable(mi), strings.Join(sets, ", "), where)
 
 	d.ins.ReplaceMarks(&query)
 
 	res, err := q.Exec(query, setValues...)
-	if err == nil {
-		return res.RowsAffected()
+	if err != nil {
+		return 0, err
 	}
-	return 0, err
+	num, err := res.RowsAffected()
+	if err != nil || vfi == nil {
+		return num, err
+	}
+	if num == 0 {
+		return 0, ErrStaleObject
+	}
+	setVersion(vfi, ind, version+1)
+	return num, nil
 }
 
 // execute delete sql dbQuerier with given struct reflect.Value.
@@ -686,16 +814,21 @@ func (d *dbBase) Delete(q dbQuerier, mi *modelInfo, ind reflect.Value, tz *time.
 		whereCols = []string{pkColumn}
 		args = append(args, pkValue)
 	}
+	whereArgs := args
+	if fi := mi.fields.tenant; fi != nil {
+		whereCols = append(whereCols, fi.column)
+		whereArgs = append(whereArgs[:len(args):len(args)], tenantValue(mi))
+	}
 
 	Q := d.ins.TableQuote()
 
 	sep := fmt.Sprintf("%s = ? AND %s", Q, Q)
 	wheres := strings.Join(whereCols, sep)
 
-	query := fmt.Sprintf("DELETE FROM %s%s%s WHERE %s%s%s = ?", Q, mi.table, Q, Q, wheres, Q)
+	query := fmt.Sprintf("DELETE FROM %s WHERE %s%s%s = ?", d.quoteTable(mi), Q, wheres, Q)
 
 	d.ins.ReplaceMarks(&query)
-	res, err := q.Exec(query, args...)
+	res, err := q.Exec(query, whereArgs...)
 	if err == nil {
 		num, err := res.RowsAffected()
 		if err != nil {
@@ -737,6 +870,19 @@ func (d *dbBase) UpdateBatch(q dbQuerier, qs *querySet, mi *modelInfo, cond *Con
 		panic(fmt.Errorf("update params cannot empty"))
 	}
 
+	// the version is increased unless it is set by the params
+	vfi := mi.fields.version
+	if vfi != nil {
+		set := false
+		for _, col := range columns {
+			set = set || col == vfi.column
+		}
+		if !set {
+			columns = append(columns, vfi.column)
+			values = append(values, ColValue(ColAdd, 1))
+		}
+	}
+
 	tables := newDbTables(mi, d.ins)
 	if qs != nil {
 		tables.parseRelated(qs.related, qs.relDepth)
@@ -780,10 +926,10 @@ func (d *dbBase) UpdateBatch(q dbQuerier, qs *querySet, mi *modelInfo, cond *Con
 	sets := strings.Join(cols, ", ") + " "
 
 	if d.ins.SupportUpdateJoin() {
-		query = fmt.Sprintf("UPDATE %s%s%s T0 %sSET %s%s", Q, mi.table, Q, join, sets, where)
+		query = fmt.Sprintf("UPDATE %s T0 %sSET %s%s", d.quoteTable(mi), join, sets, where)
 	} else {
-		supQuery := fmt.Sprintf("SELECT T0.%s%s%s FROM %s%s%s T0 %s%s", Q, mi.fields.pk.column, Q, Q, mi.table, Q, join, where)
-		query = fmt.Sprintf("UPDATE %s%s%s SET %sWHERE %s%s%s IN ( %s )", Q, mi.table, Q, sets, Q, mi.fields.pk.column, Q, supQuery)
+		supQuery := fmt.Sprintf("SELECT T0.%s%s%s FROM %s T0 %s%s", Q, mi.fields.pk.column, Q, d.quoteTable(mi), join, where)
+		query = fmt.Sprintf("UPDATE %s SET %sWHERE %s%s%s IN ( %s )", d.quoteTable(mi), sets, Q, mi.fields.pk.column, Q, supQuery)
 	}
 
 	d.ins.ReplaceMarks(&query)
@@ -794,10 +940,15 @@ func (d *dbBase) UpdateBatch(q dbQuerier, qs *querySet, mi *modelInfo, cond *Con
 	} else {
 		res, err = q.Exec(query, values...)
 	}
-	if err == nil {
-		return res.RowsAffected()
+	if err != nil {
+		return 0, err
 	}
-	return 0, err
+	num, err := res.RowsAffected()
+	// the rows filtered by their version were changed by others
+	if err == nil && num == 0 && vfi != nil && condHasExact(mi, cond, vfi) {
+		return 0, ErrStaleObject
+	}
+	return num, err
 }
 
 // delete related records.
@@ -808,7 +959,7 @@ func (d *dbBase) deleteRels(q dbQuerier, mi *modelInfo, args []interface{}, tz *
 		switch fi.onDelete {
 		case odCascade:
 			cond := NewCondition().And(fmt.Sprintf("%s__in", fi.name), args...)
-			_, err := d.DeleteBatch(q, nil, fi.mi, cond, tz)
+			_, err := d.DeleteBatch(q, nil, mi.routed(fi.mi), cond, tz)
 			if err != nil {
 				return err
 			}
@@ -818,7 +969,7 @@ func (d *dbBase) deleteRels(q dbQuerier, mi *modelInfo, args []interface{}, tz *
 			if fi.onDelete == odSetDefault {
 				params[fi.column] = fi.initial.String()
 			}
-			_, err := d.UpdateBatch(q, nil, fi.mi, cond, params, tz)
+			_, err := d.UpdateBatch(q, nil, mi.routed(fi.mi), cond, params, tz)
 			if err != nil {
 				return err
 			}
@@ -847,7 +998,7 @@ func (d *dbBase) DeleteBatch(q dbQuerier, qs *querySet, mi *modelInfo, cond *Con
 	join := tables.getJoinSQL()
 
 	cols := fmt.Sprintf("T0.%s%s%s", Q, mi.fields.pk.column, Q)
-	query := fmt.Sprintf("SELECT %s FROM %s%s%s T0 %s%s", cols, Q, mi.table, Q, join, where)
+	query := fmt.Sprintf("SELECT %s FROM %s T0 %s%s", cols, d.quoteTable(mi), join, where)
 
 	d.ins.ReplaceMarks(&query)
 
@@ -883,7 +1034,7 @@ func (d *dbBase) DeleteBatch(q dbQuerier, qs *querySet, mi *modelInfo, cond *Con
 		marks[i] = "?"
 	}
 	sqlIn := fmt.Sprintf("IN (%s)", strings.Join(marks, ", "))
-	query = fmt.Sprintf("DELETE FROM %s%s%s WHERE %s%s%s %s", Q, mi.table, Q, Q, mi.fields.pk.column, Q, sqlIn)
+	query = fmt.Sprintf("DELETE FROM %s WHERE %s%s%s %s", d.quoteTable(mi), Q, mi.fields.pk.column, Q, sqlIn)
 
 	d.ins.ReplaceMarks(&query)
 	var res sql.Result
@@ -944,12 +1095,80 @@ func (d *dbBase) ReadBatch(q dbQuerier, qs *querySet, mi *modelInfo, cond *Condi
 		}
 	}
 
-	rlimit := qs.limit
+	query, args, tables, tCols, colsNum, err := d.readBatchSQL(qs, mi, cond, tz, cols, qs.limit)
+	if err != nil {
+		return 0, err
+	}
+
+	rs, err := d.queryRows(q, qs, query, args)
+	if err != nil {
+		return 0, err
+	}
+
+	refs := make([]interface{}, colsNum)
+	for i := range refs {
+		var ref interface{}
+		refs[i] = &ref
+	}
+
+	defer rs.Close()
+
+	slice := ind
+
+	var cnt int64
+	for rs.Next() {
+		if one && cnt == 0 || !one {
+			if err := rs.Scan(refs...); err != nil {
+				return 0, err
+			}
+
+			mind := d.readBatchRow(mi, tables, tCols, refs, tz)
+
+			if one {
+				ind.Set(mind)
+			} else {
+				if cnt == 0 {
+					// you can use a empty & caped container list
+					// orm will not replace it
+					if ind.Len() != 0 {
+						// if container is not empty
+						// create a new one
+						slice = reflect.New(ind.Type()).Elem()
+					}
+				}
+
+				if isPtr {
+					slice = reflect.Append(slice, mind.Addr())
+				} else {
+					slice = reflect.Append(slice, mind)
+				}
+			}
+		}
+		cnt++
+	}
+
+	if !one {
+		if cnt > 0 {
+			ind.Set(slice)
+		} else {
+			// when a result is empty and container is nil
+			// to set a empty container
+			if ind.IsNil() {
+				ind.Set(reflect.MakeSlice(ind.Type(), 0, 0))
+			}
+		}
+	}
+
+	return cnt, nil
+}
+
+// generate the select sql of ReadBatch.
+// it returns the tables of the related models and the columns of the model.
+func (d *dbBase) readBatchSQL(qs *querySet, mi *modelInfo, cond *Condition, tz *time.Location, cols []string, rlimit int64) (query string, args []interface{}, tables *dbTables, tCols []string, colsNum int, err error) {
 	offset := qs.offset
 
 	Q := d.ins.TableQuote()
 
-	var tCols []string
 	if len(cols) > 0 {
 		hasRel := len(qs.related) > 0 || qs.relDepth > 0
 		tCols = make([]string, 0, len(cols))
@@ -964,7 +1183,8 @@ func (d *dbBase) ReadBatch(q dbQuerier, qs *querySet, mi *modelInfo, cond *Condi
 					maps[fi.column] = true
 				}
 			} else {
-				return 0, fmt.Errorf("wrong field/column name `%s`", col)
+				err = fmt.Errorf("wrong field/column name `%s`", col)
+				return
 			}
 		}
 		if hasRel {
@@ -980,11 +1200,11 @@ func (d *dbBase) ReadBatch(q dbQuerier, qs *querySet, mi *modelInfo, cond *Condi
 		tCols = mi.fields.dbcols
 	}
 
-	colsNum := len(tCols)
+	colsNum = len(tCols)
 	sep := fmt.Sprintf("%s, T0.%s", Q, Q)
 	sels := fmt.Sprintf("T0.%s%s%s", Q, strings.Join(tCols, sep), Q)
 
-	tables := newDbTables(mi, d.ins)
+	tables = newDbTables(mi, d.ins)
 	tables.parseRelated(qs.related, qs.relDepth)
 
 	where, args := tables.getCondSQL(cond, false, tz)
@@ -1005,137 +1225,97 @@ func (d *dbBase) ReadBatch(q dbQuerier, qs *querySet, mi *modelInfo, cond *Condi
 	if qs.distinct {
 		sqlSelect += " DISTINCT"
 	}
-	query := fmt.Sprintf("%s %s FROM %s%s%s T0 %s%s%s%s%s", sqlSelect, sels, Q, mi.table, Q, join, where, groupBy, orderBy, limit)
+	query = fmt.Sprintf("%s %s FROM %s T0 %s%s%s%s%s", sqlSelect, sels, d.quoteTable(mi), join, where, groupBy, orderBy, limit)
 
 	if qs.forupdate {
 		query += " FOR UPDATE"
 	}
 
 	d.ins.ReplaceMarks(&query)
+	return
+}
 
-	var rs *sql.Rows
-	var err error
+// run the select sql, with the context of the QuerySeter if it has one
+func (d *dbBase) queryRows(q dbQuerier, qs *querySet, query string, args []interface{}) (*sql.Rows, error) {
 	if qs != nil && qs.forContext {
-		rs, err = q.QueryContext(qs.ctx, query, args...)
-		if err != nil {
-			return 0, err
-		}
-	} else {
-		rs, err = q.Query(query, args...)
-		if err != nil {
-			return 0, err
-		}
-	}
-
-	refs := make([]interface{}, colsNum)
-	for i := range refs {
-		var ref interface{}
-		refs[i] = &ref
+		return q.QueryContext(qs.ctx, query, args...)
 	}
+	return q.Query(query, args...)
+}
 
-	defer rs.Close()
+// read a model struct and its selected related models from the scanned refs of a row.
+func (d *dbBase) readBatchRow(mi *modelInfo, tables *dbTables, tCols []string, refs []interface{}, tz *time.Location) reflect.Value {
+	elm := reflect.New(mi.addrField.Elem().Type())
+	mind := reflect.Indirect(elm)
 
-	slice := ind
+	cacheV := make(map[string]*reflect.Value)
+	cacheM := make(map[string]*modelInfo)
+	trefs := refs
 
-	var cnt int64
-	for rs.Next() {
-		if one && cnt == 0 || !one {
-			if err := rs.Scan(refs...); err != nil {
-				return 0, err
-			}
+	d.setColsValues(mi, &mind, tCols, refs[:len(tCols)], tz)
+	trefs = refs[len(tCols):]
 
-			elm := reflect.New(mi.addrField.Elem().Type())
-			mind := reflect.Indirect(elm)
-
-			cacheV := make(map[string]*reflect.Value)
-			cacheM := make(map[string]*modelInfo)
-			trefs := refs
-
-			d.setColsValues(mi, &mind, tCols, refs[:len(tCols)], tz)
-			trefs = refs[len(tCols):]
-
-			for _, tbl := range tables.tables {
-				// loop selected tables
-				if tbl.sel {
-					last := mind
-					names := ""
-					mmi := mi
-					// loop cascade models
-					for _, name := range tbl.names {
-						names += name
-						if val, ok := cacheV[names]; ok {
-							last = *val
-							mmi = cacheM[names]
-						} else {
-							fi := mmi.fields.GetByName(name)
-							lastm := mmi
-							mmi = fi.relModelInfo
-							field := last
-							if last.Kind() != reflect.Invalid {
-								field = reflect.Indirect(last.FieldByIndex(fi.fieldIndex))
-								if field.IsValid() {
-									d.setColsValues(mmi, &field, mmi.fields.dbcols, trefs[:len(mmi.fields.dbcols)], tz)
-									for _, fi := range mmi.fields.fieldsReverse {
-										if fi.inModel && fi.reverseFieldInfo.mi == lastm {
-											if fi.reverseFieldInfo != nil {
-												f := field.FieldByIndex(fi.fieldIndex)
-												if f.Kind() == reflect.Ptr {
-													f.Set(last.Addr())
-												}
-											}
+	for _, tbl := range tables.tables {
+		// loop selected tables
+		if tbl.sel {
+			last := mind
+			names := ""
+			mmi := mi
+			// loop cascade models
+			for _, name := range tbl.names {
+				names += name
+				if val, ok := cacheV[names]; ok {
+					last = *val
+					mmi = cacheM[names]
+				} else {
+					fi := mmi.fields.GetByName(name)
+					lastm := mmi
+					mmi = fi.relModelInfo
+					field := last
+					if last.Kind() != reflect.Invalid {
+						field = reflect.Indirect(last.FieldByIndex(fi.fieldIndex))
+						if field.IsValid() {
+							d.setColsValues(mmi, &field, mmi.fields.dbcols, trefs[:len(mmi.fields.dbcols)], tz)
+							for _, fi := range mmi.fields.fieldsReverse {
+								if fi.inModel && fi.reverseFieldInfo.mi.fullName == lastm.fullName {
+									if fi.reverseFieldInfo != nil {
+										f := field.FieldByIndex(fi.fieldIndex)
+										if f.Kind() == reflect.Ptr {
+											f.Set(last.Addr())
 										}
 									}
-									last = field
 								}
 							}
-							cacheV[names] = &field
-							cacheM[names] = mmi
+							last = field
 						}
 					}
-					trefs = trefs[len(mmi.fields.dbcols):]
-				}
-			}
-
-			if one {
-				ind.Set(mind)
-			} else {
-				if cnt == 0 {
-					// you can use a empty & caped container list
-					// orm will not replace it
-					if ind.Len() != 0 {
-						// if container is not empty
-						// create a new one
-						slice = reflect.New(ind.Type()).Elem()
-					}
-				}
-
-				if isPtr {
-					slice = reflect.Append(slice, mind.Addr())
-				} else {
-					slice = reflect.Append(slice, mind)
+					cacheV[names] = &field
+					cacheM[names] = mmi
 				}
 			}
+			trefs = trefs[len(mmi.fields.dbcols):]
 		}
-		cnt++
 	}
 
-	if !one {
-		if cnt > 0 {
-			ind.Set(slice)
-		} else {
-			// when a result is empty and container is nil
-			// to set a empty container
-			if ind.IsNil() {
-				ind.Set(reflect.MakeSlice(ind.Type(), 0, 0))
-			}
-		}
-	}
-
-	return cnt, nil
+	return mind
 }
 
 // excute count sql and return count result int64.
 func (d *dbBase) Count(q dbQuerier, qs *querySet, mi *modelInfo, cond *Condition, tz *time.Location) (cnt int64, err error) {
+	query, args, _ := d.countSQL(qs, mi, cond, tz)
+
+	var row *sql.Row
+	if qs != nil && qs.forContext {
+		row = q.QueryRowContext(qs.ctx, query, args...)
+	} else {
+		row = q.QueryRow(query, args...)
+	}
+	err = row.Scan(&cnt)
+	return
+}
+
+// generate the select sql of Count, with the tables of the related models
+func (d *dbBase) countSQL(qs *querySet, mi *modelInfo, cond *Condition, tz *time.Location) (string, []interface{}, *dbTables) {
 	tables := newDbTables(mi, d.ins)
 	tables.parseRelated(qs.related, qs.relDepth)
 
@@ -1144,24 +1324,14 @@ func (d *dbBase) Count(q dbQuerier, qs *querySet, mi *modelInfo, cond *Condition
 	tables.getOrderSQL(qs.orders)
 	join := tables.getJoinSQL()
 
-	Q := d.ins.TableQuote()
-
-	query := fmt.Sprintf("SELECT COUNT(*) FROM %s%s%s T0 %s%s%s", Q, mi.table, Q, join, where, groupBy)
+	query := fmt.Sprintf("SELECT COUNT(*) FROM %s T0 %s%s%s", d.quoteTable(mi), join, where, groupBy)
 
 	if groupBy != "" {
 		query = fmt.Sprintf("SELECT COUNT(*) FROM (%s) AS T", query)
 	}
 
 	d.ins.ReplaceMarks(&query)
-
-	var row *sql.Row
-	if qs != nil && qs.forContext {
-		row = q.QueryRowContext(qs.ctx, query, args...)
-	} else {
-		row = q.QueryRow(query, args...)
-	}
-	err = row.Scan(&cnt)
-	return
+	return query, args, tables
 }
 
 // generate sql with replacing operator string placeholders and replaced values.
@@ -1208,6 +1378,12 @@ func (d *dbBase) GenerateOperatorSQL(mi *modelInfo, fi *fieldInfo, operator stri
 				param = fmt.Sprintf("%%%s", param)
 			}
 			params[0] = param
+		case "year", "month", "day", "week_day":
+			n, err := StrTo(ToStr(arg)).Int64()
+			if err != nil {
+				panic(fmt.Errorf("operator `%s` need an integer value not `%v`", operator, arg))
+			}
+			params[0] = n
 		case "isnull":
 			if b, ok := arg.(bool); ok {
 				if b {
@@ -1229,6 +1405,11 @@ func (d *dbBase) GenerateOperatorLeftCol(*fieldInfo, string, *string) {
 	// default not use
 }
 
+// generate the condition sql of the keys in a json field and the json operators.
+func (d *dbBase) GenerateJSONSQL(string, []string, string, []interface{}, *time.Location) (string, []interface{}) {
+	panic(fmt.Errorf("json lookups are not supported by the driver"))
+}
+
 // set values to struct column.
 func (d *dbBase) setColsValues(mi *modelInfo, ind *reflect.Value, cols []string, values []interface{}, tz *time.Location) {
 	for i, column := range cols {
@@ -1417,6 +1598,10 @@ func (d *dbBase) setFieldValue(fi *fieldInfo, value interface{}, field reflect.V
 
 setValue:
 	switch {
+	case fi.jsonValue:
+		if err := jsonUnmarshalField(field, value); err != nil {
+			return nil, fmt.Errorf("field `%s` json decode failed, %s", fi.fullName, err.Error())
+		}
 	case fieldType == TypeBooleanField:
 		if isNative {
 			if nb, ok := field.Interface().(sql.NullBool); ok {
@@ -1634,58 +1819,13 @@ func (d *dbBase) ReadValues(q dbQuerier, qs *querySet, mi *modelInfo, cond *Cond
 		panic(fmt.Errorf("unsupport read values type `%T`", container))
 	}
 
-	tables := newDbTables(mi, d.ins)
-
-	var (
-		cols  []string
-		infos []*fieldInfo
-	)
-
-	hasExprs := len(exprs) > 0
-
-	Q := d.ins.TableQuote()
-
-	if hasExprs {
-		cols = make([]string, 0, len(exprs))
-		infos = make([]*fieldInfo, 0, len(exprs))
-		for _, ex := range exprs {
-			index, name, fi, suc := tables.parseExprs(mi, strings.Split(ex, ExprSep))
-			if !suc {
-				panic(fmt.Errorf("unknown field/column name `%s`", ex))
-			}
-			cols = append(cols, fmt.Sprintf("%s.%s%s%s %s%s%s", index, Q, fi.column, Q, Q, name, Q))
-			infos = append(infos, fi)
-		}
-	} else {
-		cols = make([]string, 0, len(mi.fields.dbcols))
-		infos = make([]*fieldInfo, 0, len(exprs))
-		for _, fi := range mi.fields.fieldsDB {
-			cols = append(cols, fmt.Sprintf("T0.%s%s%s %s%s%s", Q, fi.column, Q, Q, fi.name, Q))
-			infos = append(infos, fi)
-		}
-	}
-
-	where, args := tables.getCondSQL(cond, false, tz)
-	groupBy := tables.getGroupSQL(qs.groups)
-	orderBy := tables.getOrderSQL(qs.orders)
-	limit := tables.getLimitSQL(mi, qs.offset, qs.limit)
-	join := tables.getJoinSQL()
-
-	sels := strings.Join(cols, ", ")
-
-	sqlSelect := "SELECT"
-	if qs.distinct {
-		sqlSelect += " DISTINCT"
-	}
-	query := fmt.Sprintf("%s %s FROM %s%s%s T0 %s%s%s%s%s", sqlSelect, sels, Q, mi.table, Q, join, where, groupBy, orderBy, limit)
-
-	d.ins.ReplaceMarks(&query)
+	query, args, _, infos, aggs := d.readValuesSQL(qs, mi, cond, exprs, tz)
 
 	rs, err := q.Query(query, args...)
 	if err != nil {
 		return 0, err
 	}
-	refs := make([]interface{}, len(cols))
+	refs := make([]interface{}, len(infos))
 	for i := range refs {
 		var ref interface{}
 		refs[i] = &ref
@@ -1693,6 +1833,13 @@ func (d *dbBase) ReadValues(q dbQuerier, qs *querySet, mi *modelInfo, cond *Cond
 
 	defer rs.Close()
 
+	convert := func(i int, val interface{}) (interface{}, error) {
+		if aggs[i] != nil {
+			return aggs[i].convert(d, infos[i], val, tz)
+		}
+		return d.convertValueFromDB(infos[i], val, tz)
+	}
+
 	var (
 		cnt     int64
 		columns []string
@@ -1712,13 +1859,11 @@ func (d *dbBase) ReadValues(q dbQuerier, qs *querySet, mi *modelInfo, cond *Cond
 
 		switch typ {
 		case 1:
-			params := make(Params, len(cols))
+			params := make(Params, len(infos))
 			for i, ref := range refs {
-				fi := infos[i]
-
 				val := reflect.Indirect(reflect.ValueOf(ref)).Interface()
 
-				value, err := d.convertValueFromDB(fi, val, tz)
+				value, err := convert(i, val)
 				if err != nil {
 					panic(fmt.Errorf("db value convert failed `%v` %s", val, err.Error()))
 				}
@@ -1727,13 +1872,11 @@ func (d *dbBase) ReadValues(q dbQuerier, qs *querySet, mi *modelInfo, cond *Cond
 			}
 			maps = append(maps, params)
 		case 2:
-			params := make(ParamsList, 0, len(cols))
+			params := make(ParamsList, 0, len(infos))
 			for i, ref := range refs {
-				fi := infos[i]
-
 				val := reflect.Indirect(reflect.ValueOf(ref)).Interface()
 
-				value, err := d.convertValueFromDB(fi, val, tz)
+				value, err := convert(i, val)
 				if err != nil {
 					panic(fmt.Errorf("db value convert failed `%v` %s", val, err.Error()))
 				}
@@ -1743,11 +1886,9 @@ func (d *dbBase) ReadValues(q dbQuerier, qs *querySet, mi *modelInfo, cond *Cond
 			lists = append(lists, params)
 		case 3:
 			for i, ref := range refs {
-				fi := infos[i]
-
 				val := reflect.Indirect(reflect.ValueOf(ref)).Interface()
 
-				value, err := d.convertValueFromDB(fi, val, tz)
+				value, err := convert(i, val)
 				if err != nil {
 					panic(fmt.Errorf("db value convert failed `%v` %s", val, err.Error()))
 				}
@@ -1771,6 +1912,75 @@ func (d *dbBase) ReadValues(q dbQuerier, qs *querySet, mi *modelInfo, cond *Cond
 	return cnt, nil
 }
 
+// generate the select sql of ReadValues.
+// it returns the tables of the related models, and the field and the aggregation of every selected column
+// for the value conversions.
+func (d *dbBase) readValuesSQL(qs *querySet, mi *modelInfo, cond *Condition, exprs []string, tz *time.Location) (query string, args []interface{}, tables *dbTables, infos []*fieldInfo, aggs []*Aggregation) {
+	tables = newDbTables(mi, d.ins)
+	tables.setAnnotations(qs.annotations)
+
+	var cols []string
+
+	hasExprs := len(exprs) > 0
+
+	Q := d.ins.TableQuote()
+
+	if hasExprs {
+		cols = make([]string, 0, len(exprs))
+		infos = make([]*fieldInfo, 0, len(exprs))
+		aggs = make([]*Aggregation, 0, len(exprs))
+		for _, ex := range exprs {
+			if an, ok := tables.annotations[ex]; ok {
+				cols = append(cols, fmt.Sprintf("%s %s%s%s", an.sql, Q, ex, Q))
+				infos = append(infos, an.fi)
+				aggs = append(aggs, an.agg)
+				continue
+			}
+			index, name, fi, suc := tables.parseExprs(mi, strings.Split(ex, ExprSep))
+			if !suc {
+				panic(fmt.Errorf("unknown field/column name `%s`", ex))
+			}
+			cols = append(cols, fmt.Sprintf("%s.%s%s%s %s%s%s", index, Q, fi.column, Q, Q, name, Q))
+			infos = append(infos, fi)
+			aggs = append(aggs, nil)
+		}
+	} else {
+		cols = make([]string, 0, len(mi.fields.dbcols)+len(qs.annotations))
+		infos = make([]*fieldInfo, 0, len(exprs))
+		aggs = make([]*Aggregation, 0, len(exprs))
+		for _, fi := range mi.fields.fieldsDB {
+			cols = append(cols, fmt.Sprintf("T0.%s%s%s %s%s%s", Q, fi.column, Q, Q, fi.name, Q))
+			infos = append(infos, fi)
+			aggs = append(aggs, nil)
+		}
+		for _, a := range qs.annotations {
+			an := tables.annotations[a.Name()]
+			cols = append(cols, fmt.Sprintf("%s %s%s%s", an.sql, Q, a.Name(), Q))
+			infos = append(infos, an.fi)
+			aggs = append(aggs, a)
+		}
+	}
+
+	where, args := tables.getCondSQL(cond, false, tz)
+	groupBy := tables.getGroupSQL(qs.groups)
+	having, havingArgs := tables.getHavingSQL(qs.having, false, tz)
+	orderBy := tables.getOrderSQL(qs.orders)
+	limit := tables.getLimitSQL(mi, qs.offset, qs.limit)
+	join := tables.getJoinSQL()
+
+	sels := strings.Join(cols, ", ")
+	args = append(args, havingArgs...)
+
+	sqlSelect := "SELECT"
+	if qs.distinct {
+		sqlSelect += " DISTINCT"
+	}
+	query = fmt.Sprintf("%s %s FROM %s T0 %s%s%s%s%s%s", sqlSelect, sels, d.quoteTable(mi), join, where, groupBy, having, orderBy, limit)
+
+	d.ins.ReplaceMarks(&query)
+	return
+}
+
 func (d *dbBase) RowsTo(dbQuerier, *querySet, *modelInfo, *Condition, interface{}, string, string, *time.Location) (int64, error) {
 	return 0, nil
 }
@@ -1789,6 +1999,15 @@ func (d *dbBase) TableQuote() string {
 	return "`"
 }
 
+// quote the table of mi, qualified by its schema
+func (d *dbBase) quoteTable(mi *modelInfo) string {
+	Q := d.ins.TableQuote()
+	if mi.schema != "" {
+		return Q + mi.schema + Q + "." + Q + mi.table + Q
+	}
+	return Q + mi.table + Q
+}
+
 // replace value placeholder in parametered sql string.
 func (d *dbBase) ReplaceMarks(query *string) {
 	// default use `?` as mark, do nothing
@@ -1890,3 +2109,8 @@ func (d *dbBase) ShowColumnsQuery(table string) string {
 func (d *dbBase) IndexExists(dbQuerier, string, string) bool {
 	panic(ErrNotImplement)
 }
+
+// not implement.
+func (d *dbBase) GetTableSchema(dbQuerier, string) (*tableSchema, error) {
+	return nil, ErrNotImplement
+}
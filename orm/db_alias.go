@@ -111,6 +111,14 @@ type DB struct {
 	stmts map[string]*sql.Stmt
 }
 
+func newDB(db *sql.DB) *DB {
+	return &DB{
+		RWMutex: new(sync.RWMutex),
+		DB:      db,
+		stmts:   make(map[string]*sql.Stmt),
+	}
+}
+
 func (d *DB) Begin() (*sql.Tx, error) {
 	return d.DB.Begin()
 }
@@ -206,6 +214,9 @@ type alias struct {
 	DbBaser      dbBaser
 	TZ           *time.Location
 	Engine       string
+	Replicas     *replicaSet
+	QueryCache   *queryCache
+	Tenancy      TenancyMode
 }
 
 func detectTZ(al *alias) {
@@ -268,11 +279,8 @@ func addAliasWthDB(aliasName, driverName string, db *sql.DB) (*alias, error) {
 	al := new(alias)
 	al.Name = aliasName
 	al.DriverName = driverName
-	al.DB = &DB{
-		RWMutex: new(sync.RWMutex),
-		DB:      db,
-		stmts:   make(map[string]*sql.Stmt),
-	}
+	al.DB = newDB(db)
+	al.Replicas = &replicaSet{alias: aliasName}
 
 	if dr, ok := drivers[driverName]; ok {
 		al.DbBaser = dbBasers[dr]
@@ -0,0 +1,165 @@
+// Copyright 2019 asana Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package orm
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// the operators of json fields, json_contains is the json containment,
+// contains stays the LIKE of the json text.
+var jsonOperators = map[string]bool{
+	"has_key":       true,
+	"json_contains": true,
+	"contained_by":  true,
+}
+
+func isJSONField(fi *fieldInfo) bool {
+	return fi.fieldType == TypeJSONField || fi.fieldType == TypeJsonbField
+}
+
+// split the exprs at the json field, the rest exprs are the keys in the json value.
+// such as Meta__settings__theme is the field Meta and the keys settings, theme.
+func splitJSONPath(mi *modelInfo, exprs []string) ([]string, []string) {
+	mmi := mi
+	for i, ex := range exprs {
+		fi, ok := mmi.fields.GetByAny(ex)
+		if !ok {
+			break
+		}
+		switch {
+		case isJSONField(fi):
+			return exprs[:i+1], exprs[i+1:]
+		case fi.fieldType == RelManyToMany:
+			mmi = fi.relThroughModelInfo
+		case fi.rel:
+			mmi = fi.relModelInfo
+		case fi.reverse:
+			mmi = fi.reverseFieldInfo.mi
+		default:
+			return exprs, nil
+		}
+	}
+	return exprs, nil
+}
+
+// quote s as a sql string literal
+func sqlQuote(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
+
+func isArrayIndex(key string) bool {
+	if key == "" {
+		return false
+	}
+	for _, c := range key {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// the json path literal of the keys for mysql and sqlite, such as '$."settings"[0]'
+func jsonPathLiteral(path []string) string {
+	p := "$"
+	for _, key := range path {
+		if isArrayIndex(key) {
+			p += "[" + key + "]"
+		} else {
+			p += `."` + strings.Replace(strings.Replace(key, `\`, `\\`, -1), `"`, `\"`, -1) + `"`
+		}
+	}
+	return sqlQuote(p)
+}
+
+// the text array literal of the keys for postgres, such as '{"settings","0"}'
+func jsonTextArrayLiteral(path []string) string {
+	keys := make([]string, len(path))
+	for i, key := range path {
+		keys[i] = `"` + strings.Replace(strings.Replace(key, `\`, `\\`, -1), `"`, `\"`, -1) + `"`
+	}
+	return sqlQuote("{" + strings.Join(keys, ",") + "}")
+}
+
+// get the key of has_key
+func jsonKeyArg(args []interface{}) []interface{} {
+	if len(args) != 1 {
+		panic(fmt.Errorf("operator `has_key` need 1 args not %d", len(args)))
+	}
+	return []interface{}{ToStr(args[0])}
+}
+
+// get the json document of json_contains and contained_by, a string or []byte arg is the json text.
+func jsonDocArg(operator string, args []interface{}) []interface{} {
+	if len(args) != 1 {
+		panic(fmt.Errorf("operator `%s` need 1 args not %d", operator, len(args)))
+	}
+	switch v := args[0].(type) {
+	case string:
+		return []interface{}{v}
+	case []byte:
+		return []interface{}{string(v)}
+	}
+	b, err := json.Marshal(args[0])
+	if err != nil {
+		panic(fmt.Errorf("operator `%s` wrong json value, %s", operator, err.Error()))
+	}
+	return []interface{}{string(b)}
+}
+
+// kind of the compared scalar at the json path, number, bool or text
+func jsonScalarKind(args []interface{}) reflect.Kind {
+	if len(args) == 0 || args[0] == nil {
+		return reflect.String
+	}
+	switch kind := reflect.Indirect(reflect.ValueOf(args[0])).Kind(); kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return reflect.Float64
+	case reflect.Bool:
+		return reflect.Bool
+	}
+	return reflect.String
+}
+
+// encode the struct, map or slice of a json field
+func jsonMarshalField(field reflect.Value) (interface{}, error) {
+	switch field.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Interface:
+		if field.IsNil() {
+			return nil, nil
+		}
+	}
+	b, err := json.Marshal(field.Interface())
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// decode the json value to the struct, map or slice of a json field
+func jsonUnmarshalField(field reflect.Value, value interface{}) error {
+	field.Set(reflect.Zero(field.Type()))
+	s, _ := value.(string)
+	if s == "" {
+		return nil
+	}
+	return json.Unmarshal([]byte(s), field.Addr().Interface())
+}
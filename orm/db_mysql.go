@@ -18,16 +18,17 @@ import (
 	"fmt"
 	"reflect"
 	"strings"
+	"time"
 )
 
 // mysql operators.
 var mysqlOperators = map[string]string{
-	"exact":     "= ?",
-	"iexact":    "LIKE ?",
-	"contains":  "LIKE BINARY ?",
-	"icontains": "LIKE ?",
-	// "regex":       "REGEXP BINARY ?",
-	// "iregex":      "REGEXP ?",
+	"exact":       "= ?",
+	"iexact":      "LIKE ?",
+	"contains":    "LIKE BINARY ?",
+	"icontains":   "LIKE ?",
+	"regex":       "REGEXP BINARY ?",
+	"iregex":      "REGEXP ?",
 	"gt":          "> ?",
 	"gte":         ">= ?",
 	"lt":          "< ?",
@@ -38,6 +39,19 @@ var mysqlOperators = map[string]string{
 	"endswith":    "LIKE BINARY ?",
 	"istartswith": "LIKE ?",
 	"iendswith":   "LIKE ?",
+	"year":        "= ?",
+	"month":       "= ?",
+	"day":         "= ?",
+	"week_day":    "= ?",
+	"search":      "AGAINST (? IN NATURAL LANGUAGE MODE)",
+}
+
+// mysql functions of the date part operators.
+var mysqlDateParts = map[string]string{
+	"year":     "YEAR",
+	"month":    "MONTH",
+	"day":      "DAYOFMONTH",
+	"week_day": "DAYOFWEEK",
 }
 
 // mysql column field types.
@@ -99,6 +113,52 @@ func (d *dbBaseMysql) IndexExists(db dbQuerier, table string, name string) bool
 	return cnt > 0
 }
 
+// generate functioned sql for mysql, such as YEAR(datetime) and MATCH (text).
+func (d *dbBaseMysql) GenerateOperatorLeftCol(fi *fieldInfo, operator string, leftCol *string) {
+	mysqlOperatorLeftCol(operator, leftCol)
+}
+
+func mysqlOperatorLeftCol(operator string, leftCol *string) {
+	if f, ok := mysqlDateParts[operator]; ok {
+		*leftCol = fmt.Sprintf("%s(%s)", f, *leftCol)
+	} else if operator == "search" {
+		// the column need a FULLTEXT index
+		*leftCol = fmt.Sprintf("MATCH (%s)", *leftCol)
+	}
+}
+
+// generate the sql of the json lookups with the mysql json functions.
+// the scalar at the path is compared as text, or as json for the number args.
+func (d *dbBaseMysql) GenerateJSONSQL(leftCol string, path []string, operator string, args []interface{}, tz *time.Location) (string, []interface{}) {
+	value := leftCol
+	if len(path) > 0 {
+		value = fmt.Sprintf("JSON_EXTRACT(%s, %s)", leftCol, jsonPathLiteral(path))
+	}
+
+	switch operator {
+	case "has_key":
+		return fmt.Sprintf("JSON_CONTAINS_PATH(%s, 'one', CONCAT(%s, '.', JSON_QUOTE(?)))", leftCol, jsonPathLiteral(path)), jsonKeyArg(args)
+	case "json_contains":
+		return fmt.Sprintf("JSON_CONTAINS(%s, ?)", value), jsonDocArg(operator, args)
+	case "contained_by":
+		return fmt.Sprintf("JSON_CONTAINS(?, %s)", value), jsonDocArg(operator, args)
+	}
+
+	switch jsonScalarKind(args) {
+	case reflect.Float64:
+		// numbers are compared as json numbers
+	case reflect.Bool:
+		// the unquoted json true and false
+		args = []interface{}{ToStr(reflect.Indirect(reflect.ValueOf(args[0])).Bool())}
+		fallthrough
+	default:
+		value = fmt.Sprintf("JSON_UNQUOTE(%s)", value)
+	}
+	d.GenerateOperatorLeftCol(nil, operator, &value)
+	operSQL, params := d.GenerateOperatorSQL(nil, nil, operator, args, tz)
+	return value + " " + operSQL, params
+}
+
 // InsertOrUpdate a row
 // If your primary key or unique column conflict will update
 // If no will insert
@@ -126,21 +186,65 @@ func (d *dbBaseMysql) InsertOrUpdate(q dbQuerier, mi *modelInfo, ind reflect.Val
 		return 0, err
 	}
 
+	// the inserted or updated row has the next version,
+	// the duplicate row is only updated when it has the version of the model
+	vfi := mi.fields.version
+	var version int64
+	if vfi != nil {
+		version = getVersion(vfi, ind)
+	}
+
+	// there is no WHERE in ON DUPLICATE KEY UPDATE, the duplicate row is only updated
+	// when it has the version of the model and belongs to the tenant of the ormer
+	var conds []string
+	var condValues []interface{}
+	if vfi != nil {
+		conds = append(conds, fmt.Sprintf("`%s`=?", vfi.column))
+		condValues = append(condValues, version)
+	}
+	tfi := mi.fields.tenant
+	if tfi != nil {
+		conds = append(conds, fmt.Sprintf("`%s`=?", tfi.column))
+		condValues = append(condValues, tenantValue(mi))
+	}
+	cond := strings.Join(conds, " AND ")
+
 	marks := make([]string, len(names))
 	updateValues := make([]interface{}, 0)
-	updates := make([]string, len(names))
+	updates := make([]string, 0, len(names))
 
 	for i, v := range names {
 		marks[i] = "?"
+		if vfi != nil && v == vfi.column {
+			values[i] = version + 1
+			continue
+		}
+		if tfi != nil && v == tfi.column {
+			// the row does not move to another tenant
+			continue
+		}
 		valueStr := argsMap[strings.ToLower(v)]
-		if valueStr != "" {
-			updates[i] = "`" + v + "`" + "=" + valueStr
+		expr := valueStr
+		if expr == "" {
+			expr = "?"
+		}
+		if cond != "" {
+			updates = append(updates, fmt.Sprintf("`%s`=IF(%s,%s,`%s`)", v, cond, expr, v))
+			updateValues = append(updateValues, condValues...)
 		} else {
-			updates[i] = "`" + v + "`" + "=?"
+			updates = append(updates, "`"+v+"`"+"="+expr)
+		}
+		if valueStr == "" {
 			updateValues = append(updateValues, values[i])
 		}
 	}
 
+	if vfi != nil {
+		// set last, the other columns compare the old version
+		updates = append(updates, fmt.Sprintf("`%s`=IF(%s,`%s`+1,`%s`)", vfi.column, cond, vfi.column, vfi.column))
+		updateValues = append(updateValues, condValues...)
+	}
+
 	values = append(values, updateValues...)
 
 	sep := fmt.Sprintf("%s, %s", Q, Q)
@@ -154,7 +258,7 @@ func (d *dbBaseMysql) InsertOrUpdate(q dbQuerier, mi *modelInfo, ind reflect.Val
 		qmarks = strings.Repeat(qmarks+"), (", multi-1) + qmarks
 	}
 	// conflitValue maybe is a int,can`t use fmt.Sprintf
-	query := fmt.Sprintf("INSERT INTO %s%s%s (%s%s%s) VALUES (%s) %s "+qupdates, Q, mi.table, Q, Q, columns, Q, qmarks, iouStr)
+	query := fmt.Sprintf("INSERT INTO %s (%s%s%s) VALUES (%s) %s "+qupdates, d.quoteTable(mi), Q, columns, Q, qmarks, iouStr)
 
 	d.ins.ReplaceMarks(&query)
 
@@ -164,6 +268,19 @@ func (d *dbBaseMysql) InsertOrUpdate(q dbQuerier, mi *modelInfo, ind reflect.Val
 			if isMulti {
 				return res.RowsAffected()
 			}
+			if vfi != nil {
+				// no row is inserted or updated when the version is stale,
+				// the DSN must not set clientFoundRows
+				if num, err := res.RowsAffected(); err == nil && num == 0 {
+					return 0, ErrStaleObject
+				}
+				setVersion(vfi, ind, version+1)
+			} else if tfi != nil {
+				// the duplicate row belongs to another tenant, it is not updated
+				if num, err := res.RowsAffected(); err == nil && num == 0 {
+					return 0, nil
+				}
+			}
 			return res.LastInsertId()
 		}
 		return 0, err
@@ -175,6 +292,82 @@ func (d *dbBaseMysql) InsertOrUpdate(q dbQuerier, mi *modelInfo, ind reflect.Val
 	return id, err
 }
 
+// read the columns, indexes and foreign keys of table for mysql.
+func (d *dbBaseMysql) GetTableSchema(db dbQuerier, table string) (*tableSchema, error) {
+	return mysqlTableSchema(db, table)
+}
+
+func mysqlTableSchema(db dbQuerier, table string) (*tableSchema, error) {
+	schema := &tableSchema{name: table}
+
+	rows, err := db.Query("SELECT COLUMN_NAME, COLUMN_TYPE, IS_NULLABLE, COLUMN_DEFAULT, COLUMN_KEY, EXTRA "+
+		"FROM information_schema.columns WHERE table_schema = DATABASE() AND table_name = ? ORDER BY ORDINAL_POSITION", table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name, typ, null, key, extra string
+		c := new(columnSchema)
+		if err := rows.Scan(&name, &typ, &null, &c.def, &key, &extra); err != nil {
+			return nil, err
+		}
+		var args []int
+		c.name = name
+		c.dataType, args, c.unsigned = parseColumnType(typ)
+		c.setTypeArgs(args)
+		c.null = null == "YES"
+		c.pk = key == "PRI"
+		extra = strings.ToLower(extra)
+		c.auto = strings.Contains(extra, "auto_increment")
+		c.autoNow = strings.Contains(extra, "on update current_timestamp")
+		// mariadb quotes the defaults and shows the NULL default
+		if c.def.String == "NULL" {
+			c.def.Valid = false
+		}
+		schema.columns = append(schema.columns, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = db.Query("SELECT INDEX_NAME, NON_UNIQUE, COLUMN_NAME FROM information_schema.statistics "+
+		"WHERE table_schema = DATABASE() AND table_name = ? ORDER BY INDEX_NAME, SEQ_IN_INDEX", table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name, column string
+		var nonUnique int
+		if err := rows.Scan(&name, &nonUnique, &column); err != nil {
+			return nil, err
+		}
+		schema.addIndexColumn(name, nonUnique == 0, name == "PRIMARY", column)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = db.Query("SELECT kcu.CONSTRAINT_NAME, kcu.COLUMN_NAME, kcu.REFERENCED_TABLE_NAME, kcu.REFERENCED_COLUMN_NAME, rc.DELETE_RULE "+
+		"FROM information_schema.key_column_usage kcu JOIN information_schema.referential_constraints rc "+
+		"ON rc.CONSTRAINT_SCHEMA = kcu.CONSTRAINT_SCHEMA AND rc.CONSTRAINT_NAME = kcu.CONSTRAINT_NAME AND rc.TABLE_NAME = kcu.TABLE_NAME "+
+		"WHERE kcu.TABLE_SCHEMA = DATABASE() AND kcu.TABLE_NAME = ? AND kcu.REFERENCED_TABLE_NAME IS NOT NULL "+
+		"ORDER BY kcu.CONSTRAINT_NAME, kcu.ORDINAL_POSITION", table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		fk := new(foreignKeySchema)
+		if err := rows.Scan(&fk.name, &fk.column, &fk.refTable, &fk.refColumn, &fk.onDelete); err != nil {
+			return nil, err
+		}
+		schema.foreignKeys = append(schema.foreignKeys, fk)
+	}
+	return schema, rows.Err()
+}
+
 // create new mysql dbBaser.
 func newDBBaseMysql() dbBaser {
 	b := new(dbBaseMysql)
@@ -15,8 +15,12 @@
 package orm
 
 import (
+	"database/sql"
 	"fmt"
+	"reflect"
 	"strconv"
+	"strings"
+	"time"
 )
 
 // postgresql operators.
@@ -35,6 +39,20 @@ var postgresOperators = map[string]string{
 	"endswith":    "LIKE ?",
 	"istartswith": "LIKE UPPER(?)",
 	"iendswith":   "LIKE UPPER(?)",
+	"regex":       "~ ?",
+	"iregex":      "~* ?",
+	"year":        "= ?",
+	"month":       "= ?",
+	"day":         "= ?",
+	"week_day":    "= ?",
+	"search":      "@@ plainto_tsquery(?)",
+}
+
+// postgresql fields of the date part operators.
+var postgresDateParts = map[string]string{
+	"year":  "YEAR",
+	"month": "MONTH",
+	"day":   "DAY",
 }
 
 // postgresql column field types.
@@ -76,11 +94,48 @@ func (d *dbBasePostgres) OperatorSQL(operator string) string {
 // generate functioned sql string, such as contains(text).
 func (d *dbBasePostgres) GenerateOperatorLeftCol(fi *fieldInfo, operator string, leftCol *string) {
 	switch operator {
-	case "contains", "startswith", "endswith":
+	case "contains", "startswith", "endswith", "regex", "iregex":
 		*leftCol = fmt.Sprintf("%s::text", *leftCol)
 	case "iexact", "icontains", "istartswith", "iendswith":
 		*leftCol = fmt.Sprintf("UPPER(%s::text)", *leftCol)
+	case "year", "month", "day":
+		*leftCol = fmt.Sprintf("EXTRACT(%s FROM %s)", postgresDateParts[operator], *leftCol)
+	case "week_day":
+		// DOW is 0 for sunday, week_day is 1 for sunday as mysql
+		*leftCol = fmt.Sprintf("(EXTRACT(DOW FROM %s) + 1)", *leftCol)
+	case "search":
+		*leftCol = fmt.Sprintf("to_tsvector(%s::text)", *leftCol)
+	}
+}
+
+// generate the sql of the json lookups, the json value is compared as jsonb.
+// the scalar at the path is compared as text, or numeric and boolean for the number and bool args.
+func (d *dbBasePostgres) GenerateJSONSQL(leftCol string, path []string, operator string, args []interface{}, tz *time.Location) (string, []interface{}) {
+	value := leftCol + "::jsonb"
+	if len(path) > 0 {
+		value = fmt.Sprintf("(%s #> %s)", value, jsonTextArrayLiteral(path))
+	}
+
+	switch operator {
+	case "has_key":
+		// the ? operator can not be used with the ? placeholders
+		return fmt.Sprintf("(%s -> ?::text) IS NOT NULL", value), jsonKeyArg(args)
+	case "json_contains":
+		return fmt.Sprintf("%s @> ?::jsonb", value), jsonDocArg(operator, args)
+	case "contained_by":
+		return fmt.Sprintf("%s <@ ?::jsonb", value), jsonDocArg(operator, args)
 	}
+
+	leftCol = fmt.Sprintf("(%s::jsonb #>> %s)", leftCol, jsonTextArrayLiteral(path))
+	switch jsonScalarKind(args) {
+	case reflect.Float64:
+		leftCol += "::numeric"
+	case reflect.Bool:
+		leftCol += "::boolean"
+	}
+	d.GenerateOperatorLeftCol(nil, operator, &leftCol)
+	operSQL, params := d.GenerateOperatorSQL(nil, nil, operator, args, tz)
+	return leftCol + " " + operSQL, params
 }
 
 // postgresql unsupports updating joined record.
@@ -145,11 +200,15 @@ func (d *dbBasePostgres) setval(db dbQuerier, mi *modelInfo, autoFields []string
 	}
 
 	Q := d.ins.TableQuote()
+	table := mi.table
+	if mi.schema != "" {
+		table = mi.schema + "." + table
+	}
 	for _, name := range autoFields {
-		query := fmt.Sprintf("SELECT setval(pg_get_serial_sequence('%s', '%s'), (SELECT MAX(%s%s%s) FROM %s%s%s));",
-			mi.table, name,
+		query := fmt.Sprintf("SELECT setval(pg_get_serial_sequence('%s', '%s'), (SELECT MAX(%s%s%s) FROM %s));",
+			table, name,
 			Q, name, Q,
-			Q, mi.table, Q)
+			d.quoteTable(mi))
 		if _, err := db.Exec(query); err != nil {
 			return err
 		}
@@ -181,6 +240,89 @@ func (d *dbBasePostgres) IndexExists(db dbQuerier, table string, name string) bo
 	return cnt > 0
 }
 
+// read the columns, indexes and foreign keys of table in the current schema for postgresql.
+func (d *dbBasePostgres) GetTableSchema(db dbQuerier, table string) (*tableSchema, error) {
+	schema := &tableSchema{name: table}
+
+	rows, err := db.Query("SELECT column_name, data_type, udt_name, is_nullable, column_default, is_identity, "+
+		"character_maximum_length, numeric_precision, numeric_scale FROM information_schema.columns "+
+		"WHERE table_schema = current_schema() AND table_name = $1 ORDER BY ordinal_position", table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var dataType, udtName, null, identity string
+		var size, digits, decimals sql.NullInt64
+		c := new(columnSchema)
+		if err := rows.Scan(&c.name, &dataType, &udtName, &null, &c.def, &identity, &size, &digits, &decimals); err != nil {
+			return nil, err
+		}
+		c.dataType = dataType
+		if dataType == "USER-DEFINED" || dataType == "ARRAY" {
+			c.dataType = udtName
+		}
+		c.size = int(size.Int64)
+		if c.dataType == "numeric" {
+			c.digits, c.decimals = int(digits.Int64), int(decimals.Int64)
+		}
+		c.null = null == "YES"
+		c.auto = identity == "YES" || strings.HasPrefix(c.def.String, "nextval(")
+		if c.auto {
+			c.def.Valid = false
+		}
+		schema.columns = append(schema.columns, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = db.Query("SELECT i.relname, ix.indisunique, ix.indisprimary, a.attname FROM pg_index ix "+
+		"JOIN pg_class t ON t.oid = ix.indrelid JOIN pg_class i ON i.oid = ix.indexrelid "+
+		"JOIN pg_namespace n ON n.oid = t.relnamespace "+
+		"CROSS JOIN LATERAL unnest(ix.indkey::int2[]) WITH ORDINALITY AS k(attnum, ord) "+
+		"JOIN pg_attribute a ON a.attrelid = t.oid AND a.attnum = k.attnum "+
+		"WHERE n.nspname = current_schema() AND t.relname = $1 ORDER BY i.relname, k.ord", table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name, column string
+		var unique, primary bool
+		if err := rows.Scan(&name, &unique, &primary, &column); err != nil {
+			return nil, err
+		}
+		schema.addIndexColumn(name, unique, primary, column)
+		if c := schema.column(column); c != nil && primary {
+			c.pk = true
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = db.Query("SELECT rc.constraint_name, kcu.column_name, ccu.table_name, ccu.column_name, rc.delete_rule "+
+		"FROM information_schema.referential_constraints rc JOIN information_schema.key_column_usage kcu "+
+		"ON kcu.constraint_schema = rc.constraint_schema AND kcu.constraint_name = rc.constraint_name "+
+		"JOIN information_schema.constraint_column_usage ccu "+
+		"ON ccu.constraint_schema = rc.unique_constraint_schema AND ccu.constraint_name = rc.unique_constraint_name "+
+		"WHERE kcu.table_schema = current_schema() AND kcu.table_name = $1 "+
+		"ORDER BY rc.constraint_name, kcu.ordinal_position", table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		fk := new(foreignKeySchema)
+		if err := rows.Scan(&fk.name, &fk.column, &fk.refTable, &fk.refColumn, &fk.onDelete); err != nil {
+			return nil, err
+		}
+		schema.foreignKeys = append(schema.foreignKeys, fk)
+	}
+	return schema, rows.Err()
+}
+
 // create new postgresql dbBaser.
 func newDBBasePostgres() dbBaser {
 	b := new(dbBasePostgres)
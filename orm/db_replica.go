@@ -0,0 +1,229 @@
+// Copyright 2019 asana Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package orm
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ReplicaPolicy chooses the replica serving a read
+type ReplicaPolicy int
+
+// Define the replica policies
+const (
+	// use the replicas in turn
+	RoundRobin ReplicaPolicy = iota
+	// use the replica with the fewest connections in use
+	LeastConns
+)
+
+// ReplicaPingInterval is the interval of the replica health check.
+// a replica is ejected when its ping fails, and used again when a ping succeeds.
+var ReplicaPingInterval = 5 * time.Second
+
+type replica struct {
+	db         *DB
+	dataSource string
+	healthy    int32
+}
+
+func (r *replica) isHealthy() bool {
+	return atomic.LoadInt32(&r.healthy) == 1
+}
+
+// replicas of an alias, reads out of transactions are routed to them
+type replicaSet struct {
+	sync.RWMutex
+	alias    string
+	policy   ReplicaPolicy
+	next     uint32
+	replicas []*replica
+	// closed to stop the health check, nil when it is not running
+	stop chan struct{}
+}
+
+func (rs *replicaSet) add(r *replica) {
+	rs.Lock()
+	rs.replicas = append(rs.replicas, r)
+	var stop chan struct{}
+	if rs.stop == nil {
+		stop = make(chan struct{})
+		rs.stop = stop
+	}
+	rs.Unlock()
+
+	if stop != nil {
+		go rs.watch(stop)
+	}
+}
+
+// close stop the health check and close the replicas
+func (rs *replicaSet) close() error {
+	rs.Lock()
+	replicas := rs.replicas
+	rs.replicas = nil
+	if rs.stop != nil {
+		close(rs.stop)
+		rs.stop = nil
+	}
+	rs.Unlock()
+
+	var err error
+	for _, r := range replicas {
+		if cerr := r.db.DB.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// pick a healthy replica, return nil if there is none
+func (rs *replicaSet) pick() *DB {
+	rs.RLock()
+	defer rs.RUnlock()
+
+	var healthy []*replica
+	for _, r := range rs.replicas {
+		if r.isHealthy() {
+			healthy = append(healthy, r)
+		}
+	}
+	if len(healthy) == 0 {
+		return nil
+	}
+
+	switch rs.policy {
+	case LeastConns:
+		best := healthy[0]
+		inUse := best.db.DB.Stats().InUse
+		for _, r := range healthy[1:] {
+			if n := r.db.DB.Stats().InUse; n < inUse {
+				best, inUse = r, n
+			}
+		}
+		return best.db
+	default:
+		n := atomic.AddUint32(&rs.next, 1)
+		return healthy[int(n-1)%len(healthy)].db
+	}
+}
+
+// ping the replicas and update their health
+func (rs *replicaSet) check() {
+	rs.RLock()
+	replicas := rs.replicas
+	rs.RUnlock()
+
+	for _, r := range replicas {
+		if err := r.db.DB.Ping(); err != nil {
+			if atomic.SwapInt32(&r.healthy, 0) == 1 {
+				DebugLog.Printf("replica of `%s` ejected, %s\n", rs.alias, err.Error())
+			}
+		} else if atomic.SwapInt32(&r.healthy, 1) == 0 {
+			DebugLog.Printf("replica of `%s` recovered\n", rs.alias)
+		}
+	}
+}
+
+func (rs *replicaSet) watch(stop chan struct{}) {
+	ticker := time.NewTicker(ReplicaPingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			rs.check()
+		case <-stop:
+			return
+		}
+	}
+}
+
+func addReplicaWthDB(aliasName string, db *sql.DB) (*replica, error) {
+	al, ok := dataBaseCache.get(aliasName)
+	if !ok {
+		return nil, fmt.Errorf("DataBase alias name `%s` not registered", aliasName)
+	}
+
+	if err := db.Ping(); err != nil {
+		return nil, fmt.Errorf("register replica Ping `%s`, %s", aliasName, err.Error())
+	}
+
+	r := &replica{db: newDB(db), healthy: 1}
+	al.Replicas.add(r)
+	return r, nil
+}
+
+// AddReplicaWthDB add a read replica to the registered alias
+func AddReplicaWthDB(aliasName string, db *sql.DB) error {
+	_, err := addReplicaWthDB(aliasName, db)
+	return err
+}
+
+// RegisterReplica add a read replica to the registered alias, the replica uses the driver of the alias.
+// reads out of transactions are routed to the replicas, writes and FOR UPDATE use the primary.
+// params are the max idle and max open conns as in RegisterDataBase.
+func RegisterReplica(aliasName, dataSource string, params ...int) error {
+	al, ok := dataBaseCache.get(aliasName)
+	if !ok {
+		return fmt.Errorf("DataBase alias name `%s` not registered", aliasName)
+	}
+
+	db, err := sql.Open(al.DriverName, dataSource)
+	if err != nil {
+		err = fmt.Errorf("register replica `%s`, %s", aliasName, err.Error())
+		DebugLog.Println(err.Error())
+		return err
+	}
+
+	r, err := addReplicaWthDB(aliasName, db)
+	if err != nil {
+		db.Close()
+		DebugLog.Println(err.Error())
+		return err
+	}
+	r.dataSource = dataSource
+
+	for i, v := range params {
+		switch i {
+		case 0:
+			db.SetMaxIdleConns(v)
+		case 1:
+			db.SetMaxOpenConns(v)
+		}
+	}
+	return nil
+}
+
+// CloseReplicas close the read replicas of the alias and stop their health check,
+// reads use the primary again.
+func CloseReplicas(aliasName string) error {
+	al, ok := dataBaseCache.get(aliasName)
+	if !ok {
+		return fmt.Errorf("DataBase alias name `%s` not registered", aliasName)
+	}
+	return al.Replicas.close()
+}
+
+// SetReplicaPolicy Change the policy choosing the replica of a read, use specify database alias name
+func SetReplicaPolicy(aliasName string, policy ReplicaPolicy) {
+	al := getDbAlias(aliasName)
+	al.Replicas.Lock()
+	al.Replicas.policy = policy
+	al.Replicas.Unlock()
+}
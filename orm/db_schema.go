@@ -0,0 +1,125 @@
+// Copyright 2019 asana Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package orm
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+)
+
+// the schema of a table read from the database, used to generate the models.
+type tableSchema struct {
+	name        string
+	columns     []*columnSchema
+	indexes     []*indexSchema
+	foreignKeys []*foreignKeySchema
+}
+
+// get the column by name
+func (t *tableSchema) column(name string) *columnSchema {
+	for _, c := range t.columns {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// get the primary key columns
+func (t *tableSchema) pkColumns() []*columnSchema {
+	var cols []*columnSchema
+	for _, c := range t.columns {
+		if c.pk {
+			cols = append(cols, c)
+		}
+	}
+	return cols
+}
+
+// add a column of the index, the rows of the index columns are ordered by index.
+func (t *tableSchema) addIndexColumn(name string, unique, primary bool, column string) {
+	if n := len(t.indexes); n > 0 && t.indexes[n-1].name == name {
+		t.indexes[n-1].columns = append(t.indexes[n-1].columns, column)
+		return
+	}
+	t.indexes = append(t.indexes, &indexSchema{name: name, unique: unique, primary: primary, columns: []string{column}})
+}
+
+type columnSchema struct {
+	name     string
+	dataType string // lower case type name without the arguments, such as varchar
+	size     int
+	digits   int
+	decimals int
+	unsigned bool
+	null     bool
+	pk       bool
+	auto     bool
+	autoNow  bool // updated to the current time on update
+	def      sql.NullString
+}
+
+type indexSchema struct {
+	name    string
+	unique  bool
+	primary bool
+	columns []string
+}
+
+type foreignKeySchema struct {
+	name      string // the constraint name
+	column    string
+	refTable  string
+	refColumn string // empty for the primary key
+	onDelete  string // the referential action, such as CASCADE
+}
+
+// parse a column type such as varchar(255), decimal(8,2) or int(10) unsigned.
+func parseColumnType(typ string) (name string, args []int, unsigned bool) {
+	typ = strings.ToLower(strings.TrimSpace(typ))
+	unsigned = strings.Contains(typ, "unsigned")
+	name = typ
+	if i := strings.Index(typ, "("); i != -1 {
+		name = typ[:i]
+		if j := strings.Index(typ[i:], ")"); j != -1 {
+			for _, v := range strings.Split(typ[i+1:i+j], ",") {
+				if n, err := strconv.Atoi(strings.TrimSpace(v)); err == nil {
+					args = append(args, n)
+				}
+			}
+		}
+	} else {
+		name = strings.TrimSpace(strings.Replace(strings.Replace(name, "unsigned", "", 1), "zerofill", "", 1))
+	}
+	return strings.TrimSpace(name), args, unsigned
+}
+
+// set the size or the digits and decimals of the column from the type arguments
+func (c *columnSchema) setTypeArgs(args []int) {
+	switch c.dataType {
+	case "decimal", "numeric":
+		if len(args) > 0 {
+			c.digits = args[0]
+		}
+		if len(args) > 1 {
+			c.decimals = args[1]
+		}
+	default:
+		if len(args) > 0 {
+			c.size = args[0]
+		}
+	}
+}
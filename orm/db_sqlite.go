@@ -17,6 +17,10 @@ package orm
 import (
 	"database/sql"
 	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // sqlite operators.
@@ -35,6 +39,20 @@ var sqliteOperators = map[string]string{
 	"endswith":    "LIKE ? ESCAPE '\\'",
 	"istartswith": "LIKE ? ESCAPE '\\'",
 	"iendswith":   "LIKE ? ESCAPE '\\'",
+	"regex":       "REGEXP ?",
+	"iregex":      "REGEXP ?",
+	"year":        "= ?",
+	"month":       "= ?",
+	"day":         "= ?",
+	"week_day":    "= ?",
+}
+
+// sqlite strftime formats of the date part operators.
+var sqliteDateParts = map[string]string{
+	"year":     "%Y",
+	"month":    "%m",
+	"day":      "%d",
+	"week_day": "%w",
 }
 
 // sqlite column types.
@@ -72,13 +90,83 @@ func (d *dbBaseSqlite) OperatorSQL(operator string) string {
 }
 
 // generate functioned sql for sqlite.
-// only support DATE(text).
+// support DATE(text), the date parts by strftime and the rowid of the full-text search.
 func (d *dbBaseSqlite) GenerateOperatorLeftCol(fi *fieldInfo, operator string, leftCol *string) {
+	if f, ok := sqliteDateParts[operator]; ok {
+		// the times are stored with the zone offset and strftime converts them to utc,
+		// the parts are taken from the stored date time in the time zone of the database as mysql.
+		*leftCol = fmt.Sprintf("CAST(strftime('%s', substr(%s, 1, 19)) AS INTEGER)", f, *leftCol)
+		if operator == "week_day" {
+			// %w is 0 for sunday, week_day is 1 for sunday as mysql
+			*leftCol = fmt.Sprintf("(%s + 1)", *leftCol)
+		}
+		return
+	}
+	if operator == "search" {
+		Q := d.ins.TableQuote()
+		*leftCol = strings.TrimSuffix(*leftCol, Q+fi.column+Q) + Q + fi.mi.fields.pk.column + Q
+		return
+	}
 	if fi.fieldType == TypeDateField {
 		*leftCol = fmt.Sprintf("DATE(%s)", *leftCol)
 	}
 }
 
+// generate the operator sql for sqlite.
+// REGEXP need a regexp function registered to the connections, iregex adds (?i) to the pattern.
+// search matches the rowid of the fts5 table named {table}_fts which indexes the field column,
+// such as CREATE VIRTUAL TABLE post_fts USING fts5(content, content='post', content_rowid='id').
+func (d *dbBaseSqlite) GenerateOperatorSQL(mi *modelInfo, fi *fieldInfo, operator string, args []interface{}, tz *time.Location) (string, []interface{}) {
+	if operator == "search" {
+		if fi == nil {
+			panic(fmt.Errorf("operator `search` need a fts5 table of the field"))
+		}
+		if len(args) != 1 {
+			panic(fmt.Errorf("operator `search` need 1 args not %d", len(args)))
+		}
+		Q := d.ins.TableQuote()
+		sql := fmt.Sprintf("IN (SELECT rowid FROM %s WHERE %s MATCH ?)", Q+fi.mi.table+"_fts"+Q, Q+fi.column+Q)
+		return sql, []interface{}{sqliteSearchQuery(ToStr(args[0]))}
+	}
+	sql, params := d.dbBase.GenerateOperatorSQL(mi, fi, operator, args, tz)
+	if operator == "iregex" {
+		params[0] = "(?i)" + ToStr(params[0])
+	}
+	return sql, params
+}
+
+// quote the words of the plain text as the fts5 strings, the rows must contain all the words.
+func sqliteSearchQuery(text string) string {
+	words := strings.Fields(text)
+	for i, w := range words {
+		words[i] = `"` + strings.Replace(w, `"`, `""`, -1) + `"`
+	}
+	return strings.Join(words, " ")
+}
+
+// generate the sql of the json lookups with the json1 functions.
+// the json containment is not supported.
+func (d *dbBaseSqlite) GenerateJSONSQL(leftCol string, path []string, operator string, args []interface{}, tz *time.Location) (string, []interface{}) {
+	switch operator {
+	case "has_key":
+		return fmt.Sprintf("json_type(%s, %s || '.' || json_quote(?)) IS NOT NULL", leftCol, jsonPathLiteral(path)), jsonKeyArg(args)
+	case "json_contains", "contained_by":
+		panic(fmt.Errorf("operator `%s` of json fields is not supported by sqlite3", operator))
+	}
+
+	// json_extract returns the sql value, json true and false are 1 and 0
+	if jsonScalarKind(args) == reflect.Bool {
+		b := reflect.Indirect(reflect.ValueOf(args[0])).Bool()
+		args = []interface{}{0}
+		if b {
+			args = []interface{}{1}
+		}
+	}
+	leftCol = fmt.Sprintf("json_extract(%s, %s)", leftCol, jsonPathLiteral(path))
+	operSQL, params := d.GenerateOperatorSQL(nil, nil, operator, args, tz)
+	return leftCol + " " + operSQL, params
+}
+
 // unable updating joined record in sqlite.
 func (d *dbBaseSqlite) SupportUpdateJoin() bool {
 	return false
@@ -143,6 +231,110 @@ func (d *dbBaseSqlite) IndexExists(db dbQuerier, table string, name string) bool
 	return false
 }
 
+// read the columns, indexes and foreign keys of table by the pragmas in sqlite.
+func (d *dbBaseSqlite) GetTableSchema(db dbQuerier, table string) (*tableSchema, error) {
+	schema := &tableSchema{name: table}
+
+	rows, err := db.Query(d.ins.ShowColumnsQuery(table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var pks int
+	for rows.Next() {
+		var typ string
+		var notNull, pk int
+		var args []int
+		c := new(columnSchema)
+		if err := rows.Scan(new(int), &c.name, &typ, &notNull, &c.def, &pk); err != nil {
+			return nil, err
+		}
+		c.dataType, args, c.unsigned = parseColumnType(typ)
+		c.setTypeArgs(args)
+		c.null = notNull == 0
+		c.pk = pk > 0
+		if c.pk {
+			pks++
+		}
+		schema.columns = append(schema.columns, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	// the integer primary key is the alias of the rowid
+	for _, c := range schema.columns {
+		if c.pk && pks == 1 && c.dataType == "integer" {
+			c.auto = true
+			c.null = false
+		}
+	}
+
+	// the columns of index_list differ by the sqlite versions, the first four are seq, name, unique and origin.
+	var indexes []*indexSchema
+	rows, err = db.Query(fmt.Sprintf("PRAGMA index_list('%s')", table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		values := make([]sql.NullString, len(cols))
+		refs := make([]interface{}, len(cols))
+		for i := range values {
+			refs[i] = &values[i]
+		}
+		if err := rows.Scan(refs...); err != nil {
+			return nil, err
+		}
+		index := &indexSchema{name: values[1].String, unique: values[2].String == "1"}
+		if len(values) > 3 {
+			index.primary = values[3].String == "pk"
+		}
+		indexes = append(indexes, index)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+	for _, index := range indexes {
+		rows, err := db.Query(fmt.Sprintf("PRAGMA index_info('%s')", index.name))
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var column sql.NullString
+			if err := rows.Scan(new(int), new(int), &column); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			index.columns = append(index.columns, column.String)
+		}
+		rows.Close()
+		schema.indexes = append(schema.indexes, index)
+	}
+
+	rows, err = db.Query(fmt.Sprintf("PRAGMA foreign_key_list('%s')", table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		var refColumn sql.NullString
+		fk := new(foreignKeySchema)
+		if err := rows.Scan(&id, new(int), &fk.refTable, &fk.column, &refColumn, new(string), &fk.onDelete, new(string)); err != nil {
+			return nil, err
+		}
+		fk.name = strconv.Itoa(id)
+		fk.refColumn = refColumn.String
+		schema.foreignKeys = append(schema.foreignKeys, fk)
+	}
+	return schema, rows.Err()
+}
+
 // create new sqlite dbBaser.
 func newDBBaseSqlite() dbBaser {
 	b := new(dbBaseSqlite)
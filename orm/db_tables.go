@@ -40,6 +40,8 @@ type dbTables struct {
 	mi      *modelInfo
 	base    dbBaser
 	skipEnd bool
+	// annotations of the query by name
+	annotations map[string]*annotation
 }
 
 // set table info to collection.
@@ -183,7 +185,7 @@ func (t *dbTables) getJoinSQL() (join string) {
 			t1 = jt.jtl.index
 		}
 		t2 = jt.index
-		table = jt.mi.table
+		table = t.base.quoteTable(t.mi.routed(jt.mi))
 
 		switch {
 		case jt.fi.fieldType == RelManyToMany || jt.fi.fieldType == RelReverseMany || jt.fi.reverse && jt.fi.reverseFieldInfo.fieldType == RelManyToMany:
@@ -204,7 +206,7 @@ func (t *dbTables) getJoinSQL() (join string) {
 			}
 		}
 
-		join += fmt.Sprintf("%s%s%s %s ON %s.%s%s%s = %s.%s%s%s ", Q, table, Q, t2,
+		join += fmt.Sprintf("%s %s ON %s.%s%s%s = %s.%s%s%s ", table, t2,
 			t2, Q, c2, Q, t1, Q, c1, Q)
 	}
 	return
@@ -327,6 +329,18 @@ loopFor:
 
 // generate condition sql.
 func (t *dbTables) getCondSQL(cond *Condition, sub bool, tz *time.Location) (where string, params []interface{}) {
+	// the rows of a tenant scoped model are filtered by the tenant
+	if fi := t.mi.fields.tenant; fi != nil && !sub {
+		Q := t.base.TableQuote()
+		where, params = t.getCondSQL(cond, true, tz)
+		if where != "" {
+			where = fmt.Sprintf("( %s) AND ", where)
+		}
+		where = fmt.Sprintf("WHERE %sT0.%s%s%s = ? ", where, Q, fi.column, Q)
+		params = append(params, tenantValue(t.mi))
+		return
+	}
+
 	if cond == nil || cond.IsEmpty() {
 		return
 	}
@@ -363,6 +377,8 @@ func (t *dbTables) getCondSQL(cond *Condition, sub bool, tz *time.Location) (whe
 				exprs = exprs[:num]
 			}
 
+			exprs, path := splitJSONPath(mi, exprs)
+
 			index, _, fi, suc := t.parseExprs(mi, exprs)
 			if !suc {
 				panic(fmt.Errorf("unknown field/column name `%s`", strings.Join(p.exprs, ExprSep)))
@@ -372,6 +388,19 @@ func (t *dbTables) getCondSQL(cond *Condition, sub bool, tz *time.Location) (whe
 				operator = "exact"
 			}
 
+			leftCol := fmt.Sprintf("%s.%s%s%s", index, Q, fi.column, Q)
+
+			// the keys in the json value and the json operators
+			if isJSONField(fi) && !p.isRaw && (len(path) > 0 || jsonOperators[operator]) {
+				w, args := t.base.GenerateJSONSQL(leftCol, path, operator, p.args, tz)
+				where += w + " "
+				params = append(params, args...)
+				continue
+			}
+			if operator == "has_key" || operator == "json_contains" || operator == "contained_by" {
+				panic(fmt.Errorf("operator `%s` is only for json fields", operator))
+			}
+
 			var operSQL string
 			var args []interface{}
 			if p.isRaw {
@@ -380,7 +409,6 @@ func (t *dbTables) getCondSQL(cond *Condition, sub bool, tz *time.Location) (whe
 				operSQL, args = t.base.GenerateOperatorSQL(mi, fi, operator, p.args, tz)
 			}
 
-			leftCol := fmt.Sprintf("%s.%s%s%s", index, Q, fi.column, Q)
 			t.base.GenerateOperatorLeftCol(fi, operator, &leftCol)
 
 			where += fmt.Sprintf("%s %s ", leftCol, operSQL)
@@ -435,6 +463,11 @@ func (t *dbTables) getOrderSQL(orders []string) (orderSQL string) {
 			asc = "DESC"
 			order = order[1:]
 		}
+		if an, ok := t.annotations[order]; ok {
+			orderSqls = append(orderSqls, fmt.Sprintf("%s %s", an.sql, asc))
+			continue
+		}
+
 		exprs := strings.Split(order, ExprSep)
 
 		index, _, fi, suc := t.parseExprs(t.mi, exprs)
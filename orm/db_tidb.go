@@ -30,6 +30,11 @@ func (d *dbBaseTidb) OperatorSQL(operator string) string {
 	return mysqlOperators[operator]
 }
 
+// generate functioned sql for tidb as mysql.
+func (d *dbBaseTidb) GenerateOperatorLeftCol(fi *fieldInfo, operator string, leftCol *string) {
+	mysqlOperatorLeftCol(operator, leftCol)
+}
+
 // get mysql table field types.
 func (d *dbBaseTidb) DbTypes() map[string]string {
 	return mysqlTypes
@@ -55,6 +60,11 @@ func (d *dbBaseTidb) IndexExists(db dbQuerier, table string, name string) bool {
 	return cnt > 0
 }
 
+// read the columns, indexes and foreign keys of table for tidb as mysql.
+func (d *dbBaseTidb) GetTableSchema(db dbQuerier, table string) (*tableSchema, error) {
+	return mysqlTableSchema(db, table)
+}
+
 // create new mysql dbBaser.
 func newDBBaseTidb() dbBaser {
 	b := new(dbBaseTidb)
@@ -53,6 +53,54 @@ func getExistPk(mi *modelInfo, ind reflect.Value) (column string, value interfac
 	return
 }
 
+// get the optimistic locking version of the model struct.
+func getVersion(fi *fieldInfo, ind reflect.Value) int64 {
+	v := ind.FieldByIndex(fi.fieldIndex)
+	if fi.fieldType&IsPositiveIntegerField > 0 {
+		return int64(v.Uint())
+	}
+	return v.Int()
+}
+
+// set the optimistic locking version of the model struct.
+func setVersion(fi *fieldInfo, ind reflect.Value, version int64) {
+	v := ind.FieldByIndex(fi.fieldIndex)
+	if fi.fieldType&IsPositiveIntegerField > 0 {
+		v.SetUint(uint64(version))
+	} else {
+		v.SetInt(version)
+	}
+}
+
+// check the condition matches the field by an exact value,
+// such as Filter("Version", 3) or Filter("version__exact", 3).
+func condHasExact(mi *modelInfo, cond *Condition, fi *fieldInfo) bool {
+	if cond == nil {
+		return false
+	}
+	for _, p := range cond.params {
+		if p.isCond {
+			if condHasExact(mi, p.cond, fi) {
+				return true
+			}
+			continue
+		}
+		if p.isNot || p.isOr || p.isRaw {
+			continue
+		}
+		exprs := p.exprs
+		if len(exprs) == 2 && exprs[1] == "exact" {
+			exprs = exprs[:1]
+		}
+		if len(exprs) == 1 {
+			if f, ok := mi.fields.GetByAny(exprs[0]); ok && f == fi {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // get fields description as flatted string.
 func getFlatParams(fi *fieldInfo, args []interface{}, tz *time.Location) (params []interface{}) {
 
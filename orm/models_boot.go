@@ -236,17 +236,13 @@ func bootStrap() {
 			switch fi.fieldType {
 			case RelReverseOne:
 				found := false
-			mForA:
-				for _, ffi := range fi.relModelInfo.fields.fieldsByType[RelOneToOne] {
-					if ffi.relModelInfo == mi {
-						found = true
-						fi.reverseField = ffi.name
-						fi.reverseFieldInfo = ffi
+				if ffi := reverseRelField(fi.relModelInfo.fields.fieldsByType[RelOneToOne], mi); ffi != nil {
+					found = true
+					fi.reverseField = ffi.name
+					fi.reverseFieldInfo = ffi
 
-						ffi.reverseField = fi.name
-						ffi.reverseFieldInfo = fi
-						break mForA
-					}
+					ffi.reverseField = fi.name
+					ffi.reverseFieldInfo = fi
 				}
 				if !found {
 					err = fmt.Errorf("reverse field `%s` not found in model `%s`", fi.fullName, fi.relModelInfo.fullName)
@@ -254,18 +250,13 @@ func bootStrap() {
 				}
 			case RelReverseMany:
 				found := false
-			mForB:
-				for _, ffi := range fi.relModelInfo.fields.fieldsByType[RelForeignKey] {
-					if ffi.relModelInfo == mi {
-						found = true
-						fi.reverseField = ffi.name
-						fi.reverseFieldInfo = ffi
+				if ffi := reverseRelField(fi.relModelInfo.fields.fieldsByType[RelForeignKey], mi); ffi != nil {
+					found = true
+					fi.reverseField = ffi.name
+					fi.reverseFieldInfo = ffi
 
-						ffi.reverseField = fi.name
-						ffi.reverseFieldInfo = fi
-
-						break mForB
-					}
+					ffi.reverseField = fi.name
+					ffi.reverseFieldInfo = fi
 				}
 				if !found {
 				mForC:
@@ -302,6 +293,18 @@ end:
 	}
 }
 
+// find the relation field of fields to mi for a reverse field.
+// the reverse fields of a model are paired in order with the relation fields to it,
+// nil is returned when every relation field already has its reverse field.
+func reverseRelField(fields []*fieldInfo, mi *modelInfo) *fieldInfo {
+	for _, ffi := range fields {
+		if ffi.relModelInfo == mi && ffi.reverseFieldInfo == nil {
+			return ffi
+		}
+	}
+	return nil
+}
+
 // RegisterModel register models
 func RegisterModel(models ...interface{}) {
 	if modelCache.done {
@@ -26,6 +26,8 @@ var errSkipField = errors.New("skip field")
 // field info collection
 type fields struct {
 	pk            *fieldInfo
+	version       *fieldInfo
+	tenant        *fieldInfo
 	columns       map[string]*fieldInfo
 	fields        map[string]*fieldInfo
 	fieldsLow     map[string]*fieldInfo
@@ -122,6 +124,9 @@ type fieldInfo struct {
 	toText              bool
 	autoNow             bool
 	autoNowAdd          bool
+	version             bool // optimistic locking version
+	tenant              bool // tenant of a tenant scoped model
+	jsonValue           bool // struct, map or slice encoded as json
 	rel                 bool // if type equal to RelForeignKey, RelOneToOne, RelManyToMany then true
 	reverse             bool
 	reverseField        string
@@ -241,6 +246,15 @@ checkType:
 			}
 		}
 
+		if t := tags["type"]; (t == "json" || t == "jsonb") && isJSONValueKind(field) {
+			fi.jsonValue = true
+			fieldType = TypeJSONField
+			if t == "jsonb" {
+				fieldType = TypeJsonbField
+			}
+			break checkType
+		}
+
 		fieldType, err = getFieldType(addrField)
 		if err != nil {
 			goto end
@@ -307,6 +321,8 @@ checkType:
 	fi.auto = attrs["auto"]
 	fi.pk = attrs["pk"]
 	fi.unique = attrs["unique"]
+	fi.version = attrs["version"]
+	fi.tenant = attrs["tenant"]
 
 	// Mark object property if there is attribute "default" in the orm configuration
 	if _, ok := tags["default"]; ok {
@@ -406,6 +422,21 @@ checkType:
 			err = fmt.Errorf("non-integer type cannot set auto")
 			goto end
 		}
+		if fi.version {
+			err = fmt.Errorf("non-integer type cannot set version")
+			goto end
+		}
+	}
+
+	if fi.version && (fi.auto || fi.pk || fi.null || fi.isFielder || field.Kind() == reflect.Ptr) {
+		err = fmt.Errorf("version field cannot be pk, auto, null, ptr or Fielder")
+		goto end
+	}
+
+	if fi.tenant && (fieldType != TypeVarCharField && fieldType != TypeCharField && fieldType&IsIntegerField == 0 ||
+		fi.auto || fi.pk || fi.null || fi.isFielder || field.Kind() == reflect.Ptr) {
+		err = fmt.Errorf("tenant field must be a string or integer field and cannot be pk, auto, null, ptr or Fielder")
+		goto end
 	}
 
 	if fi.auto || fi.pk {
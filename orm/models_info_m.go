@@ -32,6 +32,10 @@ type modelInfo struct {
 	addrField reflect.Value //store the original struct value
 	uniques   []string
 	isThrough bool
+	// route of the tenant views of the model, see tenantView
+	tenant  string
+	tenancy TenancyMode
+	schema  string
 }
 
 // new model info
@@ -91,6 +95,22 @@ func addModelFields(mi *modelInfo, ind reflect.Value, mName string, index []int)
 				mi.fields.pk = fi
 			}
 		}
+		if fi.version {
+			if mi.fields.version != nil {
+				err = fmt.Errorf("one model must have one version field only")
+				break
+			} else {
+				mi.fields.version = fi
+			}
+		}
+		if fi.tenant {
+			if mi.fields.tenant != nil {
+				err = fmt.Errorf("one model must have one tenant field only")
+				break
+			} else {
+				mi.fields.tenant = fi
+			}
+		}
 	}
 
 	if err != nil {
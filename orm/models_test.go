@@ -411,6 +411,32 @@ type PtrPk struct {
 	Positive bool
 }
 
+type Article struct {
+	ID      int    `orm:"column(id)"`
+	Title   string `orm:"size(60)"`
+	Version int    `orm:"version"`
+}
+
+type Invoice struct {
+	ID     int    `orm:"column(id)"`
+	Tenant string `orm:"size(30);tenant"`
+	Number string `orm:"size(30)"`
+}
+
+type PreferenceSettings struct {
+	Theme    string `json:"theme"`
+	FontSize int    `json:"font_size"`
+	Beta     bool   `json:"beta"`
+}
+
+type Preference struct {
+	ID       int                    `orm:"column(id)"`
+	Name     string                 `orm:"size(30)"`
+	Settings PreferenceSettings     `orm:"type(json)"`
+	Extra    map[string]interface{} `orm:"type(jsonb);null"`
+	Tags     []string               `orm:"type(jsonb);null"`
+}
+
 var DBARGS = struct {
 	Driver string
 	Source string
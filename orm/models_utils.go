@@ -33,6 +33,8 @@ var supportTag = map[string]int{
 	"auto":         1,
 	"auto_now":     1,
 	"auto_now_add": 1,
+	"version":      1,
+	"tenant":       1,
 	"size":         2,
 	"column":       2,
 	"default":      2,
@@ -123,6 +125,26 @@ func getColumnName(ft int, _ reflect.Value, sf reflect.StructField, col string)
 	return column
 }
 
+// check the field is a struct, map or slice stored as json by `orm:"type(json)"`.
+// the sql.Null types and time.Time are stored as their values.
+func isJSONValueKind(field reflect.Value) bool {
+	typ := field.Type()
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	switch typ.Kind() {
+	case reflect.Map, reflect.Slice:
+		return true
+	case reflect.Struct:
+		switch reflect.New(typ).Interface().(type) {
+		case *sql.NullString, *sql.NullInt64, *sql.NullFloat64, *sql.NullBool, *time.Time:
+			return false
+		}
+		return true
+	}
+	return false
+}
+
 // return field type as type constant from reflect.Value
 func getFieldType(val reflect.Value) (ft int, err error) {
 	switch val.Type() {
@@ -60,7 +60,6 @@ import (
 	"fmt"
 	"os"
 	"reflect"
-	"sync"
 	"time"
 )
 
@@ -92,9 +91,15 @@ type Params map[string]interface{}
 type ParamsList []interface{}
 
 type orm struct {
-	alias *alias
-	db    dbQuerier
-	isTx  bool
+	alias      *alias
+	db         dbQuerier
+	isTx       bool
+	ctx        context.Context
+	rywWindow  time.Duration
+	lastWrite  time.Time
+	savepoints int
+	// tables written in the transaction, invalidated in the query cache by the commit
+	txWrites []string
 }
 
 var _ Ormer = new(orm)
@@ -109,7 +114,7 @@ func (o *orm) getMiInd(md interface{}, needPtr bool) (mi *modelInfo, ind reflect
 	}
 	name := getFullName(typ)
 	if mi, ok := modelCache.getByFullName(name); ok {
-		return mi, ind
+		return o.tenantModel(mi), ind
 	}
 	panic(fmt.Errorf("<Ormer> table: `%s` not found, make sure it was registered with `RegisterModel()`", name))
 }
@@ -123,10 +128,36 @@ func (o *orm) getFieldInfo(mi *modelInfo, name string) *fieldInfo {
 	return fi
 }
 
+// get the querier for reads.
+// a replica is used out of transactions and out of the read-your-writes window.
+func (o *orm) reader() dbQuerier {
+	if o.isTx || o.alias.Replicas == nil {
+		return o.db
+	}
+	if o.rywWindow > 0 && time.Since(o.lastWrite) < o.rywWindow {
+		return o.db
+	}
+	db := o.alias.Replicas.pick()
+	if db == nil {
+		return o.db
+	}
+	if logQueries() {
+		return newDbQueryLog(o.ctx, o.alias, db)
+	}
+	return db
+}
+
+// record a write to the primary for the read-your-writes window
+func (o *orm) wrote() {
+	if o.rywWindow > 0 {
+		o.lastWrite = time.Now()
+	}
+}
+
 // read data to model
 func (o *orm) Read(md interface{}, cols ...string) error {
 	mi, ind := o.getMiInd(md, true)
-	return o.alias.DbBaser.Read(o.db, mi, ind, o.alias.TZ, cols, false)
+	return o.alias.DbBaser.Read(o.reader(), mi, ind, o.alias.TZ, cols, false)
 }
 
 // read data to model, like Read(), but use "SELECT FOR UPDATE" form
@@ -161,6 +192,8 @@ func (o *orm) ReadOrCreate(md interface{}, col1 string, cols ...string) (bool, i
 // insert model data to database
 func (o *orm) Insert(md interface{}) (int64, error) {
 	mi, ind := o.getMiInd(md, true)
+	o.wrote()
+	defer o.invalidate(mi)
 	id, err := o.alias.DbBaser.Insert(o.db, mi, ind, o.alias.TZ)
 	if err != nil {
 		return id, err
@@ -187,6 +220,7 @@ func (o *orm) InsertMulti(bulk int, mds interface{}) (int64, error) {
 	var cnt int64
 
 	sind := reflect.Indirect(reflect.ValueOf(mds))
+	o.wrote()
 
 	switch sind.Kind() {
 	case reflect.Array, reflect.Slice:
@@ -197,6 +231,9 @@ func (o *orm) InsertMulti(bulk int, mds interface{}) (int64, error) {
 		return cnt, ErrArgs
 	}
 
+	mi, _ := o.getMiInd(reflect.Indirect(sind.Index(0)).Interface(), false)
+	defer o.invalidate(mi)
+
 	if bulk <= 1 {
 		for i := 0; i < sind.Len(); i++ {
 			ind := reflect.Indirect(sind.Index(i))
@@ -211,7 +248,6 @@ func (o *orm) InsertMulti(bulk int, mds interface{}) (int64, error) {
 			cnt++
 		}
 	} else {
-		mi, _ := o.getMiInd(sind.Index(0).Interface(), false)
 		return o.alias.DbBaser.InsertMulti(o.db, mi, sind, bulk, o.alias.TZ)
 	}
 	return cnt, nil
@@ -220,6 +256,8 @@ func (o *orm) InsertMulti(bulk int, mds interface{}) (int64, error) {
 // InsertOrUpdate data to database
 func (o *orm) InsertOrUpdate(md interface{}, colConflitAndArgs ...string) (int64, error) {
 	mi, ind := o.getMiInd(md, true)
+	o.wrote()
+	defer o.invalidate(mi)
 	id, err := o.alias.DbBaser.InsertOrUpdate(o.db, mi, ind, o.alias, colConflitAndArgs...)
 	if err != nil {
 		return id, err
@@ -234,6 +272,8 @@ func (o *orm) InsertOrUpdate(md interface{}, colConflitAndArgs ...string) (int64
 // cols set the columns those want to update.
 func (o *orm) Update(md interface{}, cols ...string) (int64, error) {
 	mi, ind := o.getMiInd(md, true)
+	o.wrote()
+	defer o.invalidate(mi)
 	return o.alias.DbBaser.Update(o.db, mi, ind, o.alias.TZ, cols)
 }
 
@@ -241,6 +281,8 @@ func (o *orm) Update(md interface{}, cols ...string) (int64, error) {
 // cols shows the delete conditions values read from. default is pk
 func (o *orm) Delete(md interface{}, cols ...string) (int64, error) {
 	mi, ind := o.getMiInd(md, true)
+	o.wrote()
+	defer o.invalidate(deletedModels(mi)...)
 	num, err := o.alias.DbBaser.Delete(o.db, mi, ind, o.alias.TZ, cols)
 	if err != nil {
 		return num, err
@@ -449,8 +491,8 @@ func (o *orm) Using(name string) error {
 	}
 	if al, ok := dataBaseCache.get(name); ok {
 		o.alias = al
-		if Debug {
-			o.db = newDbQueryLog(al, al.DB)
+		if logQueries() {
+			o.db = newDbQueryLog(o.ctx, al, al.DB)
 		} else {
 			o.db = al.DB
 		}
@@ -475,8 +517,8 @@ func (o *orm) BeginTx(ctx context.Context, opts *sql.TxOptions) error {
 		return err
 	}
 	o.isTx = true
-	if Debug {
-		o.db.(*dbQueryLog).SetDB(tx)
+	if d, ok := o.db.(*dbQueryLog); ok {
+		d.SetDB(tx)
 	} else {
 		o.db = tx
 	}
@@ -491,6 +533,7 @@ func (o *orm) Commit() error {
 	err := o.db.(txEnder).Commit()
 	if err == nil {
 		o.isTx = false
+		o.invalidateTx()
 		_ = o.Using(o.alias.Name)
 	} else if err == sql.ErrTxDone {
 		return ErrTxDone
@@ -506,6 +549,7 @@ func (o *orm) Rollback() error {
 	err := o.db.(txEnder).Rollback()
 	if err == nil {
 		o.isTx = false
+		o.txWrites = nil
 		_ = o.Using(o.alias.Name)
 	} else if err == sql.ErrTxDone {
 		return ErrTxDone
@@ -518,6 +562,11 @@ func (o *orm) Raw(query string, args ...interface{}) RawSeter {
 	return newRawSet(o, query, args)
 }
 
+// set the read-your-writes window
+func (o *orm) ReadYourWrites(window time.Duration) {
+	o.rywWindow = window
+}
+
 // return current using database Driver
 func (o *orm) Driver() Driver {
 	return driver(o.alias.Name)
@@ -544,6 +593,20 @@ func NewOrm() Ormer {
 	return o
 }
 
+// NewOrmWithContext create new orm whose statements are reported to the query interceptors with ctx,
+// the orm is routed to the tenant of ctx set by WithTenant.
+func NewOrmWithContext(ctx context.Context) Ormer {
+	BootStrap() // execute only once
+
+	o := new(orm)
+	o.ctx = ctx
+	err := o.Using("default")
+	if err != nil {
+		panic(err)
+	}
+	return o
+}
+
 // NewOrmWithDB create a new ormer object with specify *sql.DB for query
 func NewOrmWithDB(driverName, aliasName string, db *sql.DB) (Ormer, error) {
 	var al *alias
@@ -558,19 +621,15 @@ func NewOrmWithDB(driverName, aliasName string, db *sql.DB) (Ormer, error) {
 
 	al.Name = aliasName
 	al.DriverName = driverName
-	al.DB = &DB{
-		RWMutex: new(sync.RWMutex),
-		DB:      db,
-		stmts:   make(map[string]*sql.Stmt),
-	}
+	al.DB = newDB(db)
 
 	detectTZ(al)
 
 	o := new(orm)
 	o.alias = al
 
-	if Debug {
-		o.db = newDbQueryLog(o.alias, db)
+	if logQueries() {
+		o.db = newDbQueryLog(nil, o.alias, db)
 	} else {
 		o.db = db
 	}
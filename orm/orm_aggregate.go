@@ -0,0 +1,259 @@
+// Copyright 2019 asana Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package orm
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Aggregation is an aggregate function of a field, for QuerySeter.Aggregate and QuerySeter.Annotate.
+// the field can follow relations, such as "Orders__Amount".
+type Aggregation struct {
+	fn       string
+	expr     string
+	distinct bool
+	name     string
+}
+
+// Sum return the SUM aggregation of the field, int64 for integer fields and float64 for others
+func Sum(expr string) *Aggregation {
+	return &Aggregation{fn: "SUM", expr: expr}
+}
+
+// Avg return the AVG aggregation of the field as float64
+func Avg(expr string) *Aggregation {
+	return &Aggregation{fn: "AVG", expr: expr}
+}
+
+// Min return the MIN aggregation of the field, typed as the field
+func Min(expr string) *Aggregation {
+	return &Aggregation{fn: "MIN", expr: expr}
+}
+
+// Max return the MAX aggregation of the field, typed as the field
+func Max(expr string) *Aggregation {
+	return &Aggregation{fn: "MAX", expr: expr}
+}
+
+// Count return the COUNT aggregation of the field as int64
+func Count(expr string) *Aggregation {
+	return &Aggregation{fn: "COUNT", expr: expr}
+}
+
+// CountDistinct return the COUNT(DISTINCT) aggregation of the field as int64
+func CountDistinct(expr string) *Aggregation {
+	return &Aggregation{fn: "COUNT", expr: expr, distinct: true}
+}
+
+// As return a copy of the aggregation with the result name
+func (a *Aggregation) As(name string) *Aggregation {
+	c := *a
+	c.name = name
+	return &c
+}
+
+// Name return the result name, default is the field and the function, such as "Amount__sum"
+func (a *Aggregation) Name() string {
+	if a.name != "" {
+		return a.name
+	}
+	return a.expr + ExprSep + strings.ToLower(a.fn)
+}
+
+// convert the aggregated db value
+func (a *Aggregation) convert(d *dbBase, fi *fieldInfo, val interface{}, tz *time.Location) (interface{}, error) {
+	switch a.fn {
+	case "COUNT":
+		if val == nil {
+			return int64(0), nil
+		}
+		return StrTo(ToStr(val)).Int64()
+	case "SUM", "AVG":
+		if val == nil {
+			return nil, nil
+		}
+		if a.fn == "SUM" && fi.fieldType&IsIntegerField > 0 {
+			if n, err := StrTo(ToStr(val)).Int64(); err == nil {
+				return n, nil
+			}
+			// databases may sum integers as decimals
+			f, err := StrTo(ToStr(val)).Float64()
+			return int64(f), err
+		}
+		return StrTo(ToStr(val)).Float64()
+	}
+	return d.convertValueFromDB(fi, val, tz)
+}
+
+// the field of the aggregation when it is compared, nil for the numeric results
+func (a *Aggregation) compareField(fi *fieldInfo) *fieldInfo {
+	switch a.fn {
+	case "MIN", "MAX":
+		return fi
+	}
+	return nil
+}
+
+// generate the aggregation sql.
+// the relations of the aggregated field are LEFT OUTER JOIN, so the rows without related rows are kept.
+func (t *dbTables) getAggregationSQL(a *Aggregation) (string, *fieldInfo) {
+	Q := t.base.TableQuote()
+
+	num := len(t.tables)
+	index, _, fi, suc := t.parseExprs(t.mi, strings.Split(a.expr, ExprSep))
+	if !suc {
+		panic(fmt.Errorf("unknown field/column name `%s`", a.expr))
+	}
+	for _, jt := range t.tables[num:] {
+		jt.inner = false
+	}
+
+	col := fmt.Sprintf("%s.%s%s%s", index, Q, fi.column, Q)
+	if a.distinct {
+		col = "DISTINCT " + col
+	}
+	return fmt.Sprintf("%s(%s)", a.fn, col), fi
+}
+
+// set the annotations, they can be used in the values, orders and having conditions.
+func (t *dbTables) setAnnotations(annotations []*Aggregation) {
+	if len(annotations) == 0 {
+		return
+	}
+	t.annotations = make(map[string]*annotation, len(annotations))
+	for _, a := range annotations {
+		sql, fi := t.getAggregationSQL(a)
+		t.annotations[a.Name()] = &annotation{a, sql, fi}
+	}
+}
+
+// generate having sql, the exprs of the condition are annotation names.
+func (t *dbTables) getHavingSQL(cond *Condition, sub bool, tz *time.Location) (having string, params []interface{}) {
+	if cond == nil || cond.IsEmpty() {
+		return
+	}
+
+	for i, p := range cond.params {
+		if i > 0 {
+			if p.isOr {
+				having += "OR "
+			} else {
+				having += "AND "
+			}
+		}
+		if p.isNot {
+			having += "NOT "
+		}
+		if p.isCond {
+			h, ps := t.getHavingSQL(p.cond, true, tz)
+			if h != "" {
+				h = fmt.Sprintf("( %s) ", h)
+			}
+			having += h
+			params = append(params, ps...)
+			continue
+		}
+
+		exprs := p.exprs
+		operator := "exact"
+		if num := len(exprs) - 1; num > 0 && operators[exprs[num]] {
+			operator = exprs[num]
+			exprs = exprs[:num]
+		}
+
+		name := strings.Join(exprs, ExprSep)
+		an, ok := t.annotations[name]
+		if !ok {
+			panic(fmt.Errorf("unknown annotation name `%s`", name))
+		}
+
+		fi := an.agg.compareField(an.fi)
+		operSQL, args := t.base.GenerateOperatorSQL(t.mi, fi, operator, p.args, tz)
+		leftCol := an.sql
+		if fi != nil {
+			t.base.GenerateOperatorLeftCol(fi, operator, &leftCol)
+		}
+
+		having += fmt.Sprintf("%s %s ", leftCol, operSQL)
+		params = append(params, args...)
+	}
+
+	if !sub && having != "" {
+		having = "HAVING " + having
+	}
+	return
+}
+
+// an annotated aggregation of the query
+type annotation struct {
+	agg *Aggregation
+	sql string
+	fi  *fieldInfo
+}
+
+// query the aggregations of the rows matched by cond, the results are keyed by the aggregation names.
+func (d *dbBase) Aggregate(q dbQuerier, qs *querySet, mi *modelInfo, cond *Condition, aggs []*Aggregation, tz *time.Location) (Params, error) {
+	if len(aggs) == 0 {
+		return nil, ErrArgs
+	}
+
+	tables := newDbTables(mi, d.ins)
+
+	Q := d.ins.TableQuote()
+
+	cols := make([]string, 0, len(aggs))
+	infos := make([]*fieldInfo, 0, len(aggs))
+	for _, a := range aggs {
+		sql, fi := tables.getAggregationSQL(a)
+		cols = append(cols, fmt.Sprintf("%s %s%s%s", sql, Q, a.Name(), Q))
+		infos = append(infos, fi)
+	}
+
+	where, args := tables.getCondSQL(cond, false, tz)
+	join := tables.getJoinSQL()
+
+	query := fmt.Sprintf("SELECT %s FROM %s T0 %s%s", strings.Join(cols, ", "), d.quoteTable(mi), join, where)
+
+	d.ins.ReplaceMarks(&query)
+
+	refs := make([]interface{}, len(cols))
+	for i := range refs {
+		var ref interface{}
+		refs[i] = &ref
+	}
+
+	var err error
+	if qs != nil && qs.forContext {
+		err = q.QueryRowContext(qs.ctx, query, args...).Scan(refs...)
+	} else {
+		err = q.QueryRow(query, args...).Scan(refs...)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(Params, len(aggs))
+	for i, a := range aggs {
+		val := *(refs[i].(*interface{}))
+		value, err := a.convert(d, infos[i], val, tz)
+		if err != nil {
+			return nil, fmt.Errorf("db value convert failed `%v` %s", val, err.Error())
+		}
+		result[a.Name()] = value
+	}
+	return result, nil
+}
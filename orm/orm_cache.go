@@ -0,0 +1,316 @@
+// Copyright 2019 asana Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package orm
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/goasana/asana/cache"
+)
+
+func init() {
+	// time values of the Params read by Values
+	gob.Register(time.Time{})
+}
+
+// query cache of an alias.
+// the entries are keyed by the sql, the args and the versions of the tables of the query,
+// a write to a table gives it a new version so the entries of the old version are not read again.
+type queryCache struct {
+	alias string
+	cache cache.Cache
+	ttl   time.Duration
+}
+
+// key of the version of table
+func (qc *queryCache) versionKey(table string) string {
+	return "orm:" + qc.alias + ":" + table + ":version"
+}
+
+// give table a new version
+func (qc *queryCache) bump(table string) string {
+	version := strconv.FormatInt(time.Now().UnixNano(), 36)
+	if err := qc.cache.Put(qc.versionKey(table), version, 0); err != nil {
+		DebugLog.Printf("query cache of `%s` failed to invalidate `%s`, %s\n", qc.alias, table, err.Error())
+	}
+	return version
+}
+
+// key of the entry of a query
+func (qc *queryCache) key(kind string, tables []string, query string, args []interface{}) string {
+	h := sha1.New()
+	fmt.Fprintf(h, "%s\n%s\n%v\n", kind, query, args)
+	for _, table := range tables {
+		version := cache.GetString(qc.cache.Get(qc.versionKey(table)))
+		if version == "" {
+			version = qc.bump(table)
+		}
+		fmt.Fprintf(h, "%s=%s\n", table, version)
+	}
+	return "orm:" + qc.alias + ":" + hex.EncodeToString(h.Sum(nil))
+}
+
+// read the entry of key into values, it returns false when there is no entry or it cannot be decoded
+func (qc *queryCache) get(key string, values ...interface{}) bool {
+	var data []byte
+	switch v := qc.cache.Get(key).(type) {
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return false
+	}
+	// decode into new values, gob merges into the existing maps and structs
+	dec := gob.NewDecoder(bytes.NewReader(data))
+	news := make([]reflect.Value, len(values))
+	for i, v := range values {
+		news[i] = reflect.New(reflect.TypeOf(v).Elem())
+		if err := dec.Decode(news[i].Interface()); err != nil {
+			return false
+		}
+	}
+	for i, v := range values {
+		reflect.ValueOf(v).Elem().Set(news[i].Elem())
+	}
+	return true
+}
+
+// store values as the entry of key
+func (qc *queryCache) put(key string, ttl time.Duration, values ...interface{}) {
+	var buf bytes.Buffer
+	enc := gob.NewEncoder(&buf)
+	for _, v := range values {
+		if err := enc.Encode(v); err != nil {
+			if Debug {
+				DebugLog.Printf("query cache of `%s` cannot encode `%T`, %s\n", qc.alias, v, err.Error())
+			}
+			return
+		}
+	}
+	if ttl <= 0 {
+		ttl = qc.ttl
+	}
+	if err := qc.cache.Put(key, buf.Bytes(), ttl); err != nil && Debug {
+		DebugLog.Printf("query cache of `%s` failed to store, %s\n", qc.alias, err.Error())
+	}
+}
+
+// SetQueryCache enable the query cache of the alias, ttl is the default timeout of the entries.
+// the results of QuerySeter.Cache and Ormer.ReadCached are stored in c,
+// and the writes of the models through the Ormer and the QuerySeter invalidate the entries of their tables.
+// set a nil c to disable the query cache.
+func SetQueryCache(aliasName string, c cache.Cache, ttl time.Duration) error {
+	al, ok := dataBaseCache.get(aliasName)
+	if !ok {
+		return fmt.Errorf("DataBase alias name `%s` not registered", aliasName)
+	}
+	if c == nil {
+		al.QueryCache = nil
+		return nil
+	}
+	al.QueryCache = &queryCache{alias: aliasName, cache: c, ttl: ttl}
+	return nil
+}
+
+// InvalidateQueryCache invalidate the query cache entries of the tables,
+// use it after changing the tables with Raw or out of the orm.
+func InvalidateQueryCache(aliasName string, tables ...string) error {
+	al, ok := dataBaseCache.get(aliasName)
+	if !ok {
+		return fmt.Errorf("DataBase alias name `%s` not registered", aliasName)
+	}
+	if al.QueryCache == nil {
+		return nil
+	}
+	for _, table := range tables {
+		al.QueryCache.bump(table)
+	}
+	return nil
+}
+
+// get the table of mi in the query cache, qualified by its schema
+func cacheTable(mi *modelInfo) string {
+	if mi.schema != "" {
+		return mi.schema + "." + mi.table
+	}
+	return mi.table
+}
+
+// get the tables of a query, the table of mi and the tables joined
+func queryTables(mi *modelInfo, tables *dbTables) []string {
+	names := []string{cacheTable(mi)}
+	seen := map[string]bool{names[0]: true}
+	for _, tbl := range tables.tables {
+		if tbl.mi == nil {
+			continue
+		}
+		if name := cacheTable(mi.routed(tbl.mi)); !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// read the result of a query from the query cache into values, on a miss load it and store values.
+// the query cache is not used in transactions.
+func (o *orm) cached(ttl time.Duration, kind string, tables []string, query string, args []interface{}, load func() error, values ...interface{}) error {
+	qc := o.alias.QueryCache
+	if qc == nil || o.isTx {
+		return load()
+	}
+
+	key := qc.key(kind, tables, query, args)
+	if qc.get(key, values...) {
+		return nil
+	}
+	if err := load(); err != nil {
+		return err
+	}
+	qc.put(key, ttl, values...)
+	return nil
+}
+
+// invalidate the query cache entries of the written models.
+// in a transaction the tables are invalidated by the commit.
+func (o *orm) invalidate(mis ...*modelInfo) {
+	if o.alias.QueryCache == nil {
+		return
+	}
+	for _, mi := range mis {
+		if o.isTx {
+			o.txWrites = append(o.txWrites, cacheTable(mi))
+		} else {
+			o.alias.QueryCache.bump(cacheTable(mi))
+		}
+	}
+}
+
+// get mi and the models its deletion writes through the on_delete of their relations,
+// the cascaded models are followed to their own relations
+func deletedModels(mi *modelInfo) []*modelInfo {
+	mis := []*modelInfo{mi}
+	seen := map[string]bool{cacheTable(mi): true}
+	deleted := []*modelInfo{mi}
+	for len(deleted) > 0 {
+		cur := deleted[0]
+		deleted = deleted[1:]
+		for _, fi := range cur.fields.fieldsReverse {
+			fi = fi.reverseFieldInfo
+			switch fi.onDelete {
+			case odCascade, odSetDefault, odSetNULL:
+				rmi := cur.routed(fi.mi)
+				table := cacheTable(rmi)
+				if seen[table] {
+					continue
+				}
+				seen[table] = true
+				mis = append(mis, rmi)
+				if fi.onDelete == odCascade {
+					deleted = append(deleted, rmi)
+				}
+			}
+		}
+	}
+	return mis
+}
+
+// invalidate the tables written in the committed transaction
+func (o *orm) invalidateTx() {
+	if o.alias.QueryCache != nil {
+		for _, table := range o.txWrites {
+			o.alias.QueryCache.bump(table)
+		}
+	}
+	o.txWrites = nil
+}
+
+// read data to model through the query cache
+func (o *orm) ReadCached(md interface{}, cols ...string) error {
+	mi, ind := o.getMiInd(md, true)
+	if o.alias.QueryCache == nil {
+		return o.alias.DbBaser.Read(o.reader(), mi, ind, o.alias.TZ, cols, false)
+	}
+
+	query, args, err := o.alias.DbBaser.readSQL(mi, ind, o.alias.TZ, cols, false)
+	if err != nil {
+		return err
+	}
+	load := func() error {
+		return o.alias.DbBaser.Read(o.reader(), mi, ind, o.alias.TZ, cols, false)
+	}
+	return o.cached(0, "read", []string{cacheTable(mi)}, query, args, load, md)
+}
+
+// set the QuerySeter to read through the query cache
+func (o querySet) Cache(ttl time.Duration) QuerySeter {
+	o.cache = true
+	o.cacheTTL = ttl
+	return &o
+}
+
+// check the QuerySeter reads through the query cache
+func (o *querySet) useCache() bool {
+	return o.cache && !o.forupdate && o.orm.alias.QueryCache != nil
+}
+
+// count the rows through the query cache
+func (o *querySet) cachedCount() (int64, error) {
+	var cnt int64
+	query, args, tables := o.orm.alias.DbBaser.countSQL(o, o.mi, o.cond, o.orm.alias.TZ)
+	load := func() (err error) {
+		cnt, err = o.orm.alias.DbBaser.Count(o.reader(), o, o.mi, o.cond, o.orm.alias.TZ)
+		return
+	}
+	err := o.orm.cached(o.cacheTTL, "count", queryTables(o.mi, tables), query, args, load, &cnt)
+	return cnt, err
+}
+
+// read the models into container through the query cache
+func (o *querySet) cachedReadBatch(container interface{}, cols []string) (int64, error) {
+	var num int64
+	query, args, tables, _, _, err := o.orm.alias.DbBaser.readBatchSQL(o, o.mi, o.cond, o.orm.alias.TZ, cols, o.limit)
+	if err != nil {
+		return 0, err
+	}
+	load := func() (err error) {
+		num, err = o.orm.alias.DbBaser.ReadBatch(o.reader(), o, o.mi, o.cond, container, o.orm.alias.TZ, cols)
+		return
+	}
+	kind := fmt.Sprintf("all:%T", container)
+	err = o.orm.cached(o.cacheTTL, kind, queryTables(o.mi, tables), query, args, load, &num, container)
+	return num, err
+}
+
+// read the values into container through the query cache
+func (o *querySet) cachedReadValues(container interface{}, exprs []string) (int64, error) {
+	var num int64
+	query, args, tables, _, _ := o.orm.alias.DbBaser.readValuesSQL(o, o.mi, o.cond, exprs, o.orm.alias.TZ)
+	load := func() (err error) {
+		num, err = o.orm.alias.DbBaser.ReadValues(o.reader(), o, o.mi, o.cond, exprs, container, o.orm.alias.TZ)
+		return
+	}
+	kind := fmt.Sprintf("values:%T", container)
+	err := o.orm.cached(o.cacheTTL, kind, queryTables(o.mi, tables), query, args, load, &num, container)
+	return num, err
+}
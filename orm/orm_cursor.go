@@ -0,0 +1,277 @@
+// Copyright 2019 asana Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package orm
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// CursorSecret signs the cursors of QuerySeter.Page, so clients can not forge the sort key values.
+// it is random by default, set the same secret on all the instances serving the cursors.
+var CursorSecret = randomCursorSecret()
+
+// ErrInvalidCursor is returned by QuerySeter.Page when the cursor is forged, corrupted
+// or was made for other orders.
+var ErrInvalidCursor = errors.New("<QuerySeter.Page> invalid cursor")
+
+func randomCursorSecret() []byte {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		panic(fmt.Errorf("<orm> generate cursor secret, %s", err.Error()))
+	}
+	return secret
+}
+
+// PageCursors are the cursors of the pages around a page read by QuerySeter.Page,
+// they are empty when there is no such page.
+type PageCursors struct {
+	Next string `json:"next,omitempty"`
+	Prev string `json:"prev,omitempty"`
+}
+
+// HasNext return true if there is a page after the page
+func (c *PageCursors) HasNext() bool {
+	return c.Next != ""
+}
+
+// HasPrev return true if there is a page before the page
+func (c *PageCursors) HasPrev() bool {
+	return c.Prev != ""
+}
+
+// a sort key of the keyset pagination
+type cursorKey struct {
+	fi   *fieldInfo
+	desc bool
+}
+
+func (k cursorKey) order(reverse bool) string {
+	if k.desc != reverse {
+		return "-" + k.fi.name
+	}
+	return k.fi.name
+}
+
+// the signed content of a cursor
+type cursorPayload struct {
+	Orders []string `json:"o"`
+	Values []string `json:"v"`
+	Before bool     `json:"b,omitempty"`
+}
+
+// get the sort keys of the orders, the pk is added as the last key to make the order total.
+func cursorKeys(mi *modelInfo, orders []string) ([]cursorKey, error) {
+	keys := make([]cursorKey, 0, len(orders)+1)
+	hasPk := false
+	for _, order := range orders {
+		desc := strings.HasPrefix(order, "-")
+		name := strings.TrimPrefix(order, "-")
+		fi, ok := mi.fields.GetByAny(name)
+		if !ok || fi.fieldType&IsRelField > 0 || fi.null {
+			return nil, fmt.Errorf("<QuerySeter.Page> order `%s` must be a not null field of model `%s`", order, mi.fullName)
+		}
+		if fi == mi.fields.pk {
+			hasPk = true
+		}
+		keys = append(keys, cursorKey{fi, desc})
+	}
+	if !hasPk {
+		desc := len(keys) > 0 && keys[len(keys)-1].desc
+		keys = append(keys, cursorKey{mi.fields.pk, desc})
+	}
+	return keys, nil
+}
+
+func signCursor(content string) string {
+	mac := hmac.New(sha256.New, CursorSecret)
+	mac.Write([]byte(content))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// make the cursor of the model struct ind
+func encodeCursor(keys []cursorKey, ind reflect.Value, before bool) (string, error) {
+	payload := cursorPayload{Before: before}
+	for _, k := range keys {
+		payload.Orders = append(payload.Orders, k.order(false))
+		val := reflect.Indirect(ind.FieldByIndex(k.fi.fieldIndex))
+		if !val.IsValid() {
+			return "", fmt.Errorf("<QuerySeter.Page> sort key `%s` is null", k.fi.name)
+		}
+		if t, ok := val.Interface().(time.Time); ok {
+			payload.Values = append(payload.Values, t.Format(time.RFC3339Nano))
+		} else {
+			payload.Values = append(payload.Values, ToStr(val.Interface()))
+		}
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	content := base64.RawURLEncoding.EncodeToString(data)
+	return content + "." + signCursor(content), nil
+}
+
+// verify the cursor and get the values of the sort keys
+func decodeCursor(keys []cursorKey, cursor string) ([]interface{}, bool, error) {
+	parts := strings.Split(cursor, ".")
+	if len(parts) != 2 || !hmac.Equal([]byte(parts[1]), []byte(signCursor(parts[0]))) {
+		return nil, false, ErrInvalidCursor
+	}
+	data, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, false, ErrInvalidCursor
+	}
+	var payload cursorPayload
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return nil, false, ErrInvalidCursor
+	}
+	if len(payload.Orders) != len(keys) || len(payload.Values) != len(keys) {
+		return nil, false, ErrInvalidCursor
+	}
+
+	values := make([]interface{}, len(keys))
+	for i, k := range keys {
+		if payload.Orders[i] != k.order(false) {
+			return nil, false, ErrInvalidCursor
+		}
+		if values[i], err = cursorValue(k.fi, payload.Values[i]); err != nil {
+			return nil, false, ErrInvalidCursor
+		}
+	}
+	return values, payload.Before, nil
+}
+
+// parse a value of the cursor by the field type
+func cursorValue(fi *fieldInfo, value string) (interface{}, error) {
+	str := StrTo(value)
+	switch {
+	case fi.fieldType == TypeTimeField || fi.fieldType == TypeDateField || fi.fieldType == TypeDateTimeField:
+		return time.Parse(time.RFC3339Nano, value)
+	case fi.fieldType&IsPositiveIntegerField > 0:
+		return str.Uint64()
+	case fi.fieldType&IsIntegerField > 0:
+		return str.Int64()
+	case fi.fieldType == TypeFloatField || fi.fieldType == TypeDecimalField:
+		return str.Float64()
+	case fi.fieldType == TypeBooleanField:
+		return str.Bool()
+	}
+	return value, nil
+}
+
+// condition of the rows after the values in the orders of keys, or before them.
+// (a, b) after (1, 2) is a > 1 OR (a = 1 AND b > 2)
+func cursorCond(keys []cursorKey, values []interface{}, before bool) *Condition {
+	cond := NewCondition()
+	for i, k := range keys {
+		c := NewCondition()
+		for j := 0; j < i; j++ {
+			c = c.And(keys[j].fi.name, values[j])
+		}
+		operator := "gt"
+		if k.desc != before {
+			operator = "lt"
+		}
+		cond = cond.OrCond(c.And(k.fi.name+ExprSep+operator, values[i]))
+	}
+	return cond
+}
+
+// read a page of the keyset pagination to container and return the cursors of the pages around it
+func (o *querySet) Page(container interface{}, cols ...string) (*PageCursors, error) {
+	if o.limit <= 0 {
+		return nil, fmt.Errorf("<QuerySeter.Page> limit must be set")
+	}
+
+	val := reflect.ValueOf(container)
+	ind := reflect.Indirect(val)
+	if val.Kind() != reflect.Ptr || ind.Kind() != reflect.Slice {
+		panic(fmt.Errorf("<QuerySeter.Page> wrong object type `%s`, need a slice pointer", val.Type()))
+	}
+
+	keys, err := cursorKeys(o.mi, o.orders)
+	if err != nil {
+		return nil, err
+	}
+
+	qs := *o
+	before := false
+	if o.cursor != "" {
+		var values []interface{}
+		values, before, err = decodeCursor(keys, o.cursor)
+		if err != nil {
+			return nil, err
+		}
+		cond := o.cond
+		if cond == nil {
+			cond = NewCondition()
+		}
+		qs.cond = cond.AndCond(cursorCond(keys, values, before))
+	}
+
+	qs.orders = make([]string, len(keys))
+	for i, k := range keys {
+		qs.orders[i] = k.order(before)
+	}
+	// read one more row to know if there is a page after it
+	qs.limit = o.limit + 1
+	qs.offset = 0
+
+	num, err := o.orm.alias.DbBaser.ReadBatch(qs.reader(), &qs, qs.mi, qs.cond, container, o.orm.alias.TZ, cols)
+	if err != nil {
+		return nil, err
+	}
+
+	more := num > o.limit
+	if more {
+		ind.Set(ind.Slice(0, int(o.limit)))
+	}
+	if before {
+		swap := reflect.Swapper(ind.Interface())
+		for i, j := 0, ind.Len()-1; i < j; i, j = i+1, j-1 {
+			swap(i, j)
+		}
+	}
+
+	cursors := new(PageCursors)
+	if n := ind.Len(); n > 0 {
+		if more && !before || before {
+			if cursors.Next, err = encodeCursor(keys, reflect.Indirect(ind.Index(n-1)), false); err != nil {
+				return nil, err
+			}
+		}
+		if more && before || !before && o.cursor != "" {
+			if cursors.Prev, err = encodeCursor(keys, reflect.Indirect(ind.Index(0)), true); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if len(o.prefetches) > 0 && ind.Len() > 0 {
+		if err := o.prefetch(container); err != nil {
+			return nil, err
+		}
+	}
+	return cursors, nil
+}
@@ -0,0 +1,171 @@
+// Copyright 2019 asana Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package orm
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// QueryEvent describes a statement run by the orm
+type QueryEvent struct {
+	Ctx       context.Context
+	Alias     string
+	Operation string
+	SQL       string
+	Args      []interface{}
+	Start     time.Time
+	Duration  time.Duration
+	// rows affected by an Exec, -1 for other operations or a failed Exec
+	RowsAffected int64
+	Err          error
+}
+
+// QueryInterceptor is called after every statement, in the order of registration
+type QueryInterceptor func(e *QueryEvent)
+
+var (
+	// the []QueryInterceptor of all the aliases, replaced on registration so the statements read it without a lock
+	queryInterceptors   atomic.Value
+	queryInterceptorsMu sync.Mutex
+)
+
+// AddQueryInterceptor register an interceptor for the statements of all the aliases.
+// register interceptors before creating the ormers, for example in init.
+func AddQueryInterceptor(interceptors ...QueryInterceptor) {
+	queryInterceptorsMu.Lock()
+	defer queryInterceptorsMu.Unlock()
+	old := getQueryInterceptors()
+	chain := make([]QueryInterceptor, 0, len(old)+len(interceptors))
+	chain = append(append(chain, old...), interceptors...)
+	queryInterceptors.Store(chain)
+}
+
+// get the registered interceptors, they must not be modified
+func getQueryInterceptors() []QueryInterceptor {
+	chain, _ := queryInterceptors.Load().([]QueryInterceptor)
+	return chain
+}
+
+// check the statements need the query log wrappers
+func logQueries() bool {
+	return Debug || len(getQueryInterceptors()) > 0
+}
+
+// report a finished statement to the debug log and the interceptors
+func queryDone(ctx context.Context, alias *alias, operation, query string, t time.Time, res sql.Result, err error, args ...interface{}) {
+	if Debug {
+		debugLogQueies(alias, operation, query, t, err, args...)
+	}
+	interceptors := getQueryInterceptors()
+	if len(interceptors) == 0 {
+		return
+	}
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	e := &QueryEvent{
+		Ctx:          ctx,
+		Alias:        alias.Name,
+		Operation:    operation,
+		SQL:          query,
+		Args:         args,
+		Start:        t,
+		Duration:     time.Since(t),
+		RowsAffected: -1,
+		Err:          err,
+	}
+	if res != nil && err == nil {
+		if num, err := res.RowsAffected(); err == nil {
+			e.RowsAffected = num
+		}
+	}
+	for _, interceptor := range interceptors {
+		interceptor(e)
+	}
+}
+
+// SlowQueryInterceptor return an interceptor logging the statements slower than threshold to DebugLog.
+// for example:
+//	orm.AddQueryInterceptor(orm.SlowQueryInterceptor(200 * time.Millisecond))
+func SlowQueryInterceptor(threshold time.Duration) QueryInterceptor {
+	return func(e *QueryEvent) {
+		if e.Duration < threshold {
+			return
+		}
+		con := fmt.Sprintf(" -[Slow/%s] - [%11s / %7.1fms] - [%s]", e.Alias, e.Operation, float64(e.Duration)/float64(time.Millisecond), e.SQL)
+		if len(e.Args) > 0 {
+			con += fmt.Sprintf(" - %v", e.Args)
+		}
+		if e.Err != nil {
+			con += " - " + e.Err.Error()
+		}
+		DebugLog.Println(con)
+	}
+}
+
+// QueryStats counts the statements run with a context from WithQueryStats
+type QueryStats struct {
+	count    int64
+	duration int64
+}
+
+// Count return the number of statements
+func (s *QueryStats) Count() int64 {
+	return atomic.LoadInt64(&s.count)
+}
+
+// Duration return the total time of the statements
+func (s *QueryStats) Duration() time.Duration {
+	return time.Duration(atomic.LoadInt64(&s.duration))
+}
+
+func (s *QueryStats) String() string {
+	return fmt.Sprintf("%d queries / %.0fms", s.Count(), float64(s.Duration())/float64(time.Millisecond))
+}
+
+type queryStatsKey struct{}
+
+// WithQueryStats return a context collecting the QueryStats of the statements run with it.
+// QueryStatsInterceptor must be registered, and the statements must run with the context,
+// by NewOrmWithContext or QuerySeter.WithContext.
+// for example:
+//	ctx := orm.WithQueryStats(r.Context())
+//	o := orm.NewOrmWithContext(ctx)
+//	...
+//	log.Printf("%s %s", r.URL.Path, orm.QueryStatsFromContext(ctx)) // /user 23 queries / 41ms
+// the querystats plugin adds them to the access log of the framework.
+func WithQueryStats(ctx context.Context) context.Context {
+	return context.WithValue(ctx, queryStatsKey{}, new(QueryStats))
+}
+
+// QueryStatsFromContext return the QueryStats of ctx, nil if ctx does not collect them
+func QueryStatsFromContext(ctx context.Context) *QueryStats {
+	s, _ := ctx.Value(queryStatsKey{}).(*QueryStats)
+	return s
+}
+
+// QueryStatsInterceptor adds the statements to the QueryStats of their context
+func QueryStatsInterceptor(e *QueryEvent) {
+	if s := QueryStatsFromContext(e.Ctx); s != nil {
+		atomic.AddInt64(&s.count, 1)
+		atomic.AddInt64(&s.duration, int64(e.Duration))
+	}
+}
@@ -73,6 +73,7 @@ type stmtQueryLog struct {
 	alias *alias
 	query string
 	stmt  stmtQuerier
+	ctx   context.Context
 }
 
 var _ stmtQuerier = new(stmtQueryLog)
@@ -80,36 +81,37 @@ var _ stmtQuerier = new(stmtQueryLog)
 func (d *stmtQueryLog) Close() error {
 	a := time.Now()
 	err := d.stmt.Close()
-	debugLogQueies(d.alias, "st.Close", d.query, a, err)
+	queryDone(d.ctx, d.alias, "st.Close", d.query, a, nil, err)
 	return err
 }
 
 func (d *stmtQueryLog) Exec(args ...interface{}) (sql.Result, error) {
 	a := time.Now()
 	res, err := d.stmt.Exec(args...)
-	debugLogQueies(d.alias, "st.Exec", d.query, a, err, args...)
+	queryDone(d.ctx, d.alias, "st.Exec", d.query, a, res, err, args...)
 	return res, err
 }
 
 func (d *stmtQueryLog) Query(args ...interface{}) (*sql.Rows, error) {
 	a := time.Now()
 	res, err := d.stmt.Query(args...)
-	debugLogQueies(d.alias, "st.Query", d.query, a, err, args...)
+	queryDone(d.ctx, d.alias, "st.Query", d.query, a, nil, err, args...)
 	return res, err
 }
 
 func (d *stmtQueryLog) QueryRow(args ...interface{}) *sql.Row {
 	a := time.Now()
 	res := d.stmt.QueryRow(args...)
-	debugLogQueies(d.alias, "st.QueryRow", d.query, a, nil, args...)
+	queryDone(d.ctx, d.alias, "st.QueryRow", d.query, a, nil, nil, args...)
 	return res
 }
 
-func newStmtQueryLog(alias *alias, stmt stmtQuerier, query string) stmtQuerier {
+func newStmtQueryLog(ctx context.Context, alias *alias, stmt stmtQuerier, query string) stmtQuerier {
 	d := new(stmtQueryLog)
 	d.stmt = stmt
 	d.alias = alias
 	d.query = query
+	d.ctx = ctx
 	return d
 }
 
@@ -120,6 +122,7 @@ type dbQueryLog struct {
 	db    dbQuerier
 	tx    txer
 	txe   txEnder
+	ctx   context.Context
 }
 
 var _ dbQuerier = new(dbQueryLog)
@@ -129,84 +132,84 @@ var _ txEnder = new(dbQueryLog)
 func (d *dbQueryLog) Prepare(query string) (*sql.Stmt, error) {
 	a := time.Now()
 	stmt, err := d.db.Prepare(query)
-	debugLogQueies(d.alias, "db.Prepare", query, a, err)
+	queryDone(d.ctx, d.alias, "db.Prepare", query, a, nil, err)
 	return stmt, err
 }
 
 func (d *dbQueryLog) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
 	a := time.Now()
 	stmt, err := d.db.PrepareContext(ctx, query)
-	debugLogQueies(d.alias, "db.Prepare", query, a, err)
+	queryDone(ctx, d.alias, "db.Prepare", query, a, nil, err)
 	return stmt, err
 }
 
 func (d *dbQueryLog) Exec(query string, args ...interface{}) (sql.Result, error) {
 	a := time.Now()
 	res, err := d.db.Exec(query, args...)
-	debugLogQueies(d.alias, "db.Exec", query, a, err, args...)
+	queryDone(d.ctx, d.alias, "db.Exec", query, a, res, err, args...)
 	return res, err
 }
 
 func (d *dbQueryLog) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
 	a := time.Now()
 	res, err := d.db.ExecContext(ctx, query, args...)
-	debugLogQueies(d.alias, "db.Exec", query, a, err, args...)
+	queryDone(ctx, d.alias, "db.Exec", query, a, res, err, args...)
 	return res, err
 }
 
 func (d *dbQueryLog) Query(query string, args ...interface{}) (*sql.Rows, error) {
 	a := time.Now()
 	res, err := d.db.Query(query, args...)
-	debugLogQueies(d.alias, "db.Query", query, a, err, args...)
+	queryDone(d.ctx, d.alias, "db.Query", query, a, nil, err, args...)
 	return res, err
 }
 
 func (d *dbQueryLog) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
 	a := time.Now()
 	res, err := d.db.QueryContext(ctx, query, args...)
-	debugLogQueies(d.alias, "db.Query", query, a, err, args...)
+	queryDone(ctx, d.alias, "db.Query", query, a, nil, err, args...)
 	return res, err
 }
 
 func (d *dbQueryLog) QueryRow(query string, args ...interface{}) *sql.Row {
 	a := time.Now()
 	res := d.db.QueryRow(query, args...)
-	debugLogQueies(d.alias, "db.QueryRow", query, a, nil, args...)
+	queryDone(d.ctx, d.alias, "db.QueryRow", query, a, nil, nil, args...)
 	return res
 }
 
 func (d *dbQueryLog) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
 	a := time.Now()
 	res := d.db.QueryRowContext(ctx, query, args...)
-	debugLogQueies(d.alias, "db.QueryRow", query, a, nil, args...)
+	queryDone(ctx, d.alias, "db.QueryRow", query, a, nil, nil, args...)
 	return res
 }
 
 func (d *dbQueryLog) Begin() (*sql.Tx, error) {
 	a := time.Now()
 	tx, err := d.db.(txer).Begin()
-	debugLogQueies(d.alias, "db.Begin", "START TRANSACTION", a, err)
+	queryDone(d.ctx, d.alias, "db.Begin", "START TRANSACTION", a, nil, err)
 	return tx, err
 }
 
 func (d *dbQueryLog) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
 	a := time.Now()
 	tx, err := d.db.(txer).BeginTx(ctx, opts)
-	debugLogQueies(d.alias, "db.BeginTx", "START TRANSACTION", a, err)
+	queryDone(ctx, d.alias, "db.BeginTx", "START TRANSACTION", a, nil, err)
 	return tx, err
 }
 
 func (d *dbQueryLog) Commit() error {
 	a := time.Now()
 	err := d.db.(txEnder).Commit()
-	debugLogQueies(d.alias, "tx.Commit", "COMMIT", a, err)
+	queryDone(d.ctx, d.alias, "tx.Commit", "COMMIT", a, nil, err)
 	return err
 }
 
 func (d *dbQueryLog) Rollback() error {
 	a := time.Now()
 	err := d.db.(txEnder).Rollback()
-	debugLogQueies(d.alias, "tx.Rollback", "ROLLBACK", a, err)
+	queryDone(d.ctx, d.alias, "tx.Rollback", "ROLLBACK", a, nil, err)
 	return err
 }
 
@@ -214,9 +217,10 @@ func (d *dbQueryLog) SetDB(db dbQuerier) {
 	d.db = db
 }
 
-func newDbQueryLog(alias *alias, db dbQuerier) dbQuerier {
+func newDbQueryLog(ctx context.Context, alias *alias, db dbQuerier) dbQuerier {
 	d := new(dbQueryLog)
 	d.alias = alias
 	d.db = db
+	d.ctx = ctx
 	return d
 }
@@ -44,6 +44,8 @@ func (o *insertSet) Insert(md interface{}) (int64, error) {
 	if name != o.mi.fullName {
 		panic(fmt.Errorf("<Inserter.Insert> need model `%s` but found `%s`", o.mi.fullName, name))
 	}
+	o.orm.wrote()
+	defer o.orm.invalidate(o.mi)
 	id, err := o.orm.alias.DbBaser.InsertStmt(o.stmt, o.mi, ind, o.orm.alias.TZ)
 	if err != nil {
 		return id, err
@@ -78,8 +80,8 @@ func newInsertSet(orm *orm, mi *modelInfo) (Inserter, error) {
 	if err != nil {
 		return nil, err
 	}
-	if Debug {
-		bi.stmt = newStmtQueryLog(orm.alias, st, query)
+	if logQueries() {
+		bi.stmt = newStmtQueryLog(orm.ctx, orm.alias, st, query)
 	} else {
 		bi.stmt = st
 	}
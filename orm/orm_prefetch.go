@@ -0,0 +1,345 @@
+// Copyright 2019 asana Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package orm
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// PrefetchRelation is a relation loaded by QuerySeter.Prefetch
+// with the conditions and orders of its own QuerySeter.
+type PrefetchRelation struct {
+	name string
+	qs   QuerySeter
+}
+
+// NewPrefetch return a relation to prefetch,
+// qs must query the related model, its conditions and orders are applied to the related rows.
+// limit and offset of qs are ignored.
+// for example:
+//	qs.Prefetch(orm.NewPrefetch("Posts", o.QueryTable("post").Filter("Title__istartswith", "go").OrderBy("-Id")))
+func NewPrefetch(name string, qs QuerySeter) *PrefetchRelation {
+	return &PrefetchRelation{name: name, qs: qs}
+}
+
+// prefetch tree node, children are prefetched on the rows loaded by the node
+type prefetchNode struct {
+	name     string
+	qs       *querySet
+	children []*prefetchNode
+}
+
+func (n *prefetchNode) child(name string) *prefetchNode {
+	for _, c := range n.children {
+		if c.name == name {
+			return c
+		}
+	}
+	c := &prefetchNode{name: name}
+	n.children = append(n.children, c)
+	return c
+}
+
+// build the prefetch tree, "Posts__Tags" prefetches Posts then Tags of the posts
+func newPrefetchTree(rels []*PrefetchRelation) *prefetchNode {
+	root := new(prefetchNode)
+	for _, rel := range rels {
+		node := root
+		for _, name := range strings.Split(rel.name, ExprSep) {
+			node = node.child(name)
+		}
+		if rel.qs != nil {
+			qs, ok := rel.qs.(*querySet)
+			if !ok {
+				panic(fmt.Errorf("<QuerySeter.Prefetch> unsupported QuerySeter for `%s`", rel.name))
+			}
+			node.qs = qs
+		}
+	}
+	return root
+}
+
+// get the model structs of a container read by ReadBatch
+func prefetchTargets(container interface{}) []reflect.Value {
+	var objs []reflect.Value
+	ind := reflect.Indirect(reflect.ValueOf(container))
+	switch ind.Kind() {
+	case reflect.Slice:
+		for i := 0; i < ind.Len(); i++ {
+			if elm := reflect.Indirect(ind.Index(i)); elm.IsValid() {
+				objs = append(objs, elm)
+			}
+		}
+	case reflect.Struct:
+		objs = append(objs, ind)
+	}
+	return objs
+}
+
+// load the prefetch relations of objs, one query for each relation.
+func prefetch(o *orm, mi *modelInfo, objs []reflect.Value, node *prefetchNode) error {
+	for _, n := range node.children {
+		fi, ok := mi.fields.GetByAny(n.name)
+		if !ok || fi.fieldType&IsRelField == 0 {
+			return fmt.Errorf("<QuerySeter.Prefetch> name `%s` for model `%s` is not an available rel/reverse field", n.name, mi.fullName)
+		}
+		if n.qs != nil && n.qs.mi.fullName != fi.relModelInfo.fullName {
+			return fmt.Errorf("<QuerySeter.Prefetch> QuerySeter of `%s` must query model `%s`", n.name, fi.relModelInfo.fullName)
+		}
+
+		var rows []reflect.Value
+		var err error
+		switch {
+		case fi.fieldType == RelForeignKey || fi.fieldType == RelOneToOne:
+			rows, err = prefetchRel(o, fi, objs, n.qs)
+		case fi.fieldType == RelManyToMany || fi.fieldType == RelReverseMany && fi.reverseFieldInfo.mi.isThrough:
+			rows, err = prefetchM2M(o, mi, fi, objs, n.qs)
+		default:
+			rows, err = prefetchReverse(o, mi, fi, objs, n.qs)
+		}
+		if err != nil {
+			return err
+		}
+
+		if len(n.children) > 0 && len(rows) > 0 {
+			if err := prefetch(o, fi.relModelInfo, rows, n); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// query the related rows of mi whose expr is in values.
+// the rows are returned as pointers in query order.
+func prefetchQuery(o *orm, mi *modelInfo, custom *querySet, expr string, values []interface{}) ([]reflect.Value, error) {
+	qs := newQuerySet(o, mi).(*querySet)
+	if custom != nil {
+		qs.cond = custom.cond
+		qs.orders = custom.orders
+		qs.related = custom.related
+		qs.relDepth = custom.relDepth
+		qs.distinct = custom.distinct
+	}
+	if qs.cond == nil {
+		qs.cond = NewCondition()
+	}
+	qs.cond = qs.cond.And(expr+ExprSep+"in", values...)
+	qs.limit = -1
+
+	container := reflect.New(reflect.SliceOf(reflect.PtrTo(mi.addrField.Elem().Type())))
+	if _, err := qs.All(container.Interface()); err != nil {
+		return nil, err
+	}
+
+	ind := container.Elem()
+	rows := make([]reflect.Value, 0, ind.Len())
+	for i := 0; i < ind.Len(); i++ {
+		rows = append(rows, ind.Index(i))
+	}
+	return rows, nil
+}
+
+// get the unique pk values of objs
+func prefetchPks(mi *modelInfo, objs []reflect.Value) (values []interface{}) {
+	seen := make(map[string]bool, len(objs))
+	for _, obj := range objs {
+		key, value, ok := prefetchPk(mi, obj)
+		if ok && !seen[key] {
+			seen[key] = true
+			values = append(values, value)
+		}
+	}
+	return
+}
+
+// get the pk of the model struct ind as a map key,
+// drivers may scan the same column into different types so the key is a string.
+func prefetchPk(mi *modelInfo, ind reflect.Value) (string, interface{}, bool) {
+	if !ind.IsValid() {
+		return "", nil, false
+	}
+	_, value, exist := getExistPk(mi, ind)
+	if !exist {
+		return "", nil, false
+	}
+	return ToStr(value), value, true
+}
+
+// assign rows to the slice field of obj
+func prefetchSetMany(field reflect.Value, rows []reflect.Value) {
+	slice := reflect.MakeSlice(field.Type(), 0, len(rows))
+	ptr := field.Type().Elem().Kind() == reflect.Ptr
+	for _, row := range rows {
+		if ptr {
+			slice = reflect.Append(slice, row)
+		} else {
+			slice = reflect.Append(slice, row.Elem())
+		}
+	}
+	field.Set(slice)
+}
+
+// structs of the row pointers, used to prefetch nested relations
+func prefetchElems(rows []reflect.Value) []reflect.Value {
+	elems := make([]reflect.Value, len(rows))
+	for i, row := range rows {
+		elems[i] = row.Elem()
+	}
+	return elems
+}
+
+// prefetch a foreign key or one to one field of objs
+func prefetchRel(o *orm, fi *fieldInfo, objs []reflect.Value, custom *querySet) ([]reflect.Value, error) {
+	rmi := fi.relModelInfo
+
+	var rels []reflect.Value
+	for _, obj := range objs {
+		field := obj.FieldByIndex(fi.fieldIndex)
+		if !field.IsNil() {
+			rels = append(rels, field.Elem())
+		}
+	}
+	values := prefetchPks(rmi, rels)
+	if len(values) == 0 {
+		return nil, nil
+	}
+
+	rows, err := prefetchQuery(o, rmi, custom, rmi.fields.pk.name, values)
+	if err != nil {
+		return nil, err
+	}
+
+	byPk := make(map[string]reflect.Value, len(rows))
+	for _, row := range rows {
+		if key, _, ok := prefetchPk(rmi, row.Elem()); ok {
+			byPk[key] = row
+		}
+	}
+	for _, obj := range objs {
+		field := obj.FieldByIndex(fi.fieldIndex)
+		if field.IsNil() {
+			continue
+		}
+		key, _, _ := prefetchPk(rmi, field.Elem())
+		if row, ok := byPk[key]; ok {
+			field.Set(row)
+		}
+	}
+	return prefetchElems(rows), nil
+}
+
+// prefetch a reverse one or reverse foreign key field of objs
+func prefetchReverse(o *orm, mi *modelInfo, fi *fieldInfo, objs []reflect.Value, custom *querySet) ([]reflect.Value, error) {
+	rfi := fi.reverseFieldInfo
+
+	values := prefetchPks(mi, objs)
+	if len(values) == 0 {
+		return nil, nil
+	}
+
+	rows, err := prefetchQuery(o, fi.relModelInfo, custom, rfi.name, values)
+	if err != nil {
+		return nil, err
+	}
+
+	byParent := make(map[string][]reflect.Value)
+	for _, row := range rows {
+		parent := reflect.Indirect(row.Elem().FieldByIndex(rfi.fieldIndex))
+		if key, _, ok := prefetchPk(mi, parent); ok {
+			byParent[key] = append(byParent[key], row)
+		}
+	}
+	for _, obj := range objs {
+		key, _, ok := prefetchPk(mi, obj)
+		if !ok {
+			continue
+		}
+		field := obj.FieldByIndex(fi.fieldIndex)
+		found := byParent[key]
+		if fi.fieldType == RelReverseOne {
+			if len(found) > 0 {
+				field.Set(found[0])
+			} else {
+				field.Set(reflect.Zero(field.Type()))
+			}
+			continue
+		}
+		prefetchSetMany(field, found)
+	}
+	return prefetchElems(rows), nil
+}
+
+// prefetch a many to many field of objs, the links are read from the through table first
+func prefetchM2M(o *orm, mi *modelInfo, fi *fieldInfo, objs []reflect.Value, custom *querySet) ([]reflect.Value, error) {
+	left, right := fi.reverseFieldInfo, fi.reverseFieldInfoTwo
+
+	values := prefetchPks(mi, objs)
+	if len(values) == 0 {
+		return nil, nil
+	}
+
+	var links []ParamsList
+	through := newQuerySet(o, fi.relThroughModelInfo).(*querySet)
+	through.cond = NewCondition().And(left.name+ExprSep+"in", values...)
+	through.limit = -1
+	if _, err := through.ValuesList(&links, left.name, right.name); err != nil {
+		return nil, err
+	}
+
+	var relValues []interface{}
+	parents := make(map[string][]string)
+	for _, link := range links {
+		if link[0] == nil || link[1] == nil {
+			continue
+		}
+		relKey := ToStr(link[1])
+		if _, ok := parents[relKey]; !ok {
+			relValues = append(relValues, link[1])
+		}
+		parents[relKey] = append(parents[relKey], ToStr(link[0]))
+	}
+
+	var rows []reflect.Value
+	if len(relValues) > 0 {
+		var err error
+		rows, err = prefetchQuery(o, fi.relModelInfo, custom, fi.relModelInfo.fields.pk.name, relValues)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// keep the order of the related query for every parent
+	byParent := make(map[string][]reflect.Value)
+	for _, row := range rows {
+		key, _, ok := prefetchPk(fi.relModelInfo, row.Elem())
+		if !ok {
+			continue
+		}
+		for _, parent := range parents[key] {
+			byParent[parent] = append(byParent[parent], row)
+		}
+	}
+	for _, obj := range objs {
+		key, _, ok := prefetchPk(mi, obj)
+		if !ok {
+			continue
+		}
+		prefetchSetMany(obj.FieldByIndex(fi.fieldIndex), byParent[key])
+	}
+	return prefetchElems(rows), nil
+}
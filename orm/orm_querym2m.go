@@ -34,12 +34,12 @@ type queryM2M struct {
 // make sure the relation is defined in post model struct tag.
 func (o *queryM2M) Add(mds ...interface{}) (int64, error) {
 	fi := o.fi
-	mi := fi.relThroughModelInfo
 	mfi := fi.reverseFieldInfo
 	rfi := fi.reverseFieldInfoTwo
 
 	orm := o.qs.orm
 	dbase := orm.alias.DbBaser
+	mi := orm.tenantModel(fi.relThroughModelInfo)
 
 	var models []interface{}
 	var otherValues []interface{}
@@ -96,6 +96,8 @@ func (o *queryM2M) Add(mds ...interface{}) (int64, error) {
 	}
 	names = append(names, otherNames...)
 	values = append(values, otherValues...)
+	orm.wrote()
+	defer orm.invalidate(mi)
 	return dbase.InsertValue(orm.db, mi, true, names, values)
 }
 
@@ -17,6 +17,7 @@ package orm
 import (
 	"context"
 	"fmt"
+	"time"
 )
 
 type colValue struct {
@@ -56,19 +57,25 @@ func ColValue(opt operator, value interface{}) interface{} {
 
 // real query struct
 type querySet struct {
-	mi         *modelInfo
-	cond       *Condition
-	related    []string
-	relDepth   int
-	limit      int64
-	offset     int64
-	groups     []string
-	orders     []string
-	distinct   bool
-	forupdate  bool
-	orm        *orm
-	ctx        context.Context
-	forContext bool
+	mi          *modelInfo
+	cond        *Condition
+	related     []string
+	relDepth    int
+	prefetches  []*PrefetchRelation
+	annotations []*Aggregation
+	having      *Condition
+	cursor      string
+	limit       int64
+	offset      int64
+	groups      []string
+	orders      []string
+	distinct    bool
+	forupdate   bool
+	cache       bool
+	cacheTTL    time.Duration
+	orm         *orm
+	ctx         context.Context
+	forContext  bool
 }
 
 var _ QuerySeter = new(querySet)
@@ -166,6 +173,50 @@ func (o querySet) RelatedSel(params ...interface{}) QuerySeter {
 	return &o
 }
 
+// set relations to load after the query, one query for each relation.
+// params are relation names or *PrefetchRelation.
+func (o querySet) Prefetch(params ...interface{}) QuerySeter {
+	prefetches := make([]*PrefetchRelation, len(o.prefetches), len(o.prefetches)+len(params))
+	copy(prefetches, o.prefetches)
+	for _, p := range params {
+		switch val := p.(type) {
+		case string:
+			prefetches = append(prefetches, &PrefetchRelation{name: val})
+		case *PrefetchRelation:
+			prefetches = append(prefetches, val)
+		default:
+			panic(fmt.Errorf("<QuerySeter.Prefetch> wrong param kind: %v", val))
+		}
+	}
+	o.prefetches = prefetches
+	return &o
+}
+
+// add an aggregation named name to the values of every row.
+// it is usually used with GroupBy.
+func (o querySet) Annotate(name string, agg *Aggregation) QuerySeter {
+	annotations := make([]*Aggregation, len(o.annotations), len(o.annotations)+1)
+	copy(annotations, o.annotations)
+	o.annotations = append(annotations, agg.As(name))
+	return &o
+}
+
+// set the cursor of the page read by Page
+func (o querySet) After(cursor string) QuerySeter {
+	o.cursor = cursor
+	return &o
+}
+
+// add HAVING condition on the annotations.
+// expr is the annotation name and the operator, such as "total__gt".
+func (o querySet) Having(expr string, args ...interface{}) QuerySeter {
+	if o.having == nil {
+		o.having = NewCondition()
+	}
+	o.having = o.having.And(expr, args...)
+	return &o
+}
+
 // set condition to QuerySeter.
 func (o querySet) SetCond(cond *Condition) QuerySeter {
 	o.cond = cond
@@ -177,24 +228,44 @@ func (o querySet) GetCond() *Condition {
 	return o.cond
 }
 
+// get the querier for reads, FOR UPDATE always uses the primary
+func (o *querySet) reader() dbQuerier {
+	if o.forupdate {
+		return o.orm.db
+	}
+	return o.orm.reader()
+}
+
 // return QuerySeter execution result number
 func (o *querySet) Count() (int64, error) {
-	return o.orm.alias.DbBaser.Count(o.orm.db, o, o.mi, o.cond, o.orm.alias.TZ)
+	if o.useCache() {
+		return o.cachedCount()
+	}
+	return o.orm.alias.DbBaser.Count(o.reader(), o, o.mi, o.cond, o.orm.alias.TZ)
 }
 
 // check result empty or not after QuerySeter executed
 func (o *querySet) Exist() bool {
-	cnt, _ := o.orm.alias.DbBaser.Count(o.orm.db, o, o.mi, o.cond, o.orm.alias.TZ)
+	cnt, _ := o.Count()
 	return cnt > 0
 }
 
+// query the aggregations of the rows, the results are keyed by the aggregation names.
+func (o *querySet) Aggregate(aggs ...*Aggregation) (Params, error) {
+	return o.orm.alias.DbBaser.Aggregate(o.reader(), o, o.mi, o.cond, aggs, o.orm.alias.TZ)
+}
+
 // execute update with parameters
 func (o *querySet) Update(values Params) (int64, error) {
+	o.orm.wrote()
+	defer o.orm.invalidate(o.mi)
 	return o.orm.alias.DbBaser.UpdateBatch(o.orm.db, o, o.mi, o.cond, values, o.orm.alias.TZ)
 }
 
 // execute delete
 func (o *querySet) Delete() (int64, error) {
+	o.orm.wrote()
+	defer o.orm.invalidate(deletedModels(o.mi)...)
 	return o.orm.alias.DbBaser.DeleteBatch(o.orm.db, o, o.mi, o.cond, o.orm.alias.TZ)
 }
 
@@ -210,14 +281,18 @@ func (o *querySet) PrepareInsert() (Inserter, error) {
 // query all data and map to containers.
 // cols means the columns when querying.
 func (o *querySet) All(container interface{}, cols ...string) (int64, error) {
-	return o.orm.alias.DbBaser.ReadBatch(o.orm.db, o, o.mi, o.cond, container, o.orm.alias.TZ, cols)
+	num, err := o.readBatch(container, cols)
+	if err != nil || num == 0 || len(o.prefetches) == 0 {
+		return num, err
+	}
+	return num, o.prefetch(container)
 }
 
 // query one row data and map to containers.
 // cols means the columns when querying.
 func (o *querySet) One(container interface{}, cols ...string) error {
 	o.limit = 1
-	num, err := o.orm.alias.DbBaser.ReadBatch(o.orm.db, o, o.mi, o.cond, container, o.orm.alias.TZ, cols)
+	num, err := o.readBatch(container, cols)
 	if err != nil {
 		return err
 	}
@@ -228,26 +303,67 @@ func (o *querySet) One(container interface{}, cols ...string) error {
 	if num > 1 {
 		return ErrMultiRows
 	}
+	if len(o.prefetches) > 0 {
+		return o.prefetch(container)
+	}
 	return nil
 }
 
+// read the models into container, the related models are never cached
+// because their back pointers make the graph cyclic
+func (o *querySet) readBatch(container interface{}, cols []string) (int64, error) {
+	if o.useCache() && o.relDepth == 0 && len(o.related) == 0 {
+		return o.cachedReadBatch(container, cols)
+	}
+	return o.orm.alias.DbBaser.ReadBatch(o.reader(), o, o.mi, o.cond, container, o.orm.alias.TZ, cols)
+}
+
+// query the rows as a cursor scanning one row at a time.
+// cols means the columns when querying.
+func (o *querySet) Rows(cols ...string) (Rows, error) {
+	return o.orm.alias.DbBaser.ReadRows(o.reader(), o, o.mi, o.cond, o.orm.alias.TZ, cols)
+}
+
+// call fn with every row, fn is func(*Model) error or func(orm.Params) error.
+// the iteration stops at the first error returned by fn.
+func (o *querySet) Iterate(fn interface{}, cols ...string) error {
+	rows, err := o.Rows(cols...)
+	if err != nil {
+		return err
+	}
+	return iterateRows(o.mi, rows, fn)
+}
+
+// load the prefetch relations to the models in container
+func (o *querySet) prefetch(container interface{}) error {
+	return prefetch(o.orm, o.mi, prefetchTargets(container), newPrefetchTree(o.prefetches))
+}
+
 // query all data and map to []map[string]interface.
 // expres means condition expression.
 // it converts data to []map[column]value.
 func (o *querySet) Values(results *[]Params, exprs ...string) (int64, error) {
-	return o.orm.alias.DbBaser.ReadValues(o.orm.db, o, o.mi, o.cond, exprs, results, o.orm.alias.TZ)
+	return o.readValues(results, exprs)
 }
 
 // query all data and map to [][]interface
 // it converts data to [][column_index]value
 func (o *querySet) ValuesList(results *[]ParamsList, exprs ...string) (int64, error) {
-	return o.orm.alias.DbBaser.ReadValues(o.orm.db, o, o.mi, o.cond, exprs, results, o.orm.alias.TZ)
+	return o.readValues(results, exprs)
 }
 
 // query all data and map to []interface.
 // it's designed for one row record set, auto change to []value, not [][column]value.
 func (o *querySet) ValuesFlat(result *ParamsList, expr string) (int64, error) {
-	return o.orm.alias.DbBaser.ReadValues(o.orm.db, o, o.mi, o.cond, []string{expr}, result, o.orm.alias.TZ)
+	return o.readValues(result, []string{expr})
+}
+
+// read the values into container
+func (o *querySet) readValues(container interface{}, exprs []string) (int64, error) {
+	if o.useCache() {
+		return o.cachedReadValues(container, exprs)
+	}
+	return o.orm.alias.DbBaser.ReadValues(o.reader(), o, o.mi, o.cond, exprs, container, o.orm.alias.TZ)
 }
 
 // query all rows into map[string]interface with specify key and value column name.
@@ -288,7 +404,7 @@ func (o querySet) WithContext(ctx context.Context) QuerySeter {
 // create new QuerySeter.
 func newQuerySet(orm *orm, mi *modelInfo) QuerySeter {
 	o := new(querySet)
-	o.mi = mi
+	o.mi = orm.tenantModel(mi)
 	o.orm = orm
 	return o
 }
@@ -32,6 +32,7 @@ func (o *rawPrepare) Exec(args ...interface{}) (sql.Result, error) {
 	if o.closed {
 		return nil, ErrStmtClosed
 	}
+	o.rs.orm.wrote()
 	return o.stmt.Exec(args...)
 }
 
@@ -51,8 +52,8 @@ func newRawPreparer(rs *rawSet) (RawPreparer, error) {
 	if err != nil {
 		return nil, err
 	}
-	if Debug {
-		o.stmt = newStmtQueryLog(rs.orm.alias, st, query)
+	if logQueries() {
+		o.stmt = newStmtQueryLog(rs.orm.ctx, rs.orm.alias, st, query)
 	} else {
 		o.stmt = st
 	}
@@ -80,6 +81,7 @@ func (o *rawSet) Exec() (sql.Result, error) {
 	o.orm.alias.DbBaser.ReplaceMarks(&query)
 
 	args := getFlatParams(nil, o.args, o.orm.alias.TZ)
+	o.orm.wrote()
 	return o.orm.db.Exec(query, args...)
 }
 
@@ -367,6 +369,14 @@ func (o *rawSet) QueryRow(containers ...interface{}) error {
 							mf := reflect.New(fi.relModelInfo.addrField.Elem().Type())
 							field.Set(mf)
 							field = mf.Elem().FieldByIndex(fi.relModelInfo.fields.pk.fieldIndex)
+						} else if fi.jsonValue {
+							if value != nil {
+								value = ToStr(value)
+							}
+							if err := jsonUnmarshalField(field, value); err != nil {
+								return err
+							}
+							continue
 						}
 						o.setFieldValue(field, value)
 					}
@@ -508,6 +518,14 @@ func (o *rawSet) QueryRows(containers ...interface{}) (int64, error) {
 							mf := reflect.New(fi.relModelInfo.addrField.Elem().Type())
 							field.Set(mf)
 							field = mf.Elem().FieldByIndex(fi.relModelInfo.fields.pk.fieldIndex)
+						} else if fi.jsonValue {
+							if value != nil {
+								value = ToStr(value)
+							}
+							if err := jsonUnmarshalField(field, value); err != nil {
+								return 0, err
+							}
+							continue
 						}
 						o.setFieldValue(field, value)
 					}
@@ -0,0 +1,202 @@
+// Copyright 2019 asana Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package orm
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// Rows is a cursor of the rows of a QuerySeter, rows are scanned one at a time.
+// Close must be called when the rows are not read to the end.
+// for example:
+//	rows, err := o.QueryTable("user").Rows()
+//	defer rows.Close()
+//	for rows.Next() {
+//		var user User
+//		err = rows.Scan(&user)
+//	}
+//	err = rows.Err()
+type Rows interface {
+	// prepare the next row, return false when there is no more row or an error happened
+	Next() bool
+	// scan the current row to a *Model or a *Params keyed by the field names
+	Scan(container interface{}) error
+	// return the error happened in the iteration
+	Err() error
+	// close the rows, it is safe to call Close more than once
+	Close() error
+}
+
+// cursor of the rows read by dbBase.ReadRows
+type rowsCursor struct {
+	d      *dbBase
+	rs     *sql.Rows
+	mi     *modelInfo
+	tables *dbTables
+	tCols  []string
+	refs   []interface{}
+	tz     *time.Location
+	err    error
+}
+
+var _ Rows = new(rowsCursor)
+
+func (r *rowsCursor) Next() bool {
+	if r.err != nil {
+		return false
+	}
+	if !r.rs.Next() {
+		return false
+	}
+	if err := r.rs.Scan(r.refs...); err != nil {
+		r.err = err
+		return false
+	}
+	return true
+}
+
+func (r *rowsCursor) Scan(container interface{}) (err error) {
+	if r.err != nil {
+		return r.err
+	}
+
+	// the convert errors of the values panic as in ReadBatch
+	defer func() {
+		if p := recover(); p != nil {
+			if e, ok := p.(error); ok {
+				err = e
+				return
+			}
+			panic(p)
+		}
+	}()
+
+	if m, ok := container.(*Params); ok {
+		params := make(Params, len(r.tCols))
+		for i, column := range r.tCols {
+			fi := r.mi.fields.GetByColumn(column)
+			val := reflect.Indirect(reflect.ValueOf(r.refs[i])).Interface()
+			value, err := r.d.convertValueFromDB(fi, val, r.tz)
+			if err != nil {
+				return fmt.Errorf("db value convert failed `%v` %s", val, err.Error())
+			}
+			params[fi.name] = value
+		}
+		*m = params
+		return nil
+	}
+
+	val := reflect.ValueOf(container)
+	ind := reflect.Indirect(val)
+	if val.Kind() != reflect.Ptr || getFullName(ind.Type()) != r.mi.fullName {
+		panic(fmt.Errorf("wrong object type `%s` for rows scan, need *%s or *orm.Params", val.Type(), r.mi.fullName))
+	}
+
+	ind.Set(r.d.readBatchRow(r.mi, r.tables, r.tCols, r.refs, r.tz))
+	return nil
+}
+
+func (r *rowsCursor) Err() error {
+	if r.err != nil {
+		return r.err
+	}
+	return r.rs.Err()
+}
+
+func (r *rowsCursor) Close() error {
+	return r.rs.Close()
+}
+
+// query the rows matched by cond as a cursor.
+// the rows are not limited by DefaultRowsLimit, only by the limit of the QuerySeter.
+func (d *dbBase) ReadRows(q dbQuerier, qs *querySet, mi *modelInfo, cond *Condition, tz *time.Location, cols []string) (Rows, error) {
+	rlimit := qs.limit
+	if rlimit == 0 {
+		rlimit = -1
+	}
+
+	query, args, tables, tCols, colsNum, err := d.readBatchSQL(qs, mi, cond, tz, cols, rlimit)
+	if err != nil {
+		return nil, err
+	}
+
+	rs, err := d.queryRows(q, qs, query, args)
+	if err != nil {
+		return nil, err
+	}
+
+	refs := make([]interface{}, colsNum)
+	for i := range refs {
+		var ref interface{}
+		refs[i] = &ref
+	}
+
+	return &rowsCursor{
+		d:      d,
+		rs:     rs,
+		mi:     mi,
+		tables: tables,
+		tCols:  tCols,
+		refs:   refs,
+		tz:     tz,
+	}, nil
+}
+
+// iterate the rows, fn is func(*Model) error or func(Params) error.
+// a new model struct or Params is passed for every row.
+func iterateRows(mi *modelInfo, rows Rows, fn interface{}) error {
+	defer rows.Close()
+
+	var call func() error
+	switch f := fn.(type) {
+	case func(Params) error:
+		call = func() error {
+			var params Params
+			if err := rows.Scan(&params); err != nil {
+				return err
+			}
+			return f(params)
+		}
+	default:
+		fv := reflect.ValueOf(fn)
+		typ := fv.Type()
+		if fv.Kind() != reflect.Func || typ.NumIn() != 1 || typ.NumOut() != 1 ||
+			typ.In(0).Kind() != reflect.Ptr || getFullName(typ.In(0).Elem()) != mi.fullName ||
+			typ.Out(0) != reflect.TypeOf((*error)(nil)).Elem() {
+			panic(fmt.Errorf("<QuerySeter.Iterate> wrong func type `%s`, need func(*%s) error or func(orm.Params) error", typ, mi.fullName))
+		}
+		elm := typ.In(0).Elem()
+		call = func() error {
+			ptr := reflect.New(elm)
+			if err := rows.Scan(ptr.Interface()); err != nil {
+				return err
+			}
+			if err, _ := fv.Call([]reflect.Value{ptr})[0].Interface().(error); err != nil {
+				return err
+			}
+			return nil
+		}
+	}
+
+	for rows.Next() {
+		if err := call(); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
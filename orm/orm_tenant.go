@@ -0,0 +1,153 @@
+// Copyright 2019 asana Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package orm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+)
+
+// TenancyMode routes the tables of an alias to the tenant of the ormer
+type TenancyMode int
+
+// Define the tenancy modes
+const (
+	// the tables are shared by the tenants
+	NoTenancy TenancyMode = iota
+	// the tables are in the schema named by the tenant, "tenant"."table"
+	TenantSchema
+	// the tables are prefixed by the tenant, "tenant_table"
+	TenantTablePrefix
+)
+
+// ErrNoTenant is the panic of a query on a tenant scoped model without a tenant
+var ErrNoTenant = errors.New("<Ormer> no tenant in the context of the ormer for a tenant scoped model")
+
+type tenantKey struct{}
+
+// WithTenant return a copy of ctx carrying tenant.
+// the ormers created by NewOrmWithContext with the copy are routed to tenant, see SetTenancy.
+// the models with a `orm:"tenant"` field are tenant scoped, they are inserted with tenant in the field
+// and their queries are filtered by it. the raw queries are not routed.
+//
+//	o := orm.NewOrmWithContext(orm.WithTenant(ctx, "acme"))
+//	num, err := o.QueryTable("invoice").Count() // WHERE T0.`tenant` = 'acme'
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// TenantFromContext get the tenant carried by ctx
+func TenantFromContext(ctx context.Context) (string, bool) {
+	if ctx == nil {
+		return "", false
+	}
+	tenant, ok := ctx.Value(tenantKey{}).(string)
+	return tenant, ok && tenant != ""
+}
+
+// SetTenancy Change the tenancy mode of the tables, use specify database alias name.
+// the queries of the ormers with a tenant in their context are routed to the schema or the tables of the tenant,
+// the ormers without tenant use the tables as registered.
+func SetTenancy(aliasName string, mode TenancyMode) error {
+	al, ok := dataBaseCache.get(aliasName)
+	if !ok {
+		return fmt.Errorf("DataBase alias name `%s` not registered", aliasName)
+	}
+	al.Tenancy = mode
+	return nil
+}
+
+// check the tenant can be used in a schema or a table name
+func validTenantName(tenant string) bool {
+	for _, c := range tenant {
+		if c != '_' && (c < '0' || c > '9') && (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+// get the view of mi routed to tenant.
+// the view shares the fields of mi, its table is the table of the tenant
+// and the queries of a model with a tenant field are filtered by tenant.
+func tenantView(mi *modelInfo, mode TenancyMode, tenant string) *modelInfo {
+	if tenant == "" || mode == NoTenancy && mi.fields.tenant == nil {
+		return mi
+	}
+	if mode != NoTenancy && !validTenantName(tenant) {
+		panic(fmt.Errorf("<Ormer> tenant `%s` is not a valid schema or table name", tenant))
+	}
+
+	v := *mi
+	v.tenant = tenant
+	v.tenancy = mode
+	switch mode {
+	case TenantSchema:
+		v.schema = tenant
+	case TenantTablePrefix:
+		v.table = tenant + "_" + mi.table
+	}
+	return &v
+}
+
+// get the view of the related model rmi routed to the tenant of mi
+func (mi *modelInfo) routed(rmi *modelInfo) *modelInfo {
+	return tenantView(rmi, mi.tenancy, mi.tenant)
+}
+
+// get the value of the tenant field of mi, it panics when mi is not routed to a tenant
+func tenantValue(mi *modelInfo) interface{} {
+	if mi.tenant == "" {
+		panic(ErrNoTenant)
+	}
+	fi := mi.fields.tenant
+	switch {
+	case fi.fieldType&IsPositiveIntegerField > 0:
+		v, err := strconv.ParseUint(mi.tenant, 10, 64)
+		if err != nil {
+			panic(fmt.Errorf("<Ormer> tenant `%s` of model `%s` is not an integer", mi.tenant, mi.fullName))
+		}
+		return v
+	case fi.fieldType&IsIntegerField > 0:
+		v, err := strconv.ParseInt(mi.tenant, 10, 64)
+		if err != nil {
+			panic(fmt.Errorf("<Ormer> tenant `%s` of model `%s` is not an integer", mi.tenant, mi.fullName))
+		}
+		return v
+	}
+	return mi.tenant
+}
+
+// set the tenant field of the model ind
+func setTenant(fi *fieldInfo, ind reflect.Value, value interface{}) {
+	field := ind.FieldByIndex(fi.fieldIndex)
+	switch v := value.(type) {
+	case uint64:
+		field.SetUint(v)
+	case int64:
+		field.SetInt(v)
+	case string:
+		field.SetString(v)
+	}
+}
+
+// get the view of mi routed to the tenant in the context of the ormer
+func (o *orm) tenantModel(mi *modelInfo) *modelInfo {
+	tenant, _ := TenantFromContext(o.ctx)
+	return tenantView(mi, o.alias.Tenancy, tenant)
+}
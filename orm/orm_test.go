@@ -20,7 +20,11 @@ import (
 	"bytes"
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
 	"io/ioutil"
 	"math"
 	"os"
@@ -30,6 +34,8 @@ import (
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/goasana/asana/cache"
 )
 
 var _ = os.PathSeparator
@@ -197,6 +203,9 @@ func TestSyncDb(t *testing.T) {
 	RegisterModel(new(IntegerPk))
 	RegisterModel(new(UintPk))
 	RegisterModel(new(PtrPk))
+	RegisterModel(new(Article))
+	RegisterModel(new(Preference))
+	RegisterModel(new(Invoice))
 
 	err := RunSyncdb("default", true, Debug)
 	throwFail(t, err)
@@ -221,6 +230,9 @@ func TestRegisterModels(t *testing.T) {
 	RegisterModel(new(IntegerPk))
 	RegisterModel(new(UintPk))
 	RegisterModel(new(PtrPk))
+	RegisterModel(new(Article))
+	RegisterModel(new(Preference))
+	RegisterModel(new(Invoice))
 
 	BootStrap()
 
@@ -918,6 +930,102 @@ func TestOperators(t *testing.T) {
 	throwFail(t, AssertIs(num, 1))
 }
 
+func TestOperatorsRegex(t *testing.T) {
+	if IsSqlite {
+		var n int
+		if err := dORM.Raw("SELECT 'a' REGEXP 'a'").QueryRow(&n); err != nil {
+			t.Skip("sqlite3 connections have no regexp function")
+		}
+	}
+
+	qs := dORM.QueryTable("user")
+	num, err := qs.Filter("user_name__regex", "^s.+e$").Count()
+	throwFail(t, err)
+	throwFail(t, AssertIs(num, 1))
+
+	num, err = qs.Filter("user_name__regex", "n").Count()
+	throwFail(t, err)
+	throwFail(t, AssertIs(num, 3))
+
+	num, err = qs.Filter("user_name__regex", "^S").Count()
+	throwFail(t, err)
+	throwFail(t, AssertIs(num, 0))
+
+	num, err = qs.Filter("user_name__iregex", "^S").Count()
+	throwFail(t, err)
+	throwFail(t, AssertIs(num, 1))
+}
+
+func TestOperatorsDateParts(t *testing.T) {
+	var d Data
+	throwFailNow(t, dORM.QueryTable("data").OrderBy("id").Limit(1).One(&d))
+	// the date parts are of the times in the time zone of the database
+	al, _ := dataBaseCache.get("default")
+	dt := d.DateTime.In(al.TZ)
+	date := d.Date.In(al.TZ)
+
+	qs := dORM.QueryTable("data").Filter("id", d.ID)
+	num, err := qs.Filter("datetime__year", dt.Year()).Count()
+	throwFail(t, err)
+	throwFail(t, AssertIs(num, 1))
+
+	num, err = qs.Filter("datetime__year", dt.Year()+1).Count()
+	throwFail(t, err)
+	throwFail(t, AssertIs(num, 0))
+
+	num, err = qs.Filter("datetime__month", int(dt.Month())).Count()
+	throwFail(t, err)
+	throwFail(t, AssertIs(num, 1))
+
+	num, err = qs.Filter("datetime__day", dt.Day()).Count()
+	throwFail(t, err)
+	throwFail(t, AssertIs(num, 1))
+
+	num, err = qs.Filter("datetime__week_day", int(dt.Weekday())+1).Count()
+	throwFail(t, err)
+	throwFail(t, AssertIs(num, 1))
+
+	num, err = qs.Filter("date__year", date.Year()).Filter("date__month", int(date.Month())).Filter("date__day", date.Day()).Count()
+	throwFail(t, err)
+	throwFail(t, AssertIs(num, 1))
+
+	num, err = qs.Filter("date__week_day", int(date.Weekday())%7+2).Count()
+	throwFail(t, err)
+	throwFail(t, AssertIs(num, 0))
+}
+
+func TestOperatorsSearch(t *testing.T) {
+	switch {
+	case IsTidb:
+		t.Skip("tidb has no full-text search")
+	case IsMysql:
+		_, err := dORM.Raw("ALTER TABLE post ADD FULLTEXT INDEX post_content_fts (content)").Exec()
+		throwFailNow(t, err)
+	case IsSqlite:
+		_, err := dORM.Raw("CREATE VIRTUAL TABLE IF NOT EXISTS post_fts USING fts5(content, content='post', content_rowid='id')").Exec()
+		if err != nil {
+			t.Skip("sqlite3 is built without fts5")
+		}
+		_, err = dORM.Raw("INSERT INTO post_fts(post_fts) VALUES('rebuild')").Exec()
+		throwFailNow(t, err)
+	}
+
+	var posts []*Post
+	qs := dORM.QueryTable("post")
+	num, err := qs.Filter("content__search", "gofmt").All(&posts)
+	throwFail(t, err)
+	throwFail(t, AssertIs(num, 1))
+	throwFail(t, AssertIs(posts[0].Title, "Formatting"))
+
+	num, err = qs.Filter("content__search", "godoc").Filter("user__user_name", "nobody").Count()
+	throwFail(t, err)
+	throwFail(t, AssertIs(num, 1))
+
+	num, err = qs.Filter("content__search", "utopia").Filter("title", "Examples").Count()
+	throwFail(t, err)
+	throwFail(t, AssertIs(num, 0))
+}
+
 func TestSetCond(t *testing.T) {
 	cond := NewCondition()
 	cond1 := cond.And("profile__isnull", false).AndNot("status__in", 1).Or("profile__age__gt", 2000)
@@ -1397,6 +1505,493 @@ func TestLoadRelated(t *testing.T) {
 	throwFailNow(t, AssertIs(tag.Posts[0].User.UserName, "slene"))
 }
 
+func TestPrefetch(t *testing.T) {
+	var users []*User
+	num, err := dORM.QueryTable("user").OrderBy("Id").Prefetch("Posts", "Posts__Tags", "Profile").All(&users)
+	throwFailNow(t, err)
+	throwFailNow(t, AssertIs(num, 3))
+	for _, user := range users {
+		loaded := User{ID: user.ID}
+		n, err := dORM.LoadRelated(&loaded, "Posts")
+		throwFailNow(t, err)
+		throwFailNow(t, AssertIs(len(user.Posts), n))
+		for _, post := range user.Posts {
+			throwFailNow(t, AssertIs(post.User.ID, user.ID))
+			n, err := dORM.LoadRelated(&Post{ID: post.ID}, "Tags")
+			throwFailNow(t, err)
+			throwFailNow(t, AssertIs(len(post.Tags), n))
+		}
+		if user.Profile != nil {
+			throwFailNow(t, AssertIs(user.Profile.Age > 0, true))
+		}
+	}
+	throwFailNow(t, AssertIs(users[1].UserName, "asana"))
+	throwFailNow(t, AssertIs(len(users[1].Posts), 2))
+
+	// filter and order the prefetched rows
+	qs := dORM.QueryTable("post").OrderBy("-Id")
+	num, err = dORM.QueryTable("user").Filter("UserName", "asana").Prefetch(NewPrefetch("Posts", qs)).All(&users)
+	throwFailNow(t, err)
+	throwFailNow(t, AssertIs(num, 1))
+	throwFailNow(t, AssertIs(len(users[0].Posts), 2))
+	throwFailNow(t, AssertIs(users[0].Posts[0].Title, "Formatting"))
+
+	var user User
+	qs = dORM.QueryTable("post").Filter("Title", "Examples")
+	err = dORM.QueryTable("user").Filter("UserName", "asana").Prefetch(NewPrefetch("Posts", qs)).One(&user)
+	throwFailNow(t, err)
+	throwFailNow(t, AssertIs(len(user.Posts), 1))
+	throwFailNow(t, AssertIs(user.Posts[0].Title, "Examples"))
+
+	// foreign key
+	var posts []Post
+	num, err = dORM.QueryTable("post").Prefetch("User").All(&posts)
+	throwFailNow(t, err)
+	throwFailNow(t, AssertIs(num, 4))
+	for _, post := range posts {
+		throwFailNow(t, AssertIs(post.User.UserName != "", true))
+	}
+
+	// reverse many to many
+	var tag Tag
+	err = dORM.QueryTable("tag").Filter("Id", 1).Prefetch(NewPrefetch("Posts", dORM.QueryTable("post").OrderBy("Id"))).One(&tag)
+	throwFailNow(t, err)
+	throwFailNow(t, AssertIs(len(tag.Posts), 3))
+	throwFailNow(t, AssertIs(tag.Posts[0].Title, "Introduction"))
+
+	_, err = dORM.QueryTable("user").Prefetch("UserName").All(&users)
+	throwFailNow(t, AssertIs(err != nil, true))
+}
+
+func TestAggregate(t *testing.T) {
+	qs := dORM.QueryTable("post")
+	res, err := qs.Aggregate(Count("Id"), CountDistinct("User"), Sum("Id"), Avg("Id"), Max("Title").As("last"))
+	throwFailNow(t, err)
+	throwFailNow(t, AssertIs(res["Id__count"], int64(4)))
+	throwFailNow(t, AssertIs(res["User__count"], int64(3)))
+	throwFailNow(t, AssertIs(res["Id__sum"], int64(10)))
+	throwFailNow(t, AssertIs(res["Id__avg"], 2.5))
+	throwFailNow(t, AssertIs(res["last"], "Introduction"))
+
+	// across relations
+	res, err = qs.Filter("User__UserName", "asana").Aggregate(CountDistinct("Id"), Min("Tags__Tag__Name"))
+	throwFailNow(t, err)
+	throwFailNow(t, AssertIs(res["Id__count"], int64(2)))
+	throwFailNow(t, AssertIs(res["Tags__Tag__Name__min"], "example"))
+
+	res, err = qs.Filter("Title", "unknown").Aggregate(Count("Id"), Sum("Id"))
+	throwFailNow(t, err)
+	throwFailNow(t, AssertIs(res["Id__count"], int64(0)))
+	throwFailNow(t, AssertIs(res["Id__sum"] == nil, true))
+
+	// annotate
+	var maps []Params
+	num, err := dORM.QueryTable("user").Annotate("posts", Count("Posts")).GroupBy("Id").
+		OrderBy("-posts", "Id").Values(&maps, "UserName", "posts")
+	throwFailNow(t, err)
+	throwFailNow(t, AssertIs(num, 3))
+	throwFailNow(t, AssertIs(maps[0]["UserName"], "asana"))
+	throwFailNow(t, AssertIs(maps[0]["posts"], int64(2)))
+	throwFailNow(t, AssertIs(maps[2]["posts"], int64(1)))
+
+	num, err = dORM.QueryTable("user").Annotate("posts", Count("Posts")).GroupBy("Id").
+		Having("posts__gt", 1).Values(&maps)
+	throwFailNow(t, err)
+	throwFailNow(t, AssertIs(num, 1))
+	throwFailNow(t, AssertIs(maps[0]["UserName"], "asana"))
+	throwFailNow(t, AssertIs(maps[0]["posts"], int64(2)))
+
+	var list ParamsList
+	num, err = dORM.QueryTable("user").Filter("UserName", "asana").
+		Annotate("total", Sum("Posts__Id")).GroupBy("Id").ValuesFlat(&list, "total")
+	throwFailNow(t, err)
+	throwFailNow(t, AssertIs(num, 1))
+	throwFailNow(t, AssertIs(list[0], int64(5)))
+}
+
+func TestIterate(t *testing.T) {
+	qs := dORM.QueryTable("post").OrderBy("Id")
+
+	var titles []string
+	err := qs.RelatedSel("User").Iterate(func(post *Post) error {
+		throwFailNow(t, AssertIs(post.User != nil && post.User.UserName != "", true))
+		titles = append(titles, post.Title)
+		return nil
+	})
+	throwFailNow(t, err)
+	throwFailNow(t, AssertIs(len(titles), 4))
+	throwFailNow(t, AssertIs(titles[0], "Introduction"))
+	throwFailNow(t, AssertIs(titles[3], "Commentary"))
+
+	var maps []Params
+	err = qs.Filter("User__UserName", "asana").Iterate(func(m Params) error {
+		maps = append(maps, m)
+		return nil
+	}, "Id", "Title")
+	throwFailNow(t, err)
+	throwFailNow(t, AssertIs(len(maps), 2))
+	throwFailNow(t, AssertIs(maps[0]["Title"], "Examples"))
+	throwFailNow(t, AssertIs(maps[1]["Title"], "Formatting"))
+
+	// stop at the first error
+	stop := errors.New("stop")
+	num := 0
+	err = qs.Iterate(func(post *Post) error {
+		num++
+		return stop
+	})
+	throwFailNow(t, AssertIs(err, stop))
+	throwFailNow(t, AssertIs(num, 1))
+
+	rows, err := qs.Limit(2).Rows()
+	throwFailNow(t, err)
+	num = 0
+	for rows.Next() {
+		var post Post
+		throwFailNow(t, rows.Scan(&post))
+		throwFailNow(t, AssertIs(post.ID > 0, true))
+		num++
+	}
+	throwFailNow(t, rows.Err())
+	throwFailNow(t, rows.Close())
+	throwFailNow(t, AssertIs(num, 2))
+
+	// in a transaction
+	err = dORM.DoTx(func(tx Ormer) error {
+		num = 0
+		return tx.QueryTable("post").Iterate(func(post *Post) error {
+			num++
+			return nil
+		})
+	})
+	throwFailNow(t, err)
+	throwFailNow(t, AssertIs(num, 4))
+}
+
+func TestPage(t *testing.T) {
+	qs := dORM.QueryTable("post").OrderBy("-Id").Limit(3)
+
+	var posts []*Post
+	cursors, err := qs.Page(&posts)
+	throwFailNow(t, err)
+	throwFailNow(t, AssertIs(len(posts), 3))
+	throwFailNow(t, AssertIs(posts[0].ID, 4))
+	throwFailNow(t, AssertIs(posts[2].ID, 2))
+	throwFailNow(t, AssertIs(cursors.HasNext(), true))
+	throwFailNow(t, AssertIs(cursors.HasPrev(), false))
+
+	cursors, err = qs.After(cursors.Next).Page(&posts)
+	throwFailNow(t, err)
+	throwFailNow(t, AssertIs(len(posts), 1))
+	throwFailNow(t, AssertIs(posts[0].ID, 1))
+	throwFailNow(t, AssertIs(cursors.HasNext(), false))
+	throwFailNow(t, AssertIs(cursors.HasPrev(), true))
+
+	cursors, err = qs.After(cursors.Prev).Page(&posts)
+	throwFailNow(t, err)
+	throwFailNow(t, AssertIs(len(posts), 3))
+	throwFailNow(t, AssertIs(posts[0].ID, 4))
+	throwFailNow(t, AssertIs(posts[2].ID, 2))
+	throwFailNow(t, AssertIs(cursors.HasNext(), true))
+	throwFailNow(t, AssertIs(cursors.HasPrev(), false))
+
+	// struct slices and string sort keys
+	var users []User
+	cursors, err = dORM.QueryTable("user").OrderBy("UserName").Limit(1).Page(&users)
+	throwFailNow(t, err)
+	throwFailNow(t, AssertIs(len(users), 1))
+	first := users[0].UserName
+	next := cursors.Next
+	_, err = dORM.QueryTable("user").OrderBy("UserName").Limit(1).After(next).Page(&users)
+	throwFailNow(t, err)
+	throwFailNow(t, AssertIs(len(users), 1))
+	throwFailNow(t, AssertIs(users[0].UserName > first, true))
+
+	// forged and mismatched cursors
+	_, err = qs.After(next).Page(&posts)
+	throwFailNow(t, AssertIs(err, ErrInvalidCursor))
+	_, err = qs.After(next[1:]).Page(&posts)
+	throwFailNow(t, AssertIs(err, ErrInvalidCursor))
+
+	_, err = dORM.QueryTable("post").OrderBy("-Id").Page(&posts)
+	throwFailNow(t, AssertIs(err != nil, true))
+}
+
+func TestVersion(t *testing.T) {
+	article := &Article{Title: "draft"}
+	id, err := dORM.Insert(article)
+	throwFailNow(t, err)
+	throwFailNow(t, AssertIs(id > 0, true))
+
+	// two editors read the same version
+	a := &Article{ID: article.ID}
+	b := &Article{ID: article.ID}
+	throwFailNow(t, dORM.Read(a))
+	throwFailNow(t, dORM.Read(b))
+
+	a.Title = "edited by a"
+	num, err := dORM.Update(a)
+	throwFailNow(t, err)
+	throwFailNow(t, AssertIs(num, 1))
+	throwFailNow(t, AssertIs(a.Version, 1))
+
+	b.Title = "edited by b"
+	num, err = dORM.Update(b, "Title")
+	throwFailNow(t, AssertIs(err, ErrStaleObject))
+	throwFailNow(t, AssertIs(num, 0))
+	throwFailNow(t, AssertIs(b.Version, 0))
+
+	throwFailNow(t, dORM.Read(b))
+	throwFailNow(t, AssertIs(b.Title, "edited by a"))
+	throwFailNow(t, AssertIs(b.Version, 1))
+
+	// the version can not be set by Update
+	b.Version = 5
+	_, err = dORM.Update(b)
+	throwFailNow(t, AssertIs(err, ErrStaleObject))
+
+	// QuerySeter.Update increases the version
+	qs := dORM.QueryTable("article").Filter("ID", article.ID)
+	num, err = qs.Update(Params{"Title": "bulk"})
+	throwFailNow(t, err)
+	throwFailNow(t, AssertIs(num, 1))
+	throwFailNow(t, dORM.Read(a))
+	throwFailNow(t, AssertIs(a.Version, 2))
+
+	num, err = qs.Filter("Version", 1).Update(Params{"Title": "stale"})
+	throwFailNow(t, AssertIs(err, ErrStaleObject))
+	throwFailNow(t, AssertIs(num, 0))
+
+	num, err = qs.Filter("Version", 2).Update(Params{"Title": "fresh"})
+	throwFailNow(t, err)
+	throwFailNow(t, AssertIs(num, 1))
+
+	// no stale error without a version filter
+	num, err = dORM.QueryTable("article").Filter("Title", "unknown").Update(Params{"Title": "none"})
+	throwFailNow(t, err)
+	throwFailNow(t, AssertIs(num, 0))
+
+	// InsertOrUpdate only updates the conflicting row when it has the version of the model
+	if IsMysql || IsPostgres {
+		throwFailNow(t, dORM.Read(a))
+		version := a.Version
+
+		stale := &Article{ID: article.ID, Title: "upsert stale", Version: version - 1}
+		num, err = dORM.InsertOrUpdate(stale, "id")
+		throwFailNow(t, AssertIs(err, ErrStaleObject))
+		throwFailNow(t, AssertIs(num, 0))
+		throwFailNow(t, AssertIs(stale.Version, version-1))
+
+		throwFailNow(t, dORM.Read(b))
+		throwFailNow(t, AssertIs(b.Title, "fresh"))
+		throwFailNow(t, AssertIs(b.Version, version))
+
+		a.Title = "upsert fresh"
+		_, err = dORM.InsertOrUpdate(a, "id")
+		throwFailNow(t, err)
+		throwFailNow(t, AssertIs(a.Version, version+1))
+
+		throwFailNow(t, dORM.Read(b))
+		throwFailNow(t, AssertIs(b.Title, "upsert fresh"))
+		throwFailNow(t, AssertIs(b.Version, version+1))
+	}
+}
+
+func TestJSONField(t *testing.T) {
+	dark := &Preference{
+		Name:     "dark",
+		Settings: PreferenceSettings{Theme: "dark", FontSize: 14, Beta: true},
+		Extra:    map[string]interface{}{"lang": "en"},
+		Tags:     []string{"a", "b"},
+	}
+	light := &Preference{
+		Name:     "light",
+		Settings: PreferenceSettings{Theme: "light", FontSize: 12},
+	}
+	_, err := dORM.Insert(dark)
+	throwFailNow(t, err)
+	_, err = dORM.Insert(light)
+	throwFailNow(t, err)
+
+	p := &Preference{ID: dark.ID}
+	throwFailNow(t, dORM.Read(p))
+	throwFailNow(t, AssertIs(p.Settings.Theme, "dark"))
+	throwFailNow(t, AssertIs(p.Settings.FontSize, 14))
+	throwFailNow(t, AssertIs(p.Settings.Beta, true))
+	throwFailNow(t, AssertIs(p.Extra["lang"], "en"))
+	throwFailNow(t, AssertIs(len(p.Tags), 2))
+	throwFailNow(t, AssertIs(p.Tags[1], "b"))
+
+	p = &Preference{ID: light.ID}
+	throwFailNow(t, dORM.Read(p))
+	throwFailNow(t, AssertIs(p.Settings.Theme, "light"))
+	throwFailNow(t, AssertIs(p.Extra == nil, true))
+	throwFailNow(t, AssertIs(p.Tags == nil, true))
+
+	var prefs []*Preference
+	num, err := dORM.Raw("SELECT * FROM preference ORDER BY id").QueryRows(&prefs)
+	throwFailNow(t, err)
+	throwFailNow(t, AssertIs(num, 2))
+	throwFailNow(t, AssertIs(prefs[0].Settings.Theme, "dark"))
+	throwFailNow(t, AssertIs(prefs[0].Tags[0], "a"))
+
+	// contains is still the LIKE of the json text
+	num, err = dORM.QueryTable("preference").Filter("Settings__contains", "light").Count()
+	throwFailNow(t, err)
+	throwFailNow(t, AssertIs(num, 1))
+
+	if IsSqlite {
+		var s string
+		if err := dORM.Raw("SELECT json_extract('{}', '$')").QueryRow(&s); err != nil {
+			t.Skip("sqlite3 is built without the json1 functions")
+		}
+	}
+
+	qs := dORM.QueryTable("preference")
+	num, err = qs.Filter("Settings__theme", "dark").Count()
+	throwFailNow(t, err)
+	throwFailNow(t, AssertIs(num, 1))
+
+	num, err = qs.Filter("Settings__font_size__gt", 12).Count()
+	throwFailNow(t, err)
+	throwFailNow(t, AssertIs(num, 1))
+
+	num, err = qs.Filter("Settings__beta", true).Count()
+	throwFailNow(t, err)
+	throwFailNow(t, AssertIs(num, 1))
+
+	num, err = qs.Filter("Settings__theme__in", "dark", "light").Count()
+	throwFailNow(t, err)
+	throwFailNow(t, AssertIs(num, 2))
+
+	num, err = qs.Filter("Tags__0", "a").Count()
+	throwFailNow(t, err)
+	throwFailNow(t, AssertIs(num, 1))
+
+	num, err = qs.Filter("Extra__has_key", "lang").Count()
+	throwFailNow(t, err)
+	throwFailNow(t, AssertIs(num, 1))
+
+	num, err = qs.Filter("Settings__has_key", "font_size").Count()
+	throwFailNow(t, err)
+	throwFailNow(t, AssertIs(num, 2))
+
+	if IsSqlite {
+		return
+	}
+
+	num, err = qs.Filter("Tags__json_contains", []string{"b"}).Count()
+	throwFailNow(t, err)
+	throwFailNow(t, AssertIs(num, 1))
+
+	num, err = qs.Filter("Settings__json_contains", `{"theme":"light"}`).Count()
+	throwFailNow(t, err)
+	throwFailNow(t, AssertIs(num, 1))
+
+	num, err = qs.Filter("Tags__contained_by", []string{"a", "b", "c"}).Count()
+	throwFailNow(t, err)
+	throwFailNow(t, AssertIs(num, 1))
+}
+
+func TestGenerateModels(t *testing.T) {
+	auto := "integer NOT NULL PRIMARY KEY AUTOINCREMENT"
+	switch {
+	case IsMysql || IsTidb:
+		auto = "integer AUTO_INCREMENT NOT NULL PRIMARY KEY"
+	case IsPostgres:
+		auto = "serial NOT NULL PRIMARY KEY"
+	}
+	queries := []string{
+		"DROP TABLE IF EXISTS inspect_log",
+		"DROP TABLE IF EXISTS inspect_review",
+		"DROP TABLE IF EXISTS inspect_book",
+		"DROP TABLE IF EXISTS inspect_author",
+		"CREATE TABLE inspect_author (id " + auto + ", name varchar(40) NOT NULL UNIQUE, bio text NULL)",
+		"CREATE TABLE inspect_book (id " + auto + ", author_id integer NOT NULL, title varchar(100) NOT NULL, " +
+			"price decimal(8,2) NULL, published date NULL, pages integer NOT NULL DEFAULT 1, " +
+			"FOREIGN KEY (author_id) REFERENCES inspect_author (id) ON DELETE CASCADE)",
+		"CREATE INDEX inspect_book_title_published ON inspect_book (title, published)",
+		"CREATE TABLE inspect_review (id " + auto + ", author_id integer NOT NULL, editor_id integer NULL, " +
+			"FOREIGN KEY (author_id) REFERENCES inspect_author (id), FOREIGN KEY (editor_id) REFERENCES inspect_author (id))",
+		"CREATE TABLE inspect_log (message varchar(100) NOT NULL)",
+	}
+	for _, query := range queries {
+		_, err := dORM.Raw(query).Exec()
+		throwFailNow(t, err)
+	}
+
+	src, err := GenerateModels("default", "models", "inspect_author", "inspect_book", "inspect_review", "inspect_log")
+	throwFailNow(t, err)
+
+	file, err := parser.ParseFile(token.NewFileSet(), "models.go", src, 0)
+	throwFailNow(t, err)
+	throwFailNow(t, AssertIs(file.Name.Name, "models"))
+
+	// the types and orm tags of the fields of the models
+	fields := make(map[string][2]string)
+	for _, decl := range file.Decls {
+		gd, ok := decl.(*ast.GenDecl)
+		if !ok || gd.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range gd.Specs {
+			ts := spec.(*ast.TypeSpec)
+			for _, f := range ts.Type.(*ast.StructType).Fields.List {
+				var tag string
+				if f.Tag != nil {
+					tag = reflect.StructTag(strings.Trim(f.Tag.Value, "`")).Get("orm")
+				}
+				fields[ts.Name.Name+"."+f.Names[0].Name] = [2]string{string(src[f.Type.Pos()-1 : f.Type.End()-1]), tag}
+			}
+		}
+	}
+
+	throwFail(t, AssertIs(fields["InspectAuthor.Id"], [2]string{"int", "auto"}))
+	throwFail(t, AssertIs(fields["InspectAuthor.Name"], [2]string{"string", "size(40);unique"}))
+	throwFail(t, AssertIs(fields["InspectAuthor.Bio"], [2]string{"string", "type(text);null"}))
+	throwFail(t, AssertIs(fields["InspectAuthor.InspectBooks"], [2]string{"[]*InspectBook", "reverse(many)"}))
+	throwFail(t, AssertIs(fields["InspectBook.Id"], [2]string{"int", "auto"}))
+	throwFail(t, AssertIs(fields["InspectBook.Title"], [2]string{"string", "size(100)"}))
+	throwFail(t, AssertIs(fields["InspectBook.Price"], [2]string{"float64", "digits(8);decimals(2);null"}))
+	throwFail(t, AssertIs(fields["InspectBook.Published"], [2]string{"time.Time", "type(date);null"}))
+	throwFail(t, AssertIs(fields["InspectBook.Pages"], [2]string{"int", "default(1)"}))
+	// mysql adds an index of the foreign key
+	author := fields["InspectBook.Author"]
+	throwFail(t, AssertIs(author[0], "*InspectAuthor"))
+	throwFail(t, AssertIs(strings.TrimSuffix(author[1], ";index"), "rel(fk)"))
+
+	throwFail(t, AssertIs(bytes.Contains(src, []byte(`return "inspect_book"`)), true))
+	throwFail(t, AssertIs(bytes.Contains(src, []byte(`{"Title", "Published"},`)), true))
+	// a reverse field for each relation from inspect_review
+	throwFail(t, AssertIs(fields["InspectAuthor.AuthorInspectReviews"], [2]string{"[]*InspectReview", "reverse(many)"}))
+	throwFail(t, AssertIs(fields["InspectAuthor.EditorInspectReviews"], [2]string{"[]*InspectReview", "reverse(many)"}))
+	// the model without a primary key is generated but not registered
+	throwFail(t, AssertIs(fields["InspectLog.Message"], [2]string{"string", "size(100)"}))
+	throwFail(t, AssertIs(bytes.Contains(src, []byte(`orm.RegisterModel(new(InspectAuthor), new(InspectBook), new(InspectReview))`)), true))
+
+	_, err = GenerateModels("default", "models", "inspect_unknown")
+	throwFail(t, AssertIs(err != nil, true))
+
+	for _, query := range queries[:4] {
+		_, err := dORM.Raw(query).Exec()
+		throwFailNow(t, err)
+	}
+}
+
+func TestReverseRelField(t *testing.T) {
+	mi, other := new(modelInfo), new(modelInfo)
+	a, b := &fieldInfo{relModelInfo: mi}, &fieldInfo{relModelInfo: mi}
+	fields := []*fieldInfo{{relModelInfo: other}, a, b}
+
+	// the reverse fields are paired in order with the relations, an extra reverse field has none
+	throwFailNow(t, AssertIs(reverseRelField(fields, mi) == a, true))
+	a.reverseFieldInfo = new(fieldInfo)
+	throwFailNow(t, AssertIs(reverseRelField(fields, mi) == b, true))
+	b.reverseFieldInfo = new(fieldInfo)
+	throwFailNow(t, AssertIs(reverseRelField(fields, mi) == nil, true))
+	throwFailNow(t, AssertIs(reverseRelField(fields, new(modelInfo)) == nil, true))
+}
+
 func TestQueryM2M(t *testing.T) {
 	post := Post{ID: 4}
 	m2m := dORM.QueryM2M(&post, "Tags")
@@ -2066,6 +2661,185 @@ func TestTransaction(t *testing.T) {
 
 }
 
+type testSQLStateError string
+
+func (e testSQLStateError) Error() string    { return string(e) }
+func (e testSQLStateError) SQLState() string { return string(e) }
+
+type testMySQLError struct {
+	Number  uint16
+	Message string
+}
+
+func (e *testMySQLError) Error() string { return e.Message }
+
+// an error wrapped as by github.com/pkg/errors
+type testCauseError struct {
+	cause error
+}
+
+func (e *testCauseError) Error() string { return "wrapped: " + e.cause.Error() }
+func (e *testCauseError) Cause() error  { return e.cause }
+
+func TestDoTx(t *testing.T) {
+	o := NewOrm()
+	count := func(name string) int64 {
+		num, err := o.QueryTable("tag").Filter("name", name).Count()
+		throwFailNow(t, err)
+		return num
+	}
+
+	// commit
+	err := o.DoTx(func(tx Ormer) error {
+		_, err := tx.Insert(&Tag{Name: "dotx_commit"})
+		return err
+	})
+	throwFailNow(t, err)
+	throwFailNow(t, AssertIs(count("dotx_commit"), 1))
+
+	// rollback on error
+	errTask := errors.New("task failed")
+	err = o.DoTx(func(tx Ormer) error {
+		_, err := tx.Insert(&Tag{Name: "dotx_rollback"})
+		throwFailNow(t, err)
+		return errTask
+	})
+	throwFailNow(t, AssertIs(err, errTask))
+	throwFailNow(t, AssertIs(count("dotx_rollback"), 0))
+
+	// rollback on panic
+	func() {
+		defer func() {
+			throwFailNow(t, AssertIs(recover(), "boom"))
+		}()
+		_ = o.DoTx(func(tx Ormer) error {
+			_, err := tx.Insert(&Tag{Name: "dotx_panic"})
+			throwFailNow(t, err)
+			panic("boom")
+		})
+	}()
+	throwFailNow(t, AssertIs(count("dotx_panic"), 0))
+
+	// a failed nested call only rolls back its savepoint
+	err = o.DoTxWithCtx(context.Background(), nil, func(tx Ormer) error {
+		if _, err := tx.Insert(&Tag{Name: "dotx_outer"}); err != nil {
+			return err
+		}
+		err := tx.DoTx(func(tx Ormer) error {
+			_, err := tx.Insert(&Tag{Name: "dotx_inner"})
+			throwFailNow(t, err)
+			return errTask
+		})
+		throwFailNow(t, AssertIs(err, errTask))
+		return tx.DoTx(func(tx Ormer) error {
+			_, err := tx.Insert(&Tag{Name: "dotx_inner_ok"})
+			return err
+		})
+	})
+	throwFailNow(t, err)
+	throwFailNow(t, AssertIs(count("dotx_outer"), 1))
+	throwFailNow(t, AssertIs(count("dotx_inner"), 0))
+	throwFailNow(t, AssertIs(count("dotx_inner_ok"), 1))
+
+	// serialization failures and deadlocks are retried
+	calls := 0
+	err = o.DoTx(func(tx Ormer) error {
+		calls++
+		if calls < 3 {
+			return testSQLStateError("40001")
+		}
+		return nil
+	})
+	throwFailNow(t, err)
+	throwFailNow(t, AssertIs(calls, 3))
+
+	calls = 0
+	err = o.DoTx(func(tx Ormer) error {
+		calls++
+		return &testMySQLError{Number: 1213, Message: "Deadlock found"}
+	})
+	throwFailNow(t, AssertIs(err != nil, true))
+	throwFailNow(t, AssertIs(calls, TxRetries+1))
+
+	// the wrapped driver errors are retried
+	calls = 0
+	err = o.DoTx(func(tx Ormer) error {
+		calls++
+		if calls == 1 {
+			return fmt.Errorf("insert tag: %w", testSQLStateError("40P01"))
+		}
+		if calls == 2 {
+			return &testCauseError{cause: &testMySQLError{Number: 1205, Message: "Lock wait timeout"}}
+		}
+		return nil
+	})
+	throwFailNow(t, err)
+	throwFailNow(t, AssertIs(calls, 3))
+
+	calls = 0
+	err = o.DoTx(func(tx Ormer) error {
+		calls++
+		return errTask
+	})
+	throwFailNow(t, AssertIs(err, errTask))
+	throwFailNow(t, AssertIs(calls, 1))
+
+	num, err := o.QueryTable("tag").Filter("name__startswith", "dotx_").Delete()
+	throwFailNow(t, err)
+	throwFailNow(t, AssertIs(num, 3))
+}
+
+func TestQueryInterceptor(t *testing.T) {
+	saved, savedLog := getQueryInterceptors(), DebugLog
+	defer func() {
+		queryInterceptors.Store(saved)
+		DebugLog = savedLog
+	}()
+	queryInterceptors.Store([]QueryInterceptor(nil))
+
+	var buf bytes.Buffer
+	DebugLog = NewLog(&buf)
+
+	var events []*QueryEvent
+	AddQueryInterceptor(func(e *QueryEvent) {
+		events = append(events, e)
+	}, QueryStatsInterceptor, SlowQueryInterceptor(0))
+
+	ctx := WithQueryStats(context.Background())
+	o := NewOrmWithContext(ctx)
+
+	num, err := o.QueryTable("user").Filter("UserName", "slene").Count()
+	throwFailNow(t, err)
+	throwFailNow(t, AssertIs(num, 1))
+	throwFailNow(t, AssertIs(len(events), 1))
+	throwFailNow(t, AssertIs(events[0].Alias, "default"))
+	throwFailNow(t, AssertIs(events[0].Operation, "db.QueryRow"))
+	throwFailNow(t, AssertIs(strings.Contains(events[0].SQL, "COUNT(*)"), true))
+	throwFailNow(t, AssertIs(events[0].Args[0], "slene"))
+	throwFailNow(t, AssertIs(events[0].RowsAffected, -1))
+	throwFailNow(t, AssertIs(events[0].Ctx, ctx))
+
+	res, err := o.Raw("UPDATE tag SET name = ? WHERE name = ?", "golang", "golang").Exec()
+	throwFailNow(t, err)
+	num, err = res.RowsAffected()
+	throwFailNow(t, err)
+	throwFailNow(t, AssertIs(len(events), 2))
+	throwFailNow(t, AssertIs(events[1].Operation, "db.Exec"))
+	throwFailNow(t, AssertIs(events[1].RowsAffected, num))
+
+	_, err = o.Raw("SELECT * FROM unknown_table").Exec()
+	throwFailNow(t, AssertIs(err != nil, true))
+	throwFailNow(t, AssertIs(events[2].Err, err))
+
+	stats := QueryStatsFromContext(ctx)
+	throwFailNow(t, AssertIs(stats.Count(), 3))
+	throwFailNow(t, AssertIs(stats.Duration() > 0, true))
+	throwFailNow(t, AssertIs(strings.HasPrefix(stats.String(), "3 queries / "), true))
+	throwFailNow(t, AssertIs(QueryStatsFromContext(context.Background()) == nil, true))
+
+	throwFailNow(t, AssertIs(strings.Count(buf.String(), "[Slow/default]"), 3))
+}
+
 func TestTransactionIsolationLevel(t *testing.T) {
 	// this test worked when database support transaction isolation level
 	if IsSqlite {
@@ -2126,6 +2900,279 @@ func TestBeginTxWithContextCanceled(t *testing.T) {
 	throwFail(t, AssertIs(err, context.Canceled))
 }
 
+func TestReplica(t *testing.T) {
+	if IsSqlite && (strings.Contains(DBARGS.Source, "mode=memory") || strings.Contains(DBARGS.Source, ":memory:")) {
+		t.Skip("each connection of an in-memory sqlite source opens its own empty database")
+	}
+	err := RegisterDataBase("replica", DBARGS.Driver, DBARGS.Source)
+	throwFailNow(t, err)
+	throwFailNow(t, RegisterReplica("replica", DBARGS.Source))
+	throwFailNow(t, RegisterReplica("replica", DBARGS.Source))
+	throwFailNow(t, AssertIs(RegisterReplica("unknown", DBARGS.Source) != nil, true))
+
+	o := NewOrm().(*orm)
+	throwFailNow(t, o.Using("replica"))
+
+	querier := func(q dbQuerier) dbQuerier {
+		if l, ok := q.(*dbQueryLog); ok {
+			return l.db
+		}
+		return q
+	}
+	primary := querier(o.db)
+	replicas := o.alias.Replicas.replicas
+	throwFailNow(t, AssertIs(len(replicas), 2))
+
+	// round robin
+	first := querier(o.reader())
+	second := querier(o.reader())
+	throwFailNow(t, AssertIs(first != primary, true))
+	throwFailNow(t, AssertIs(second != primary, true))
+	throwFailNow(t, AssertIs(first != second, true))
+	throwFailNow(t, AssertIs(querier(o.reader()) == first, true))
+
+	// reads are served by the replicas
+	num, err := o.QueryTable("user").Count()
+	throwFailNow(t, err)
+	throwFailNow(t, AssertIs(num > 0, true))
+	user := User{ID: 2}
+	throwFailNow(t, o.Read(&user))
+	throwFailNow(t, AssertIs(user.UserName, "slene"))
+
+	// FOR UPDATE uses the primary
+	qs := o.QueryTable("user").ForUpdate().(*querySet)
+	throwFailNow(t, AssertIs(querier(qs.reader()) == primary, true))
+
+	// read your writes
+	o.ReadYourWrites(100 * time.Millisecond)
+	_, err = o.Update(&user, "UserName")
+	throwFailNow(t, err)
+	throwFailNow(t, AssertIs(querier(o.reader()) == primary, true))
+	time.Sleep(150 * time.Millisecond)
+	throwFailNow(t, AssertIs(querier(o.reader()) != primary, true))
+	o.ReadYourWrites(0)
+
+	// transactions use the primary
+	throwFailNow(t, o.Begin())
+	throwFailNow(t, AssertIs(querier(o.reader()) == querier(o.db), true))
+	throwFailNow(t, o.Rollback())
+
+	// unhealthy replicas are ejected
+	SetReplicaPolicy("replica", LeastConns)
+	replicas[0].db.DB.Close()
+	o.alias.Replicas.check()
+	throwFailNow(t, AssertIs(replicas[0].isHealthy(), false))
+	for i := 0; i < 3; i++ {
+		throwFailNow(t, AssertIs(querier(o.reader()) == replicas[1].db, true))
+	}
+	replicas[1].db.DB.Close()
+	o.alias.Replicas.check()
+	throwFailNow(t, AssertIs(querier(o.reader()) == primary, true))
+
+	// closing stops the health check
+	throwFailNow(t, CloseReplicas("replica"))
+	throwFailNow(t, AssertIs(len(o.alias.Replicas.replicas), 0))
+	throwFailNow(t, AssertIs(o.alias.Replicas.stop == nil, true))
+	throwFailNow(t, AssertIs(CloseReplicas("unknown") != nil, true))
+}
+
+func TestQueryCache(t *testing.T) {
+	bm, err := cache.NewCache(cache.MemoryProvider, `{"interval":60}`)
+	throwFailNow(t, err)
+	throwFailNow(t, AssertIs(SetQueryCache("unknown", bm, time.Minute) != nil, true))
+	throwFailNow(t, SetQueryCache("default", bm, time.Minute))
+	defer SetQueryCache("default", nil, 0)
+
+	Q := dDbBaser.TableQuote()
+	rename := fmt.Sprintf("UPDATE %suser%s SET %suser_name%s = ? WHERE %sid%s = ?", Q, Q, Q, Q, Q, Q)
+
+	// entries are read until the table is invalidated
+	user := User{ID: 2}
+	throwFailNow(t, dORM.ReadCached(&user))
+	throwFailNow(t, AssertIs(user.UserName, "slene"))
+	_, err = dORM.Raw(rename, "cached", 2).Exec()
+	throwFailNow(t, err)
+	user = User{ID: 2}
+	throwFailNow(t, dORM.ReadCached(&user))
+	throwFailNow(t, AssertIs(user.UserName, "slene"))
+	throwFailNow(t, InvalidateQueryCache("default", "user"))
+	throwFailNow(t, dORM.ReadCached(&user))
+	throwFailNow(t, AssertIs(user.UserName, "cached"))
+
+	// writes through the orm invalidate the entries
+	user.UserName = "slene"
+	_, err = dORM.Update(&user, "UserName")
+	throwFailNow(t, err)
+	throwFailNow(t, dORM.ReadCached(&user))
+	throwFailNow(t, AssertIs(user.UserName, "slene"))
+
+	qs := dORM.QueryTable("user").Filter("UserName", "slene").Cache(0)
+	num, err := qs.Count()
+	throwFailNow(t, err)
+	throwFailNow(t, AssertIs(num, 1))
+
+	var users []*User
+	num, err = qs.All(&users)
+	throwFailNow(t, err)
+	throwFailNow(t, AssertIs(num, 1))
+	throwFailNow(t, AssertIs(users[0].ID, 2))
+
+	var maps []Params
+	num, err = qs.Values(&maps, "ID", "UserName", "Created")
+	throwFailNow(t, err)
+	throwFailNow(t, AssertIs(num, 1))
+
+	// the related models point back to their parent and are read without the cache
+	users = nil
+	num, err = dORM.QueryTable("user").Filter("Profile__isnull", false).RelatedSel("profile").Cache(0).All(&users)
+	throwFailNow(t, err)
+	throwFailNow(t, AssertIs(num > 0, true))
+	throwFailNow(t, AssertIs(users[0].Profile.User, users[0]))
+
+	_, err = dORM.Raw(rename, "cached", 2).Exec()
+	throwFailNow(t, err)
+	num, err = qs.Count()
+	throwFailNow(t, err)
+	throwFailNow(t, AssertIs(num, 1))
+	users = nil
+	num, err = qs.All(&users)
+	throwFailNow(t, err)
+	throwFailNow(t, AssertIs(num, 1))
+	throwFailNow(t, AssertIs(users[0].UserName, "slene"))
+	maps = nil
+	num, err = qs.Values(&maps, "ID", "UserName", "Created")
+	throwFailNow(t, err)
+	throwFailNow(t, AssertIs(num, 1))
+	throwFailNow(t, AssertIs(maps[0]["UserName"], "slene"))
+	_, ok := maps[0]["Created"].(time.Time)
+	throwFailNow(t, AssertIs(ok, true))
+
+	// the queryset update invalidates the entries
+	num, err = dORM.QueryTable("user").Filter("ID", 2).Update(Params{"UserName": "slene"})
+	throwFailNow(t, err)
+	throwFailNow(t, AssertIs(num, 1))
+	_, err = dORM.Raw(rename, "cached", 2).Exec()
+	throwFailNow(t, err)
+	num, err = qs.Count()
+	throwFailNow(t, err)
+	throwFailNow(t, AssertIs(num, 0))
+
+	// transactions invalidate the entries when they commit
+	user = User{ID: 2}
+	throwFailNow(t, dORM.ReadCached(&user))
+	throwFailNow(t, AssertIs(user.UserName, "cached"))
+	err = dORM.DoTx(func(tx Ormer) error {
+		user.UserName = "slene"
+		_, err := tx.Update(&user, "UserName")
+		return err
+	})
+	throwFailNow(t, err)
+	user = User{ID: 2}
+	throwFailNow(t, dORM.ReadCached(&user))
+	throwFailNow(t, AssertIs(user.UserName, "slene"))
+}
+
+func TestTenancy(t *testing.T) {
+	acme := NewOrmWithContext(WithTenant(context.Background(), "acme"))
+	globex := NewOrmWithContext(WithTenant(context.Background(), "globex"))
+
+	// the tenant scoped models need a tenant
+	func() {
+		defer func() {
+			throwFailNow(t, AssertIs(recover(), ErrNoTenant))
+		}()
+		dORM.QueryTable("invoice").Count()
+	}()
+
+	// inserts set the tenant and queries are filtered by the tenant
+	invoice := Invoice{Number: "A-1"}
+	_, err := acme.Insert(&invoice)
+	throwFailNow(t, err)
+	throwFailNow(t, AssertIs(invoice.Tenant, "acme"))
+	other := Invoice{Number: "G-1", Tenant: "acme"}
+	_, err = globex.Insert(&other)
+	throwFailNow(t, err)
+	throwFailNow(t, AssertIs(other.Tenant, "globex"))
+
+	num, err := acme.QueryTable("invoice").Count()
+	throwFailNow(t, err)
+	throwFailNow(t, AssertIs(num, 1))
+	var invoices []*Invoice
+	num, err = globex.QueryTable("invoice").SetCond(NewCondition().Or("Number", "A-1").Or("Number", "G-1")).All(&invoices)
+	throwFailNow(t, err)
+	throwFailNow(t, AssertIs(num, 1))
+	throwFailNow(t, AssertIs(invoices[0].Number, "G-1"))
+
+	read := Invoice{ID: invoice.ID}
+	throwFailNow(t, AssertIs(globex.Read(&read), ErrNoRows))
+	throwFailNow(t, acme.Read(&read))
+	throwFailNow(t, AssertIs(read.Number, "A-1"))
+
+	invoice.Number = "A-2"
+	num, err = globex.Update(&invoice)
+	throwFailNow(t, err)
+	throwFailNow(t, AssertIs(num, 0))
+	num, err = globex.QueryTable("invoice").Filter("ID", invoice.ID).Update(Params{"Number": "A-2"})
+	throwFailNow(t, err)
+	throwFailNow(t, AssertIs(num, 0))
+	num, err = globex.Delete(&Invoice{ID: invoice.ID})
+	throwFailNow(t, err)
+	throwFailNow(t, AssertIs(num, 0))
+	num, err = acme.Update(&invoice)
+	throwFailNow(t, err)
+	throwFailNow(t, AssertIs(num, 1))
+	throwFailNow(t, acme.Read(&read))
+	throwFailNow(t, AssertIs(read.Tenant, "acme"))
+	throwFailNow(t, AssertIs(read.Number, "A-2"))
+
+	// a conflict with the row of another tenant does not update it
+	if !IsSqlite {
+		num, err = globex.InsertOrUpdate(&Invoice{ID: invoice.ID, Number: "G-2"}, "id")
+		throwFailNow(t, err)
+		throwFailNow(t, AssertIs(num, 0))
+		throwFailNow(t, acme.Read(&read))
+		throwFailNow(t, AssertIs(read.Tenant, "acme"))
+		throwFailNow(t, AssertIs(read.Number, "A-2"))
+
+		_, err = acme.InsertOrUpdate(&Invoice{ID: invoice.ID, Number: "A-3"}, "id")
+		throwFailNow(t, err)
+		throwFailNow(t, acme.Read(&read))
+		throwFailNow(t, AssertIs(read.Tenant, "acme"))
+		throwFailNow(t, AssertIs(read.Number, "A-3"))
+	}
+
+	// tables prefixed by the tenant
+	throwFailNow(t, SetTenancy("default", TenantTablePrefix))
+	defer SetTenancy("default", NoTenancy)
+	throwFailNow(t, AssertIs(SetTenancy("unknown", TenantSchema) != nil, true))
+
+	Q := dDbBaser.TableQuote()
+	sqls, _ := getDbCreateSQL(getDbAlias("default"))
+	for _, query := range sqls {
+		if strings.Contains(query, Q+"article"+Q) {
+			_, err = dORM.Raw(strings.Replace(query, Q+"article"+Q, Q+"acme_article"+Q, 1)).Exec()
+			throwFailNow(t, err)
+		}
+	}
+	defer dORM.Raw(fmt.Sprintf("DROP TABLE %sacme_article%s", Q, Q)).Exec()
+
+	_, err = acme.Insert(&Article{Title: "acme"})
+	throwFailNow(t, err)
+	num, err = acme.QueryTable("article").Count()
+	throwFailNow(t, err)
+	throwFailNow(t, AssertIs(num, 1))
+	num, err = dORM.QueryTable("article").Filter("Title", "acme").Count()
+	throwFailNow(t, err)
+	throwFailNow(t, AssertIs(num, 0))
+
+	func() {
+		defer func() {
+			throwFailNow(t, AssertIs(recover() != nil, true))
+		}()
+		NewOrmWithContext(WithTenant(context.Background(), "a;b")).QueryTable("article")
+	}()
+}
+
 func TestReadOrCreate(t *testing.T) {
 	u := &User{
 		UserName: "Kyle",
@@ -2224,6 +3271,30 @@ func TestInLineOneToOne(t *testing.T) {
 	throwFail(t, AssertIs(rinline.Email, email))
 }
 
+func TestQueryCacheCascade(t *testing.T) {
+	bm, err := cache.NewCache(cache.MemoryProvider, `{"interval":60}`)
+	throwFailNow(t, err)
+	throwFailNow(t, SetQueryCache("default", bm, time.Minute))
+	defer SetQueryCache("default", nil, 0)
+
+	// the deletions cascaded to the related tables invalidate their entries
+	inline := &InLine{Name: "cached", Email: "cached@example.com"}
+	_, err = dORM.Insert(inline)
+	throwFailNow(t, err)
+	_, err = dORM.Insert(&InLineOneToOne{Note: "cached", InLine: inline})
+	throwFailNow(t, err)
+	related := dORM.QueryTable(new(InLineOneToOne)).Filter("Note", "cached").Cache(0)
+	num, err := related.Count()
+	throwFailNow(t, err)
+	throwFailNow(t, AssertIs(num, 1))
+	num, err = dORM.Delete(inline)
+	throwFailNow(t, err)
+	throwFailNow(t, AssertIs(num, 1))
+	num, err = related.Count()
+	throwFailNow(t, err)
+	throwFailNow(t, AssertIs(num, 0))
+}
+
 func TestIntegerPk(t *testing.T) {
 	its := []IntegerPk{
 		{ID: math.MinInt64, Value: "-"},
@@ -2488,3 +3559,52 @@ func TestInsertOrUpdate(t *testing.T) {
 		throwFailNow(t, AssertIs((((user2.Status+1)-1)*3)/3, test.Status))
 	}
 }
+
+func TestQueryBuilder(t *testing.T) {
+	qb, err := NewQueryBuilder("postgres")
+	throwFailNow(t, err)
+	qb.Select(qb.Quote("T.id"), qb.Quote("name")).From(qb.Quote("user")+" T").
+		Where("age > ?", 18).And(qb.ILike("name"), "%slene%").Limit(10)
+	throwFail(t, AssertIs(qb.String(), `SELECT "T"."id", "name" FROM "user" T WHERE age > $1 AND name ILIKE $2 LIMIT 10`))
+	throwFail(t, AssertIs(len(qb.Args()), 2))
+	_, ok := qb.(*PostgresQueryBuilder)
+	throwFail(t, AssertIs(ok, true))
+
+	qb, _ = NewQueryBuilder("postgres")
+	qb.InsertInto("tag", "name").Values("?").Bind("golang").OnConflict("name").DoNothing().Returning("id")
+	throwFail(t, AssertIs(qb.String(), `INSERT INTO tag ( name ) VALUES ( $1 ) ON CONFLICT ( name ) DO NOTHING RETURNING id`))
+
+	qb, _ = NewQueryBuilder("sqlite")
+	qb.InsertInto("tag", "name").Values("?").Bind("golang").OnConflict("name").DoUpdate("name = excluded.name")
+	throwFail(t, AssertIs(qb.String(), `INSERT INTO tag ( name ) VALUES ( ? ) ON CONFLICT ( name ) DO UPDATE SET name = excluded.name`))
+
+	qb, _ = NewQueryBuilder("mysql")
+	qb.InsertInto("tag", "name").Values("?").Bind("golang").OnConflict().DoUpdate("name = VALUES(name)")
+	throwFail(t, AssertIs(qb.String(), "INSERT INTO tag ( name ) VALUES ( ? ) ON DUPLICATE KEY UPDATE name = VALUES(name)"))
+	throwFail(t, AssertIs(qb.Quote("user"), "`user`"))
+
+	// the clauses the dialect lacks are errors of the chain
+	qb, _ = NewQueryBuilder("mysql")
+	qb.InsertInto("tag", "name").Values("?").Bind("golang").OnConflict().DoNothing().Returning("id")
+	query, args, err := qb.Build()
+	throwFail(t, AssertIs(strings.HasPrefix(err.Error(), "DO NOTHING is not supported by mysql"), true))
+	throwFail(t, AssertIs(query, ""))
+	throwFail(t, AssertIs(len(args), 0))
+	throwFail(t, AssertIs(qb.String(), ""))
+	qb, _ = NewQueryBuilder("sqlite3")
+	_, _, err = qb.Select("id").From("tag").ForUpdate().Build()
+	throwFail(t, AssertIs(err != nil, true))
+	qb, _ = NewQueryBuilder("postgres")
+	query, args, err = qb.Select("id").From("tag").Where("name = ?", "golang").ForUpdate().Build()
+	throwFail(t, err)
+	throwFail(t, AssertIs(query, "SELECT id FROM tag WHERE name = $1 FOR UPDATE"))
+	throwFail(t, AssertIs(len(args), 1))
+
+	qb, err = NewQueryBuilder(DBARGS.Driver)
+	throwFailNow(t, err)
+	qb.Select("COUNT(*)").From(qb.Quote("user")).Where(qb.Quote("user_name")+" = ?", "slene")
+	var num int
+	err = dORM.Raw(qb.String(), qb.Args()...).QueryRow(&num)
+	throwFailNow(t, err)
+	throwFail(t, AssertIs(num, 1))
+}
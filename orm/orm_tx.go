@@ -0,0 +1,172 @@
+// Copyright 2019 asana Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package orm
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+var (
+	// TxRetries is how many times DoTx retries a transaction
+	// failed by a serialization failure or a deadlock.
+	TxRetries = 3
+	// TxRetryInterval is the wait before the first retry, it grows with every retry.
+	TxRetryInterval = 10 * time.Millisecond
+)
+
+// sql states of postgres serialization failure and deadlock
+var retryableSQLStates = map[string]bool{
+	"40001": true,
+	"40P01": true,
+}
+
+// error numbers of mysql deadlock and lock wait timeout
+var retryableMySQLErrors = map[uint64]bool{
+	1213: true,
+	1205: true,
+}
+
+// check the error aborts the transaction by a serialization failure or a deadlock.
+// the errors wrapped by fmt.Errorf("%w") or pkg/errors are unwrapped to the driver error.
+func isRetryableTxError(err error) bool {
+	// a bound on the chain, a Cause may return its own error
+	for i := 0; err != nil && i < 100; i++ {
+		if isRetryableDriverError(err) {
+			return true
+		}
+		switch e := err.(type) {
+		case interface{ Unwrap() error }:
+			err = e.Unwrap()
+		case interface{ Cause() error }:
+			err = e.Cause()
+		default:
+			return false
+		}
+	}
+	return false
+}
+
+// check the driver error is a serialization failure or a deadlock.
+// driver errors are inspected by their fields so that no driver is imported.
+func isRetryableDriverError(err error) bool {
+	if e, ok := err.(interface{ SQLState() string }); ok {
+		return retryableSQLStates[e.SQLState()]
+	}
+	ind := reflect.Indirect(reflect.ValueOf(err))
+	if ind.Kind() != reflect.Struct {
+		return false
+	}
+	// postgres *pq.Error
+	if f := ind.FieldByName("Code"); f.IsValid() && f.Kind() == reflect.String {
+		return retryableSQLStates[f.String()]
+	}
+	// mysql *mysql.MySQLError
+	if f := ind.FieldByName("Number"); f.IsValid() && f.Kind() == reflect.Uint16 {
+		return retryableMySQLErrors[f.Uint()]
+	}
+	return false
+}
+
+// run task in a transaction
+func (o *orm) DoTx(task func(tx Ormer) error) error {
+	return o.DoTxWithCtx(context.Background(), nil, task)
+}
+
+// run task in a transaction begun with ctx and opts.
+// it runs in a savepoint when the ormer is already in a transaction.
+func (o *orm) DoTxWithCtx(ctx context.Context, opts *sql.TxOptions, task func(tx Ormer) error) error {
+	if o.isTx {
+		return o.doSavepoint(task)
+	}
+
+	wait := TxRetryInterval
+	for retries := 0; ; retries++ {
+		err := o.doTx(ctx, opts, task)
+		if err == nil {
+			o.wrote()
+			return nil
+		}
+		if retries >= TxRetries || !isRetryableTxError(err) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+		wait *= 2
+	}
+}
+
+// run task in a new transaction on a copy of the ormer,
+// so the ormer can still be used outside the transaction.
+func (o *orm) doTx(ctx context.Context, opts *sql.TxOptions, task func(tx Ormer) error) (err error) {
+	db := o.db
+	if d, ok := db.(*dbQueryLog); ok {
+		db = newDbQueryLog(d.ctx, d.alias, d.db)
+	}
+	tx := &orm{alias: o.alias, db: db, ctx: o.ctx}
+
+	if err = tx.BeginTx(ctx, opts); err != nil {
+		return err
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			_ = tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	if err = task(tx); err != nil {
+		if rerr := tx.Rollback(); rerr != nil {
+			DebugLog.Println("<Ormer.DoTx> rollback error:", rerr.Error())
+		}
+		return err
+	}
+	return tx.Commit()
+}
+
+// run task in a savepoint of the current transaction,
+// a failed task only rolls back to the savepoint.
+func (o *orm) doSavepoint(task func(tx Ormer) error) (err error) {
+	o.savepoints++
+	defer func() { o.savepoints-- }()
+	name := fmt.Sprintf("asana_sp_%d", o.savepoints)
+
+	if _, err = o.db.Exec("SAVEPOINT " + name); err != nil {
+		return err
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			_, _ = o.db.Exec("ROLLBACK TO SAVEPOINT " + name)
+			panic(p)
+		}
+	}()
+
+	if err = task(o); err != nil {
+		if _, rerr := o.db.Exec("ROLLBACK TO SAVEPOINT " + name); rerr != nil {
+			DebugLog.Println("<Ormer.DoTx> rollback to savepoint error:", rerr.Error())
+		}
+		return err
+	}
+	_, err = o.db.Exec("RELEASE SAVEPOINT " + name)
+	return err
+}
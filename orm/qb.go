@@ -14,9 +14,26 @@
 
 package orm
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// CommaSpace is the separation
+const CommaSpace = ", "
 
 // QueryBuilder is the Query builder interface
+// conditions use ? as placeholder for every dialect, the bound args are returned by Args.
+// for example:
+//
+//	qb, _ := orm.NewQueryBuilder("postgres")
+//	qb.Select("id", "name").From("user").Where("age > ?", 18).And(qb.ILike("name"), "%slene%")
+//	qb.String() // SELECT id, name FROM user WHERE age > $1 AND name ILIKE $2
+//	o.Raw(qb.String(), qb.Args()...)
+//
+// a clause the dialect does not support, such as FOR UPDATE on sqlite, is an error returned by Build.
 type QueryBuilder interface {
 	Select(fields ...string) QueryBuilder
 	ForUpdate() QueryBuilder
@@ -24,10 +41,10 @@ type QueryBuilder interface {
 	InnerJoin(table string) QueryBuilder
 	LeftJoin(table string) QueryBuilder
 	RightJoin(table string) QueryBuilder
-	On(cond string) QueryBuilder
-	Where(cond string) QueryBuilder
-	And(cond string) QueryBuilder
-	Or(cond string) QueryBuilder
+	On(cond string, args ...interface{}) QueryBuilder
+	Where(cond string, args ...interface{}) QueryBuilder
+	And(cond string, args ...interface{}) QueryBuilder
+	Or(cond string, args ...interface{}) QueryBuilder
 	In(vals ...string) QueryBuilder
 	OrderBy(fields ...string) QueryBuilder
 	Asc() QueryBuilder
@@ -35,28 +52,319 @@ type QueryBuilder interface {
 	Limit(limit int) QueryBuilder
 	Offset(offset int) QueryBuilder
 	GroupBy(fields ...string) QueryBuilder
-	Having(cond string) QueryBuilder
+	Having(cond string, args ...interface{}) QueryBuilder
 	Update(tables ...string) QueryBuilder
 	Set(kv ...string) QueryBuilder
 	Delete(tables ...string) QueryBuilder
 	InsertInto(table string, fields ...string) QueryBuilder
 	Values(vals ...string) QueryBuilder
+	// add RETURNING fields, not supported by mysql
+	Returning(fields ...string) QueryBuilder
+	// add the upsert conflict target, mysql ignores the fields and uses ON DUPLICATE KEY
+	OnConflict(fields ...string) QueryBuilder
+	// set the update clause of an upsert
+	DoUpdate(kv ...string) QueryBuilder
+	// ignore conflicting rows of an upsert, not supported by mysql
+	DoNothing() QueryBuilder
+	// bind args for the ? placeholders written in the previous tokens
+	// for example:
+	//	qb.InsertInto("user", "name", "age").Values("?", "?").Bind("slene", 28)
+	Bind(args ...interface{}) QueryBuilder
+	// return the args bound so far, in placeholder order
+	Args() []interface{}
+	// quote the identifier for the dialect, "user.name" is quoted as two parts
+	Quote(identifier string) string
+	// return a case insensitive LIKE condition on field with one placeholder
+	ILike(field string) string
 	Subquery(sub string, alias string) string
+	// return the query, it is empty when the chain has an error
 	String() string
+	// return the query, its args and the first error of the chain
+	Build() (string, []interface{}, error)
 }
 
 // NewQueryBuilder return the QueryBuilder
 func NewQueryBuilder(driver string) (qb QueryBuilder, err error) {
-	if driver == "mysql" {
-		qb = new(MySQLQueryBuilder)
-	} else if driver == "tidb" {
-		qb = new(TiDBQueryBuilder)
-	} else if driver == "postgres" {
-		err = errors.New("postgres query builder is not supported yet")
-	} else if driver == "sqlite" {
-		err = errors.New("sqlite query builder is not supported yet")
-	} else {
+	switch driver {
+	case "mysql":
+		qb = newMySQLQueryBuilder()
+	case "tidb":
+		qb = newTiDBQueryBuilder()
+	case "postgres":
+		qb = newPostgresQueryBuilder()
+	case "sqlite", "sqlite3":
+		qb = newSQLiteQueryBuilder()
+	default:
 		err = errors.New("unknown driver for query builder")
 	}
 	return
 }
+
+// queryBuilder is the implementation shared by all dialects.
+// the zero value builds mysql queries.
+type queryBuilder struct {
+	Tokens []string
+	args   []interface{}
+	driver DriverType
+	ins    QueryBuilder
+	// the first error of the chain
+	err error
+}
+
+var _ QueryBuilder = new(queryBuilder)
+
+// return the outer dialect builder, so chains keep their concrete type
+func (qb *queryBuilder) self() QueryBuilder {
+	if qb.ins != nil {
+		return qb.ins
+	}
+	return qb
+}
+
+func (qb *queryBuilder) base() dbBaser {
+	if b, ok := dbBasers[qb.driver]; ok {
+		return b
+	}
+	return dbBasers[DRMySQL]
+}
+
+// add tokens and the args for their placeholders
+func (qb *queryBuilder) add(args []interface{}, tokens ...string) QueryBuilder {
+	qb.Tokens = append(qb.Tokens, tokens...)
+	qb.args = append(qb.args, args...)
+	return qb.self()
+}
+
+// record the first error of the chain, the clause is not added
+func (qb *queryBuilder) fail(err error) QueryBuilder {
+	if qb.err == nil {
+		qb.err = err
+	}
+	return qb.self()
+}
+
+// Select will join the fields
+func (qb *queryBuilder) Select(fields ...string) QueryBuilder {
+	return qb.add(nil, "SELECT", strings.Join(fields, CommaSpace))
+}
+
+// ForUpdate add the FOR UPDATE clause
+func (qb *queryBuilder) ForUpdate() QueryBuilder {
+	if qb.driver == DRSqlite {
+		return qb.fail(fmt.Errorf("FOR UPDATE is not supported by sqlite3, %s", ErrNotImplement.Error()))
+	}
+	return qb.add(nil, "FOR UPDATE")
+}
+
+// From join the tables
+func (qb *queryBuilder) From(tables ...string) QueryBuilder {
+	return qb.add(nil, "FROM", strings.Join(tables, CommaSpace))
+}
+
+// InnerJoin INNER JOIN the table
+func (qb *queryBuilder) InnerJoin(table string) QueryBuilder {
+	return qb.add(nil, "INNER JOIN", table)
+}
+
+// LeftJoin LEFT JOIN the table
+func (qb *queryBuilder) LeftJoin(table string) QueryBuilder {
+	return qb.add(nil, "LEFT JOIN", table)
+}
+
+// RightJoin RIGHT JOIN the table
+func (qb *queryBuilder) RightJoin(table string) QueryBuilder {
+	return qb.add(nil, "RIGHT JOIN", table)
+}
+
+// On join with on cond
+func (qb *queryBuilder) On(cond string, args ...interface{}) QueryBuilder {
+	return qb.add(args, "ON", cond)
+}
+
+// Where join the Where cond
+func (qb *queryBuilder) Where(cond string, args ...interface{}) QueryBuilder {
+	return qb.add(args, "WHERE", cond)
+}
+
+// And join the and cond
+func (qb *queryBuilder) And(cond string, args ...interface{}) QueryBuilder {
+	return qb.add(args, "AND", cond)
+}
+
+// Or join the or cond
+func (qb *queryBuilder) Or(cond string, args ...interface{}) QueryBuilder {
+	return qb.add(args, "OR", cond)
+}
+
+// In join the IN (vals)
+func (qb *queryBuilder) In(vals ...string) QueryBuilder {
+	return qb.add(nil, "IN", "(", strings.Join(vals, CommaSpace), ")")
+}
+
+// OrderBy join the Order by fields
+func (qb *queryBuilder) OrderBy(fields ...string) QueryBuilder {
+	return qb.add(nil, "ORDER BY", strings.Join(fields, CommaSpace))
+}
+
+// Asc join the asc
+func (qb *queryBuilder) Asc() QueryBuilder {
+	return qb.add(nil, "ASC")
+}
+
+// Desc join the desc
+func (qb *queryBuilder) Desc() QueryBuilder {
+	return qb.add(nil, "DESC")
+}
+
+// Limit join the limit num
+func (qb *queryBuilder) Limit(limit int) QueryBuilder {
+	return qb.add(nil, "LIMIT", strconv.Itoa(limit))
+}
+
+// Offset join the offset num
+func (qb *queryBuilder) Offset(offset int) QueryBuilder {
+	return qb.add(nil, "OFFSET", strconv.Itoa(offset))
+}
+
+// GroupBy join the Group by fields
+func (qb *queryBuilder) GroupBy(fields ...string) QueryBuilder {
+	return qb.add(nil, "GROUP BY", strings.Join(fields, CommaSpace))
+}
+
+// Having join the Having cond
+func (qb *queryBuilder) Having(cond string, args ...interface{}) QueryBuilder {
+	return qb.add(args, "HAVING", cond)
+}
+
+// Update join the update table
+func (qb *queryBuilder) Update(tables ...string) QueryBuilder {
+	return qb.add(nil, "UPDATE", strings.Join(tables, CommaSpace))
+}
+
+// Set join the set kv
+func (qb *queryBuilder) Set(kv ...string) QueryBuilder {
+	return qb.add(nil, "SET", strings.Join(kv, CommaSpace))
+}
+
+// Delete join the Delete tables
+func (qb *queryBuilder) Delete(tables ...string) QueryBuilder {
+	qb.Tokens = append(qb.Tokens, "DELETE")
+	if len(tables) != 0 {
+		qb.Tokens = append(qb.Tokens, strings.Join(tables, CommaSpace))
+	}
+	return qb.self()
+}
+
+// InsertInto join the insert SQL
+func (qb *queryBuilder) InsertInto(table string, fields ...string) QueryBuilder {
+	qb.Tokens = append(qb.Tokens, "INSERT INTO", table)
+	if len(fields) != 0 {
+		fieldsStr := strings.Join(fields, CommaSpace)
+		qb.Tokens = append(qb.Tokens, "(", fieldsStr, ")")
+	}
+	return qb.self()
+}
+
+// Values join the Values(vals)
+func (qb *queryBuilder) Values(vals ...string) QueryBuilder {
+	return qb.add(nil, "VALUES", "(", strings.Join(vals, CommaSpace), ")")
+}
+
+// Returning join the RETURNING fields
+func (qb *queryBuilder) Returning(fields ...string) QueryBuilder {
+	switch qb.driver {
+	case DRPostgres, DRSqlite:
+	default:
+		return qb.fail(fmt.Errorf("RETURNING is not supported by mysql, %s", ErrNotImplement.Error()))
+	}
+	return qb.add(nil, "RETURNING", strings.Join(fields, CommaSpace))
+}
+
+// OnConflict join the conflict target of an upsert
+func (qb *queryBuilder) OnConflict(fields ...string) QueryBuilder {
+	switch qb.driver {
+	case DRPostgres, DRSqlite:
+		if len(fields) == 0 {
+			return qb.add(nil, "ON CONFLICT")
+		}
+		return qb.add(nil, "ON CONFLICT", "(", strings.Join(fields, CommaSpace), ")")
+	}
+	return qb.add(nil, "ON DUPLICATE KEY")
+}
+
+// DoUpdate join the update kv of an upsert
+func (qb *queryBuilder) DoUpdate(kv ...string) QueryBuilder {
+	switch qb.driver {
+	case DRPostgres, DRSqlite:
+		return qb.add(nil, "DO UPDATE SET", strings.Join(kv, CommaSpace))
+	}
+	return qb.add(nil, "UPDATE", strings.Join(kv, CommaSpace))
+}
+
+// DoNothing ignore the conflicting rows of an upsert
+func (qb *queryBuilder) DoNothing() QueryBuilder {
+	switch qb.driver {
+	case DRPostgres, DRSqlite:
+	default:
+		return qb.fail(fmt.Errorf("DO NOTHING is not supported by mysql, %s", ErrNotImplement.Error()))
+	}
+	return qb.add(nil, "DO NOTHING")
+}
+
+// Bind add args for the placeholders of the previous tokens
+func (qb *queryBuilder) Bind(args ...interface{}) QueryBuilder {
+	return qb.add(args)
+}
+
+// Args return the bound args
+func (qb *queryBuilder) Args() []interface{} {
+	return qb.args
+}
+
+// Quote quote the identifier, every dot separated part is quoted
+func (qb *queryBuilder) Quote(identifier string) string {
+	Q := qb.base().TableQuote()
+	parts := strings.Split(identifier, ".")
+	for i, p := range parts {
+		if p != "*" {
+			parts[i] = Q + p + Q
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+// ILike return the case insensitive LIKE cond of the field
+func (qb *queryBuilder) ILike(field string) string {
+	switch qb.driver {
+	case DRPostgres:
+		return field + " ILIKE ?"
+	case DRSqlite:
+		// LIKE of sqlite is case insensitive for ASCII
+		return field + " LIKE ?"
+	}
+	return fmt.Sprintf("LOWER(%s) LIKE LOWER(?)", field)
+}
+
+// Subquery join the sub as alias
+func (qb *queryBuilder) Subquery(sub string, alias string) string {
+	return fmt.Sprintf("(%s) AS %s", sub, alias)
+}
+
+// String join all Tokens, placeholders are converted for the dialect.
+// it is empty when the chain has an error, use Build to get it.
+func (qb *queryBuilder) String() string {
+	if qb.err != nil {
+		return ""
+	}
+	query := strings.Join(qb.Tokens, " ")
+	qb.base().ReplaceMarks(&query)
+	return query
+}
+
+// Build return the query, its args and the first error of the chain
+func (qb *queryBuilder) Build() (string, []interface{}, error) {
+	if qb.err != nil {
+		return "", nil, qb.err
+	}
+	return qb.String(), qb.args, nil
+}
@@ -0,0 +1,30 @@
+// Copyright 2019 asana Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package orm
+
+// SQLiteQueryBuilder is the SQL build
+type SQLiteQueryBuilder struct {
+	queryBuilder
+}
+
+var _ QueryBuilder = new(SQLiteQueryBuilder)
+
+// create new sqlite query builder
+func newSQLiteQueryBuilder() *SQLiteQueryBuilder {
+	qb := new(SQLiteQueryBuilder)
+	qb.driver = DRSqlite
+	qb.ins = qb
+	return qb
+}
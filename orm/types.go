@@ -49,6 +49,11 @@ type Ormer interface {
 	// Like Read(), but with "FOR UPDATE" clause, useful in transaction.
 	// Some databases are not support this feature.
 	ReadForUpdate(md interface{}, cols ...string) error
+	// Like Read(), but read through the query cache of the alias set by SetQueryCache.
+	// the cached model is invalidated by the writes of its table through the orm.
+	//	u = &User{Id: user.Id}
+	//	err = Ormer.ReadCached(u)
+	ReadCached(md interface{}, cols ...string) error
 	// Try to read a row from the database, or insert one if it doesn't exist
 	ReadOrCreate(md interface{}, col1 string, cols ...string) (bool, int64, error)
 	// insert model data to database
@@ -61,6 +66,8 @@ type Ormer interface {
 	// if colu type is integer : can use(+-*/), string : convert(colu,"value")
 	// postgres: InsertOrUpdate(model,"conflictColumnName") or InsertOrUpdate(model,"conflictColumnName","colu=colu+value")
 	// if colu type is integer : can use(+-*/), string : colu || "value"
+	// with a `orm:"version"` field, the conflicting row is only updated when it has the version of md,
+	// else ErrStaleObject is returned.
 	InsertOrUpdate(md interface{}, colConflitAndArgs ...string) (int64, error)
 	// insert some models to database
 	InsertMulti(bulk int, mds interface{}) (int64, error)
@@ -73,6 +80,8 @@ type Ormer interface {
 	//	user.Extra.Name = "asana"
 	//	user.Extra.data = "orm"
 	//	num, err = Ormer.Update(&user, "Langs", "Extra")
+	// with a `orm:"version"` field, the row is only updated when it has the version of md and the version
+	// is increased, else ErrStaleObject is returned because the row was changed or deleted by others.
 	Update(md interface{}, cols ...string) (int64, error)
 	// delete model in database
 	Delete(md interface{}, cols ...string) (int64, error)
@@ -122,11 +131,34 @@ type Ormer interface {
 	Commit() error
 	// rollback transaction
 	Rollback() error
+	// run task in a transaction, commit when task returns nil, rollback when it returns an error or panics.
+	// the transaction is retried on serialization failures and deadlocks, up to TxRetries times.
+	// in a transaction, task runs in a SAVEPOINT and a failure only rolls back to the savepoint.
+	// for example:
+	//	err := o.DoTx(func(tx Ormer) error {
+	//		if _, err := tx.Insert(&order); err != nil {
+	//			return err
+	//		}
+	//		return tx.DoTx(func(tx Ormer) error {
+	//			_, err := tx.Update(&stock)
+	//			return err
+	//		})
+	//	})
+	DoTx(task func(tx Ormer) error) error
+	// like DoTx, but begin the transaction with ctx and the optional TxOptions
+	DoTxWithCtx(ctx context.Context, opts *sql.TxOptions, task func(tx Ormer) error) error
 	// return a raw query seter for raw sql string.
 	// for example:
 	//	 ormer.Raw("UPDATE `user` SET `user_name` = ? WHERE `user_name` = ?", "slene", "testing").Exec()
 	//	// update user testing's name to slene
 	Raw(query string, args ...interface{}) RawSeter
+	// read from the primary for the window after a write, when the alias has replicas.
+	// reads in transactions and FOR UPDATE always use the primary.
+	// for example:
+	//	o.ReadYourWrites(2 * time.Second)
+	//	o.Insert(&user)
+	//	o.Read(&user) // read from the primary
+	ReadYourWrites(window time.Duration)
 	Driver() Driver
 	DBStats() *sql.DBStats
 }
@@ -202,20 +234,60 @@ type QuerySeter interface {
 	//	qs.RelatedSel("profile").One(&user)
 	//	user.Profile.Age = 32
 	RelatedSel(params ...interface{}) QuerySeter
+	// set relations to load after All or One, one IN query for each relation instead of one for each row.
+	// nested relations are separated by __, and *PrefetchRelation filters and orders the related rows.
+	// for example:
+	//	qs.Prefetch("Posts", "Posts__Tags").All(&users)
+	//	qs.Prefetch(orm.NewPrefetch("Posts", o.QueryTable("post").OrderBy("-Id"))).All(&users)
+	//	users[0].Posts[0].Tags[0].Name = "golang"
+	Prefetch(params ...interface{}) QuerySeter
 	// Set Distinct
 	// for example:
 	//  o.QueryTable("policy").Filter("Groups__Group__Users__User", user).
 	//    Distinct().
 	//    All(&permissions)
 	Distinct() QuerySeter
+	// set the cursor of the page read by Page, an empty cursor is the first page.
+	// the cursor is one of the PageCursors returned by Page with the same orders.
+	After(cursor string) QuerySeter
+	// read a page of keyset pagination to the slice container and return the cursors of the next and previous pages.
+	// the rows are read after the sort key values of the cursor instead of an offset, so the pages keep stable
+	// when rows are added. the orders must be not null fields of the model, the pk is added as the last order.
+	// for example:
+	//	cursors, err := qs.After(cursor).OrderBy("-Created", "-Id").Limit(20).Page(&posts)
+	//	next := cursors.Next // the cursor of the next page, empty on the last page
+	Page(container interface{}, cols ...string) (*PageCursors, error)
 	// set FOR UPDATE to query.
 	// for example:
 	//  o.QueryTable("user").Filter("uid", uid).ForUpdate().All(&users)
 	ForUpdate() QuerySeter
+	// read the results of All, One, Count, Exist, Values, ValuesList and ValuesFlat through the query cache
+	// of the alias set by SetQueryCache, ttl is the timeout of the entries, 0 uses the timeout of the alias.
+	// the entries are invalidated by the writes of the tables of the query through the orm,
+	// the query cache is not used in transactions, with ForUpdate and with RelatedSel.
+	// for example:
+	//	num, err = qs.Filter("Status", 1).Cache(time.Minute).Count()
+	Cache(ttl time.Duration) QuerySeter
 	// return QuerySeter execution result number
 	// for example:
 	//	num, err = qs.Filter("profile__age__gt", 28).Count()
 	Count() (int64, error)
+	// query the aggregations of the rows, results are keyed by the aggregation names
+	// and typed by the aggregations, see Sum, Avg, Min, Max, Count and CountDistinct.
+	// for example:
+	//	res, err := qs.Filter("User__UserName", "slene").Aggregate(orm.Count("Id"), orm.Max("Created").As("last"))
+	//	res["Id__count"] == int64(2)
+	Aggregate(aggs ...*Aggregation) (Params, error)
+	// add an aggregation named name to the Values, ValuesList and ValuesFlat of every row,
+	// the name can be used in OrderBy and Having.
+	// for example:
+	//	qs.Annotate("posts", orm.Count("Posts")).GroupBy("Id").Having("posts__gte", 2).OrderBy("-posts").
+	//		Values(&maps, "Id", "UserName", "posts")
+	Annotate(name string, agg *Aggregation) QuerySeter
+	// add HAVING condition on the annotations.
+	// for example:
+	//	qs.Annotate("total", orm.Sum("Orders__Amount")).GroupBy("Id").Having("total__gt", 100)
+	Having(expr string, args ...interface{}) QuerySeter
 	// check result empty or not after QuerySeter executed
 	// the same as QuerySeter.Count > 0
 	Exist() bool
@@ -227,6 +299,9 @@ type QuerySeter interface {
 	//	num, err = qs.Filter("UserName", "slene").Update(Params{
 	//		"user_name": "slene2"
 	//	}) // user slene's  name will change to slene2
+	// a `orm:"version"` field is increased unless it is in values, ErrStaleObject is returned
+	// when the rows are filtered by the version and no row is updated.
+	//	num, err = qs.Filter("Id", 1).Filter("Version", 3).Update(Params{"Title": "new"})
 	Update(values Params) (int64, error)
 	// delete from table
 	//for example:
@@ -253,6 +328,24 @@ type QuerySeter interface {
 	//	var user User
 	//	qs.One(&user) //user.UserName == "slene"
 	One(container interface{}, cols ...string) error
+	// query the rows as a cursor, rows are scanned one at a time so big tables are read in constant memory.
+	// the rows are not limited by DefaultRowsLimit. Close the rows when they are not read to the end,
+	// some drivers can not run other queries of a transaction while its rows are open.
+	// for example:
+	//	rows, err := qs.Rows()
+	//	defer rows.Close()
+	//	for rows.Next() {
+	//		var user User
+	//		err = rows.Scan(&user) // or var m orm.Params; rows.Scan(&m)
+	//	}
+	Rows(cols ...string) (Rows, error)
+	// call fn with every row scanned by Rows, fn is func(*Model) error or func(orm.Params) error.
+	// the iteration stops at the first error returned by fn and returns it.
+	// for example:
+	//	err := qs.Iterate(func(user *User) error {
+	//		return send(user.Email)
+	//	})
+	Iterate(fn interface{}, cols ...string) error
 	// query all data and map to []map[string]interface.
 	// expres means condition expression.
 	// it converts data to []map[column]value.
@@ -446,13 +539,16 @@ type dbBaser interface {
 	Update(dbQuerier, *modelInfo, reflect.Value, *time.Location, []string) (int64, error)
 	Delete(dbQuerier, *modelInfo, reflect.Value, *time.Location, []string) (int64, error)
 	ReadBatch(dbQuerier, *querySet, *modelInfo, *Condition, interface{}, *time.Location, []string) (int64, error)
+	ReadRows(dbQuerier, *querySet, *modelInfo, *Condition, *time.Location, []string) (Rows, error)
 	SupportUpdateJoin() bool
 	UpdateBatch(dbQuerier, *querySet, *modelInfo, *Condition, Params, *time.Location) (int64, error)
 	DeleteBatch(dbQuerier, *querySet, *modelInfo, *Condition, *time.Location) (int64, error)
 	Count(dbQuerier, *querySet, *modelInfo, *Condition, *time.Location) (int64, error)
+	Aggregate(dbQuerier, *querySet, *modelInfo, *Condition, []*Aggregation, *time.Location) (Params, error)
 	OperatorSQL(string) string
 	GenerateOperatorSQL(*modelInfo, *fieldInfo, string, []interface{}, *time.Location) (string, []interface{})
 	GenerateOperatorLeftCol(*fieldInfo, string, *string)
+	GenerateJSONSQL(string, []string, string, []interface{}, *time.Location) (string, []interface{})
 	PrepareInsert(dbQuerier, *modelInfo) (stmtQuerier, string, error)
 	ReadValues(dbQuerier, *querySet, *modelInfo, *Condition, []string, interface{}, *time.Location) (int64, error)
 	RowsTo(dbQuerier, *querySet, *modelInfo, *Condition, interface{}, string, string, *time.Location) (int64, error)
@@ -468,6 +564,12 @@ type dbBaser interface {
 	ShowTablesQuery() string
 	ShowColumnsQuery(string) string
 	IndexExists(dbQuerier, string, string) bool
+	GetTableSchema(dbQuerier, string) (*tableSchema, error)
 	collectFieldValue(*modelInfo, *fieldInfo, reflect.Value, bool, *time.Location) (interface{}, error)
+	quoteTable(*modelInfo) string
+	readSQL(*modelInfo, reflect.Value, *time.Location, []string, bool) (string, []interface{}, error)
+	readBatchSQL(*querySet, *modelInfo, *Condition, *time.Location, []string, int64) (string, []interface{}, *dbTables, []string, int, error)
+	countSQL(*querySet, *modelInfo, *Condition, *time.Location) (string, []interface{}, *dbTables)
+	readValuesSQL(*querySet, *modelInfo, *Condition, []string, *time.Location) (string, []interface{}, *dbTables, []*fieldInfo, []*Aggregation)
 	setval(dbQuerier, *modelInfo, []string) error
 }
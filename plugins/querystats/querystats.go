@@ -0,0 +1,58 @@
+// Copyright 2019 asana Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package querystats adds the number and the time of the orm statements of a request to the access log.
+// The statements must run with the context of the request.
+// Usage
+//	import (
+//		"github.com/goasana/asana"
+//		"github.com/goasana/asana/orm"
+//		"github.com/goasana/asana/plugins/querystats"
+//	)
+//
+//	func main() {
+//		asana.InsertFilter("*", asana.BeforeRouter, querystats.Handler())
+//		asana.Run()
+//	}
+//
+//	func (c *UserController) Get() {
+//		o := orm.NewOrmWithContext(c.Ctx.HTTPRequest.Context())
+//		...
+//	}
+//
+// the access log then ends with "23 queries / 41ms".
+package querystats
+
+import (
+	"sync"
+
+	"github.com/goasana/asana"
+	"github.com/goasana/asana/context"
+	"github.com/goasana/asana/orm"
+)
+
+var register sync.Once
+
+// Handler returns a filter collecting the orm.QueryStats of each request for the access log,
+// it registers orm.QueryStatsInterceptor once.
+func Handler() asana.FilterFunc {
+	register.Do(func() {
+		orm.AddQueryInterceptor(orm.QueryStatsInterceptor)
+	})
+	return func(ctx *context.Context) {
+		c := orm.WithQueryStats(ctx.HTTPRequest.Context())
+		ctx.HTTPRequest = ctx.HTTPRequest.WithContext(c)
+		ctx.Request().Data()[asana.AccessLogQueriesKey] = orm.QueryStatsFromContext(c)
+	}
+}
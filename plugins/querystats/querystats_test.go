@@ -0,0 +1,47 @@
+// Copyright 2019 asana Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package querystats
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/goasana/asana"
+	"github.com/goasana/asana/context"
+	"github.com/goasana/asana/orm"
+)
+
+func TestHandler(t *testing.T) {
+	handler := asana.NewControllerRegister()
+	_ = handler.InsertFilter("*", asana.BeforeRouter, Handler())
+
+	var logged string
+	handler.Any("/foo", func(ctx *context.Context) {
+		// a statement run with the context of the request
+		orm.QueryStatsInterceptor(&orm.QueryEvent{Ctx: ctx.HTTPRequest.Context(), Duration: 5 * time.Millisecond})
+		if s, ok := ctx.Request().Data()[asana.AccessLogQueriesKey].(fmt.Stringer); ok {
+			logged = s.String()
+		}
+	})
+	r, _ := http.NewRequest("GET", "/foo", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	if logged != "1 queries / 5ms" {
+		t.Errorf("the access log queries should be 1 queries / 5ms, found %q", logged)
+	}
+}
@@ -971,6 +971,10 @@ func toURL(params map[string]string) string {
 	return strings.TrimRight(u, "&")
 }
 
+// AccessLogQueriesKey is the key of the request data holding the database statements of the request,
+// a fmt.Stringer written to the access log. it is set by the querystats plugin.
+const AccessLogQueriesKey = "asana.access_log.queries"
+
 // LogAccess logging info HTTP Access
 func LogAccess(ctx *context.Context, startTime *time.Time, statusCode int) {
 	//Skip logging if AccessLogs config is false
@@ -1004,5 +1008,8 @@ func LogAccess(ctx *context.Context, startTime *time.Time, statusCode int) {
 		RemoteUser:     r.Header.Get("Remote-User"),
 		BodyBytesSent:  0, //@todo this one is missing!
 	}
+	if queries, ok := ctx.Request().Data()[AccessLogQueriesKey].(fmt.Stringer); ok {
+		record.Queries = queries.String()
+	}
 	logs.AccessLog(record, BConfig.Log.AccessLogsFormat)
 }
@@ -24,3 +24,10 @@ func SetPaginator(context *context.Context, per int, nums int64) (paginator *Pag
 	context.Request().SetFlash("paginator", &paginator)
 	return
 }
+
+// SetCursorPaginator Instantiates a CursorPaginator and assigns it to context.Request.data("paginator").
+func SetCursorPaginator(context *context.Context, per int) (paginator *CursorPaginator) {
+	paginator = NewCursorPaginator(context.HTTPRequest, per)
+	context.Request().SetFlash("paginator", paginator)
+	return
+}
@@ -0,0 +1,139 @@
+// Copyright 2019 asana Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pagination
+
+import (
+	"net/http"
+	"net/url"
+)
+
+// CursorParam is the url query param of the cursor.
+var CursorParam = "cursor"
+
+// CursorPaginator within the state of a http request, for keyset pagination
+// where the pages are addressed by opaque cursors instead of page numbers.
+type CursorPaginator struct {
+	Request     *http.Request
+	PerPageNums int
+
+	next string
+	prev string
+}
+
+// CursorMeta is the pagination metadata of an API response.
+type CursorMeta struct {
+	PerPage    int    `json:"per_page"`
+	Cursor     string `json:"cursor,omitempty"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	PrevCursor string `json:"prev_cursor,omitempty"`
+	Next       string `json:"next,omitempty"`
+	Prev       string `json:"prev,omitempty"`
+}
+
+// Cursor Returns the cursor of the current page, empty for the first page.
+func (p *CursorPaginator) Cursor() string {
+	if p.Request.Form == nil {
+		_ = p.Request.ParseForm()
+	}
+	return p.Request.Form.Get(CursorParam)
+}
+
+// SetCursors Sets the cursors of the next and previous pages, empty if there is no such page.
+func (p *CursorPaginator) SetCursors(next, prev string) {
+	p.next = next
+	p.prev = prev
+}
+
+// NextCursor Returns the cursor of the next page.
+func (p *CursorPaginator) NextCursor() string {
+	return p.next
+}
+
+// PrevCursor Returns the cursor of the previous page.
+func (p *CursorPaginator) PrevCursor() string {
+	return p.prev
+}
+
+// PageLink Returns URL for a given cursor.
+func (p *CursorPaginator) PageLink(cursor string) string {
+	link, _ := url.ParseRequestURI(p.Request.URL.String())
+	values := link.Query()
+	if cursor == "" {
+		values.Del(CursorParam)
+	} else {
+		values.Set(CursorParam, cursor)
+	}
+	link.RawQuery = values.Encode()
+	return link.String()
+}
+
+// PageLinkPrev Returns URL to the previous page.
+func (p *CursorPaginator) PageLinkPrev() (link string) {
+	if p.HasPrev() {
+		link = p.PageLink(p.prev)
+	}
+	return
+}
+
+// PageLinkNext Returns URL to the next page.
+func (p *CursorPaginator) PageLinkNext() (link string) {
+	if p.HasNext() {
+		link = p.PageLink(p.next)
+	}
+	return
+}
+
+// PageLinkFirst Returns URL to the first page.
+func (p *CursorPaginator) PageLinkFirst() (link string) {
+	return p.PageLink("")
+}
+
+// HasPrev Returns true if the current page has a predecessor.
+func (p *CursorPaginator) HasPrev() bool {
+	return p.prev != ""
+}
+
+// HasNext Returns true if the current page has a successor.
+func (p *CursorPaginator) HasNext() bool {
+	return p.next != ""
+}
+
+// HasPages Returns true if there is more than one page.
+func (p *CursorPaginator) HasPages() bool {
+	return p.HasPrev() || p.HasNext()
+}
+
+// Meta Returns the pagination metadata for an API response.
+func (p *CursorPaginator) Meta() CursorMeta {
+	return CursorMeta{
+		PerPage:    p.PerPageNums,
+		Cursor:     p.Cursor(),
+		NextCursor: p.next,
+		PrevCursor: p.prev,
+		Next:       p.PageLinkNext(),
+		Prev:       p.PageLinkPrev(),
+	}
+}
+
+// NewCursorPaginator Instantiates a cursor paginator struct for the current http request.
+func NewCursorPaginator(req *http.Request, per int) *CursorPaginator {
+	p := CursorPaginator{}
+	p.Request = req
+	if per <= 0 {
+		per = 10
+	}
+	p.PerPageNums = per
+	return &p
+}
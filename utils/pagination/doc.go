@@ -50,6 +50,26 @@ In your view templates:
  </ul>
  {{end}}
 
+Cursor pagination
+
+For big tables and feeds use keyset pagination, the pages are addressed by
+the opaque cursors of orm QuerySeter.Page instead of offsets:
+
+ func (this *PostsController) ListPosts() {
+     paginator := pagination.SetCursorPaginator(this.Ctx, 20)
+
+     var posts []*models.Post
+     cursors, err := orm.NewOrm().QueryTable("post").OrderBy("-Created", "-Id").
+         After(paginator.Cursor()).Limit(paginator.PerPageNums).Page(&posts)
+     if err != nil {
+         ...
+     }
+     paginator.SetCursors(cursors.Next, cursors.Prev)
+
+     // in the view use .paginator.HasPrev, .paginator.PageLinkPrev, .paginator.HasNext and .paginator.PageLinkNext,
+     // in an API return paginator.Meta() with the posts
+ }
+
 See also
 
 http://asana.me/docs/mvc/view/page.md